@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// AccessConfig restricts the management surface to client IP ranges, so
+// an internet-facing redirect host can keep its UI and API private.
+// Redirects under the short prefix and the health endpoints stay public.
+type AccessConfig struct {
+	// UI lists the ranges allowed to reach anything under the UI prefix:
+	// the web UI, the API and the admin routes. Empty allows everyone.
+	UI []string `yaml:"ui"`
+	// Admin lists the ranges allowed to reach the admin panel and admin
+	// API, on top of UI. Empty allows everyone UI allows.
+	Admin []string `yaml:"admin"`
+}
+
+// accessRanges are the parsed ranges of an AccessConfig; nil means
+// unrestricted.
+type accessRanges struct {
+	ui    []netip.Prefix
+	admin []netip.Prefix
+}
+
+func parseAccess(c AccessConfig) (accessRanges, error) {
+	ui, err := parseRanges("UI access range", c.UI)
+	if err != nil {
+		return accessRanges{}, err
+	}
+	admin, err := parseRanges("admin access range", c.Admin)
+	if err != nil {
+		return accessRanges{}, err
+	}
+	return accessRanges{ui: ui, admin: admin}, nil
+}
+
+// underPath reports whether path is prefix or below it.
+func underPath(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// inRanges reports whether addr falls in one of ranges.
+func inRanges(ranges []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range ranges {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessAllowed reports whether the client of r may reach its path.
+func (s *Server) accessAllowed(r *http.Request) bool {
+	path := r.URL.Path
+	if !underPath(path, s.uiPrefix) {
+		return true
+	}
+	// Redirects stay public unless the UI prefix is the more specific of
+	// the two, as with an empty short prefix or a UI nested below it.
+	if underPath(path, s.prefix) && len(s.prefix) > len(s.uiPrefix) {
+		return true
+	}
+	var lists [][]netip.Prefix
+	if s.access.ui != nil {
+		lists = append(lists, s.access.ui)
+	}
+	if s.access.admin != nil && (underPath(path, s.uiPrefix+"/admin") || underPath(path, s.uiPrefix+"/api/admin")) {
+		lists = append(lists, s.access.admin)
+	}
+	if len(lists) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(s.clientIP(r))
+	if err != nil {
+		return false
+	}
+	for _, ranges := range lists {
+		if !inRanges(ranges, addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// accessMiddleware refuses requests to the UI and admin routes from
+// client IPs outside the configured ranges.
+func (s *Server) accessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.accessAllowed(r) {
+			requestLogger(r).Warn("access denied", "path", r.URL.Path, "ip", s.clientIP(r))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
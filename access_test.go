@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessRestrictions(t *testing.T) {
+	t.Setenv("UI_ALLOWED_IPS", "10.0.0.0/8, 192.0.2.1")
+	t.Setenv("ADMIN_ALLOWED_IPS", "10.0.1.0/24")
+	t.Setenv("ADMIN_TOKEN", "secret")
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/", createOptions{CustomID: "pub"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		remote string
+		want   int
+	}{
+		{"/s/pub", "198.51.100.7:1234", http.StatusFound},
+		{"/s/pub/preview", "198.51.100.7:1234", http.StatusOK},
+		{"/healthz", "198.51.100.7:1234", http.StatusOK},
+		{"/sui/", "198.51.100.7:1234", http.StatusForbidden},
+		{"/sui/api/version", "198.51.100.7:1234", http.StatusForbidden},
+		{"/sui/", "10.9.9.9:1234", http.StatusOK},
+		{"/sui/", "192.0.2.1:1234", http.StatusOK},
+		{"/sui/api/admin/bans", "10.9.9.9:1234", http.StatusForbidden},
+		{"/sui/admin", "10.9.9.9:1234", http.StatusForbidden},
+		{"/sui/api/admin/bans", "10.0.1.5:1234", http.StatusOK},
+		{"/sui/api/admin/bans", "[::ffff:10.0.1.5]:1234", http.StatusOK},
+		// The admin list alone doesn't grant access to the rest of the UI.
+		{"/sui/api/admin/bans", "192.0.2.1:1234", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("X-Admin-Token", "secret")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("GET %s from %s = %d, want %d", tt.path, tt.remote, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestAccessOverlappingPrefixes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.access, _ = parseAccess(AccessConfig{UI: []string{"10.0.0.0/8"}})
+
+	tests := []struct {
+		prefix, uiPrefix string
+		path             string
+		want             bool
+	}{
+		{"", "/sui", "/sui/", false},
+		{"", "/sui", "/sui/api/admin/bans", false},
+		{"", "/sui", "/pub", true},
+		{"/s", "/s/ui", "/s/ui/api/list", false},
+		{"/s", "/s/ui", "/s/pub", true},
+		{"/s", "", "/s/pub", true},
+		{"/s", "", "/api/list", false},
+	}
+	for _, tt := range tests {
+		srv.prefix, srv.uiPrefix = tt.prefix, tt.uiPrefix
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.RemoteAddr = "198.51.100.7:1234"
+		if got := srv.accessAllowed(req); got != tt.want {
+			t.Errorf("prefixes %q, %q: GET %s allowed = %v, want %v", tt.prefix, tt.uiPrefix, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseAccess(t *testing.T) {
+	if _, err := parseAccess(AccessConfig{UI: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("expected an error for an invalid UI range")
+	}
+	if _, err := parseAccess(AccessConfig{Admin: []string{"admin.example"}}); err == nil {
+		t.Error("expected an error for an invalid admin range")
+	}
+	access, err := parseAccess(AccessConfig{})
+	if err != nil || access.ui != nil || access.admin != nil {
+		t.Errorf("empty config = %+v, %v; want unrestricted", access, err)
+	}
+}
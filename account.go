@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// renderAccount renders the account page. backupCodes and newToken, when
+// set, are freshly generated secrets shown exactly once.
+func (s *Server) renderAccount(w http.ResponseWriter, r *http.Request, status int, errMsg string, backupCodes []string, newToken string) {
+	user := s.currentUser(r)
+	tokens, err := s.listAPIKeys(user.Username)
+	if err != nil {
+		http.Error(w, "Failed to get API tokens", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+
+	data := s.pageData(r)
+	data["Error"] = errMsg
+	data["BackupCodes"] = backupCodes
+	data["APITokens"] = tokens
+	data["NewToken"] = newToken
+	data["Scopes"] = apiScopes
+	data["TwoFactorEnabled"] = user.TOTPSecret != ""
+	data["BackupCodesLeft"] = len(user.BackupCodes)
+	if redirect := r.FormValue("redirect_uri"); validExtensionRedirect(redirect) {
+		data["ExtensionRedirect"] = redirect
+	}
+
+	if user.TOTPSecret == "" {
+		// Keep the secret from a failed enrollment attempt, so the user
+		// doesn't have to scan a new code.
+		secret := r.FormValue("secret")
+		if !validTOTPSecret(secret) {
+			if secret, err = newTOTPSecret(); err != nil {
+				http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+				return
+			}
+		}
+		qr, err := qrDataURL(totpURI(user.Username, secret))
+		if err != nil {
+			http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+			return
+		}
+		data["TOTPSecret"] = secret
+		data["TOTPQRCode"] = qr
+	}
+
+	w.WriteHeader(status)
+	if err := s.templates().ExecuteTemplate(w, "account.html", data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
+
+// requireUser rejects requests without a logged-in user.
+func (s *Server) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.currentUser(r) == nil {
+			http.Redirect(w, r, s.uiPrefix+"/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	s.renderAccount(w, r, http.StatusOK, "", nil, "")
+}
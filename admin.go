@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// isAdmin reports whether the request is made by an admin: either a user
+// with the admin role, or a client sending the configured admin token in
+// the X-Admin-Token header (token access is disabled when no token is set).
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.adminToken != "" {
+		token := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1 {
+			return true
+		}
+	}
+	return s.currentUser(r).IsAdmin()
+}
+
+// requireAdmin rejects requests that are not authenticated as admin.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// renderAdmin renders the admin panel. newKey, when set, is a freshly
+// created API key secret that is shown exactly once.
+func (s *Server) renderAdmin(w http.ResponseWriter, r *http.Request, status int, errMsg, newKey string) {
+	users, err := s.listUsers()
+	if err != nil {
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+
+	keys, err := s.listAPIKeys("")
+	if err != nil {
+		http.Error(w, "Failed to get API keys", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	staticKeys := s.staticAPIKeyNames()
+
+	teams, err := s.listTeams()
+	if err != nil {
+		http.Error(w, "Failed to get teams", http.StatusInternalServerError)
+		return
+	}
+
+	namespaces, err := s.listNamespaces()
+	if err != nil {
+		http.Error(w, "Failed to get namespaces", http.StatusInternalServerError)
+		return
+	}
+
+	flagged, err := s.getAllLinks(func(l *Link) bool { return l.Flagged != nil })
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(flagged, func(i, j int) bool { return flagged[i].Flagged.At.After(flagged[j].Flagged.At) })
+
+	reported, err := s.getAllLinks(func(l *Link) bool { return l.Reported != nil })
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(reported, func(i, j int) bool { return reported[i].Reported.LastAt.After(reported[j].Reported.LastAt) })
+
+	settings := s.getSettings()
+
+	data := s.pageData(r)
+	data["Users"] = users
+	data["AllTeams"] = teams
+	data["AllNamespaces"] = namespaces
+	data["APIKeys"] = keys
+	data["StaticKeys"] = staticKeys
+	data["FlaggedLinks"] = flagged
+	data["ReportedLinks"] = reported
+	data["SafeBrowsing"] = s.threats != nil
+	data["Settings"] = settings
+	data["LDAP"] = s.ldap != nil
+	data["ReservedWords"] = strings.Join(settings.ReservedWords, "\n")
+	data["BlockedDomains"] = strings.Join(settings.BlockedDomains, "\n")
+	data["AllowedDomains"] = strings.Join(settings.AllowedDomains, "\n")
+	data["QuotaOverrides"] = formatQuotaOverrides(settings.QuotaOverrides)
+	data["Error"] = errMsg
+	data["NewKey"] = newKey
+
+	w.WriteHeader(status)
+	if err := s.templates().ExecuteTemplate(w, "admin.html", data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
+
+func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	s.renderAdmin(w, r, http.StatusOK, "", "")
+}
+
+// selfAction reports whether an admin panel action targets the logged-in
+// admin's own account, which is refused so an admin can't lock themselves
+// (and possibly everyone) out.
+func (s *Server) selfAction(r *http.Request, username string) bool {
+	user := s.currentUser(r)
+	return user != nil && user.Username == username
+}
+
+func (s *Server) handleAdminSetRole(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	role := r.FormValue("role")
+	if role != roleAdmin && role != roleUser {
+		s.renderAdmin(w, r, http.StatusBadRequest, "Unknown role", "")
+		return
+	}
+	if s.selfAction(r, username) {
+		s.renderAdmin(w, r, http.StatusBadRequest, "You cannot change your own role", "")
+		return
+	}
+
+	err := s.updateUser(username, func(u *User) error {
+		u.Role = role
+		return nil
+	})
+	if err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if s.selfAction(r, username) {
+		s.renderAdmin(w, r, http.StatusBadRequest, "You cannot delete your own account", "")
+		return
+	}
+
+	if err := s.deleteUser(username); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminCreateKey(w http.ResponseWriter, r *http.Request) {
+	secret, _, err := s.createAPIKey(r.FormValue("name"), "", nil)
+	if err != nil {
+		s.renderAdmin(w, r, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	s.renderAdmin(w, r, http.StatusOK, "", secret)
+}
+
+func (s *Server) handleAdminRevokeKey(w http.ResponseWriter, r *http.Request) {
+	if err := s.revokeAPIKey(mux.Vars(r)["id"], ""); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	settings := s.getSettings()
+	settings.RegistrationOpen = r.FormValue("registration_open") == "on"
+	settings.AnonymousCreate = r.FormValue("anonymous_create") == "on"
+	settings.RequireDeleteReason = r.FormValue("require_delete_reason") == "on"
+	settings.ReservedWords = splitLines(r.FormValue("reserved_words"))
+	settings.BlockedDomains = splitLines(r.FormValue("blocked_domains"))
+	settings.AllowedDomains = splitLines(r.FormValue("allowed_domains"))
+	for _, list := range [][]string{settings.BlockedDomains, settings.AllowedDomains} {
+		if err := validateDomainPatterns(list); err != nil {
+			s.renderAdmin(w, r, http.StatusBadRequest, err.Error(), "")
+			return
+		}
+	}
+
+	perDay, err1 := parseQuotaLimit(r.FormValue("quota_links_per_day"))
+	total, err2 := parseQuotaLimit(r.FormValue("quota_total_links"))
+	if err1 != nil || err2 != nil {
+		s.renderAdmin(w, r, http.StatusBadRequest, "Quota limits must be non-negative numbers", "")
+		return
+	}
+	settings.Quota = Quota{LinksPerDay: perDay, TotalLinks: total}
+
+	overrides, err := parseQuotaOverrides(strings.Split(r.FormValue("quota_overrides"), "\n"))
+	if err != nil {
+		s.renderAdmin(w, r, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	settings.QuotaOverrides = overrides
+
+	if err := s.saveSettings(settings); err != nil {
+		s.renderAdmin(w, r, http.StatusInternalServerError, "Failed to save settings", "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
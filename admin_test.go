@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// loginAs creates a user and returns a session cookie for it.
+func loginAs(t testing.TB, srv *Server, username string) *http.Cookie {
+	t.Helper()
+	if _, err := srv.createUser(username, "password123"); err != nil {
+		t.Fatalf("createUser(%q) error: %v", username, err)
+	}
+	token, err := srv.createSession(username)
+	if err != nil {
+		t.Fatalf("createSession() error: %v", err)
+	}
+	return &http.Cookie{Name: sessionCookieName, Value: token}
+}
+
+func TestAdminUserBootstrap(t *testing.T) {
+	srv := newTestServer(t)
+
+	first, err := srv.createUser("user", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := srv.createUser("Root", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.IsAdmin() || !admin.IsAdmin() {
+		t.Errorf("roles = %q, %q; want user, admin", first.Role, admin.Role)
+	}
+
+	srv.adminUser = ""
+	if other, err := srv.createUser("other", "password123"); err != nil || other.IsAdmin() {
+		t.Errorf("without ADMIN_USER: %+v, %v; want a user", other, err)
+	}
+}
+
+func TestAdminPanelAccess(t *testing.T) {
+	srv := newTestServer(t)
+	adminCookie := loginAs(t, srv, "root")
+	userCookie := loginAs(t, srv, "mallory")
+
+	get := func(cookie *http.Cookie) int {
+		req := httptest.NewRequest("GET", srv.uiPrefix+"/admin", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := get(adminCookie); code != http.StatusOK {
+		t.Errorf("admin GET /admin status = %d, want 200", code)
+	}
+	if code := get(userCookie); code != http.StatusForbidden {
+		t.Errorf("user GET /admin status = %d, want 403", code)
+	}
+}
+
+func TestAdminSettingsAreEnforced(t *testing.T) {
+	srv := newTestServer(t)
+	adminCookie := loginAs(t, srv, "root")
+
+	form := url.Values{
+		"reserved_words":  {"Login\nsignup"},
+		"blocked_domains": {"evil.example"},
+	}
+	req := httptest.NewRequest("POST", srv.uiPrefix+"/admin/settings", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(adminCookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("save settings status = %d, body %s", rr.Code, rr.Body.String())
+	}
+
+	settings := srv.getSettings()
+	if settings.RegistrationOpen {
+		t.Error("unchecked registration box should close registration")
+	}
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "LOGIN"}); err == nil {
+		t.Error("expected reserved word to be rejected")
+	}
+	if _, err := srv.createShortLink("https://cdn.evil.example/x", createOptions{}); createErrorStatus(err) != http.StatusForbidden {
+		t.Errorf("blocked domain error = %v, want 403", err)
+	}
+
+	reloaded, err := loadSettings(srv.db, defaultConfig())
+	if err != nil || len(reloaded.ReservedWords) != 2 {
+		t.Errorf("settings were not persisted: %+v, %v", reloaded, err)
+	}
+}
+
+func TestAdminCannotDemoteSelf(t *testing.T) {
+	srv := newTestServer(t)
+	adminCookie := loginAs(t, srv, "root")
+
+	req := httptest.NewRequest("POST", srv.uiPrefix+"/admin/users/root/role", strings.NewReader("role=user"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(adminCookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("self demotion status = %d, want 400", rr.Code)
+	}
+}
+
+func TestDestinationDomainLists(t *testing.T) {
+	srv := newTestServer(t)
+	settings := srv.getSettings()
+	settings.AllowedDomains = []string{"corp.example", "*.cdn.example", "docs-*.io"}
+	settings.BlockedDomains = []string{"legacy.corp.example"}
+	if err := srv.saveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://corp.example/wiki", nil},
+		{"https://intranet.corp.example/", nil},
+		{"https://img.cdn.example/a.png", nil},
+		{"https://cdn.example/a.png", errDomainNotAllowed},
+		{"https://docs-v2.io/", nil},
+		{"https://docs.io/", errDomainNotAllowed},
+		{"https://legacy.corp.example/", errBlockedDomain},
+		{"https://example.com/", errDomainNotAllowed},
+		{"https://notcorp.example/", errDomainNotAllowed},
+	}
+	for _, tt := range tests {
+		if err := srv.checkBlockedDomain(tt.url); !errors.Is(err, tt.want) {
+			t.Errorf("checkBlockedDomain(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+
+	if _, err := srv.createShortLink("https://example.com", createOptions{}); createErrorStatus(err) != http.StatusForbidden {
+		t.Errorf("create outside the allowlist = %v, want 403", err)
+	}
+}
+
+func TestAdminSettingsRejectBadDomainPattern(t *testing.T) {
+	srv := newTestServer(t)
+	adminCookie := loginAs(t, srv, "root")
+
+	form := url.Values{"allowed_domains": {"[corp.example"}}
+	req := httptest.NewRequest("POST", srv.uiPrefix+"/admin/settings", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(adminCookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rr.Code)
+	}
+	if got := srv.getSettings().AllowedDomains; len(got) != 0 {
+		t.Errorf("allowed domains = %q, want none saved", got)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	apiKeysBucket   = "api_keys"
+	apiKeySecretPfx = "pks_"
+
+	// Scopes a key can be limited to. A key without scopes may do anything
+	// its owner can.
+	scopeCreate = "create"
+	scopeRead   = "read"
+	scopeDelete = "delete"
+
+	maxUserAPIKeys = 20
+
+	// apiKeyTouchInterval limits how often LastUsedAt is written, so busy
+	// integrations don't turn every request into a database write.
+	apiKeyTouchInterval = time.Minute
+)
+
+var apiScopes = []string{scopeCreate, scopeRead, scopeDelete}
+
+// APIKey is an API key stored in the database, complementing the static
+// keys from API_KEYS. Keys created in the admin panel identify a system by
+// Name; personal tokens created by users on their account page have an
+// Owner and act as that user, with Name being just a label. Only the
+// SHA-256 of the secret is stored; the secret itself is shown once at
+// creation.
+type APIKey struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	Owner      string    `json:"owner,omitempty"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Allows reports whether the key grants scope.
+func (k *APIKey) Allows(scope string) bool {
+	return scopeAllowed(k.Scopes, scope)
+}
+
+func scopeAllowed(scopes []string, scope string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScopes orders scopes and rejects unknown ones. Granting every
+// scope is stored as no restriction.
+func normalizeScopes(scopes []string) ([]string, error) {
+	granted := make(map[string]bool)
+	for _, scope := range scopes {
+		granted[scope] = true
+	}
+
+	var out []string
+	for _, known := range apiScopes {
+		if granted[known] {
+			out = append(out, known)
+			delete(granted, known)
+		}
+	}
+	for scope := range granted {
+		return nil, fmt.Errorf("unknown scope %q", scope)
+	}
+	if len(out) == len(apiScopes) {
+		return nil, nil
+	}
+	return out, nil
+}
+
+func hashAPIKey(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// createAPIKey mints a new key and returns its secret. owner is empty for
+// system keys created by admins, and the username for personal tokens.
+func (s *Server) createAPIKey(name, owner string, scopes []string) (string, *APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("key name is required")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := apiKeySecretPfx + base64.RawURLEncoding.EncodeToString(b)
+	hash := hashAPIKey(secret)
+
+	key := &APIKey{
+		ID:        hex.EncodeToString(hash[:8]),
+		Name:      name,
+		CreatedAt: time.Now(),
+		Owner:     owner,
+		Scopes:    scopes,
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(apiKeysBucket))
+		if owner != "" {
+			count := 0
+			b.ForEach(func(k, v []byte) error {
+				var existing APIKey
+				if json.Unmarshal(v, &existing) == nil && existing.Owner == owner {
+					count++
+				}
+				return nil
+			})
+			if count >= maxUserAPIKeys {
+				return fmt.Errorf("you can have at most %d API tokens", maxUserAPIKeys)
+			}
+		}
+		return b.Put(hash, data)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+// lookupAPIKey finds the stored key matching secret and records its use.
+// Personal tokens stop working when their owner is deleted.
+func (s *Server) lookupAPIKey(secret string) (*APIKey, bool) {
+	hash := hashAPIKey(secret)
+	var key *APIKey
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(apiKeysBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get(hash)
+		if data == nil {
+			return nil
+		}
+		k := &APIKey{}
+		if err := json.Unmarshal(data, k); err != nil {
+			return err
+		}
+		if k.Owner != "" && tx.Bucket([]byte(usersBucket)).Get([]byte(k.Owner)) == nil {
+			return nil
+		}
+		key = k
+		return nil
+	})
+	if key == nil {
+		return nil, false
+	}
+
+	if now := time.Now(); !s.readOnly && !s.maintenance().Enabled && now.Sub(key.LastUsedAt) > apiKeyTouchInterval {
+		key.LastUsedAt = now
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(apiKeysBucket))
+			if b.Get(hash) == nil {
+				return nil
+			}
+			data, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			return b.Put(hash, data)
+		})
+		if err != nil {
+			slog.Error("failed to record API key use", "key", key.ID, "err", err)
+		}
+	}
+	return key, true
+}
+
+// listAPIKeys returns stored keys: all of them for an empty owner,
+// otherwise the personal tokens of owner.
+func (s *Server) listAPIKeys(owner string) ([]APIKey, error) {
+	var keys []APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(apiKeysBucket)).ForEach(func(k, v []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
+			if owner == "" || key.Owner == owner {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// revokeAPIKey deletes the stored key with the given ID. With a non-empty
+// owner only that user's personal tokens can be revoked.
+func (s *Server) revokeAPIKey(id, owner string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteAPIKeys(tx, func(key *APIKey) bool {
+			return key.ID == id && (owner == "" || key.Owner == owner)
+		}, true)
+	})
+}
+
+// deleteAPIKeys removes every stored key matching match. With mustExist it
+// fails when nothing matched.
+func deleteAPIKeys(tx *bolt.Tx, match func(*APIKey) bool, mustExist bool) error {
+	b := tx.Bucket([]byte(apiKeysBucket))
+	var found [][]byte
+	b.ForEach(func(k, v []byte) error {
+		var key APIKey
+		if json.Unmarshal(v, &key) == nil && match(&key) {
+			found = append(found, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if len(found) == 0 && mustExist {
+		return fmt.Errorf("API key not found")
+	}
+	for _, k := range found {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiCredential is what the API key sent with a request resolves to.
+type apiCredential struct {
+	// System names a static or admin-created key.
+	System string
+	// User is the owner of a personal token.
+	User   string
+	Scopes []string
+}
+
+// requestCredential resolves the API key sent with the request, checking
+// the static API_KEYS first and then stored keys. The key may be given as
+// "Authorization: Bearer <key>" or in the X-API-Key header. It returns nil
+// when no key is sent and ok=false when an unknown key is sent.
+func (s *Server) requestCredential(r *http.Request) (cred *apiCredential, ok bool) {
+	secret := r.Header.Get("X-API-Key")
+	if secret == "" {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			secret = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+	}
+	if secret == "" {
+		return nil, true
+	}
+	if name, ok := s.staticAPIKey(secret); ok {
+		return &apiCredential{System: name}, true
+	}
+	key, ok := s.lookupAPIKey(secret)
+	if !ok {
+		return nil, false
+	}
+	if key.Owner != "" {
+		return &apiCredential{User: key.Owner, Scopes: key.Scopes}, true
+	}
+	return &apiCredential{System: key.Name, Scopes: key.Scopes}, true
+}
+
+// requireScope checks that the API key sent with the request, if any, is
+// valid and grants scope. Session-authenticated requests are not limited.
+// It writes an error response and returns false when the request is not
+// allowed.
+func (s *Server) requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	cred, ok := s.requestCredential(r)
+	if !ok {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return false
+	}
+	if cred != nil && !scopeAllowed(cred.Scopes, scope) {
+		http.Error(w, fmt.Sprintf("API key lacks the %q scope", scope), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleCreateUserAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+	scopes := r.Form["scope"]
+	if len(scopes) == 0 {
+		s.renderAccount(w, r, http.StatusBadRequest, "Select at least one scope", nil, "")
+		return
+	}
+	user := s.currentUser(r)
+	secret, _, err := s.createAPIKey(r.FormValue("name"), user.Username, scopes)
+	if err != nil {
+		s.renderAccount(w, r, http.StatusBadRequest, err.Error(), nil, "")
+		return
+	}
+	s.renderAccount(w, r, http.StatusOK, "", nil, secret)
+}
+
+func (s *Server) handleRevokeUserAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if err := s.revokeAPIKey(mux.Vars(r)["id"], user.Username); err != nil {
+		s.renderAccount(w, r, http.StatusNotFound, err.Error(), nil, "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/account", http.StatusSeeOther)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{[]string{"read"}, []string{"read"}, false},
+		{[]string{"delete", "read", "read"}, []string{"read", "delete"}, false},
+		{[]string{"create", "read", "delete"}, nil, false},
+		{[]string{"read", "admin"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeScopes(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeScopes(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeScopes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPersonalAPIToken(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "alice")
+	secret, key, err := srv.createAPIKey("script", "alice", []string{scopeCreate})
+	if err != nil {
+		t.Fatalf("createAPIKey() error: %v", err)
+	}
+
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, srv.uiPrefix+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := do("POST", "/api/create", `{"url": "https://example.com", "custom_id": "alice-api"}`); code != http.StatusOK {
+		t.Fatalf("create with token status = %d, want 200", code)
+	}
+	link, err := srv.getLink("alice-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Owner != "alice" {
+		t.Errorf("link owner = %q, want alice", link.Owner)
+	}
+
+	if code := do("GET", "/api/list", ""); code != http.StatusForbidden {
+		t.Errorf("list without read scope status = %d, want 403", code)
+	}
+	if code := do("DELETE", "/api/delete/alice-api", ""); code != http.StatusForbidden {
+		t.Errorf("delete without delete scope status = %d, want 403", code)
+	}
+
+	keys, err := srv.listAPIKeys("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt.IsZero() {
+		t.Errorf("alice's keys = %+v, want one with LastUsedAt set", keys)
+	}
+
+	if err := srv.revokeAPIKey(key.ID, "bob"); err == nil {
+		t.Error("revoking another user's token succeeded")
+	}
+	if err := srv.deleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := srv.listAPIKeys(""); len(keys) != 0 {
+		t.Errorf("keys after deleting the owner = %+v, want none", keys)
+	}
+	if code := do("POST", "/api/create", `{"url": "https://example.com"}`); code != http.StatusUnauthorized {
+		t.Errorf("create with deleted user's token status = %d, want 401", code)
+	}
+}
+
+func TestAccountTokenPages(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+
+	post := func(path, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", srv.uiPrefix+path, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("/account/tokens", "name=ci"); rr.Code != http.StatusBadRequest {
+		t.Errorf("create without scopes status = %d, want 400", rr.Code)
+	}
+	rr := post("/account/tokens", "name=ci&scope=read")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), apiKeySecretPfx) {
+		t.Fatalf("create token status = %d, want 200 with the secret shown", rr.Code)
+	}
+
+	keys, _ := srv.listAPIKeys("alice")
+	if len(keys) != 1 {
+		t.Fatalf("alice has %d tokens, want 1", len(keys))
+	}
+	if rr := post("/account/tokens/"+keys[0].ID+"/revoke", ""); rr.Code != http.StatusSeeOther {
+		t.Errorf("revoke status = %d, want 303", rr.Code)
+	}
+	if keys, _ := srv.listAPIKeys("alice"); len(keys) != 0 {
+		t.Errorf("tokens after revoke = %+v, want none", keys)
+	}
+}
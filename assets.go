@@ -0,0 +1,87 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// embeddedAssets holds the HTML templates and static files, so the binary
+// runs from any directory.
+//
+//go:embed templates/*.html static
+var embeddedAssets embed.FS
+
+// uiAssets returns the templates and static files, with files under dir
+// (in templates/ and static/ subdirectories) taking precedence over the
+// embedded ones. Only the files to customize need to exist there.
+func uiAssets(dir string) fs.FS {
+	if dir == "" {
+		return embeddedAssets
+	}
+	return overlayFS{upper: os.DirFS(dir), lower: embeddedAssets}
+}
+
+// parseTemplates loads the HTML templates from assets.
+func parseTemplates(assets fs.FS) (*template.Template, error) {
+	return template.ParseFS(assets, "templates/*.html")
+}
+
+// overlayFS serves files from upper when they exist there and from lower
+// otherwise. Directory listings are merged.
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil {
+		if info, statErr := f.Stat(); statErr == nil && !info.IsDir() {
+			return f, nil
+		}
+		f.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.lower.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	lower, lowerErr := fs.ReadDir(o.lower, name)
+	upper, upperErr := fs.ReadDir(o.upper, name)
+	if lowerErr != nil && upperErr != nil {
+		return nil, lowerErr
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	for _, e := range lower {
+		entries[e.Name()] = e
+	}
+	for _, e := range upper {
+		entries[e.Name()] = e
+	}
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		merged = append(merged, e)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+// handleStatic serves the static files under the UI prefix.
+func (s *Server) handleStatic(w http.ResponseWriter, r *http.Request) {
+	s.reloadMu.RLock()
+	assets := s.assets
+	s.reloadMu.RUnlock()
+
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.StripPrefix(s.uiPrefix+"/static/", http.FileServer(http.FS(static))).ServeHTTP(w, r)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplatesAreEmbedded(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tmpl, err := parseTemplates(uiAssets(""))
+	if err != nil {
+		t.Fatalf("parseTemplates() outside the repository error: %v", err)
+	}
+	if tmpl.Lookup("index.html") == nil {
+		t.Error("index.html is not embedded")
+	}
+}
+
+func TestStaticOnlyUnderUIPrefix(t *testing.T) {
+	srv := newTestServer(t)
+	// The tests run next to static/, which must not be served from disk.
+	for path, want := range map[string]int{srv.uiPrefix + "/static/app.js": http.StatusOK, "/static/app.js": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rr.Code, want)
+		}
+	}
+}
+
+func TestPagesLoadTheme(t *testing.T) {
+	for _, name := range []string{"static/theme.css", "static/theme.js"} {
+		if _, err := fs.Stat(embeddedAssets, name); err != nil {
+			t.Errorf("%s is not embedded: %v", name, err)
+		}
+	}
+	pages, err := fs.Glob(embeddedAssets, "templates/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		data, err := fs.ReadFile(embeddedAssets, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		html := string(data)
+		// The stylesheet follows the page's own styles so its rules win ties.
+		if !strings.Contains(html, "/static/theme.js") || strings.Index(html, "/static/theme.css") < strings.Index(html, "</style>") {
+			t.Errorf("%s does not load the theme after its styles", page)
+		}
+	}
+}
+
+func TestUIDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "templates"), 0755)
+	os.MkdirAll(filepath.Join(dir, "static"), 0755)
+	os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte(`custom home {{.UIPrefix}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "static", "logo.svg"), []byte(`<svg/>`), 0644)
+	t.Setenv("UI_DIR", dir)
+	srv := newTestServer(t)
+
+	get := func(path string) (int, string) {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		body, _ := io.ReadAll(rr.Body)
+		return rr.Code, string(body)
+	}
+
+	if _, body := get(srv.uiPrefix + "/"); body != "custom home "+srv.uiPrefix {
+		t.Errorf("home page = %q, want the overriding template", body)
+	}
+	if _, body := get(srv.uiPrefix + "/list"); !strings.Contains(body, "<table") && !strings.Contains(body, "no-links") {
+		t.Error("templates missing from the override directory should fall back to the embedded ones")
+	}
+	if code, body := get(srv.uiPrefix + "/static/logo.svg"); code != http.StatusOK || body != "<svg/>" {
+		t.Errorf("added static file = %d %q", code, body)
+	}
+	if code, body := get(srv.uiPrefix + "/static/app.js"); code != http.StatusOK || !strings.Contains(body, "custom_id") {
+		t.Errorf("embedded static file = %d", code)
+	}
+}
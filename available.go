@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// checkCustomID runs the checks of a custom ID that don't depend on the
+// links stored: its format, and reserved prefixes and words. system is
+// the API key name of the caller, as in createOptions.
+func (s *Server) checkCustomID(id, system string) error {
+	validate := validateCustomID
+	if _, _, ok := splitNamespace(id); ok {
+		validate = validateNamespacedID
+	}
+	if err := validate(id); err != nil {
+		return err
+	}
+	if err := s.checkReserved(id, system); err != nil {
+		return err
+	}
+	return s.checkReservedWord(id)
+}
+
+// checkCustomIDFree returns errCustomIDTaken when a link uses id, or a code
+// differing only in case while codes are case-insensitive.
+func (s *Server) checkCustomIDFree(tx *bolt.Tx, id string) error {
+	if tx.Bucket([]byte(bucketName)).Get([]byte(id)) != nil || (s.ids.caseInsensitive && foldedShort(tx, id) != "") {
+		return fmt.Errorf("%w: '%s' already exists", errCustomIDTaken, id)
+	}
+	return nil
+}
+
+// handleAvailable tells whether a link could be created with the custom
+// ID in the path, and if not why, so forms can check it as it is typed.
+// It answers the callers allowed to create links.
+func (s *Server) handleAvailable(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	if owner, _ := s.callerOwner(r); owner == "" && !s.getSettings().AnonymousCreate {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	id := mux.Vars(r)["short"]
+	system, _ := s.apiKeySystem(r)
+
+	err := s.checkCustomID(id, system)
+	if err == nil {
+		err = s.db.View(func(tx *bolt.Tx) error {
+			return s.checkCustomIDFree(tx, id)
+		})
+	}
+	resp := map[string]interface{}{"id": id, "available": err == nil}
+	if err != nil {
+		if createErrorField(err) != "custom_id" {
+			requestLogger(r).Error("failed to check custom ID", "id", id, "err", err)
+			http.Error(w, "Failed to check custom ID", http.StatusInternalServerError)
+			return
+		}
+		resp["reason"] = capitalize(err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAvailable(t *testing.T) {
+	t.Setenv("DISABLE_ANONYMOUS_CREATE", "true")
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "taken", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id            string
+		wantAvailable bool
+		wantReason    string
+	}{
+		{"free-name", true, ""},
+		{"taken", false, "already exists"},
+		{"ab", false, "at least 3 characters"},
+		{"admin", false, "reserved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/sui/api/available/"+tt.id, nil)
+			req.AddCookie(cookie)
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rr.Code)
+			}
+			var resp struct {
+				ID        string `json:"id"`
+				Available bool   `json:"available"`
+				Reason    string `json:"reason"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ID != tt.id || resp.Available != tt.wantAvailable || !strings.Contains(resp.Reason, tt.wantReason) {
+				t.Errorf("response = %+v, want available %v with a reason about %q", resp, tt.wantAvailable, tt.wantReason)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/sui/api/available/free-name", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous status = %d, want 401", rr.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// backupDB writes a consistent copy of the database at path to out and
+// returns its size. The copy is written next to out first and renamed into
+// place, so an interrupted backup never leaves a truncated file behind.
+func backupDB(path, out string) (int64, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database (is the server still running?): %w", err)
+	}
+	defer db.Close()
+
+	tmpPath := out + ".tmp"
+	var size int64
+	err = db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return tx.CopyFile(tmpPath, 0600)
+	})
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmpPath, out); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return size, nil
+}
+
+// runBackup implements the "backup" command.
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("output", "", "file to write the backup to (default: the database path with a timestamp appended)")
+	flags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = cfg.DBPath + "." + time.Now().UTC().Format("20060102T150405Z") + ".bak"
+	}
+
+	size, err := backupDB(cfg.DBPath, *output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s (%d bytes)\n", cfg.DBPath, *output, size)
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupDB(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	path := srv.db.Path()
+	srv.Close()
+
+	out := filepath.Join(t.TempDir(), "links.bak")
+	size, err := backupDB(path, out)
+	if err != nil {
+		t.Fatalf("backupDB() error: %v", err)
+	}
+	info, err := os.Stat(out)
+	if err != nil || info.Size() != size {
+		t.Fatalf("backup file = %v, %v; want %d bytes", info, err, size)
+	}
+	if _, err := os.Stat(out + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary backup file should be removed")
+	}
+
+	links, err := readLinksFromFile(out)
+	if err != nil || len(links) != 1 || links[0].Short != "kept" {
+		t.Errorf("links in backup = %v, %v", links, err)
+	}
+}
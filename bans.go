@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bansBucket maps a banned CIDR range to its Ban.
+const bansBucket = "bans"
+
+// Ban blocks link creation from an IP range.
+type Ban struct {
+	CIDR      string    `json:"cidr"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// parseBanRange parses a CIDR range, or a single address as a range of
+// one, in its canonical form.
+func parseBanRange(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP range %q", value)
+	}
+	return prefix.Masked(), nil
+}
+
+// loadBans reads the banned ranges into memory, where isBanned checks
+// them.
+func (s *Server) loadBans() error {
+	var ranges []netip.Prefix
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bansBucket)).ForEach(func(k, _ []byte) error {
+			prefix, err := netip.ParsePrefix(string(k))
+			if err != nil {
+				return err
+			}
+			ranges = append(ranges, prefix)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.bans.Store(&ranges)
+	return nil
+}
+
+// isBanned reports whether addr falls in a banned range.
+func (s *Server) isBanned(addr netip.Addr) bool {
+	ranges := s.bans.Load()
+	if ranges == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range *ranges {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// listBans returns every ban, sorted by range.
+func (s *Server) listBans() ([]Ban, error) {
+	bans := []Ban{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bansBucket)).ForEach(func(_, v []byte) error {
+			var ban Ban
+			if err := json.Unmarshal(v, &ban); err != nil {
+				return err
+			}
+			bans = append(bans, ban)
+			return nil
+		})
+	})
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CIDR < bans[j].CIDR })
+	return bans, err
+}
+
+// addBan stores a ban for the range in value, replacing any earlier ban
+// of the same range.
+func (s *Server) addBan(value, reason string) (*Ban, error) {
+	prefix, err := parseBanRange(value)
+	if err != nil {
+		return nil, err
+	}
+	ban := &Ban{CIDR: prefix.String(), Reason: strings.TrimSpace(reason), CreatedAt: time.Now()}
+	data, err := json.Marshal(ban)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bansBucket)).Put([]byte(ban.CIDR), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ban, s.loadBans()
+}
+
+// removeBan lifts the ban of the range in value.
+func (s *Server) removeBan(value string) error {
+	prefix, err := parseBanRange(value)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bansBucket))
+		if b.Get([]byte(prefix.String())) == nil {
+			return fmt.Errorf("ban not found")
+		}
+		return b.Delete([]byte(prefix.String()))
+	})
+	if err != nil {
+		return err
+	}
+	return s.loadBans()
+}
+
+// handleAdminBans lists the bans on GET, bans a range on POST with
+// {"cidr": "203.0.113.0/24", "reason": "..."}, and lifts a ban on DELETE
+// with ?cidr=.
+func (s *Server) handleAdminBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			CIDR   string `json:"cidr"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+		ban, err := s.addBan(req.CIDR, req.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requestLogger(r).Info("banned IP range", "cidr", ban.CIDR, "reason", ban.Reason)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ban)
+		return
+	case http.MethodDelete:
+		cidr := r.URL.Query().Get("cidr")
+		if _, err := parseBanRange(cidr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.removeBan(cidr); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		requestLogger(r).Info("lifted IP range ban", "cidr", cidr)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	bans, err := s.listBans()
+	if err != nil {
+		http.Error(w, "Failed to get bans", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseBanRange(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"203.0.113.7", "203.0.113.7/32", false},
+		{" 203.0.113.7/24 ", "203.0.113.0/24", false},
+		{"2001:db8::1", "2001:db8::1/128", false},
+		{"::ffff:203.0.113.7", "203.0.113.7/32", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"example.com", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseBanRange(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBanRange(%q) error = %v", tt.in, err)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("parseBanRange(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	srv := newTestServer(t)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+	create := func(remote string) int {
+		req := httptest.NewRequest("POST", "/sui/api/create", strings.NewReader(`{"url": "https://example.com"}`))
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if rr := do("POST", "/sui/api/admin/bans", `{"cidr": "203.0.113.0/24", "reason": "spam"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("ban status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("POST", "/sui/api/admin/bans", `{"cidr": "not-an-ip"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid ban status = %d, want 400", rr.Code)
+	}
+
+	if code := create("203.0.113.9:1234"); code != http.StatusForbidden {
+		t.Errorf("create from banned range = %d, want 403", code)
+	}
+	if code := create("198.51.100.1:1234"); code != http.StatusOK {
+		t.Errorf("create from elsewhere = %d, want 200", code)
+	}
+	if !srv.isBanned(netip.MustParseAddr("::ffff:203.0.113.9")) {
+		t.Error("IPv4-mapped address escaped the ban")
+	}
+
+	var bans []Ban
+	json.NewDecoder(do("GET", "/sui/api/admin/bans", "").Body).Decode(&bans)
+	if len(bans) != 1 || bans[0].CIDR != "203.0.113.0/24" || bans[0].Reason != "spam" {
+		t.Errorf("bans = %+v", bans)
+	}
+
+	if rr := do("DELETE", "/sui/api/admin/bans?cidr=203.0.113.0/24", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("unban status = %d", rr.Code)
+	}
+	if rr := do("DELETE", "/sui/api/admin/bans?cidr=203.0.113.0/24", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("second unban status = %d, want 404", rr.Code)
+	}
+	if code := create("203.0.113.9:1234"); code != http.StatusOK {
+		t.Errorf("create after unban = %d, want 200", code)
+	}
+}
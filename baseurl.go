@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseBaseURL validates the external base URL short links are generated
+// with, returning it without a trailing slash. An empty value is allowed
+// and means the URL is derived from each request.
+func parseBaseURL(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("invalid base URL %q: only scheme, host and path are allowed", raw)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// shortBase returns the URL short codes are appended to, e.g.
+// "https://go.example.com/s". It uses the configured base URL, falling back
+// to the scheme and host of the request.
+func (s *Server) shortBase(r *http.Request) string {
+	if s.baseURL != "" {
+		return s.baseURL + s.prefix
+	}
+	return fmt.Sprintf("%s://%s%s", s.scheme(r), r.Host, s.prefix)
+}
+
+// shortURL returns the public URL of a short link on domain.
+func (s *Server) shortURL(r *http.Request, domain, short string) string {
+	return s.domainBase(r, domain) + "/" + short
+}
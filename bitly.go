@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// bitlyTimeLayout is how Bitly formats times.
+const bitlyTimeLayout = "2006-01-02T15:04:05-0700"
+
+// BitlyConfig enables the Bitly-compatible endpoints; see
+// setupBitlyRoutes.
+type BitlyConfig struct {
+	// Enabled serves POST /v4/shorten and GET /v4/bitlinks/{id}/clicks, so
+	// tools written for Bitly only need a new base URL and token.
+	Enabled bool `yaml:"enabled"`
+}
+
+// setupBitlyRoutes registers the subset of Bitly's v4 API pk-shorts
+// implements. Bitlink IDs are short URLs without the scheme, like
+// "sho.rt/s/abc", so they span several path segments.
+func (s *Server) setupBitlyRoutes() {
+	v4 := s.router.PathPrefix("/v4").Subrouter()
+	v4.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Bitly authenticates with tokens only.
+			r.Header.Del("Cookie")
+			next.ServeHTTP(w, r)
+		})
+	})
+	v4.HandleFunc("/shorten", s.limitCreate(s.handleBitlyShorten)).Methods("POST")
+	v4.HandleFunc("/bitlinks/{bitlink:.+}/clicks", s.handleBitlyClicks).Methods("GET")
+}
+
+// writeBitlyError answers with an error shaped like Bitly's.
+func writeBitlyError(w http.ResponseWriter, status int, message, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message, "description": description, "resource": "bitlinks"})
+}
+
+// bitlyAuth checks the request carries a valid token granting scope. It
+// writes an error response and returns false otherwise.
+func (s *Server) bitlyAuth(w http.ResponseWriter, r *http.Request, scope string) bool {
+	cred, ok := s.requestCredential(r)
+	if !ok || cred == nil {
+		writeBitlyError(w, http.StatusForbidden, "FORBIDDEN", "A valid access token is required")
+		return false
+	}
+	if !scopeAllowed(cred.Scopes, scope) {
+		writeBitlyError(w, http.StatusForbidden, "FORBIDDEN", "The token lacks the "+strconv.Quote(scope)+" scope")
+		return false
+	}
+	return true
+}
+
+// bitlinkID returns the Bitly ID of short, its short URL without the
+// scheme.
+func (s *Server) bitlinkID(r *http.Request, domain, short string) string {
+	shortURL := s.shortURL(r, domain, short)
+	if _, rest, ok := strings.Cut(shortURL, "://"); ok {
+		return rest
+	}
+	return shortURL
+}
+
+// bitlinkShort returns the short code in a bitlink ID: what follows the
+// host and the redirect prefix. A bare short code is accepted too.
+func (s *Server) bitlinkShort(id string) string {
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+	_, path, ok := strings.Cut(id, "/")
+	if !ok {
+		return id
+	}
+	return strings.TrimPrefix(path, strings.TrimPrefix(s.prefix, "/")+"/")
+}
+
+// handleBitlyShorten shortens long_url. Like Bitly, it answers 200 with
+// the caller's existing link to the same URL, and 201 with a new one.
+func (s *Server) handleBitlyShorten(w http.ResponseWriter, r *http.Request) {
+	if !s.bitlyAuth(w, r, scopeCreate) {
+		return
+	}
+	var req struct {
+		LongURL string `json:"long_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBitlyError(w, http.StatusBadRequest, "INVALID_ARG_LONG_URL", "Invalid request body")
+		return
+	}
+	if req.LongURL == "" {
+		writeBitlyError(w, http.StatusBadRequest, "INVALID_ARG_LONG_URL", "long_url is required")
+		return
+	}
+	owner, _ := s.callerOwner(r)
+	system, _ := s.apiKeySystem(r)
+	domain := s.requestDomain(r)
+	destination := s.destinations.withDefaultScheme(req.LongURL)
+
+	status := http.StatusOK
+	link := s.findOwnLink(owner, destination, domain)
+	if link == nil {
+		short, err := s.createShortLink(destination, createOptions{System: system, Owner: owner, Domain: domain})
+		if err != nil {
+			if createErrorStatus(err) == http.StatusInternalServerError {
+				requestLogger(r).Error("failed to create short link", "err", err)
+				writeBitlyError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create short link")
+				return
+			}
+			writeBitlyError(w, http.StatusBadRequest, "INVALID_ARG_LONG_URL", capitalize(err.Error()))
+			return
+		}
+		if link, err = s.getLink(short); err != nil {
+			writeBitlyError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create short link")
+			return
+		}
+		status = http.StatusCreated
+	}
+
+	tags := link.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"created_at":      link.CreatedAt.Format(bitlyTimeLayout),
+		"id":              s.bitlinkID(r, link.Domain, link.Short),
+		"link":            s.shortURL(r, link.Domain, link.Short),
+		"custom_bitlinks": []string{},
+		"long_url":        link.Original,
+		"archived":        false,
+		"tags":            tags,
+		"deeplinks":       []string{},
+	})
+}
+
+// bitlyPeriodStart returns the start of the unit ("day", "week" starting
+// on Monday, or "month") t falls in, in UTC.
+func bitlyPeriodStart(t time.Time, unit string) time.Time {
+	day := t.UTC().Truncate(24 * time.Hour)
+	switch unit {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// bitlyAddUnits moves period start t by n units.
+func bitlyAddUnits(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// handleBitlyClicks returns the clicks of a link per unit (day, week or
+// month), newest first, for the last units units or, with units=-1 (the
+// default), since the link was created. Daily counts go back at most
+// maxStatsRangeDays.
+func (s *Server) handleBitlyClicks(w http.ResponseWriter, r *http.Request) {
+	if !s.bitlyAuth(w, r, scopeRead) {
+		return
+	}
+	link, err := s.getLink(s.bitlinkShort(mux.Vars(r)["bitlink"]))
+	if err != nil {
+		writeBitlyError(w, http.StatusNotFound, "NOT_FOUND", "Bitlink not found")
+		return
+	}
+	if status, _ := s.checkCanManage(r, link); status != http.StatusOK {
+		writeBitlyError(w, http.StatusNotFound, "NOT_FOUND", "Bitlink not found")
+		return
+	}
+
+	query := r.URL.Query()
+	unit := query.Get("unit")
+	if unit == "" {
+		unit = "day"
+	}
+	if unit != "day" && unit != "week" && unit != "month" {
+		writeBitlyError(w, http.StatusBadRequest, "INVALID_ARG_UNIT", "unit must be day, week or month")
+		return
+	}
+	units := -1
+	if v := query.Get("units"); v != "" {
+		if units, err = strconv.Atoi(v); err != nil || units == 0 || units < -1 {
+			writeBitlyError(w, http.StatusBadRequest, "INVALID_ARG_UNITS", "units must be positive or -1")
+			return
+		}
+	}
+
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	current := bitlyPeriodStart(now, unit)
+	start := link.CreatedAt.UTC().Truncate(24 * time.Hour)
+	if units > 0 {
+		start = bitlyAddUnits(current, unit, 1-units)
+	}
+	if oldest := today.AddDate(0, 0, 1-maxStatsRangeDays); start.Before(oldest) {
+		start = oldest
+	}
+	days := statsDays(now, int(today.Sub(start)/(24*time.Hour))+1)
+	counts, err := s.getDailyClicks(link.Short, days)
+	if err != nil {
+		writeBitlyError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get clicks")
+		return
+	}
+
+	type periodClicks struct {
+		Clicks uint64 `json:"clicks"`
+		Date   string `json:"date"`
+	}
+	periods := []periodClicks{}
+	index := make(map[time.Time]int)
+	for period := current; !period.Before(bitlyPeriodStart(start, unit)); period = bitlyAddUnits(period, unit, -1) {
+		index[period] = len(periods)
+		periods = append(periods, periodClicks{Date: period.Format(bitlyTimeLayout)})
+	}
+	for i, day := range days {
+		at, _ := time.Parse(dayKeyLayout, day)
+		periods[index[bitlyPeriodStart(at, unit)]].Clicks += counts[i]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"link_clicks":    periods,
+		"units":          units,
+		"unit":           unit,
+		"unit_reference": now.UTC().Format(bitlyTimeLayout),
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBitlyPeriodStart(t *testing.T) {
+	at := time.Date(2024, 5, 16, 15, 4, 5, 0, time.UTC) // a Thursday
+	tests := []struct {
+		unit string
+		want time.Time
+	}{
+		{"day", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"week", time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"month", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := bitlyPeriodStart(at, tt.unit); !got.Equal(tt.want) {
+			t.Errorf("bitlyPeriodStart(%s) = %v, want %v", tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestBitlyAPI(t *testing.T) {
+	t.Setenv("BITLY_API", "true")
+	t.Setenv("API_KEYS", "tool:s3cret,other:0ther")
+	srv := newTestServer(t)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = "sho.rt"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("POST", "/v4/shorten", "", `{"long_url":"https://example.com"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("shorten without a token = %d, want 403", rr.Code)
+	}
+
+	var created struct {
+		ID      string `json:"id"`
+		Link    string `json:"link"`
+		LongURL string `json:"long_url"`
+	}
+	rr := do("POST", "/v4/shorten", "s3cret", `{"long_url":"https://example.com/docs","domain":"bit.ly"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("shorten = %d %s, want 201", rr.Code, rr.Body)
+	}
+	json.NewDecoder(rr.Body).Decode(&created)
+	if !strings.HasPrefix(created.ID, "sho.rt/s/") || created.Link != "http://"+created.ID || created.LongURL != "https://example.com/docs" {
+		t.Fatalf("created = %+v", created)
+	}
+	if rr := do("POST", "/v4/shorten", "s3cret", `{"long_url":"https://example.com/docs"}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), created.ID) {
+		t.Errorf("shortening again = %d %s, want 200 with the same bitlink", rr.Code, rr.Body)
+	}
+	if rr := do("POST", "/v4/shorten", "s3cret", `{"long_url":""}`); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "INVALID_ARG_LONG_URL") {
+		t.Errorf("empty long_url = %d %s", rr.Code, rr.Body)
+	}
+
+	short := strings.TrimPrefix(created.ID, "sho.rt/s/")
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	srv.db.Update(func(tx *bolt.Tx) error {
+		recordDailyClick(tx, short, yesterday)
+		recordDailyClick(tx, short, yesterday)
+		return recordDailyClick(tx, short, time.Now())
+	})
+
+	var clicks struct {
+		LinkClicks []struct {
+			Clicks uint64 `json:"clicks"`
+			Date   string `json:"date"`
+		} `json:"link_clicks"`
+		Unit string `json:"unit"`
+	}
+	rr = do("GET", "/v4/bitlinks/"+created.ID+"/clicks?unit=day&units=3", "s3cret", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("clicks = %d %s", rr.Code, rr.Body)
+	}
+	json.NewDecoder(rr.Body).Decode(&clicks)
+	if len(clicks.LinkClicks) != 3 || clicks.LinkClicks[0].Clicks != 1 || clicks.LinkClicks[1].Clicks != 2 || clicks.LinkClicks[2].Clicks != 0 ||
+		!strings.HasPrefix(clicks.LinkClicks[1].Date, yesterday.Format(dayKeyLayout)+"T00:00:00") {
+		t.Errorf("clicks = %+v, want 1, 2, 0 newest first", clicks.LinkClicks)
+	}
+
+	rr = do("GET", "/v4/bitlinks/"+short+"/clicks", "s3cret", "")
+	json.NewDecoder(rr.Body).Decode(&clicks)
+	if rr.Code != http.StatusOK || len(clicks.LinkClicks) != 1 || clicks.LinkClicks[0].Clicks != 1 {
+		t.Errorf("clicks since creation = %d %+v, want today only", rr.Code, clicks.LinkClicks)
+	}
+
+	for _, tt := range []struct {
+		path, token string
+		want        int
+	}{
+		{"/v4/bitlinks/" + created.ID + "/clicks", "0ther", http.StatusNotFound},
+		{"/v4/bitlinks/sho.rt/s/missing/clicks", "s3cret", http.StatusNotFound},
+		{"/v4/bitlinks/" + created.ID + "/clicks?unit=minute", "s3cret", http.StatusBadRequest},
+	} {
+		if rr := do("GET", tt.path, tt.token, ""); rr.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, rr.Code, tt.want)
+		}
+	}
+}
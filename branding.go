@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultBrandName is the product name shown when none is configured.
+const defaultBrandName = "PK Shorts"
+
+// hexColor matches the CSS colors accepted as accent color.
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// BrandingConfig white-labels the UI. Every page gets it as .Brand.
+type BrandingConfig struct {
+	// Name replaces "PK Shorts" in page titles, headings and the
+	// installed app's name.
+	Name string `yaml:"name"`
+	// LogoURL is an image shown in place of the 🔗 in headings, either
+	// absolute or a path on this server, e.g. "/sui/static/logo.png".
+	LogoURL string `yaml:"logo_url"`
+	// AccentColor replaces the purple of buttons, links and headers, as a
+	// hex color such as "#0f766e".
+	AccentColor string `yaml:"accent_color"`
+	// Footer is a line of text at the bottom of every page.
+	Footer string `yaml:"footer"`
+}
+
+// parseBranding validates c and returns it with the default name filled in.
+func parseBranding(c BrandingConfig) (BrandingConfig, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		c.Name = defaultBrandName
+	}
+	c.Footer = strings.TrimSpace(c.Footer)
+	if c.AccentColor != "" && !hexColor.MatchString(c.AccentColor) {
+		return c, fmt.Errorf("invalid accent color %q: want a hex color like #0f766e", c.AccentColor)
+	}
+	if c.LogoURL != "" {
+		u, err := url.Parse(c.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && !strings.HasPrefix(c.LogoURL, "/")) {
+			return c, fmt.Errorf("invalid logo URL %q: want an http(s) URL or an absolute path", c.LogoURL)
+		}
+	}
+	return c, nil
+}
+
+// brand returns the branding of the UI.
+func (s *Server) brand() BrandingConfig {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	return s.branding
+}
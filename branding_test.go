@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBranding(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   BrandingConfig
+		wantName string
+		wantErr  bool
+	}{
+		{"defaults", BrandingConfig{}, defaultBrandName, false},
+		{"custom", BrandingConfig{Name: " Acme Links ", AccentColor: "#0f766e", LogoURL: "https://cdn.example.com/logo.svg"}, "Acme Links", false},
+		{"short color", BrandingConfig{AccentColor: "#f80"}, defaultBrandName, false},
+		{"local logo", BrandingConfig{LogoURL: "/sui/static/logo.png"}, defaultBrandName, false},
+		{"named color", BrandingConfig{AccentColor: "teal"}, "", true},
+		{"color with CSS", BrandingConfig{AccentColor: "#fff; background: url(x)"}, "", true},
+		{"script logo", BrandingConfig{LogoURL: "javascript:alert(1)"}, "", true},
+		{"relative logo", BrandingConfig{LogoURL: "logo.png"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBranding(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBranding() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", got.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestBrandedPages(t *testing.T) {
+	t.Setenv("BRAND_NAME", "Acme Links")
+	t.Setenv("BRAND_LOGO_URL", "/sui/static/icon.svg")
+	t.Setenv("BRAND_ACCENT_COLOR", "#0f766e")
+	t.Setenv("BRAND_FOOTER", "Internal use only")
+	srv := newTestServer(t)
+
+	for _, path := range []string{"/sui/", "/sui/login", "/s/missing"} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		body := rr.Body.String()
+		if title, _, _ := strings.Cut(body, "</title>"); !strings.Contains(title, "Acme Links") {
+			t.Errorf("%s title does not show the brand name", path)
+		}
+		for _, want := range []string{"--accent: #0f766e", `<footer class="brand-footer">Internal use only</footer>`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s does not contain %q", path, want)
+			}
+		}
+		if strings.Contains(body, "PK Shorts") {
+			t.Errorf("%s still shows the default name", path)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/sui/", nil))
+	if !strings.Contains(rr.Body.String(), `<img class="brand-logo" src="/sui/static/icon.svg" alt=""> Acme Links</h1>`) {
+		t.Error("home page heading does not show the logo and name")
+	}
+
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/sui/manifest.webmanifest", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"Acme Links"`) || !strings.Contains(rr.Body.String(), `"theme_color":"#0f766e"`) {
+		t.Errorf("manifest = %d %s, want the brand name and color", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// maxBulkLinks is the most links one bulk request may change.
+const maxBulkLinks = 500
+
+// errLinkDisabledByOwner is returned when resolving a link its owner
+// turned off.
+var errLinkDisabledByOwner = errors.New("link is disabled by its owner")
+
+// bulkRequest is the body of a bulk action on several links. Tags are
+// used by the tag and untag actions, Reason by delete.
+type bulkRequest struct {
+	Action string   `json:"action"`
+	Shorts []string `json:"shorts"`
+	Tags   []string `json:"tags"`
+	Reason string   `json:"reason"`
+}
+
+// bulkResult is the outcome of a bulk action on one link, with the status
+// the single-link endpoint would have answered.
+type bulkResult struct {
+	Short  string `json:"short"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleAPIBulk applies one action to several links:
+// POST {"action": "delete"|"tag"|"untag"|"disable"|"enable", "shorts": [...]}.
+// Each link is checked and changed on its own, so the response lists the
+// result per link and some may fail while others succeed.
+func (s *Server) handleAPIBulk(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	scope := scopeCreate
+	if req.Action == "delete" {
+		scope = scopeDelete
+	}
+	if !s.requireScope(w, r, scope) {
+		return
+	}
+
+	shorts := slices.Compact(slices.Sorted(slices.Values(req.Shorts)))
+	if len(shorts) == 0 {
+		http.Error(w, "shorts is required", http.StatusBadRequest)
+		return
+	}
+	if len(shorts) > maxBulkLinks {
+		http.Error(w, fmt.Sprintf("At most %d links can be changed at once", maxBulkLinks), http.StatusBadRequest)
+		return
+	}
+
+	var apply func(short string) (int, string)
+	switch req.Action {
+	case "delete":
+		reason, err := s.checkDeleteReason(req.Reason)
+		if err != nil {
+			http.Error(w, "A reason is required to delete links", http.StatusBadRequest)
+			return
+		}
+		apply = func(short string) (int, string) { return s.bulkDelete(r, short, reason) }
+	case "tag", "untag":
+		tags, err := normalizeTags(req.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(tags) == 0 {
+			http.Error(w, "tags is required", http.StatusBadRequest)
+			return
+		}
+		apply = func(short string) (int, string) { return s.bulkTag(r, short, tags, req.Action == "tag") }
+	case "disable", "enable":
+		disabled := req.Action == "disable"
+		apply = func(short string) (int, string) {
+			return s.bulkUpdate(r, short, func(link *Link) { link.Disabled = disabled })
+		}
+	default:
+		http.Error(w, "action must be delete, tag, untag, disable or enable", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]bulkResult, 0, len(shorts))
+	var failed int
+	for _, short := range shorts {
+		status, msg := apply(short)
+		if status != http.StatusOK {
+			failed++
+		}
+		results = append(results, bulkResult{Short: short, Status: status, Error: msg})
+	}
+	requestLogger(r).Info("bulk action", "action", req.Action, "links", len(shorts), "failed", failed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action":    req.Action,
+		"succeeded": len(shorts) - failed,
+		"failed":    failed,
+		"results":   results,
+	})
+}
+
+func (s *Server) bulkDelete(r *http.Request, short, reason string) (int, string) {
+	if status, msg := s.checkCanDelete(r, short); status != http.StatusOK {
+		return status, msg
+	}
+	if err := s.deleteLink(short, s.deleteActor(r), reason); err != nil {
+		if err.Error() == "link not found" {
+			return http.StatusNotFound, "Link not found"
+		}
+		return http.StatusInternalServerError, "Failed to delete link"
+	}
+	return http.StatusOK, ""
+}
+
+// bulkTag adds tags to short, or removes them when add is false.
+func (s *Server) bulkTag(r *http.Request, short string, tags []string, add bool) (int, string) {
+	link, err := s.getLink(short)
+	if err != nil {
+		return http.StatusNotFound, "Link not found"
+	}
+	if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+		return status, msg
+	}
+	var updated []string
+	if add {
+		if updated, err = normalizeTags(append(slices.Clone(link.Tags), tags...)); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	} else {
+		updated = slices.DeleteFunc(slices.Clone(link.Tags), func(tag string) bool { return slices.Contains(tags, tag) })
+	}
+	if err := s.updateLink(short, func(link *Link) { link.Tags = updated }); err != nil {
+		return http.StatusInternalServerError, "Failed to update link"
+	}
+	return http.StatusOK, ""
+}
+
+// bulkUpdate applies fn to short if the caller may manage it.
+func (s *Server) bulkUpdate(r *http.Request, short string, fn func(*Link)) (int, string) {
+	link, err := s.getLink(short)
+	if err != nil {
+		return http.StatusNotFound, "Link not found"
+	}
+	if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+		return status, msg
+	}
+	if err := s.updateLink(short, fn); err != nil {
+		return http.StatusInternalServerError, "Failed to update link"
+	}
+	return http.StatusOK, ""
+}
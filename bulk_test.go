@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIBulk(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "root") // the first user is the admin
+	alice := loginAs(t, srv, "alice")
+	for _, l := range []struct{ short, owner string }{{"one", "alice"}, {"two", "alice"}, {"bobs", "bob"}} {
+		if _, err := srv.createShortLink("https://example.com/"+l.short, createOptions{CustomID: l.short, Owner: l.owner, Tags: []string{"old"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bulk := func(body string) (int, map[string]int) {
+		req := httptest.NewRequest("POST", "/sui/api/links/bulk", strings.NewReader(body))
+		req.AddCookie(alice)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		var resp struct {
+			Results []bulkResult `json:"results"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		statuses := map[string]int{}
+		for _, r := range resp.Results {
+			statuses[r.Short] = r.Status
+		}
+		return rr.Code, statuses
+	}
+	redirect := func(short string) int {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/"+short, nil))
+		return rr.Code
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown action", `{"action": "archive", "shorts": ["one"]}`, http.StatusBadRequest},
+		{"no links", `{"action": "disable", "shorts": []}`, http.StatusBadRequest},
+		{"no tags", `{"action": "tag", "shorts": ["one"]}`, http.StatusBadRequest},
+		{"invalid tag", `{"action": "tag", "shorts": ["one"], "tags": ["a b"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code, _ := bulk(tt.body); code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	code, results := bulk(`{"action": "tag", "shorts": ["one", "two", "two", "bobs", "gone"], "tags": ["Sale"]}`)
+	if code != http.StatusOK || len(results) != 4 || results["one"] != 200 || results["two"] != 200 || results["bobs"] != 403 || results["gone"] != 404 {
+		t.Fatalf("tag = %d %v", code, results)
+	}
+	if link, _ := srv.getLink("two"); strings.Join(link.Tags, ",") != "old,sale" {
+		t.Errorf("tags after tagging = %v", link.Tags)
+	}
+	if link, _ := srv.getLink("bobs"); strings.Join(link.Tags, ",") != "old" {
+		t.Errorf("another user's link was tagged: %v", link.Tags)
+	}
+	bulk(`{"action": "untag", "shorts": ["one"], "tags": ["old"]}`)
+	if link, _ := srv.getLink("one"); strings.Join(link.Tags, ",") != "sale" {
+		t.Errorf("tags after untagging = %v", link.Tags)
+	}
+
+	redirect("one") // cache the destination
+	if _, results := bulk(`{"action": "disable", "shorts": ["one", "bobs"]}`); results["one"] != 200 || results["bobs"] != 403 {
+		t.Fatalf("disable = %v", results)
+	}
+	if code := redirect("one"); code != http.StatusGone {
+		t.Errorf("disabled link redirect = %d, want 410", code)
+	}
+	if code := redirect("bobs"); code != http.StatusFound {
+		t.Errorf("another user's link redirect = %d, want 302", code)
+	}
+	bulk(`{"action": "enable", "shorts": ["one"]}`)
+	if code := redirect("one"); code != http.StatusFound {
+		t.Errorf("enabled link redirect = %d, want 302", code)
+	}
+
+	if _, results := bulk(`{"action": "delete", "shorts": ["one", "two", "bobs"], "reason": "cleanup"}`); results["one"] != 200 || results["two"] != 200 || results["bobs"] != 403 {
+		t.Fatalf("delete = %v", results)
+	}
+	if tombstones, _ := srv.listTombstones("two", 1); len(tombstones) != 1 || tombstones[0].Reason != "cleanup" {
+		t.Errorf("tombstone = %+v", tombstones)
+	}
+	if _, err := srv.getLink("bobs"); err != nil {
+		t.Error("another user's link was deleted")
+	}
+}
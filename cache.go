@@ -0,0 +1,161 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheSize = 10000
+	defaultCacheTTL  = 5 * time.Minute
+)
+
+type cacheEntry struct {
+	key   string
+	value string
+	// expires is when the entry stops being served; zero for never.
+	expires time.Time
+}
+
+// lruCache is a size-bounded, TTL-limited cache of short code to destination
+// URL used in front of the database on the redirect path. A nil *lruCache is
+// valid and caches nothing, which is how caching is disabled.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// newLRUCache returns a cache holding at most size entries for ttl each, or
+// nil when size is zero or negative. A ttl of zero keeps entries until they
+// are evicted or invalidated.
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	if size <= 0 {
+		return nil
+	}
+	return &lruCache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached value for key, if present and not expired.
+func (c *lruCache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return "", false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.misses.Add(1)
+		return "", false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+// Set stores value under key, evicting the least recently used entry if the
+// cache is full.
+func (c *lruCache) Set(key, value string) {
+	c.SetUntil(key, value, time.Time{})
+}
+
+// SetUntil stores value under key like Set, but no later than until, for
+// values that go stale at a known time. A zero until only applies the TTL.
+func (c *lruCache) SetUntil(key, value string, until time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+	if !until.IsZero() && (expires.IsZero() || until.Before(expires)) {
+		expires = until
+	}
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.value = value
+		entry.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Remove invalidates key. It must be called whenever a link changes or is
+// deleted.
+func (c *lruCache) Remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Len returns the number of cached entries.
+func (c *lruCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Size returns the maximum number of entries, zero when caching is
+// disabled.
+func (c *lruCache) Size() int {
+	if c == nil {
+		return 0
+	}
+	return c.size
+}
+
+// Stats returns the number of lookups served from the cache and the
+// number that missed it.
+func (c *lruCache) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return c.hits.Load(), c.misses.Load()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache(2, time.Minute)
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Get("a") // a is now most recently used
+	c.Set("c", "3")
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Errorf("Get(a) = %q, %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected removed entry to be gone")
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	c := newLRUCache(10, 10*time.Millisecond)
+	c.Set("a", "1")
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected expired entry to miss")
+	}
+}
+
+func TestLRUCacheSetUntil(t *testing.T) {
+	for _, ttl := range []time.Duration{0, time.Minute} {
+		c := newLRUCache(10, ttl)
+		c.SetUntil("soon", "1", time.Now().Add(10*time.Millisecond))
+		c.SetUntil("later", "2", time.Now().Add(time.Hour))
+		time.Sleep(20 * time.Millisecond)
+		if _, ok := c.Get("soon"); ok {
+			t.Errorf("ttl %v: expected entry past its time to miss", ttl)
+		}
+		if _, ok := c.Get("later"); !ok {
+			t.Errorf("ttl %v: expected entry to hit until its time", ttl)
+		}
+	}
+}
+
+func TestNilCacheIsDisabled(t *testing.T) {
+	c := newLRUCache(0, time.Minute)
+	if c != nil {
+		t.Fatal("expected nil cache for size 0")
+	}
+	c.Set("a", "1")
+	if _, ok := c.Get("a"); ok {
+		t.Error("disabled cache should never hit")
+	}
+	c.Remove("a")
+}
+
+func TestDeleteInvalidatesCache(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "cached"}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	if _, err := srv.getOriginalURL("", "cached"); err != nil {
+		t.Fatalf("getOriginalURL() error: %v", err)
+	}
+	if _, ok := srv.cache.Get("cached"); !ok {
+		t.Fatal("expected lookup to populate the cache")
+	}
+
+	if err := srv.deleteLink("cached", "", ""); err != nil {
+		t.Fatalf("deleteLink() error: %v", err)
+	}
+	if _, err := srv.getOriginalURL("", "cached"); err == nil {
+		t.Error("expected deleted link to be gone despite caching")
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// campaignsBucket stores campaigns under "<owner>/<name>", so each owner
+// has its own campaign names.
+const campaignsBucket = "campaigns"
+
+var (
+	errCampaignExists   = errors.New("campaign already exists")
+	errCampaignNotFound = errors.New("campaign not found")
+	errCampaignEnded    = errors.New("campaign has ended")
+)
+
+// UTM holds the utm_* query parameters added to the destination of
+// campaign links. Empty values are left out.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// params returns the parameters of u in a fixed order.
+func (u UTM) params() [][2]string {
+	return [][2]string{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	}
+}
+
+// Campaign groups the links of one launch and holds the settings they
+// share. Links created for a campaign get its tags and UTM parameters and
+// expire as its policy says; changing a campaign only affects links
+// created afterwards.
+type Campaign struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	// Tags are added to the tags given for each link.
+	Tags []string `json:"tags,omitempty"`
+	UTM  UTM      `json:"utm"`
+	// ExpiresIn is how long each link redirects after it is created, as
+	// a Go duration, or "" for no limit.
+	ExpiresIn string `json:"expires_in,omitempty"`
+	// EndsAt, when set, is when every link of the campaign stops
+	// redirecting; no links can be created for it afterwards.
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func campaignKey(owner, name string) []byte {
+	return []byte(owner + "/" + name)
+}
+
+// normalize checks c and puts its name, tags and UTM parameters in
+// canonical form.
+func (c *Campaign) normalize() error {
+	c.Name = strings.ToLower(strings.TrimSpace(c.Name))
+	if err := validateHandle("campaign name", c.Name); err != nil {
+		return err
+	}
+	tags, err := normalizeTags(c.Tags)
+	if err != nil {
+		return err
+	}
+	c.Tags = tags
+	for _, v := range []*string{&c.UTM.Source, &c.UTM.Medium, &c.UTM.Campaign, &c.UTM.Term, &c.UTM.Content} {
+		*v = strings.TrimSpace(*v)
+	}
+	if c.ExpiresIn != "" {
+		if d, err := time.ParseDuration(c.ExpiresIn); err != nil || d <= 0 {
+			return fmt.Errorf("invalid expires_in %q", c.ExpiresIn)
+		}
+	}
+	return nil
+}
+
+// apply gives a link created at now the settings of c and returns its
+// destination with the campaign's UTM parameters. Tags and an expiry set
+// for the link itself are kept, but the link never outlives the campaign.
+func (c *Campaign) apply(destination string, opts *createOptions, now time.Time) (string, error) {
+	if c.EndsAt != nil && !c.EndsAt.After(now) {
+		return "", errCampaignEnded
+	}
+	tags, err := normalizeTags(append(append([]string{}, opts.Tags...), c.Tags...))
+	if err != nil {
+		return "", err
+	}
+	opts.Tags = tags
+	if opts.ExpiresAt == nil && c.ExpiresIn != "" {
+		d, _ := time.ParseDuration(c.ExpiresIn)
+		expires := now.Add(d)
+		opts.ExpiresAt = &expires
+	}
+	if c.EndsAt != nil && (opts.ExpiresAt == nil || opts.ExpiresAt.After(*c.EndsAt)) {
+		ends := *c.EndsAt
+		opts.ExpiresAt = &ends
+	}
+	opts.Campaign = c.Name
+	if destination == "" {
+		return "", nil
+	}
+	return withUTM(destination, c.UTM), nil
+}
+
+// withUTM adds the parameters of u to destination, leaving any it already
+// has alone. Destinations that don't parse are returned as they are.
+func withUTM(destination string, u UTM) string {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	query := parsed.Query()
+	var added bool
+	for _, p := range u.params() {
+		if p[1] != "" && !query.Has(p[0]) {
+			query.Set(p[0], p[1])
+			added = true
+		}
+	}
+	if !added {
+		return destination
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// createCampaign stores a new campaign.
+func (s *Server) createCampaign(c *Campaign) error {
+	if err := c.normalize(); err != nil {
+		return err
+	}
+	c.CreatedAt = time.Now()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(campaignsBucket))
+		key := campaignKey(c.Owner, c.Name)
+		if b.Get(key) != nil {
+			return errCampaignExists
+		}
+		return b.Put(key, data)
+	})
+}
+
+// updateCampaign replaces the settings of a stored campaign with those
+// of c, keeping when it was created.
+func (s *Server) updateCampaign(c *Campaign) error {
+	if err := c.normalize(); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(campaignsBucket))
+		key := campaignKey(c.Owner, c.Name)
+		var existing Campaign
+		data := b.Get(key)
+		if data == nil {
+			return errCampaignNotFound
+		}
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return err
+		}
+		c.CreatedAt = existing.CreatedAt
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, data)
+	})
+}
+
+// getCampaign loads the campaign of owner with the given name.
+func (s *Server) getCampaign(owner, name string) (*Campaign, error) {
+	var c *Campaign
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(campaignsBucket)).Get(campaignKey(owner, strings.ToLower(name)))
+		if data == nil {
+			return errCampaignNotFound
+		}
+		c = &Campaign{}
+		return json.Unmarshal(data, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// listCampaigns returns the campaigns of owner, ordered by name.
+func (s *Server) listCampaigns(owner string) ([]Campaign, error) {
+	campaigns := []Campaign{}
+	prefix := campaignKey(owner, "")
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(campaignsBucket)).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var campaign Campaign
+			if err := json.Unmarshal(v, &campaign); err != nil {
+				return err
+			}
+			campaigns = append(campaigns, campaign)
+		}
+		return nil
+	})
+	return campaigns, err
+}
+
+// deleteCampaign removes a campaign. Its links keep their settings and
+// campaign name.
+func (s *Server) deleteCampaign(owner, name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(campaignsBucket))
+		key := campaignKey(owner, strings.ToLower(name))
+		if b.Get(key) == nil {
+			return errCampaignNotFound
+		}
+		return b.Delete(key)
+	})
+}
+
+// applyCampaign looks up the campaign name of the link's owner and applies
+// it to opts, returning the destination to create the link with.
+func (s *Server) applyCampaign(name, destination string, opts *createOptions) (string, error) {
+	if opts.Owner == "" {
+		return "", errCampaignNotFound
+	}
+	c, err := s.getCampaign(opts.Owner, name)
+	if err != nil {
+		return "", err
+	}
+	return c.apply(destination, opts, time.Now())
+}
+
+// writeCampaignError answers a request that failed on a campaign.
+func writeCampaignError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errCampaignNotFound):
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+	case errors.Is(err, errCampaignExists):
+		http.Error(w, "Campaign already exists", http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// campaignOwner returns the owner whose campaigns a request works with:
+// the team named by the "team" query parameter, or the caller. It writes
+// the error response when there is none.
+func (s *Server) campaignOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if team := r.URL.Query().Get("team"); team != "" {
+		owner, err := s.teamOwner(r, team)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return "", false
+		}
+		return owner, true
+	}
+	owner, ok := s.callerOwner(r)
+	if !ok {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return "", false
+	}
+	if owner == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	return owner, true
+}
+
+// campaignRequest is the body of campaign create and update requests.
+type campaignRequest struct {
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags"`
+	UTM       UTM      `json:"utm"`
+	ExpiresIn string   `json:"expires_in"`
+	EndsAt    string   `json:"ends_at"`
+}
+
+// campaign returns the campaign req describes for owner.
+func (req campaignRequest) campaign(owner string) (*Campaign, error) {
+	c := &Campaign{Name: req.Name, Owner: owner, Tags: req.Tags, UTM: req.UTM, ExpiresIn: req.ExpiresIn}
+	if req.EndsAt != "" {
+		ends, err := parseTimeParam(req.EndsAt)
+		if err != nil {
+			return nil, err
+		}
+		c.EndsAt = &ends
+	}
+	return c, nil
+}
+
+// handleAPICampaigns lists the caller's campaigns with GET and creates one
+// with POST {"name": ..., "tags": [...], "utm": {"source": ...}, "expires_in":
+// "720h", "ends_at": ...}. The "team" query parameter works with a team's
+// campaigns instead.
+func (s *Server) handleAPICampaigns(w http.ResponseWriter, r *http.Request) {
+	scope := scopeRead
+	if r.Method == http.MethodPost {
+		scope = scopeCreate
+	}
+	if !s.requireScope(w, r, scope) {
+		return
+	}
+	owner, ok := s.campaignOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req campaignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+		c, err := req.campaign(owner)
+		if err == nil {
+			err = s.createCampaign(c)
+		}
+		if err != nil {
+			writeCampaignError(w, err)
+			return
+		}
+		requestLogger(r).Info("created campaign", "campaign", c.Name, "owner", owner)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+		return
+	}
+
+	campaigns, err := s.listCampaigns(owner)
+	if err != nil {
+		http.Error(w, "Failed to get campaigns", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaigns)
+}
+
+// campaignSummary is a campaign with totals over its links.
+type campaignSummary struct {
+	*Campaign
+	Links  int `json:"links"`
+	Clicks int `json:"clicks"`
+}
+
+// handleAPICampaign shows a campaign and totals over its links with GET,
+// replaces its settings with PUT, taking the body of handleAPICampaigns,
+// and deletes it with DELETE.
+func (s *Server) handleAPICampaign(w http.ResponseWriter, r *http.Request) {
+	scope := scopeCreate
+	if r.Method == http.MethodGet {
+		scope = scopeRead
+	}
+	if !s.requireScope(w, r, scope) {
+		return
+	}
+	owner, ok := s.campaignOwner(w, r)
+	if !ok {
+		return
+	}
+	name := strings.ToLower(mux.Vars(r)["name"])
+
+	switch r.Method {
+	case http.MethodPut:
+		var req campaignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+		req.Name = name
+		c, err := req.campaign(owner)
+		if err == nil {
+			err = s.updateCampaign(c)
+		}
+		if err != nil {
+			writeCampaignError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+		return
+	case http.MethodDelete:
+		if err := s.deleteCampaign(owner, name); err != nil {
+			writeCampaignError(w, err)
+			return
+		}
+		requestLogger(r).Info("deleted campaign", "campaign", name, "owner", owner)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c, err := s.getCampaign(owner, name)
+	if err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	links, err := s.getAllLinks(func(link *Link) bool {
+		return link.Owner == owner && link.Campaign == name
+	})
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		return
+	}
+	summary := campaignSummary{Campaign: c, Links: len(links)}
+	for _, link := range links {
+		summary.Clicks += link.Clicks
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
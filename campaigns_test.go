@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithUTM(t *testing.T) {
+	utm := UTM{Source: "newsletter", Medium: "email", Campaign: "spring launch"}
+	tests := []struct {
+		name        string
+		destination string
+		utm         UTM
+		want        string
+	}{
+		{"adds parameters", "https://example.com/p", utm, "https://example.com/p?utm_campaign=spring+launch&utm_medium=email&utm_source=newsletter"},
+		{"keeps the link's own", "https://example.com/p?utm_source=ads&id=1", utm, "https://example.com/p?id=1&utm_campaign=spring+launch&utm_medium=email&utm_source=ads"},
+		{"keeps the fragment", "https://example.com/p#top", UTM{Term: "shoes"}, "https://example.com/p?utm_term=shoes#top"},
+		{"nothing to add", "https://example.com/p?a=b&c", UTM{}, "https://example.com/p?a=b&c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withUTM(tt.destination, tt.utm); got != tt.want {
+				t.Errorf("withUTM() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCampaignApply(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ends := now.Add(48 * time.Hour)
+	tests := []struct {
+		name     string
+		campaign Campaign
+		opts     createOptions
+		tags     []string
+		expires  *time.Time
+		wantErr  error
+	}{
+		{"tags merged", Campaign{Tags: []string{"launch"}}, createOptions{Tags: []string{"email", "launch"}}, []string{"email", "launch"}, nil, nil},
+		{"link lifetime", Campaign{ExpiresIn: "24h"}, createOptions{}, nil, ptrTime(now.Add(24 * time.Hour)), nil},
+		{"own expiry kept", Campaign{ExpiresIn: "24h"}, createOptions{ExpiresAt: ptrTime(now.Add(time.Hour))}, nil, ptrTime(now.Add(time.Hour)), nil},
+		{"capped by the end", Campaign{ExpiresIn: "720h", EndsAt: &ends}, createOptions{}, nil, &ends, nil},
+		{"ended", Campaign{EndsAt: ptrTime(now.Add(-time.Hour))}, createOptions{}, nil, nil, errCampaignEnded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.campaign
+			c.Name = "spring"
+			opts := tt.opts
+			_, err := c.apply("https://example.com", &opts, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if opts.Campaign != "spring" || strings.Join(opts.Tags, ",") != strings.Join(tt.tags, ",") {
+				t.Errorf("opts = %+v, want campaign spring and tags %v", opts, tt.tags)
+			}
+			if (opts.ExpiresAt == nil) != (tt.expires == nil) || (opts.ExpiresAt != nil && !opts.ExpiresAt.Equal(*tt.expires)) {
+				t.Errorf("expires = %v, want %v", opts.ExpiresAt, tt.expires)
+			}
+		})
+	}
+}
+
+func TestAPICampaigns(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	serve := func(cookie *http.Cookie, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(alice, "POST", "/sui/api/campaigns", `{"name": "Spring", "tags": ["launch"], "utm": {"source": "newsletter", "campaign": "spring"}, "expires_in": "720h"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create campaign = %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := serve(alice, "POST", "/sui/api/campaigns", `{"name": "spring"}`); rr.Code != http.StatusConflict {
+		t.Errorf("duplicate campaign = %d, want 409", rr.Code)
+	}
+	if rr := serve(alice, "POST", "/sui/api/campaigns", `{"name": "x", "expires_in": "soon"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid campaign = %d, want 400", rr.Code)
+	}
+
+	for i, short := range []string{"spring-a", "spring-b"} {
+		body := `{"url": "https://example.com/p?utm_source=ads", "custom_id": "` + short + `", "campaign": "spring", "tags": ["email"]}`
+		if i == 1 {
+			body = `{"url": "https://example.com/q", "custom_id": "` + short + `", "campaign": "spring"}`
+		}
+		if rr := serve(alice, "POST", "/sui/api/create", body); rr.Code != http.StatusOK {
+			t.Fatalf("create %s = %d: %s", short, rr.Code, rr.Body.String())
+		}
+	}
+	link, _ := srv.getLink("spring-a")
+	if link.Campaign != "spring" || link.Original != "https://example.com/p?utm_campaign=spring&utm_source=ads" ||
+		strings.Join(link.Tags, ",") != "email,launch" || link.ExpiresAt == nil {
+		t.Errorf("link = %+v", link)
+	}
+	if link, _ := srv.getLink("spring-b"); link.Original != "https://example.com/q?utm_campaign=spring&utm_source=newsletter" {
+		t.Errorf("destination = %s", link.Original)
+	}
+	if rr := serve(bob, "POST", "/sui/api/create", `{"url": "https://example.com", "campaign": "spring"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("another user's campaign = %d, want 404", rr.Code)
+	}
+
+	rr = serve(alice, "GET", "/sui/api/list?campaign=spring", "")
+	var links []Link
+	json.NewDecoder(rr.Body).Decode(&links)
+	if len(links) != 2 {
+		t.Errorf("listed %d campaign links, want 2", len(links))
+	}
+
+	rr = serve(alice, "GET", "/sui/api/campaigns/spring", "")
+	var summary struct {
+		Name  string `json:"name"`
+		Links int    `json:"links"`
+	}
+	json.NewDecoder(rr.Body).Decode(&summary)
+	if rr.Code != http.StatusOK || summary.Name != "spring" || summary.Links != 2 {
+		t.Errorf("campaign = %d %+v", rr.Code, summary)
+	}
+	if rr := serve(bob, "GET", "/sui/api/campaigns", ""); rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("bob's campaigns = %d %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serve(alice, "PUT", "/sui/api/campaigns/spring", `{"tags": ["summer"]}`); rr.Code != http.StatusOK {
+		t.Errorf("update campaign = %d: %s", rr.Code, rr.Body.String())
+	}
+	if c, _ := srv.getCampaign("alice", "spring"); c.ExpiresIn != "" || strings.Join(c.Tags, ",") != "summer" {
+		t.Errorf("updated campaign = %+v", c)
+	}
+	if rr := serve(alice, "DELETE", "/sui/api/campaigns/spring", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete campaign = %d", rr.Code)
+	}
+	if rr := serve(alice, "GET", "/sui/api/campaigns/spring", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted campaign = %d, want 404", rr.Code)
+	}
+	if link, _ := srv.getLink("spring-b"); link.Campaign != "spring" {
+		t.Error("deleting the campaign changed its links")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hcaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+	turnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+
+	captchaTimeout = 5 * time.Second
+
+	// powValidity is how long a proof-of-work challenge can be solved
+	// and redeemed.
+	powValidity = 10 * time.Minute
+)
+
+var errNotHuman = errors.New("human verification failed")
+
+// CaptchaConfig protects anonymous link creation from bots: a CAPTCHA on
+// the web form, and a proof-of-work puzzle for the API.
+type CaptchaConfig struct {
+	// Provider is "hcaptcha", "turnstile" or empty for no CAPTCHA.
+	Provider string `yaml:"provider"`
+	SiteKey  string `yaml:"site_key"`
+	Secret   string `yaml:"secret"`
+	// Endpoint overrides the provider's verification URL.
+	Endpoint string `yaml:"endpoint"`
+	// PowDifficulty is the number of leading zero bits the API's
+	// proof-of-work hash needs; 0 disables it. Each extra bit doubles the
+	// work, and 20 takes about a second in a browser.
+	PowDifficulty int `yaml:"pow_difficulty"`
+}
+
+// captcha describes the widget of a provider for the templates.
+type captcha struct {
+	Provider string
+	SiteKey  string
+	// Script is the widget's JavaScript, Class the element it renders in
+	// and Field the form field carrying the solved token.
+	Script string
+	Class  string
+	Field  string
+	verify string
+}
+
+// newCaptcha validates c and returns the configured widget, or nil when no
+// CAPTCHA is configured.
+func newCaptcha(c CaptchaConfig) (*captcha, error) {
+	if c.PowDifficulty < 0 || c.PowDifficulty > 32 {
+		return nil, fmt.Errorf("invalid proof-of-work difficulty %d: use 0 to 32", c.PowDifficulty)
+	}
+	var w captcha
+	switch strings.ToLower(c.Provider) {
+	case "":
+		return nil, nil
+	case "hcaptcha":
+		w = captcha{Script: "https://js.hcaptcha.com/1/api.js", Class: "h-captcha", Field: "h-captcha-response", verify: hcaptchaVerifyURL}
+	case "turnstile":
+		w = captcha{Script: "https://challenges.cloudflare.com/turnstile/v0/api.js", Class: "cf-turnstile", Field: "cf-turnstile-response", verify: turnstileVerifyURL}
+	default:
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q: use hcaptcha or turnstile", c.Provider)
+	}
+	if c.SiteKey == "" || c.Secret == "" {
+		return nil, fmt.Errorf("the %s CAPTCHA needs a site key and a secret", c.Provider)
+	}
+	w.Provider = strings.ToLower(c.Provider)
+	w.SiteKey = c.SiteKey
+	if c.Endpoint != "" {
+		w.verify = c.Endpoint
+	}
+	return &w, nil
+}
+
+// formCaptcha returns the CAPTCHA to show on the create form to user, or
+// nil when none is needed.
+func (s *Server) formCaptcha(user *User) *captcha {
+	if user != nil {
+		return nil
+	}
+	return s.captcha
+}
+
+// verifyCaptcha checks the CAPTCHA token submitted with the create form.
+func (s *Server) verifyCaptcha(r *http.Request) error {
+	token := r.FormValue(s.captcha.Field)
+	if token == "" {
+		return fmt.Errorf("%w: please complete the CAPTCHA", errNotHuman)
+	}
+	form := url.Values{
+		"secret":   {s.captchaSecret},
+		"response": {token},
+		"remoteip": {s.clientIP(r)},
+		"sitekey":  {s.captcha.SiteKey},
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), captchaTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", s.captcha.verify, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("CAPTCHA verification unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("CAPTCHA verification unavailable: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: CAPTCHA rejected (%s)", errNotHuman, strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
+
+// writeNotHumanError reports a failed CAPTCHA or proof of work: 403 when
+// the client failed it, 503 when it couldn't be checked.
+func writeNotHumanError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNotHuman) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
+
+// powIssuer hands out stateless proof-of-work challenges, signed so they
+// can't be forged, and remembers redeemed ones until they expire so each
+// can only be used once.
+type powIssuer struct {
+	difficulty int
+	key        []byte
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// newPowIssuer returns an issuer for difficulty, or nil when it is 0.
+func newPowIssuer(difficulty int) *powIssuer {
+	if difficulty <= 0 {
+		return nil
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &powIssuer{difficulty: difficulty, key: key, used: make(map[string]time.Time)}
+}
+
+// challenge returns a new challenge issued at now.
+func (p *powIssuer) challenge(now time.Time) string {
+	payload := make([]byte, 8+16)
+	binary.BigEndian.PutUint64(payload, uint64(now.Unix()))
+	rand.Read(payload[8:])
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(p.sign(payload))
+}
+
+func (p *powIssuer) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// redeem checks that nonce solves challenge and that the challenge is
+// genuine, unexpired and unused.
+func (p *powIssuer) redeem(challenge, nonce string, now time.Time) error {
+	encPayload, encSig, ok := strings.Cut(challenge, ".")
+	payload, err1 := base64.RawURLEncoding.DecodeString(encPayload)
+	sig, err2 := base64.RawURLEncoding.DecodeString(encSig)
+	if !ok || err1 != nil || err2 != nil || len(payload) != 24 || !hmac.Equal(sig, p.sign(payload)) {
+		return fmt.Errorf("%w: invalid proof-of-work challenge", errNotHuman)
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if now.Sub(issued) > powValidity {
+		return fmt.Errorf("%w: proof-of-work challenge expired", errNotHuman)
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) < p.difficulty {
+		return fmt.Errorf("%w: proof-of-work nonce does not solve the challenge", errNotHuman)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c, at := range p.used {
+		if now.Sub(at) > powValidity {
+			delete(p.used, c)
+		}
+	}
+	if _, dup := p.used[challenge]; dup {
+		return fmt.Errorf("%w: proof-of-work challenge already used", errNotHuman)
+	}
+	p.used[challenge] = issued
+	return nil
+}
+
+// leadingZeroBits counts the zero bits at the start of sum.
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// handlePowChallenge issues a proof-of-work challenge for an anonymous API
+// create: find a nonce such that SHA-256 of "<challenge>:<nonce>" starts
+// with difficulty zero bits, then send both in the X-PoW-Challenge and
+// X-PoW-Nonce headers.
+func (s *Server) handlePowChallenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if s.pow == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"required": false})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"required":   true,
+		"challenge":  s.pow.challenge(time.Now()),
+		"difficulty": s.pow.difficulty,
+		"expires_in": int(powValidity.Seconds()),
+	})
+}
+
+// verifyPow checks the proof of work sent with an anonymous API create.
+func (s *Server) verifyPow(r *http.Request) error {
+	challenge, nonce := r.Header.Get("X-PoW-Challenge"), r.Header.Get("X-PoW-Nonce")
+	if challenge == "" || nonce == "" {
+		return fmt.Errorf("%w: anonymous requests need a proof of work from %s/api/pow", errNotHuman, s.uiPrefix)
+	}
+	return s.pow.redeem(challenge, nonce, time.Now())
+}
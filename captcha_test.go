@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// solvePow finds a nonce for challenge; clients do the same.
+func solvePow(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+func TestNewCaptcha(t *testing.T) {
+	tests := []struct {
+		cfg     CaptchaConfig
+		want    string
+		wantErr bool
+	}{
+		{CaptchaConfig{}, "", false},
+		{CaptchaConfig{Provider: "hcaptcha", SiteKey: "site", Secret: "s"}, "h-captcha-response", false},
+		{CaptchaConfig{Provider: "Turnstile", SiteKey: "site", Secret: "s"}, "cf-turnstile-response", false},
+		{CaptchaConfig{Provider: "turnstile", SiteKey: "site"}, "", true},
+		{CaptchaConfig{Provider: "recaptcha", SiteKey: "site", Secret: "s"}, "", true},
+		{CaptchaConfig{PowDifficulty: 33}, "", true},
+	}
+	for _, tt := range tests {
+		c, err := newCaptcha(tt.cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newCaptcha(%+v) error = %v", tt.cfg, err)
+			continue
+		}
+		field := ""
+		if c != nil {
+			field = c.Field
+		}
+		if field != tt.want {
+			t.Errorf("newCaptcha(%+v) field = %q, want %q", tt.cfg, field, tt.want)
+		}
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	if newPowIssuer(0) != nil {
+		t.Fatal("difficulty 0 should disable proof of work")
+	}
+	p := newPowIssuer(8)
+	now := time.Now()
+
+	challenge := p.challenge(now)
+	nonce := solvePow(challenge, 8)
+	if err := p.redeem(challenge, nonce, now); err != nil {
+		t.Fatalf("redeem() error: %v", err)
+	}
+	if err := p.redeem(challenge, nonce, now); !errors.Is(err, errNotHuman) {
+		t.Errorf("replayed challenge = %v, want errNotHuman", err)
+	}
+
+	fresh := p.challenge(now)
+	for n := 0; ; n++ {
+		if leadingZeroBits(sha256.Sum256([]byte(fresh+":"+strconv.Itoa(n)))) < 8 {
+			if err := p.redeem(fresh, strconv.Itoa(n), now); !errors.Is(err, errNotHuman) {
+				t.Errorf("wrong nonce = %v, want errNotHuman", err)
+			}
+			break
+		}
+	}
+
+	old := p.challenge(now.Add(-powValidity - time.Minute))
+	if err := p.redeem(old, solvePow(old, 8), now); !errors.Is(err, errNotHuman) {
+		t.Errorf("expired challenge = %v, want errNotHuman", err)
+	}
+
+	other := newPowIssuer(8)
+	forged := other.challenge(now)
+	if err := p.redeem(forged, solvePow(forged, 8), now); !errors.Is(err, errNotHuman) {
+		t.Errorf("forged challenge = %v, want errNotHuman", err)
+	}
+}
+
+func TestAnonymousAPICreateNeedsProofOfWork(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+	srv.pow = newPowIssuer(4)
+
+	create := func(headers map[string]string) int {
+		req := httptest.NewRequest("POST", "/sui/api/create", strings.NewReader(`{"url": "https://example.com"}`))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := create(nil); code != http.StatusForbidden {
+		t.Errorf("anonymous create without proof = %d, want 403", code)
+	}
+	if code := create(map[string]string{"X-API-Key": "k1"}); code != http.StatusOK {
+		t.Errorf("create with API key = %d, want 200", code)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/sui/api/pow", nil))
+	var pow struct {
+		Required   bool   `json:"required"`
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&pow); err != nil || !pow.Required || pow.Difficulty != 4 {
+		t.Fatalf("pow challenge = %+v, %v", pow, err)
+	}
+	proof := map[string]string{"X-PoW-Challenge": pow.Challenge, "X-PoW-Nonce": solvePow(pow.Challenge, pow.Difficulty)}
+	if code := create(proof); code != http.StatusOK {
+		t.Errorf("anonymous create with proof = %d, want 200", code)
+	}
+}
+
+func TestCreateFormCaptcha(t *testing.T) {
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok := r.FormValue("secret") == "s" && r.FormValue("response") == "solved"
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": ok, "error-codes": []string{}})
+	}))
+	defer verifier.Close()
+
+	srv := newTestServer(t)
+	var err error
+	if srv.captcha, err = newCaptcha(CaptchaConfig{Provider: "turnstile", SiteKey: "site", Secret: "s", Endpoint: verifier.URL}); err != nil {
+		t.Fatal(err)
+	}
+	srv.captchaSecret = "s"
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/sui/", nil))
+	if !strings.Contains(rr.Body.String(), `data-sitekey="site"`) {
+		t.Error("home page does not render the CAPTCHA widget")
+	}
+
+	post := func(token string, cookie *http.Cookie) int {
+		form := url.Values{"url": {"https://example.com"}, "cf-turnstile-response": {token}}
+		req := httptest.NewRequest("POST", "/sui/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := post("", nil); code != http.StatusForbidden {
+		t.Errorf("create without CAPTCHA = %d, want 403", code)
+	}
+	if code := post("forged", nil); code != http.StatusForbidden {
+		t.Errorf("create with a rejected CAPTCHA = %d, want 403", code)
+	}
+	if code := post("solved", nil); code != http.StatusOK {
+		t.Errorf("create with a solved CAPTCHA = %d, want 200", code)
+	}
+	if code := post("", loginAs(t, srv, "alice")); code != http.StatusOK {
+		t.Errorf("logged-in create = %d, want 200 without CAPTCHA", code)
+	}
+}
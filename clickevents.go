@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// clickEventsBucket keeps the most recent clicks of each link in a
+	// nested bucket keyed by sequence number; clickSourcesBucket counts
+	// clicks per referrer host and country in a nested bucket per link.
+	clickEventsBucket  = "click_events"
+	clickSourcesBucket = "click_sources"
+
+	// maxClickEvents is how many recent clicks are kept per link.
+	maxClickEvents = 100
+	// maxClickSources caps the distinct referrers and countries counted per
+	// link; clicks from further referrers are counted as otherReferrer.
+	maxClickSources = 500
+
+	referrerPrefix = "r:"
+	countryPrefix  = "c:"
+	otherReferrer  = "(other)"
+)
+
+// ClickEvent is one recorded click. Only the referring host and the
+// country are kept, never the client address.
+type ClickEvent struct {
+	At       time.Time `json:"at"`
+	Referrer string    `json:"referrer,omitempty"`
+	Country  string    `json:"country,omitempty"`
+}
+
+// clickEvent describes the click r made: the host of its Referer header,
+// and its country from the configured header when a trusted proxy sent it.
+func (s *Server) clickEvent(r *http.Request) ClickEvent {
+	click := ClickEvent{At: time.Now().UTC()}
+	if ref, err := url.Parse(r.Referer()); err == nil {
+		click.Referrer = strings.TrimPrefix(strings.ToLower(ref.Hostname()), "www.")
+	}
+	if s.countryHeader != "" && s.fromTrustedProxy(r) {
+		click.Country = normalizeCountry(r.Header.Get(s.countryHeader))
+	}
+	return click
+}
+
+// normalizeCountry returns code as an upper-case ISO 3166 alpha-2 code, or
+// "" when it isn't one. "XX", which proxies send for unknown locations, is
+// dropped too.
+func normalizeCountry(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code == "XX" || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+	return code
+}
+
+// recordClickEvent appends click to the recent clicks of short, dropping
+// the oldest beyond maxClickEvents, and counts its referrer and country.
+func recordClickEvent(tx *bolt.Tx, short string, click ClickEvent) error {
+	events, err := tx.Bucket([]byte(clickEventsBucket)).CreateBucketIfNotExists([]byte(short))
+	if err != nil {
+		return err
+	}
+	seq, err := events.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+	if err := events.Put(sequenceKey(seq), data); err != nil {
+		return err
+	}
+	// Every click removes the one maxClickEvents before it, so the bucket
+	// never holds more than that.
+	if seq > maxClickEvents {
+		if err := events.Delete(sequenceKey(seq - maxClickEvents)); err != nil {
+			return err
+		}
+	}
+
+	sources, err := tx.Bucket([]byte(clickSourcesBucket)).CreateBucketIfNotExists([]byte(short))
+	if err != nil {
+		return err
+	}
+	ref := referrerPrefix + click.Referrer
+	if sources.Get([]byte(ref)) == nil && sources.Stats().KeyN >= maxClickSources {
+		ref = referrerPrefix + otherReferrer
+	}
+	if err := addCount(sources, ref); err != nil {
+		return err
+	}
+	if click.Country != "" {
+		return addCount(sources, countryPrefix+click.Country)
+	}
+	return nil
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// addCount increments the big-endian counter under key in b.
+func addCount(b *bolt.Bucket, key string) error {
+	var count uint64
+	if v := b.Get([]byte(key)); len(v) == 8 {
+		count = binary.BigEndian.Uint64(v)
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, count+1)
+	return b.Put([]byte(key), buf)
+}
+
+// deleteClickEvents drops the recent clicks and source counters of short.
+func deleteClickEvents(tx *bolt.Tx, short string) error {
+	for _, name := range []string{clickEventsBucket, clickSourcesBucket} {
+		b := tx.Bucket([]byte(name))
+		if b.Bucket([]byte(short)) == nil {
+			continue
+		}
+		if err := b.DeleteBucket([]byte(short)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceCount is the number of clicks from one referrer or country.
+type sourceCount struct {
+	Name   string `json:"name"`
+	Clicks uint64 `json:"clicks"`
+}
+
+// clickSources returns the referrer and country counts of short, most
+// clicks first. Clicks without a referrer are listed under "".
+func clickSources(tx *bolt.Tx, short string) (referrers, countries []sourceCount) {
+	referrers, countries = []sourceCount{}, []sourceCount{}
+	b := tx.Bucket([]byte(clickSourcesBucket)).Bucket([]byte(short))
+	if b == nil {
+		return referrers, countries
+	}
+	b.ForEach(func(k, v []byte) error {
+		if len(v) != 8 {
+			return nil
+		}
+		count := binary.BigEndian.Uint64(v)
+		if name, ok := strings.CutPrefix(string(k), referrerPrefix); ok {
+			referrers = append(referrers, sourceCount{name, count})
+		} else if name, ok := strings.CutPrefix(string(k), countryPrefix); ok {
+			countries = append(countries, sourceCount{name, count})
+		}
+		return nil
+	})
+	for _, list := range [][]sourceCount{referrers, countries} {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Clicks > list[j].Clicks })
+	}
+	return referrers, countries
+}
+
+// recentClicks returns up to limit of the latest clicks on short, newest
+// first.
+func recentClicks(tx *bolt.Tx, short string, limit int) []ClickEvent {
+	clicks := []ClickEvent{}
+	b := tx.Bucket([]byte(clickEventsBucket)).Bucket([]byte(short))
+	if b == nil {
+		return clicks
+	}
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil && len(clicks) < limit; k, v = c.Prev() {
+		var click ClickEvent
+		if err := json.Unmarshal(v, &click); err == nil {
+			clicks = append(clicks, click)
+		}
+	}
+	return clicks
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestClickEvent(t *testing.T) {
+	srv := newTestServer(t)
+	srv.countryHeader = "CF-IPCountry"
+
+	tests := []struct {
+		remote, referer, country string
+		wantRef, wantCountry     string
+	}{
+		{"127.0.0.1:1234", "https://www.News.example/story?id=1", "de", "news.example", "DE"},
+		{"127.0.0.1:1234", "", "XX", "", ""},
+		{"127.0.0.1:1234", "", "Germany", "", ""},
+		// Only trusted proxies may claim a country.
+		{"203.0.113.9:1234", "https://t.co/x", "DE", "t.co", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/s/x", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("Referer", tt.referer)
+		req.Header.Set("CF-IPCountry", tt.country)
+		click := srv.clickEvent(req)
+		if click.Referrer != tt.wantRef || click.Country != tt.wantCountry || click.At.IsZero() {
+			t.Errorf("clickEvent(%s, %q, %q) = %+v", tt.remote, tt.referer, tt.country, click)
+		}
+	}
+}
+
+func TestRecordClickEvent(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "busy"}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < maxClickEvents+5; i++ {
+		click := ClickEvent{At: start.Add(time.Duration(i) * time.Second), Referrer: "a.example"}
+		if i%3 == 0 {
+			click.Referrer, click.Country = "", "FR"
+		}
+		srv.incrementClicks("busy", click)
+	}
+
+	srv.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket([]byte(clickEventsBucket)).Bucket([]byte("busy")).Stats().KeyN; n != maxClickEvents {
+			t.Errorf("kept %d recent clicks, want %d", n, maxClickEvents)
+		}
+		recent := recentClicks(tx, "busy", 3)
+		if len(recent) != 3 || !recent[0].At.Equal(start.Add((maxClickEvents+4)*time.Second)) || !recent[0].At.After(recent[1].At) {
+			t.Errorf("recentClicks() = %+v, want the newest first", recent)
+		}
+		referrers, countries := clickSources(tx, "busy")
+		if fmt.Sprint(referrers) != "[{a.example 70} { 35}]" || fmt.Sprint(countries) != "[{FR 35}]" {
+			t.Errorf("clickSources() = %v, %v", referrers, countries)
+		}
+		return nil
+	})
+
+	if err := srv.deleteLink("busy", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	// The events are kept while the deletion can be undone.
+	srv.db.Update(func(tx *bolt.Tx) error {
+		return purgeDeletedLinks(tx, time.Now().Add(undoDeleteWindow+time.Minute))
+	})
+	srv.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(clickEventsBucket)).Bucket([]byte("busy")) != nil || tx.Bucket([]byte(clickSourcesBucket)).Bucket([]byte("busy")) != nil {
+			t.Error("click events kept after the link was deleted")
+		}
+		return nil
+	})
+}
+
+func TestClickSourcesCapped(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "viral"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxClickSources+2; i++ {
+		srv.incrementClicks("viral", ClickEvent{At: time.Now(), Referrer: fmt.Sprintf("site%d.example", i)})
+	}
+	srv.db.View(func(tx *bolt.Tx) error {
+		referrers, _ := clickSources(tx, "viral")
+		if len(referrers) != maxClickSources+1 || referrers[0].Name != otherReferrer || referrers[0].Clicks != 2 {
+			t.Errorf("got %d referrers, first %+v; want the overflow counted as %s", len(referrers), referrers[0], otherReferrer)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// defaultClickFlushInterval is how long clicks wait to be written.
+	defaultClickFlushInterval = time.Second
+	// maxQueuedClicks is how many clicks may wait; the redirect that
+	// reaches it writes them all at once instead of queueing more.
+	maxQueuedClicks = 10000
+)
+
+// ClicksConfig tunes how clicks are written.
+type ClicksConfig struct {
+	// FlushInterval is how long clicks are queued before being written
+	// together, so redirects never wait for a write transaction; 0 writes
+	// each click as it happens.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// queuedClick is a click waiting to be written.
+type queuedClick struct {
+	short string
+	event ClickEvent
+}
+
+// clickQueue batches the clicks of redirects: the first click queued
+// schedules a flush after the interval, which writes every click queued by
+// then in one transaction. A nil *clickQueue queues nothing, which is how
+// batching is disabled.
+type clickQueue struct {
+	interval time.Duration
+	write    func([]queuedClick) error
+
+	mu      sync.Mutex
+	pending []queuedClick
+	timer   *time.Timer
+	closed  bool
+}
+
+// newClickQueue returns a queue writing clicks with write every interval,
+// or nil when interval is zero or negative.
+func newClickQueue(interval time.Duration, write func([]queuedClick) error) *clickQueue {
+	if interval <= 0 {
+		return nil
+	}
+	return &clickQueue{interval: interval, write: write}
+}
+
+// add queues a click. Once the queue is full or closed, clicks are written
+// right away, so a burst slows redirects down rather than piling up.
+func (q *clickQueue) add(c queuedClick) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.writeBatch([]queuedClick{c})
+		return
+	}
+	q.pending = append(q.pending, c)
+	full := len(q.pending) >= maxQueuedClicks
+	if q.timer == nil && !full {
+		q.timer = time.AfterFunc(q.interval, func() { q.flush() })
+	}
+	q.mu.Unlock()
+	if full {
+		q.flush()
+	}
+}
+
+// flush writes the queued clicks, returning how many could not be.
+func (q *clickQueue) flush() (dropped int) {
+	if q == nil {
+		return 0
+	}
+	return q.writeBatch(q.take())
+}
+
+// drain is flush giving up once ctx is done, when the clicks still being
+// written count as dropped.
+func (q *clickQueue) drain(ctx context.Context) (dropped int) {
+	if q == nil {
+		return 0
+	}
+	batch := q.take()
+	done := make(chan int, 1)
+	go func() { done <- q.writeBatch(batch) }()
+	select {
+	case dropped := <-done:
+		return dropped
+	case <-ctx.Done():
+		return len(batch)
+	}
+}
+
+// take empties the queue, returning the clicks it held.
+func (q *clickQueue) take() []queuedClick {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	batch := q.pending
+	q.pending = nil
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	return batch
+}
+
+func (q *clickQueue) writeBatch(batch []queuedClick) (dropped int) {
+	if len(batch) == 0 {
+		return 0
+	}
+	if err := q.write(batch); err != nil {
+		slog.Error("failed to write clicks", "clicks", len(batch), "err", err)
+		return len(batch)
+	}
+	return 0
+}
+
+// close writes the queued clicks; later ones are written as they come.
+func (q *clickQueue) close() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.flush()
+}
+
+// countClick records a click on short, queued when batching is enabled.
+func (s *Server) countClick(short string, click ClickEvent) {
+	if s.clickQueue == nil {
+		s.incrementClicks(short, click)
+		return
+	}
+	s.clickQueue.add(queuedClick{short: short, event: click})
+}
+
+// incrementClicks records a click on short right away.
+func (s *Server) incrementClicks(short string, click ClickEvent) {
+	s.writeClicks([]queuedClick{{short: short, event: click}})
+}
+
+// writeClicks records clicks in one transaction, shared through db.Batch
+// with other writes of clicks happening at the same time. Clicks on links
+// deleted since are dropped. Live event subscribers are told the new
+// total of each link clicked.
+func (s *Server) writeClicks(clicks []queuedClick) error {
+	var clicked []*Link
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		// Batch runs the function again on its own if the shared
+		// transaction fails.
+		clicked = nil
+		b := tx.Bucket([]byte(bucketName))
+		var order []string
+		counts := make(map[string]uint64)
+		for _, c := range clicks {
+			if b.Get([]byte(c.short)) == nil {
+				continue
+			}
+			if counts[c.short] == 0 {
+				order = append(order, c.short)
+			}
+			counts[c.short]++
+			if err := recordDailyClick(tx, c.short, c.event.At); err != nil {
+				return err
+			}
+			if err := recordClickEvent(tx, c.short, c.event); err != nil {
+				return err
+			}
+		}
+		for _, short := range order {
+			if err := addClicks(tx, short, counts[short]); err != nil {
+				return err
+			}
+			if !s.events.active() {
+				continue
+			}
+			var link Link
+			if err := json.Unmarshal(b.Get([]byte(short)), &link); err == nil {
+				loadClicks(tx, &link)
+				clicked = append(clicked, &link)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, link := range clicked {
+		s.events.publish(link)
+	}
+	return nil
+}
+
+// drainClicks writes the queued clicks on shutdown.
+func (s *Server) drainClicks(ctx context.Context) int {
+	return s.clickQueue.drain(ctx)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClickQueue(t *testing.T) {
+	var written [][]queuedClick
+	q := newClickQueue(time.Hour, func(batch []queuedClick) error {
+		written = append(written, batch)
+		return nil
+	})
+
+	q.add(queuedClick{short: "a"})
+	q.add(queuedClick{short: "b"})
+	if len(written) != 0 {
+		t.Fatalf("clicks written before the flush: %v", written)
+	}
+	if dropped := q.flush(); dropped != 0 || len(written) != 1 || len(written[0]) != 2 {
+		t.Fatalf("flush() = %d, wrote %v, want one batch of 2", dropped, written)
+	}
+
+	q.add(queuedClick{short: "c"})
+	q.close()
+	q.add(queuedClick{short: "d"})
+	if len(written) != 3 || written[1][0].short != "c" || written[2][0].short != "d" {
+		t.Errorf("after close wrote %v, want c then d right away", written)
+	}
+
+	if newClickQueue(0, nil) != nil {
+		t.Error("expected nil queue for a zero interval")
+	}
+}
+
+func TestClickQueueFlushesAfterInterval(t *testing.T) {
+	done := make(chan int, 1)
+	q := newClickQueue(10*time.Millisecond, func(batch []queuedClick) error {
+		done <- len(batch)
+		return nil
+	})
+	q.add(queuedClick{short: "a"})
+	q.add(queuedClick{short: "a"})
+	select {
+	case n := <-done:
+		if n != 2 {
+			t.Errorf("flushed %d clicks, want 2", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued clicks were not flushed")
+	}
+}
+
+func TestClickQueueDrainGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	q := newClickQueue(time.Hour, func(batch []queuedClick) error {
+		<-release
+		return nil
+	})
+	q.add(queuedClick{short: "a"})
+	q.add(queuedClick{short: "b"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if dropped := q.drain(ctx); dropped != 2 {
+		t.Errorf("drain() = %d, want the 2 clicks still being written", dropped)
+	}
+	if dropped := q.drain(context.Background()); dropped != 0 {
+		t.Errorf("drain() of an empty queue = %d, want 0", dropped)
+	}
+}
+
+func TestRedirectQueuesClicks(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DBPath = filepath.Join(t.TempDir(), "links.db")
+	cfg.Clicks.FlushInterval = time.Hour
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	srv.setupRoutes()
+
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "queued"}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/queued", nil))
+		if rr.Code != http.StatusFound {
+			t.Fatalf("redirect status = %d, want %d", rr.Code, http.StatusFound)
+		}
+	}
+	clicks := func() int {
+		link, err := srv.getLink("queued")
+		if err != nil {
+			t.Fatalf("getLink() error: %v", err)
+		}
+		return link.Clicks
+	}
+	if n := clicks(); n != 0 {
+		t.Errorf("clicks before the flush = %d, want 0", n)
+	}
+
+	// Maintenance mode writes what was queued before it starts.
+	srv.setMaintenance(true, "")
+	if n := clicks(); n != 3 {
+		t.Errorf("clicks after the flush = %d, want 3", n)
+	}
+	counts, err := srv.getDailyClicks("queued", statsDays(time.Now(), 1))
+	if err != nil || len(counts) != 1 || counts[0] != 3 {
+		t.Errorf("getDailyClicks() = %v, %v, want 3 clicks today", counts, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const clicksBucket = "clicks"
+
+// Click totals are kept in their own bucket as raw big-endian uint64 values
+// keyed by short code. Redirects only touch this counter, so they never
+// rewrite (and never race with edits to) the link's JSON record. The Clicks
+// field stored inside the link JSON is no longer authoritative; readers fill
+// it in from this bucket via loadClicks.
+
+// clickCount returns the stored click total for short.
+func clickCount(tx *bolt.Tx, short string) uint64 {
+	v := tx.Bucket([]byte(clicksBucket)).Get([]byte(short))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// addClicks adds n to the click total for short.
+func addClicks(tx *bolt.Tx, short string, n uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, clickCount(tx, short)+n)
+	return tx.Bucket([]byte(clicksBucket)).Put([]byte(short), buf)
+}
+
+// loadClicks sets link.Clicks from the clicks bucket.
+func loadClicks(tx *bolt.Tx, link *Link) {
+	link.Clicks = int(clickCount(tx, link.Short))
+}
+
+// migrateClicks copies click totals embedded in link JSON into the clicks
+// bucket. It is used when opening a database created before the bucket
+// existed.
+func migrateClicks(tx *bolt.Tx) error {
+	return tx.Bucket([]byte(bucketName)).ForEach(func(k, v []byte) error {
+		var link Link
+		if err := json.Unmarshal(v, &link); err != nil {
+			return err
+		}
+		if link.Clicks <= 0 {
+			return nil
+		}
+		return addClicks(tx, link.Short, uint64(link.Clicks))
+	})
+}
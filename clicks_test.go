@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIncrementClicksUsesCounterBucket(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "counted"}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		srv.incrementClicks("counted", ClickEvent{At: time.Now()})
+	}
+	srv.incrementClicks("missing", ClickEvent{At: time.Now()})
+
+	links, err := srv.getAllLinks(nil)
+	if err != nil {
+		t.Fatalf("getAllLinks() error: %v", err)
+	}
+	if len(links) != 1 || links[0].Clicks != 3 {
+		t.Fatalf("expected 3 clicks, got %+v", links)
+	}
+
+	// The stored link JSON must not be rewritten by redirects.
+	srv.db.View(func(tx *bolt.Tx) error {
+		var stored Link
+		json.Unmarshal(tx.Bucket([]byte(bucketName)).Get([]byte("counted")), &stored)
+		if stored.Clicks != 0 {
+			t.Errorf("link JSON clicks = %d, want 0", stored.Clicks)
+		}
+		if tx.Bucket([]byte(clicksBucket)).Get([]byte("missing")) != nil {
+			t.Error("clicks on unknown links should not be recorded")
+		}
+		return nil
+	})
+}
+
+func TestMigrateClicks(t *testing.T) {
+	srv := newTestServer(t)
+
+	// Simulate a database written before the clicks bucket existed.
+	err := srv.db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(Link{Short: "legacy", Original: "https://example.com", CreatedAt: time.Now(), Clicks: 42})
+		if err := tx.Bucket([]byte(bucketName)).Put([]byte("legacy"), data); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket([]byte(clicksBucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(clicksBucket)); err != nil {
+			return err
+		}
+		return migrateClicks(tx)
+	})
+	if err != nil {
+		t.Fatalf("migration error: %v", err)
+	}
+
+	links, err := srv.getAllLinks(nil)
+	if err != nil {
+		t.Fatalf("getAllLinks() error: %v", err)
+	}
+	if len(links) != 1 || links[0].Clicks != 42 {
+		t.Errorf("expected migrated 42 clicks, got %+v", links)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// clientTimeout bounds each request of the client commands.
+const clientTimeout = 30 * time.Second
+
+// apiClient calls the API of a remote instance for the client commands
+// "shorten" and "ls".
+type apiClient struct {
+	// base is the URL of the instance's UI, e.g. https://sho.rt/sui.
+	base   string
+	token  string
+	client *http.Client
+}
+
+// newAPIClient returns a client of the instance at server, authenticating
+// with token when set. A server URL without a path gets the default UI
+// prefix.
+func newAPIClient(server, token string) (*apiClient, error) {
+	if server == "" {
+		return nil, fmt.Errorf("no server given: use -server or PK_SHORTS_SERVER")
+	}
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q: want e.g. https://sho.rt", server)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = defaultUIPrefix
+	}
+	return &apiClient{
+		base:   strings.TrimSuffix(u.String(), "/"),
+		token:  token,
+		client: &http.Client{Timeout: clientTimeout},
+	}, nil
+}
+
+// do sends a request to the API path and decodes the JSON answer into
+// out, turning error statuses into errors carrying the server's message.
+func (c *apiClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// shortenResult is the answer of /api/create the client uses.
+type shortenResult struct {
+	ShortURL    string `json:"short_url"`
+	DeleteToken string `json:"delete_token"`
+}
+
+func (c *apiClient) shorten(destination, customID string, secure bool) (shortenResult, error) {
+	var res shortenResult
+	req := map[string]interface{}{"url": destination, "custom_id": customID, "secure": secure}
+	err := c.do("POST", "/api/create", req, &res)
+	return res, err
+}
+
+// list returns the newest limit links the token may see.
+func (c *apiClient) list(limit int) ([]Link, error) {
+	var links []Link
+	err := c.do("GET", "/api/list?limit="+strconv.Itoa(limit), nil, &links)
+	return links, err
+}
+
+// clientFlags are the flags shared by the client commands; the server and
+// token default to PK_SHORTS_SERVER and PK_SHORTS_TOKEN.
+type clientFlags struct {
+	server, token *string
+}
+
+func newClientFlags(fs *flag.FlagSet) clientFlags {
+	return clientFlags{
+		server: fs.String("server", os.Getenv("PK_SHORTS_SERVER"), "URL of the instance, e.g. https://sho.rt (env PK_SHORTS_SERVER)"),
+		token:  fs.String("token", os.Getenv("PK_SHORTS_TOKEN"), "API key to authenticate with (env PK_SHORTS_TOKEN)"),
+	}
+}
+
+func (f clientFlags) client() (*apiClient, error) {
+	return newAPIClient(*f.server, *f.token)
+}
+
+// parseInterspersed parses args with fs, accepting flags after positional
+// arguments too, as in "shorten https://example.com -custom docs", and
+// returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// runShorten implements the "shorten" command, which creates a link on a
+// remote instance and prints its short URL.
+func runShorten(args []string) error {
+	fs := flag.NewFlagSet("shorten", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s shorten <url> [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	flags := newClientFlags(fs)
+	customID := fs.String("custom", "", "custom short ID")
+	secure := fs.Bool("secure", false, "generate a longer, hard to guess ID")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("shorten takes exactly one URL")
+	}
+
+	client, err := flags.client()
+	if err != nil {
+		return err
+	}
+	res, err := client.shorten(positional[0], *customID, *secure)
+	if err != nil {
+		return err
+	}
+	fmt.Println(res.ShortURL)
+	if res.DeleteToken != "" {
+		fmt.Fprintf(os.Stderr, "Delete token: %s\n", res.DeleteToken)
+	}
+	return nil
+}
+
+// runList implements the "ls" command, which prints the newest links of
+// a remote instance.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	flags := newClientFlags(fs)
+	limit := fs.Int("limit", 20, "how many of the newest links to show")
+	parseInterspersed(fs, args)
+	if *limit <= 0 {
+		return fmt.Errorf("invalid limit %d", *limit)
+	}
+
+	client, err := flags.client()
+	if err != nil {
+		return err
+	}
+	links, err := client.list(*limit)
+	if err != nil {
+		return err
+	}
+	printLinks(os.Stdout, links)
+	return nil
+}
+
+// printLinks writes links as a table of short code, clicks, creation date
+// and destination.
+func printLinks(w io.Writer, links []Link) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SHORT\tCLICKS\tCREATED\tDESTINATION")
+	for _, link := range links {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", link.Short, link.Clicks, link.CreatedAt.Format(time.DateOnly), link.Original)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIClient(t *testing.T) {
+	tests := []struct {
+		server   string
+		wantBase string
+		wantErr  bool
+	}{
+		{"https://sho.rt", "https://sho.rt/sui", false},
+		{"https://sho.rt/", "https://sho.rt/sui", false},
+		{"https://sho.rt/links/ui/", "https://sho.rt/links/ui", false},
+		{"", "", true},
+		{"sho.rt", "", true},
+		{"ftp://sho.rt", "", true},
+	}
+	for _, tt := range tests {
+		c, err := newAPIClient(tt.server, "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newAPIClient(%q) error = %v, wantErr %v", tt.server, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && c.base != tt.wantBase {
+			t.Errorf("newAPIClient(%q) base = %q, want %q", tt.server, c.base, tt.wantBase)
+		}
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("shorten", flag.ContinueOnError)
+	custom := fs.String("custom", "", "")
+	got := parseInterspersed(fs, []string{"https://example.com", "-custom", "docs"})
+	if !reflect.DeepEqual(got, []string{"https://example.com"}) || *custom != "docs" {
+		t.Errorf("parseInterspersed() = %q with custom %q", got, *custom)
+	}
+}
+
+func TestAPIClient(t *testing.T) {
+	t.Setenv("API_KEYS", "cli:s3cret")
+	t.Setenv("DISABLE_ANONYMOUS_CREATE", "true")
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.router)
+	defer ts.Close()
+
+	anonymous, _ := newAPIClient(ts.URL, "")
+	if _, err := anonymous.shorten("https://example.com", "", false); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("anonymous shorten error = %v, want 401", err)
+	}
+
+	client, err := newAPIClient(ts.URL, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.shorten("example.com/docs", "docs", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ShortURL != ts.URL+"/s/docs" {
+		t.Errorf("short URL = %q, want %q", res.ShortURL, ts.URL+"/s/docs")
+	}
+	if _, err := client.shorten("https://example.com/other", "docs", false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("taken custom ID error = %v", err)
+	}
+
+	links, err := client.list(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Short != "docs" || links[0].Original != "https://example.com/docs" {
+		t.Fatalf("list() = %+v, want the new link", links)
+	}
+
+	var sb strings.Builder
+	links[0].CreatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	printLinks(&sb, links)
+	if want := "docs   0       2024-05-01  https://example.com/docs"; !strings.Contains(sb.String(), want) {
+		t.Errorf("printLinks() = %q, want a row %q", sb.String(), want)
+	}
+}
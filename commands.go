@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand of the binary. Each one parses its own flags
+// from args, usually with newConfigFlags so it reads the same
+// configuration as the server.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands returns the subcommands in the order they are listed in the
+// usage text.
+func commands() []command {
+	return []command{
+		{"serve", "run the server (the default when no command is given)", runServe},
+		{"migrate", "apply pending database migrations and exit", runMigrate},
+		{"import", "load links from a JSON file into the database", runImport},
+		{"export", "write links as JSON or as nginx/Caddy redirects", runExport},
+		{"backup", "copy the database to a file", runBackup},
+		{"compact", "rewrite the database to reclaim free space", runCompact},
+		{"healthcheck", "check that the local server is ready", runHealthcheck},
+		{"shorten", "shorten a link on a remote instance", runShorten},
+		{"ls", "list the newest links of a remote instance", runList},
+		{"loadtest", "send requests to a running instance at a steady rate and report latency", runLoadtest},
+		{"discord-register", "register the Discord slash commands of the configured application", runDiscordRegister},
+		{"help", "show this help", runHelp},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-17s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun \"%s <command> -h\" for the flags of a command.\n", os.Args[0])
+}
+
+func runHelp(args []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
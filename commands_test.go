@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"serve", "migrate", "import", "export", "backup", "compact", "healthcheck", "shorten", "ls", "loadtest", "discord-register", "help"} {
+		if cmd, ok := findCommand(name); !ok || cmd.run == nil {
+			t.Errorf("findCommand(%q) not found", name)
+		}
+	}
+	if _, ok := findCommand("frobnicate"); ok {
+		t.Error("findCommand() found an unknown command")
+	}
+
+	var sb strings.Builder
+	printUsage(&sb)
+	for _, cmd := range commands() {
+		if !strings.Contains(sb.String(), cmd.name) {
+			t.Errorf("usage does not list %q", cmd.name)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// compactTxMaxSize bounds how much data bolt.Compact copies per transaction,
+// keeping memory use flat for large databases.
+const compactTxMaxSize = 64 * 1024 * 1024
+
+// compactDB rewrites the database at path into a fresh file, dropping the
+// free pages left behind by deleted links, and atomically replaces the
+// original. It returns the file size before and after.
+func compactDB(path string) (before, after int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	before = info.Size()
+
+	src, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open database (is the server still running?): %w", err)
+	}
+	defer src.Close()
+
+	tmpPath := path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, info.Mode().Perm(), &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create compacted database: %w", err)
+	}
+
+	if err := bolt.Compact(dst, src, compactTxMaxSize); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("failed to compact database: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("failed to replace database: %w", err)
+	}
+
+	info, err = os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return before, info.Size(), nil
+}
+
+// runCompact implements the "compact" command.
+func runCompact(args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	dbFile := cfg.DBPath
+
+	before, after, err := compactDB(dbFile)
+	if err != nil {
+		return err
+	}
+
+	saved := before - after
+	pct := 0.0
+	if before > 0 {
+		pct = float64(saved) / float64(before) * 100
+	}
+	fmt.Printf("Compacted %s: %d bytes -> %d bytes (reclaimed %d bytes, %.1f%%)\n", dbFile, before, after, saved, pct)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCompactDB(t *testing.T) {
+	srv := newTestServer(t)
+
+	for i := 0; i < 500; i++ {
+		if _, err := srv.createShortLink(fmt.Sprintf("https://example.com/%d", i), createOptions{CustomID: fmt.Sprintf("link-%d", i)}); err != nil {
+			t.Fatalf("createShortLink() error: %v", err)
+		}
+	}
+	for i := 0; i < 490; i++ {
+		if err := srv.deleteLink(fmt.Sprintf("link-%d", i), "", ""); err != nil {
+			t.Fatalf("deleteLink() error: %v", err)
+		}
+	}
+	path := srv.db.Path()
+	srv.Close()
+
+	before, after, err := compactDB(path)
+	if err != nil {
+		t.Fatalf("compactDB() error: %v", err)
+	}
+	if after >= before {
+		t.Errorf("expected compaction to shrink the file: before %d, after %d", before, after)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Error("temporary compaction file should be removed")
+	}
+
+	t.Setenv("DB_PATH", path)
+	reopened, err := NewServer(testConfig(t))
+	if err != nil {
+		t.Fatalf("NewServer() after compaction error: %v", err)
+	}
+	defer reopened.Close()
+
+	links, err := reopened.getAllLinks(nil)
+	if err != nil {
+		t.Fatalf("getAllLinks() error: %v", err)
+	}
+	if len(links) != 10 {
+		t.Errorf("expected 10 links after compaction, got %d", len(links))
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressMinBytes is the smallest response worth compressing; below it
+// the gzip header and checksum outweigh the savings.
+const compressMinBytes = 1024
+
+// compressibleTypes are the media types compressMiddleware compresses.
+// Images other than SVG, fonts and archives are compressed already.
+var compressibleTypes = map[string]bool{
+	"text/html":                 true,
+	"text/plain":                true,
+	"text/csv":                  true,
+	"text/css":                  true,
+	"text/javascript":           true,
+	"text/xml":                  true,
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/problem+json":  true,
+	"application/manifest+json": true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+}
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// acceptsGzip reports whether the Accept-Encoding header h allows gzip.
+func acceptsGzip(h string) bool {
+	for _, part := range strings.Split(h, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compressMiddleware gzips text responses, such as pages, the list API and
+// exports, for clients that accept it. Redirects and other responses
+// without a body worth compressing are sent as they are, as are responses
+// smaller than compressMinBytes.
+func (s *Server) compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.disableCompression || r.Method == http.MethodHead || r.Header.Get("Range") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, status: http.StatusOK}
+		defer cw.finish()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds back the start of a response until it knows
+// whether to compress it: once compressMinBytes are written, or the
+// handler flushes or returns.
+type compressWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.status = status
+	// Informational responses don't end the headers, and a response
+	// without a body has nothing to compress.
+	if status < http.StatusOK {
+		c.ResponseWriter.WriteHeader(status)
+		c.wroteHeader = false
+		return
+	}
+	if !c.bodyAllowed() {
+		c.decide(false)
+	}
+}
+
+// bodyAllowed reports whether the status may carry a body worth
+// compressing; redirects never get one.
+func (c *compressWriter) bodyAllowed() bool {
+	return c.status != http.StatusNoContent && c.status != http.StatusNotModified &&
+		(c.status < 300 || c.status >= 400)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.decided {
+		if c.gz != nil {
+			return c.gz.Write(p)
+		}
+		return c.ResponseWriter.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= compressMinBytes {
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide sends the headers, compressing the response if want allows and
+// its type is compressible, then what was held back.
+func (c *compressWriter) decide(want bool) error {
+	c.decided = true
+	h := c.Header()
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if compressibleTypes[mediaType] && c.bodyAllowed() {
+		h.Add("Vary", "Accept-Encoding")
+		if want && h.Get("Content-Encoding") == "" {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+				h.Set("ETag", "W/"+etag)
+			}
+			c.gz = gzipWriters.Get().(*gzip.Writer)
+			c.gz.Reset(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	if len(c.buf) == 0 {
+		return nil
+	}
+	buf := c.buf
+	c.buf = nil
+	if c.gz != nil {
+		_, err := c.gz.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends what was written so far, deciding on compression if the
+// handler streams before writing compressMinBytes. Event streams are not
+// compressible, so they are always sent as they are.
+func (c *compressWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		c.decide(len(c.buf) > 0)
+	}
+	if c.gz != nil {
+		c.gz.Flush()
+	}
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// finish ends the response once the handler returns.
+func (c *compressWriter) finish() {
+	if !c.wroteHeader && len(c.buf) == 0 {
+		return
+	}
+	if !c.decided {
+		c.decide(false)
+	}
+	if c.gz != nil {
+		c.gz.Close()
+		c.gz.Reset(io.Discard)
+		gzipWriters.Put(c.gz)
+		c.gz = nil
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
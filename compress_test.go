@@ -0,0 +1,94 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8, br", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	for i := 0; i < 30; i++ {
+		if _, err := srv.createShortLink(fmt.Sprintf("https://example.com/page/%d", i), createOptions{Owner: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "home"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.AddCookie(cookie)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/sui/api/list", "gzip")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Vary") == "" {
+		t.Fatalf("list API: status %d, headers %v; want gzip", rr.Code, rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if plain := get("/sui/api/list", ""); plain.Header().Get("Content-Encoding") != "" || plain.Body.String() != string(body) {
+		t.Errorf("uncompressed list differs or is compressed: %v", plain.Header())
+	}
+
+	if rr := get("/sui/list", "gzip"); rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("list page not compressed: %v", rr.Header())
+	}
+	if rr := get("/s/home", "gzip"); rr.Code != http.StatusFound || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("redirect: status %d, headers %v; want it uncompressed", rr.Code, rr.Header())
+	}
+	if rr := get("/healthz", "gzip"); rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("small response compressed: %v", rr.Header())
+	}
+}
+
+func TestCompressWriterFlush(t *testing.T) {
+	handler := (&Server{}).compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, strings.Repeat("data: x\n\n", 200))
+	}))
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if !rr.Flushed || rr.Header().Get("Content-Encoding") != "" || !strings.HasPrefix(rr.Body.String(), "data: 1\n\n") {
+		t.Errorf("event stream: flushed %v, headers %v; want it flushed uncompressed", rr.Flushed, rr.Header())
+	}
+}
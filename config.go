@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the static configuration of an instance. It is read from an
+// optional YAML file given with --config; environment variables override
+// the values from the file, so containers can still be configured without
+// one. Settings saved from the admin panel in turn override the quota,
+// registration, anonymous-creation and blocklist defaults given here.
+type Config struct {
+	Port        string `yaml:"port"`
+	DBPath      string `yaml:"db_path"`
+	ShortPrefix string `yaml:"short_prefix"`
+	UIPrefix    string `yaml:"ui_prefix"`
+	ReadOnly    bool   `yaml:"read_only"`
+	// Maintenance starts the server in maintenance mode, which admins can
+	// turn off through the API.
+	Maintenance bool `yaml:"maintenance"`
+	// BaseURL is the external URL of the instance, such as
+	// "https://go.example.com", used for the short URLs shown to users.
+	// When empty it is derived from each request.
+	BaseURL string `yaml:"base_url"`
+	// UIDir optionally overrides the embedded templates and static files
+	// with those found in its templates/ and static/ subdirectories.
+	UIDir string `yaml:"ui_dir"`
+	// DebugAddr, when set, serves pprof and expvar on this loopback
+	// address, e.g. "localhost:6060".
+	DebugAddr string `yaml:"debug_addr"`
+	// TrustedProxies lists the CIDR ranges of reverse proxies allowed to
+	// set X-Forwarded-For and X-Forwarded-Proto.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// CountryHeader names the header trusted proxies send the client's
+	// country code in, for click statistics.
+	CountryHeader string `yaml:"country_header"`
+	// Access restricts the UI and admin routes to client IP ranges.
+	Access AccessConfig `yaml:"access"`
+	// Domains are extra hostnames serving their own short links.
+	Domains []DomainConfig `yaml:"domains"`
+	// AppLinks are the association files letting native apps open short
+	// links.
+	AppLinks AppLinksConfig `yaml:"app_links"`
+	// Destinations restricts the URLs links may point to.
+	Destinations DestinationConfig `yaml:"destinations"`
+	// ExternalWarning confirms redirects to untrusted destinations.
+	ExternalWarning ExternalWarningConfig `yaml:"external_warning"`
+	// Branding white-labels the UI.
+	Branding BrandingConfig `yaml:"branding"`
+	// Metadata fetches destination titles and icons for the list page.
+	Metadata MetadataConfig `yaml:"metadata"`
+	// IDs shapes the randomly generated short codes.
+	IDs IDConfig `yaml:"ids"`
+
+	TLS       TLSConfig       `yaml:"tls"`
+	Log       LogConfig       `yaml:"log"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Clicks    ClicksConfig    `yaml:"clicks"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Quota     Quota           `yaml:"quota"`
+
+	SafeBrowsing SafeBrowsingConfig `yaml:"safe_browsing"`
+	Captcha      CaptchaConfig      `yaml:"captcha"`
+	Ephemeral    EphemeralConfig    `yaml:"ephemeral"`
+	Slack        SlackConfig        `yaml:"slack"`
+	Discord      DiscordConfig      `yaml:"discord"`
+	Shlink       ShlinkConfig       `yaml:"shlink"`
+	Bitly        BitlyConfig        `yaml:"bitly"`
+	YOURLS       YOURLSConfig       `yaml:"yourls"`
+	Email        EmailConfig        `yaml:"email"`
+
+	ReservedPrefixes []ReservedPrefixConfig `yaml:"reserved_prefixes"`
+	ReservedWords    []string               `yaml:"reserved_words"`
+	BlockedDomains   []string               `yaml:"blocked_domains"`
+	AllowedDomains   []string               `yaml:"allowed_domains"`
+	// RequireDeleteReason makes deletions state a reason; see Settings.
+	RequireDeleteReason bool `yaml:"require_delete_reason"`
+	// DisableCompression sends responses without gzip, for when a reverse
+	// proxy compresses them.
+	DisableCompression bool `yaml:"disable_compression"`
+}
+
+// CacheConfig sizes the redirect cache.
+type CacheConfig struct {
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+// AuthConfig covers who may use the instance and how they log in.
+type AuthConfig struct {
+	AdminToken             string         `yaml:"admin_token"`
+	AdminUser              string         `yaml:"admin_user"`
+	APIKeys                []APIKeyConfig `yaml:"api_keys"`
+	DisableRegistration    bool           `yaml:"disable_registration"`
+	DisableAnonymousCreate bool           `yaml:"disable_anonymous_create"`
+	LDAP                   LDAPConfig     `yaml:"ldap"`
+}
+
+// APIKeyConfig is a static API key identifying a system by name.
+type APIKeyConfig struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// ReservedPrefixConfig reserves custom IDs starting with Prefix for the
+// named API key systems, or for nobody when Systems is empty.
+type ReservedPrefixConfig struct {
+	Prefix  string   `yaml:"prefix"`
+	Systems []string `yaml:"systems"`
+}
+
+// defaultConfig returns the configuration used when neither a file nor
+// the environment sets a value.
+func defaultConfig() *Config {
+	return &Config{
+		Port:           "8080",
+		DBPath:         defaultDBFile,
+		ShortPrefix:    defaultPrefix,
+		UIPrefix:       defaultUIPrefix,
+		TLS:            TLSConfig{Autocert: AutocertConfig{CacheDir: "autocert-cache", HTTPPort: "80"}},
+		Log:            LogConfig{Level: "info", Format: "text"},
+		Database:       defaultDatabase(),
+		Cache:          CacheConfig{Size: defaultCacheSize, TTL: defaultCacheTTL},
+		Clicks:         ClicksConfig{FlushInterval: defaultClickFlushInterval},
+		Limits:         defaultLimits(),
+		Destinations:   defaultDestinations(),
+		Metadata:       MetadataConfig{RefreshInterval: defaultMetadataRefreshInterval},
+		SafeBrowsing:   SafeBrowsingConfig{RescanInterval: defaultRescanInterval},
+		Ephemeral:      EphemeralConfig{MaxTTL: defaultEphemeralMaxTTL},
+		Email:          EmailConfig{Mailbox: "INBOX", PollInterval: defaultEmailPollInterval},
+		TrustedProxies: append([]string(nil), defaultTrustedProxies...),
+	}
+}
+
+// loadConfig builds the configuration from the defaults, the YAML file at
+// path (skipped when path is empty) and the environment, in that order.
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the environment variables
+// that are set to a non-empty value.
+func (c *Config) applyEnv() error {
+	envString(&c.Port, "PORT")
+	envString(&c.DBPath, "DB_PATH")
+	envString(&c.ShortPrefix, "SHORT_PREFIX")
+	envString(&c.UIPrefix, "UI_PREFIX")
+	envBool(&c.ReadOnly, "READ_ONLY")
+	envBool(&c.Maintenance, "MAINTENANCE")
+	envString(&c.BaseURL, "BASE_URL")
+	envString(&c.UIDir, "UI_DIR")
+	envString(&c.Branding.Name, "BRAND_NAME")
+	envString(&c.Branding.LogoURL, "BRAND_LOGO_URL")
+	envString(&c.Branding.AccentColor, "BRAND_ACCENT_COLOR")
+	envString(&c.Branding.Footer, "BRAND_FOOTER")
+	envBool(&c.Metadata.Enabled, "FETCH_METADATA")
+	envBool(&c.Metadata.Passthrough, "METADATA_PASSTHROUGH")
+	if v := os.Getenv("METADATA_REFRESH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid METADATA_REFRESH_INTERVAL: %w", err)
+		}
+		c.Metadata.RefreshInterval = d
+	}
+	envString(&c.IDs.Strategy, "ID_STRATEGY")
+	envString(&c.IDs.Alphabet, "ID_ALPHABET")
+	envBool(&c.IDs.ExcludeConfusable, "ID_EXCLUDE_CONFUSABLE")
+	envBool(&c.IDs.CaseInsensitive, "ID_CASE_INSENSITIVE")
+	envString(&c.DebugAddr, "DEBUG_ADDR")
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		c.TrustedProxies = strings.Split(v, ",")
+	}
+	envString(&c.CountryHeader, "COUNTRY_HEADER")
+	if v := os.Getenv("UI_ALLOWED_IPS"); v != "" {
+		c.Access.UI = strings.Split(v, ",")
+	}
+	if v := os.Getenv("ADMIN_ALLOWED_IPS"); v != "" {
+		c.Access.Admin = strings.Split(v, ",")
+	}
+	envString(&c.TLS.Cert, "TLS_CERT")
+	envString(&c.TLS.Key, "TLS_KEY")
+	if v := os.Getenv("AUTOCERT_DOMAINS"); v != "" {
+		c.TLS.Autocert.Domains = strings.Split(v, ",")
+	}
+	envString(&c.TLS.Autocert.Email, "AUTOCERT_EMAIL")
+	envString(&c.TLS.Autocert.CacheDir, "AUTOCERT_CACHE_DIR")
+	envString(&c.TLS.Autocert.HTTPPort, "AUTOCERT_HTTP_PORT")
+	envString(&c.Log.Level, "LOG_LEVEL")
+	envString(&c.Log.Format, "LOG_FORMAT")
+	envString(&c.Log.File, "LOG_FILE")
+
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid CACHE_SIZE: %w", err)
+		}
+		c.Cache.Size = n
+	}
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid CACHE_TTL: %w", err)
+		}
+		c.Cache.TTL = d
+	}
+	envBool(&c.Database.NoSync, "DB_NO_SYNC")
+	envString(&c.Database.FreelistType, "DB_FREELIST_TYPE")
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"DB_INITIAL_MMAP_SIZE", &c.Database.InitialMmapSize},
+		{"DB_MAX_BATCH_SIZE", &c.Database.MaxBatchSize},
+	} {
+		if value := os.Getenv(v.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s %q", v.name, value)
+			}
+			*v.dst = n
+		}
+	}
+	if v := os.Getenv("DB_MAX_BATCH_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid DB_MAX_BATCH_DELAY: %w", err)
+		}
+		c.Database.MaxBatchDelay = d
+	}
+	if v := os.Getenv("CLICK_FLUSH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid CLICK_FLUSH_INTERVAL: %w", err)
+		}
+		c.Clicks.FlushInterval = d
+	}
+
+	if v := os.Getenv("URL_SCHEMES"); v != "" {
+		c.Destinations.Schemes = strings.Split(v, ",")
+	}
+	envBool(&c.Destinations.BlockInternal, "BLOCK_INTERNAL_TARGETS")
+	envBool(&c.RequireDeleteReason, "REQUIRE_DELETE_REASON")
+	if v := os.Getenv("MAX_URL_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_URL_LENGTH: %w", err)
+		}
+		c.Destinations.MaxLength = n
+	}
+
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"CREATE_RATE_LIMIT", &c.RateLimit.CreatesPerMinute},
+		{"CREATE_RATE_BURST", &c.RateLimit.Burst},
+		{"ID_LENGTH", &c.IDs.Length},
+		{"SECURE_ID_LENGTH", &c.IDs.SecureLength},
+	} {
+		if value := os.Getenv(v.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s %q", v.name, value)
+			}
+			*v.dst = n
+		}
+	}
+
+	envString(&c.Captcha.Provider, "CAPTCHA_PROVIDER")
+	envString(&c.Captcha.SiteKey, "CAPTCHA_SITE_KEY")
+	envString(&c.Captcha.Secret, "CAPTCHA_SECRET")
+	if v := os.Getenv("POW_DIFFICULTY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid POW_DIFFICULTY: %w", err)
+		}
+		c.Captcha.PowDifficulty = n
+	}
+
+	envBool(&c.ExternalWarning.Enabled, "EXTERNAL_LINK_WARNING")
+	if v := os.Getenv("TRUSTED_DOMAINS"); v != "" {
+		c.ExternalWarning.TrustedDomains = strings.Split(v, ",")
+	}
+
+	envString(&c.Slack.SigningSecret, "SLACK_SIGNING_SECRET")
+	envString(&c.Discord.PublicKey, "DISCORD_PUBLIC_KEY")
+	envString(&c.Discord.ApplicationID, "DISCORD_APPLICATION_ID")
+	envString(&c.Discord.BotToken, "DISCORD_BOT_TOKEN")
+	envBool(&c.Shlink.Enabled, "SHLINK_API")
+	envBool(&c.Bitly.Enabled, "BITLY_API")
+	envBool(&c.YOURLS.Enabled, "YOURLS_API")
+	envString(&c.AppLinks.AppleAppSiteAssociation, "APPLE_APP_SITE_ASSOCIATION_FILE")
+	envString(&c.AppLinks.AssetLinks, "ASSETLINKS_FILE")
+	envString(&c.Email.IMAPAddr, "EMAIL_IMAP_ADDR")
+	envString(&c.Email.SMTPAddr, "EMAIL_SMTP_ADDR")
+	envString(&c.Email.Username, "EMAIL_USERNAME")
+	envString(&c.Email.Password, "EMAIL_PASSWORD")
+	envString(&c.Email.Mailbox, "EMAIL_MAILBOX")
+	envString(&c.Email.From, "EMAIL_FROM")
+	if v := os.Getenv("EMAIL_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid EMAIL_POLL_INTERVAL: %w", err)
+		}
+		c.Email.PollInterval = d
+	}
+	if v := os.Getenv("EMAIL_ALLOWED_SENDERS"); v != "" {
+		c.Email.AllowedSenders = strings.Split(v, ",")
+	}
+	envString(&c.Ephemeral.Secret, "EPHEMERAL_SECRET")
+	if v := os.Getenv("EPHEMERAL_MAX_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid EPHEMERAL_MAX_TTL: %w", err)
+		}
+		c.Ephemeral.MaxTTL = d
+	}
+
+	envString(&c.SafeBrowsing.Provider, "SAFE_BROWSING_PROVIDER")
+	envString(&c.SafeBrowsing.APIKey, "SAFE_BROWSING_API_KEY")
+	if v := os.Getenv("SAFE_BROWSING_RESCAN_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid SAFE_BROWSING_RESCAN_INTERVAL: %w", err)
+		}
+		c.SafeBrowsing.RescanInterval = d
+	}
+
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid MAX_BODY_BYTES %q", v)
+		}
+		c.Limits.MaxBodyBytes = n
+	}
+	if v := os.Getenv("MAX_HEADER_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid MAX_HEADER_BYTES %q", v)
+		}
+		c.Limits.MaxHeaderBytes = n
+	}
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"MAX_CONCURRENT_REQUESTS", &c.Limits.MaxConcurrent},
+		{"MAX_QUEUED_REQUESTS", &c.Limits.MaxQueued},
+	} {
+		if value := os.Getenv(v.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s %q", v.name, value)
+			}
+			*v.dst = n
+		}
+	}
+	envBool(&c.DisableCompression, "DISABLE_COMPRESSION")
+	for _, v := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"READ_TIMEOUT", &c.Limits.ReadTimeout},
+		{"WRITE_TIMEOUT", &c.Limits.WriteTimeout},
+		{"IDLE_TIMEOUT", &c.Limits.IdleTimeout},
+		{"REQUEST_TIMEOUT", &c.Limits.RequestTimeout},
+		{"QUEUE_TIMEOUT", &c.Limits.QueueTimeout},
+	} {
+		if value := os.Getenv(v.name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", v.name, err)
+			}
+			*v.dst = d
+		}
+	}
+
+	envString(&c.Auth.AdminToken, "ADMIN_TOKEN")
+	envString(&c.Auth.AdminUser, "ADMIN_USER")
+	envBool(&c.Auth.DisableRegistration, "DISABLE_REGISTRATION")
+	envBool(&c.Auth.DisableAnonymousCreate, "DISABLE_ANONYMOUS_CREATE")
+	if v := os.Getenv("API_KEYS"); v != "" {
+		keys, err := parseAPIKeys(v)
+		if err != nil {
+			return err
+		}
+		c.Auth.APIKeys = nil
+		for key, name := range keys {
+			c.Auth.APIKeys = append(c.Auth.APIKeys, APIKeyConfig{Name: name, Key: key})
+		}
+	}
+
+	ldap := &c.Auth.LDAP
+	envString(&ldap.URL, "LDAP_URL")
+	envString(&ldap.BindDN, "LDAP_BIND_DN")
+	envString(&ldap.BindPassword, "LDAP_BIND_PASSWORD")
+	envString(&ldap.BaseDN, "LDAP_BASE_DN")
+	envString(&ldap.UserFilter, "LDAP_USER_FILTER")
+	envString(&ldap.AdminFilter, "LDAP_ADMIN_FILTER")
+	envBool(&ldap.StartTLS, "LDAP_START_TLS")
+	envBool(&ldap.InsecureSkipVerify, "LDAP_INSECURE_SKIP_VERIFY")
+
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"QUOTA_LINKS_PER_DAY", &c.Quota.LinksPerDay},
+		{"QUOTA_TOTAL_LINKS", &c.Quota.TotalLinks},
+	} {
+		if value := os.Getenv(v.name); value != "" {
+			n, err := parseQuotaLimit(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", v.name, err)
+			}
+			*v.dst = n
+		}
+	}
+
+	if v := os.Getenv("RESERVED_PREFIXES"); v != "" {
+		reserved, err := parseReservedPrefixes(v)
+		if err != nil {
+			return err
+		}
+		c.ReservedPrefixes = nil
+		for _, rp := range reserved {
+			c.ReservedPrefixes = append(c.ReservedPrefixes, ReservedPrefixConfig{Prefix: rp.prefix, Systems: rp.systems})
+		}
+	}
+	return nil
+}
+
+// configFlags binds the command-line flags that override the
+// configuration. Flags take precedence over both the file and the
+// environment, but only when given explicitly.
+type configFlags struct {
+	fs     *flag.FlagSet
+	path   string
+	values *Config
+}
+
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{fs: fs, values: defaultConfig()}
+	v := f.values
+	fs.StringVar(&f.path, "config", "", "path to a YAML config file")
+	fs.StringVar(&v.Port, "port", v.Port, "port to listen on (env PORT)")
+	fs.StringVar(&v.DBPath, "db-path", v.DBPath, "path of the bbolt database file (env DB_PATH)")
+	fs.StringVar(&v.ShortPrefix, "short-prefix", v.ShortPrefix, "URL prefix for short links (env SHORT_PREFIX)")
+	fs.StringVar(&v.UIPrefix, "ui-prefix", v.UIPrefix, "URL prefix for the web UI and API (env UI_PREFIX)")
+	fs.StringVar(&v.BaseURL, "base-url", v.BaseURL, "external URL short links are generated with, e.g. https://go.example.com (env BASE_URL)")
+	fs.BoolVar(&v.ReadOnly, "read-only", v.ReadOnly, "open the database read-only and serve redirects only (env READ_ONLY)")
+	fs.BoolVar(&v.Maintenance, "maintenance", v.Maintenance, "start in maintenance mode, refusing changes to links while redirects keep working (env MAINTENANCE)")
+	fs.StringVar(&v.UIDir, "ui-dir", v.UIDir, "directory with templates/ and static/ files overriding the built-in ones (env UI_DIR)")
+	fs.StringVar(&v.DebugAddr, "debug-addr", v.DebugAddr, "serve pprof and expvar on this localhost address, e.g. localhost:6060 (env DEBUG_ADDR)")
+	fs.StringVar(&v.TLS.Cert, "tls-cert", v.TLS.Cert, "PEM certificate (chain) to serve HTTPS with (env TLS_CERT)")
+	fs.StringVar(&v.TLS.Key, "tls-key", v.TLS.Key, "PEM private key of the TLS certificate (env TLS_KEY)")
+	fs.StringVar(&v.Log.Level, "log-level", v.Log.Level, "minimum log level: debug, info, warn or error (env LOG_LEVEL)")
+	fs.StringVar(&v.Log.Format, "log-format", v.Log.Format, "log output format: text or json (env LOG_FORMAT)")
+	fs.StringVar(&v.Log.File, "log-file", v.Log.File, "append logs to this file instead of stderr, reopened on SIGHUP (env LOG_FILE)")
+	fs.IntVar(&v.Cache.Size, "cache-size", v.Cache.Size, "redirect targets kept in memory, 0 disables the cache (env CACHE_SIZE)")
+	fs.DurationVar(&v.Cache.TTL, "cache-ttl", v.Cache.TTL, "how long a cached redirect target stays valid (env CACHE_TTL)")
+	return f
+}
+
+// load reads the configuration from the file given with --config and the
+// environment, then applies the flags that were set.
+func (f *configFlags) load() (*Config, error) {
+	cfg, err := loadConfig(f.path)
+	if err != nil {
+		return nil, err
+	}
+	v := f.values
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "port":
+			cfg.Port = v.Port
+		case "db-path":
+			cfg.DBPath = v.DBPath
+		case "short-prefix":
+			cfg.ShortPrefix = v.ShortPrefix
+		case "ui-prefix":
+			cfg.UIPrefix = v.UIPrefix
+		case "base-url":
+			cfg.BaseURL = v.BaseURL
+		case "read-only":
+			cfg.ReadOnly = v.ReadOnly
+		case "maintenance":
+			cfg.Maintenance = v.Maintenance
+		case "ui-dir":
+			cfg.UIDir = v.UIDir
+		case "debug-addr":
+			cfg.DebugAddr = v.DebugAddr
+		case "tls-cert":
+			cfg.TLS.Cert = v.TLS.Cert
+		case "tls-key":
+			cfg.TLS.Key = v.TLS.Key
+		case "log-level":
+			cfg.Log.Level = v.Log.Level
+		case "log-format":
+			cfg.Log.Format = v.Log.Format
+		case "log-file":
+			cfg.Log.File = v.Log.File
+		case "cache-size":
+			cfg.Cache.Size = v.Cache.Size
+		case "cache-ttl":
+			cfg.Cache.TTL = v.Cache.TTL
+		}
+	})
+	return cfg, nil
+}
+
+func envString(dst *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+func envBool(dst *bool, name string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v == "true"
+	}
+}
+
+// apiKeyMap maps each static API key to its system name.
+func (c *Config) apiKeyMap() (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, k := range c.Auth.APIKeys {
+		name, key := strings.TrimSpace(k.Name), strings.TrimSpace(k.Key)
+		if name == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key entry for %q: name and key are required", k.Name)
+		}
+		keys[key] = name
+	}
+	return keys, nil
+}
+
+// reservedPrefixes converts the configured reservations, keeping their
+// order since the first matching prefix wins.
+func (c *Config) reservedPrefixes() ([]reservedPrefix, error) {
+	var reserved []reservedPrefix
+	for _, rp := range c.ReservedPrefixes {
+		prefix := strings.ToLower(strings.TrimSpace(rp.Prefix))
+		if prefix == "" {
+			return nil, fmt.Errorf("invalid reserved prefix entry: empty prefix")
+		}
+		reserved = append(reserved, reservedPrefix{prefix: prefix, systems: rp.Systems})
+	}
+	return reserved, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfig(t, `
+port: 9090
+db_path: /var/lib/pk-shorts/links.db
+short_prefix: /go
+cache:
+  ttl: 1m
+auth:
+  admin_token: from-file
+  api_keys:
+    - name: billing
+      key: s3cret
+  disable_registration: true
+  ldap:
+    url: ldaps://dc.corp.example.com
+    base_dn: dc=corp,dc=example,dc=com
+quota:
+  links_per_day: 50
+reserved_prefixes:
+  - prefix: Bill-
+    systems: [billing]
+blocked_domains: [evil.example]
+`)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+
+	if cfg.Port != "9090" || cfg.DBPath != "/var/lib/pk-shorts/links.db" || cfg.ShortPrefix != "/go" {
+		t.Errorf("server options = %q, %q, %q", cfg.Port, cfg.DBPath, cfg.ShortPrefix)
+	}
+	if cfg.UIPrefix != defaultUIPrefix || cfg.Cache.Size != defaultCacheSize {
+		t.Errorf("unset options should keep their defaults: %q, %d", cfg.UIPrefix, cfg.Cache.Size)
+	}
+	if cfg.Cache.TTL != time.Minute {
+		t.Errorf("cache TTL = %v, want 1m", cfg.Cache.TTL)
+	}
+	if keys, _ := cfg.apiKeyMap(); !reflect.DeepEqual(keys, map[string]string{"s3cret": "billing"}) {
+		t.Errorf("API keys = %v", keys)
+	}
+	if reserved, _ := cfg.reservedPrefixes(); len(reserved) != 1 || reserved[0].prefix != "bill-" {
+		t.Errorf("reserved prefixes = %+v", reserved)
+	}
+	if ldap, err := cfg.Auth.LDAP.resolve(); err != nil || ldap == nil || ldap.UserFilter != defaultLDAPUserFilter {
+		t.Errorf("LDAP = %+v, %v", ldap, err)
+	}
+
+	settings := defaultSettings(cfg)
+	if settings.RegistrationOpen || !settings.AnonymousCreate || settings.Quota.LinksPerDay != 50 {
+		t.Errorf("default settings = %+v", settings)
+	}
+	if !reflect.DeepEqual(settings.BlockedDomains, []string{"evil.example"}) {
+		t.Errorf("blocked domains = %q", settings.BlockedDomains)
+	}
+}
+
+func TestEnvOverridesConfigFile(t *testing.T) {
+	path := writeConfig(t, `
+port: "9090"
+auth:
+  admin_token: from-file
+  disable_registration: true
+  api_keys:
+    - name: billing
+      key: s3cret
+`)
+	t.Setenv("PORT", "7070")
+	t.Setenv("DISABLE_REGISTRATION", "false")
+	t.Setenv("API_KEYS", "crm:k1")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	if cfg.Port != "7070" {
+		t.Errorf("port = %q, want the environment's 7070", cfg.Port)
+	}
+	if cfg.Auth.AdminToken != "from-file" {
+		t.Errorf("admin token = %q, want the file's value", cfg.Auth.AdminToken)
+	}
+	if cfg.Auth.DisableRegistration {
+		t.Error("DISABLE_REGISTRATION=false should override the file")
+	}
+	if keys, _ := cfg.apiKeyMap(); !reflect.DeepEqual(keys, map[string]string{"k1": "crm"}) {
+		t.Errorf("API keys = %v, want only the environment's", keys)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown field", "prot: 8080\n"},
+		{"bad duration", "cache:\n  ttl: soon\n"},
+		{"wrong type", "auth:\n  api_keys: billing\n"},
+		{"bad batch delay", "database:\n  max_batch_delay: soon\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadConfig(writeConfig(t, tt.content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestConfigFlagsOverride(t *testing.T) {
+	path := writeConfig(t, "port: 9090\ndb_path: from-file.db\nshort_prefix: /go\n")
+	t.Setenv("DB_PATH", "from-env.db")
+	t.Setenv("SHORT_PREFIX", "/env")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := newConfigFlags(fs)
+	if err := fs.Parse([]string{"--config", path, "--db-path", "from-flag.db", "--cache-ttl", "30s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		t.Fatalf("load() error: %v", err)
+	}
+	if cfg.DBPath != "from-flag.db" {
+		t.Errorf("db path = %q, want the flag's value", cfg.DBPath)
+	}
+	if cfg.ShortPrefix != "/env" {
+		t.Errorf("short prefix = %q, want the environment's value", cfg.ShortPrefix)
+	}
+	if cfg.Port != "9090" {
+		t.Errorf("port = %q, want the file's value", cfg.Port)
+	}
+	if cfg.Cache.TTL != 30*time.Second {
+		t.Errorf("cache TTL = %v, want 30s", cfg.Cache.TTL)
+	}
+}
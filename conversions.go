@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// conversionsBucket counts the conversions of each link in a nested
+	// bucket per link, per UTC day and per goal.
+	conversionsBucket = "conversions"
+
+	conversionDayPrefix  = "d:"
+	conversionGoalPrefix = "g:"
+
+	// maxConversionGoals caps the distinct goals counted per link;
+	// conversions for further goals are counted as otherGoal.
+	maxConversionGoals = 50
+	maxGoalLength      = 32
+	otherGoal          = "(other)"
+)
+
+var errInvalidGoal = errors.New("invalid goal")
+
+// pixelGIF is a transparent 1x1 GIF.
+var pixelGIF = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+// normalizeGoal lowercases the name of a conversion goal and checks its
+// format. Conversions without a goal are counted under "".
+func normalizeGoal(goal string) (string, error) {
+	goal = strings.ToLower(strings.TrimSpace(goal))
+	if len(goal) > maxGoalLength {
+		return "", fmt.Errorf("%w: goal is longer than %d characters", errInvalidGoal, maxGoalLength)
+	}
+	for _, ch := range goal {
+		if !((ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.') {
+			return "", fmt.Errorf("%w: goal can only contain letters, numbers, dots, dashes, and underscores", errInvalidGoal)
+		}
+	}
+	return goal, nil
+}
+
+// recordConversion counts a conversion of short toward goal on the day of
+// at. Links deleted since are not found.
+func (s *Server) recordConversion(short, goal string, at time.Time) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucketName)).Get([]byte(short)) == nil {
+			return fmt.Errorf("link not found")
+		}
+		b, err := tx.Bucket([]byte(conversionsBucket)).CreateBucketIfNotExists([]byte(short))
+		if err != nil {
+			return err
+		}
+		if err := addCount(b, conversionDayPrefix+at.UTC().Format(dayKeyLayout)); err != nil {
+			return err
+		}
+		key := conversionGoalPrefix + goal
+		if b.Get([]byte(key)) == nil && countGoals(b) >= maxConversionGoals {
+			key = conversionGoalPrefix + otherGoal
+		}
+		return addCount(b, key)
+	})
+}
+
+// countGoals returns how many goals b counts conversions for.
+func countGoals(b *bolt.Bucket) int {
+	var n int
+	c := b.Cursor()
+	prefix := []byte(conversionGoalPrefix)
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), conversionGoalPrefix); k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+// deleteConversions drops the conversion counters of short.
+func deleteConversions(tx *bolt.Tx, short string) error {
+	b := tx.Bucket([]byte(conversionsBucket))
+	if b.Bucket([]byte(short)) == nil {
+		return nil
+	}
+	return b.DeleteBucket([]byte(short))
+}
+
+// goalConversions is the number of conversions toward one goal.
+type goalConversions struct {
+	Name        string `json:"name"`
+	Conversions uint64 `json:"conversions"`
+}
+
+// conversionCounts are the conversions of a link: on each of the days
+// asked for, in total, and per goal, most conversions first.
+type conversionCounts struct {
+	Daily   []uint64
+	AllTime uint64
+	Goals   []goalConversions
+}
+
+// conversions returns the conversion counts of short on days, which must
+// be sorted ascending.
+func conversions(tx *bolt.Tx, short string, days []string) conversionCounts {
+	counts := conversionCounts{Daily: make([]uint64, len(days)), Goals: []goalConversions{}}
+	b := tx.Bucket([]byte(conversionsBucket)).Bucket([]byte(short))
+	if b == nil {
+		return counts
+	}
+	index := make(map[string]int, len(days))
+	for i, d := range days {
+		index[d] = i
+	}
+	b.ForEach(func(k, v []byte) error {
+		if len(v) != 8 {
+			return nil
+		}
+		n := binary.BigEndian.Uint64(v)
+		if day, ok := strings.CutPrefix(string(k), conversionDayPrefix); ok {
+			counts.AllTime += n
+			if i, ok := index[day]; ok {
+				counts.Daily[i] = n
+			}
+		} else if goal, ok := strings.CutPrefix(string(k), conversionGoalPrefix); ok {
+			counts.Goals = append(counts.Goals, goalConversions{goal, n})
+		}
+		return nil
+	})
+	sort.SliceStable(counts.Goals, func(i, j int) bool { return counts.Goals[i].Conversions > counts.Goals[j].Conversions })
+	return counts
+}
+
+// conversionRate returns conversions per click, or 0 without clicks.
+func conversionRate(conversions, clicks uint64) float64 {
+	if clicks == 0 {
+		return 0
+	}
+	return float64(conversions) / float64(clicks)
+}
+
+// handleConversionPixel counts a conversion of the link and answers with a
+// transparent GIF, for destination pages to embed as
+// <img src="/s/{short}/pixel.gif?goal=signup">. It never fails, so a page
+// doesn't show a broken image for a mistyped or deleted link.
+func (s *Server) handleConversionPixel(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	goal, err := normalizeGoal(r.URL.Query().Get("goal"))
+	if err == nil && !s.readOnly && !s.maintenance().Enabled {
+		err = s.recordConversion(short, goal, time.Now())
+	}
+	if err != nil {
+		requestLogger(r).Debug("conversion not counted", "short", short, "err", err)
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(pixelGIF)
+}
+
+// handleAPIConversion counts a conversion of the link with POST and an
+// optional {"goal": "signup"}, for the destination's backend to report
+// conversions it can vouch for. It takes the credentials that may manage
+// the link.
+func (s *Server) handleAPIConversion(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	short := mux.Vars(r)["short"]
+	link, err := s.getLink(short)
+	if err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+
+	var req struct {
+		Goal string `json:"goal"`
+	}
+	// The body is optional.
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	goal, err := normalizeGoal(req.Goal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.recordConversion(short, goal, time.Now()); err != nil {
+		http.Error(w, "Failed to record conversion", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to record conversion", "short", short, "err", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
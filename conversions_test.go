@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNormalizeGoal(t *testing.T) {
+	tests := []struct {
+		goal    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{" Signup ", "signup", false},
+		{"checkout.paid", "checkout.paid", false},
+		{"two words", "", true},
+		{strings.Repeat("a", maxGoalLength+1), "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeGoal(tt.goal)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeGoal(%q) = %q, %v, want %q", tt.goal, got, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, errInvalidGoal) {
+			t.Errorf("normalizeGoal(%q) error = %v, want errInvalidGoal", tt.goal, err)
+		}
+	}
+}
+
+func TestConversionPixel(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/shop", createOptions{CustomID: "shop", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/s/shop/pixel.gif", "/s/shop/pixel.gif?goal=Signup", "/s/shop/pixel.gif?goal=signup", "/s/missing/pixel.gif", "/s/shop/pixel.gif?goal=not+valid"} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/gif" || rr.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: status = %d, headers %v", target, rr.Code, rr.Header())
+		}
+		if img, err := gif.Decode(bytes.NewReader(rr.Body.Bytes())); err != nil || img.Bounds().Dx() != 1 || img.Bounds().Dy() != 1 {
+			t.Errorf("%s: not a 1x1 GIF: %v", target, err)
+		}
+	}
+
+	srv.db.View(func(tx *bolt.Tx) error {
+		got := conversions(tx, "shop", statsDays(time.Now(), 1))
+		if got.AllTime != 3 || got.Daily[0] != 3 || fmt.Sprint(got.Goals) != "[{signup 2} { 1}]" {
+			t.Errorf("conversions = %+v, want 3 with 2 signups", got)
+		}
+		return nil
+	})
+}
+
+func TestConversionGoalsCapped(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "busy"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxConversionGoals+5; i++ {
+		if err := srv.recordConversion("busy", fmt.Sprintf("goal-%d", i), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.db.View(func(tx *bolt.Tx) error {
+		got := conversions(tx, "busy", nil)
+		if len(got.Goals) != maxConversionGoals+1 || got.Goals[0].Name != otherGoal || got.Goals[0].Conversions != 5 || got.AllTime != maxConversionGoals+5 {
+			t.Errorf("goals = %d, first %+v, all time %d", len(got.Goals), got.Goals[0], got.AllTime)
+		}
+		return nil
+	})
+
+	if err := srv.deleteLink("busy", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "busy"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.db.View(func(tx *bolt.Tx) error {
+		if got := conversions(tx, "busy", nil); got.AllTime != 0 {
+			t.Errorf("a new link with the ID of a deleted one has %d conversions", got.AllTime)
+		}
+		return nil
+	})
+}
+
+func TestAPIConversion(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	if _, err := srv.createShortLink("https://example.com/shop", createOptions{CustomID: "shop", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		srv.incrementClicks("shop", ClickEvent{At: time.Now()})
+	}
+	serve := func(cookie *http.Cookie, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		target string
+		body   string
+		want   int
+	}{
+		{"goal", alice, "/sui/api/links/shop/conversion", `{"goal": "purchase"}`, http.StatusNoContent},
+		{"no body", alice, "/sui/api/links/shop/conversion", "", http.StatusNoContent},
+		{"invalid goal", alice, "/sui/api/links/shop/conversion", `{"goal": "a b"}`, http.StatusBadRequest},
+		{"other user's link", bob, "/sui/api/links/shop/conversion", `{}`, http.StatusForbidden},
+		{"logged out", nil, "/sui/api/links/shop/conversion", `{}`, http.StatusForbidden},
+		{"unknown link", alice, "/sui/api/links/nope/conversion", `{}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rr := serve(tt.cookie, "POST", tt.target, tt.body); rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rr.Code, tt.want, rr.Body.String())
+		}
+	}
+
+	rr := serve(alice, "GET", "/sui/api/links/shop/stats?range=7d", "")
+	var stats linkStats
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.ConversionTotal != 2 || stats.Conversions[6] != 2 || stats.ConversionRate != 0.5 || stats.AllTimeConversions != 2 || len(stats.Goals) != 2 {
+		t.Errorf("stats = %+v, want 2 conversions of 4 clicks", stats)
+	}
+
+	rr = serve(alice, "GET", "/sui/api/stats/compare?shorts=shop", "")
+	var compare struct {
+		Series []statsSeries `json:"series"`
+	}
+	json.NewDecoder(rr.Body).Decode(&compare)
+	if len(compare.Series) != 1 || compare.Series[0].Conversions != 2 || compare.Series[0].ConversionRate != 0.5 {
+		t.Errorf("compare = %+v", compare.Series)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const createdIndexBucket = "links_by_created"
+
+// createdIndexKey builds the index key for a link: the big-endian creation
+// time in nanoseconds followed by the short code. Keys therefore sort by
+// creation time, and the short suffix keeps links created in the same
+// nanosecond distinct.
+func createdIndexKey(createdAt time.Time, short string) []byte {
+	key := make([]byte, 8+len(short))
+	binary.BigEndian.PutUint64(key, uint64(createdAt.UnixNano()))
+	copy(key[8:], short)
+	return key
+}
+
+// parseCreatedIndexKey splits an index key back into its creation time and
+// short code.
+func parseCreatedIndexKey(key []byte) (time.Time, string, error) {
+	if len(key) < 8 {
+		return time.Time{}, "", fmt.Errorf("invalid index key")
+	}
+	nanos := int64(binary.BigEndian.Uint64(key[:8]))
+	return time.Unix(0, nanos), string(key[8:]), nil
+}
+
+// backfillCreatedIndex populates the creation-date index from the links
+// bucket. It is used when opening a database created before the index
+// existed.
+func backfillCreatedIndex(tx *bolt.Tx) error {
+	idx := tx.Bucket([]byte(createdIndexBucket))
+	return tx.Bucket([]byte(bucketName)).ForEach(func(k, v []byte) error {
+		var link Link
+		if err := json.Unmarshal(v, &link); err != nil {
+			return err
+		}
+		return idx.Put(createdIndexKey(link.CreatedAt, link.Short), []byte{})
+	})
+}
+
+// getLinksCreatedBetween returns links created in [from, to), newest
+// first. A zero from or to leaves that side of the range open, a limit of
+// zero or less returns every match, and a non-nil match further filters
+// the links. Only the index range is scanned, so the cost depends on the
+// number of matching links rather than the size of the database.
+func (s *Server) getLinksCreatedBetween(from, to time.Time, limit int, match func(*Link) bool) ([]Link, error) {
+	var links []Link
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return walkCreatedIndex(tx, createdWalk{from: from, to: to, match: match, decode: true}, func(_ []byte, link *Link) bool {
+			if limit > 0 && len(links) >= limit {
+				return false
+			}
+			loadClicks(tx, link)
+			links = append(links, *link)
+			return true
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// createdWalk describes a walk over the creation-date index: the links
+// created in [from, to) that match, newest first.
+type createdWalk struct {
+	from, to time.Time
+	// after, when set, starts the walk just past this index key, so a
+	// page can continue where the previous one ended.
+	after []byte
+	// newer walks towards newer links instead, from the oldest.
+	newer bool
+	match func(*Link) bool
+	// decode loads each link even when match doesn't need it.
+	decode bool
+}
+
+// walkCreatedIndex calls fn with the index key and link of each link of
+// w until it returns false. The link is nil unless w.match or w.decode
+// needed it decoded, so counting or skipping links without a filter only
+// reads index keys. The walk seeks to where it starts rather than
+// scanning up to it.
+func walkCreatedIndex(tx *bolt.Tx, w createdWalk, fn func(key []byte, link *Link) bool) error {
+	b := tx.Bucket([]byte(bucketName))
+	c := tx.Bucket([]byte(createdIndexBucket)).Cursor()
+
+	var lower, upper []byte
+	if !w.from.IsZero() {
+		lower = createdIndexKey(w.from, "")
+	}
+	if !w.to.IsZero() {
+		upper = createdIndexKey(w.to, "")
+	}
+
+	var k []byte
+	step := c.Prev
+	if w.newer {
+		step = c.Next
+		start := lower
+		if w.after != nil && bytes.Compare(w.after, start) >= 0 {
+			start = w.after
+		}
+		if start == nil {
+			k, _ = c.First()
+		} else {
+			k, _ = c.Seek(start)
+		}
+		if k != nil && w.after != nil && bytes.Equal(k, w.after) {
+			k, _ = c.Next()
+		}
+	} else {
+		// Both bounds are exclusive: seek lands on the first key at or
+		// after the bound, so step back below it.
+		bound := upper
+		if w.after != nil && (bound == nil || bytes.Compare(w.after, bound) < 0) {
+			bound = w.after
+		}
+		if bound == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Seek(bound)
+			if k == nil {
+				k, _ = c.Last()
+			}
+			for k != nil && bytes.Compare(k, bound) >= 0 {
+				k, _ = c.Prev()
+			}
+		}
+	}
+
+	for ; k != nil; k, _ = step() {
+		if w.newer && upper != nil && bytes.Compare(k, upper) >= 0 {
+			break
+		}
+		if !w.newer && lower != nil && bytes.Compare(k, lower) < 0 {
+			break
+		}
+
+		var link *Link
+		if w.match != nil || w.decode {
+			_, short, err := parseCreatedIndexKey(k)
+			if err != nil {
+				return err
+			}
+			data := b.Get([]byte(short))
+			if data == nil {
+				continue
+			}
+			link = new(Link)
+			if err := json.Unmarshal(data, link); err != nil {
+				return err
+			}
+			if w.match != nil && !w.match(link) {
+				continue
+			}
+		}
+		if !fn(k, link) {
+			break
+		}
+	}
+	return nil
+}
+
+// parseTimeParam parses a time query parameter given either as RFC 3339 or
+// as a plain date (YYYY-MM-DD, interpreted as midnight UTC).
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
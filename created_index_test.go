@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreatedIndexKeyRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 42, time.UTC)
+	key := createdIndexKey(created, "abc")
+
+	got, short, err := parseCreatedIndexKey(key)
+	if err != nil {
+		t.Fatalf("parseCreatedIndexKey() error: %v", err)
+	}
+	if !got.Equal(created) {
+		t.Errorf("time = %v, want %v", got, created)
+	}
+	if short != "abc" {
+		t.Errorf("short = %q, want %q", short, "abc")
+	}
+
+	if _, _, err := parseCreatedIndexKey([]byte{1, 2}); err == nil {
+		t.Error("expected error for truncated key")
+	}
+}
+
+func TestGetLinksCreatedBetween(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, id := range []string{"first", "second", "third"} {
+		if _, err := srv.createShortLink("https://example.com/"+id, createOptions{CustomID: id}); err != nil {
+			t.Fatalf("createShortLink(%q) error: %v", id, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	links, err := srv.getLinksCreatedBetween(time.Time{}, time.Time{}, 0, nil)
+	if err != nil {
+		t.Fatalf("getLinksCreatedBetween() error: %v", err)
+	}
+	if len(links) != 3 || links[0].Short != "third" || links[2].Short != "first" {
+		t.Fatalf("expected newest-first order, got %+v", links)
+	}
+
+	limited, err := srv.getLinksCreatedBetween(time.Time{}, time.Time{}, 2, nil)
+	if err != nil {
+		t.Fatalf("getLinksCreatedBetween() error: %v", err)
+	}
+	if len(limited) != 2 {
+		t.Errorf("expected 2 links with limit, got %d", len(limited))
+	}
+
+	// Restrict the range to exclude the oldest and newest links.
+	ranged, err := srv.getLinksCreatedBetween(links[1].CreatedAt, links[0].CreatedAt, 0, nil)
+	if err != nil {
+		t.Fatalf("getLinksCreatedBetween() error: %v", err)
+	}
+	if len(ranged) != 1 || ranged[0].Short != "second" {
+		t.Errorf("expected only %q in range, got %+v", "second", ranged)
+	}
+
+	if err := srv.deleteLink("second", "", ""); err != nil {
+		t.Fatalf("deleteLink() error: %v", err)
+	}
+	remaining, err := srv.getLinksCreatedBetween(time.Time{}, time.Time{}, 0, nil)
+	if err != nil {
+		t.Fatalf("getLinksCreatedBetween() error: %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Errorf("expected deleted link to leave the index, got %+v", remaining)
+	}
+}
+
+func TestParseTimeParam(t *testing.T) {
+	tests := []struct {
+		value     string
+		shouldErr bool
+	}{
+		{"", false},
+		{"2024-05-01", false},
+		{"2024-05-01T10:00:00Z", false},
+		{"yesterday", true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseTimeParam(tt.value)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("parseTimeParam(%q) error = %v, shouldErr %v", tt.value, err, tt.shouldErr)
+		}
+	}
+}
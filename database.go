@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DatabaseConfig tunes the Bolt database for write throughput.
+type DatabaseConfig struct {
+	// NoSync skips the fsync after each commit. It speeds up bulk imports
+	// a lot, but a crash or power loss can then corrupt the database, so
+	// leave it off for a server taking traffic.
+	NoSync bool `yaml:"no_sync"`
+	// FreelistType is "array" (the default) or "hashmap", which is
+	// faster for large databases with much free space.
+	FreelistType string `yaml:"freelist_type"`
+	// InitialMmapSize maps this many bytes up front, so a growing file
+	// doesn't have to be remapped, which blocks writes while it happens.
+	InitialMmapSize int `yaml:"initial_mmap_size"`
+	// MaxBatchSize and MaxBatchDelay bound how many concurrent writes of
+	// clicks are committed together, and how long the first one waits
+	// for others.
+	MaxBatchSize  int           `yaml:"max_batch_size"`
+	MaxBatchDelay time.Duration `yaml:"max_batch_delay"`
+}
+
+func defaultDatabase() DatabaseConfig {
+	return DatabaseConfig{
+		FreelistType:  string(bolt.FreelistArrayType),
+		MaxBatchSize:  bolt.DefaultMaxBatchSize,
+		MaxBatchDelay: bolt.DefaultMaxBatchDelay,
+	}
+}
+
+// openDB opens the database at path with the options of c.
+func openDB(path string, c DatabaseConfig, readOnly bool) (*bolt.DB, error) {
+	freelist := bolt.FreelistType(c.FreelistType)
+	switch freelist {
+	case "":
+		freelist = bolt.FreelistArrayType
+	case bolt.FreelistArrayType, bolt.FreelistMapType:
+	default:
+		return nil, fmt.Errorf("invalid freelist type %q, want array or hashmap", c.FreelistType)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout:         1 * time.Second,
+		ReadOnly:        readOnly,
+		NoSync:          c.NoSync,
+		FreelistType:    freelist,
+		InitialMmapSize: c.InitialMmapSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBatchSize > 0 {
+		db.MaxBatchSize = c.MaxBatchSize
+	}
+	if c.MaxBatchDelay > 0 {
+		db.MaxBatchDelay = c.MaxBatchDelay
+	}
+	return db, nil
+}
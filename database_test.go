@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestOpenDB(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    DatabaseConfig
+		wantErr   bool
+		batchSize int
+		delay     time.Duration
+	}{
+		{"defaults", defaultDatabase(), false, bolt.DefaultMaxBatchSize, bolt.DefaultMaxBatchDelay},
+		{"unset", DatabaseConfig{}, false, bolt.DefaultMaxBatchSize, bolt.DefaultMaxBatchDelay},
+		{"tuned", DatabaseConfig{NoSync: true, FreelistType: "hashmap", InitialMmapSize: 1 << 20, MaxBatchSize: 50, MaxBatchDelay: time.Millisecond}, false, 50, time.Millisecond},
+		{"invalid freelist", DatabaseConfig{FreelistType: "list"}, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := openDB(filepath.Join(t.TempDir(), "test.db"), tt.config, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openDB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer db.Close()
+			if db.NoSync != tt.config.NoSync || db.MaxBatchSize != tt.batchSize || db.MaxBatchDelay != tt.delay {
+				t.Errorf("NoSync %v, MaxBatchSize %d, MaxBatchDelay %v; want %v, %d, %v",
+					db.NoSync, db.MaxBatchSize, db.MaxBatchDelay, tt.config.NoSync, tt.batchSize, tt.delay)
+			}
+			if err := db.Update(migrate); err != nil {
+				t.Errorf("migrate error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckDebugAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"localhost:6060", false},
+		{"127.0.0.1:6060", false},
+		{"[::1]:6060", false},
+		{":6060", true},
+		{"0.0.0.0:6060", true},
+		{"10.0.0.5:6060", true},
+		{"localhost", true},
+	}
+
+	for _, tt := range tests {
+		if err := checkDebugAddr(tt.addr); (err != nil) != tt.wantErr {
+			t.Errorf("checkDebugAddr(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	h := debugHandler()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil || vars["memstats"] == nil {
+		t.Errorf("/debug/vars = %d, want JSON with memstats", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("/debug/pprof/ status = %d, want 200", rr.Code)
+	}
+
+	srv := newTestServer(t)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("public /debug/pprof/ status = %d, want 404", rr.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// deleteTokensBucket maps the short code of an anonymous link to the
+// SHA-256 of its deletion token. Anonymous creators have no identity to
+// prove ownership with, so the token handed out at creation is the only
+// way for them to remove the link again.
+const deleteTokensBucket = "delete_tokens"
+
+// newDeleteToken returns a random deletion token.
+func newDeleteToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashDeleteToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// putDeleteToken stores the token for short.
+func putDeleteToken(tx *bolt.Tx, short, token string) error {
+	return tx.Bucket([]byte(deleteTokensBucket)).Put([]byte(short), hashDeleteToken(token))
+}
+
+// checkDeleteToken reports whether token is the deletion token of short.
+func (s *Server) checkDeleteToken(short, token string) bool {
+	if token == "" {
+		return false
+	}
+	var ok bool
+	s.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket([]byte(deleteTokensBucket)).Get([]byte(short))
+		ok = stored != nil && subtle.ConstantTimeCompare(stored, hashDeleteToken(token)) == 1
+		return nil
+	})
+	return ok
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnonymousDeleteToken(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+
+	create := func(header, value, customID string) map[string]interface{} {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/api/create",
+			strings.NewReader(`{"url": "https://example.com", "custom_id": "`+customID+`"}`))
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("create %s status = %d: %s", customID, rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return resp
+	}
+	del := func(short, token string) int {
+		req := httptest.NewRequest("DELETE", srv.uiPrefix+"/api/delete/"+short+"?token="+token, nil)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if resp := create("X-API-Key", "k1", "keyed"); resp["delete_token"] != nil {
+		t.Errorf("owned link got a deletion token: %v", resp["delete_token"])
+	}
+
+	first, _ := create("", "", "anon-one")["delete_token"].(string)
+	second, _ := create("", "", "anon-two")["delete_token"].(string)
+	if first == "" || second == "" || first == second {
+		t.Fatalf("deletion tokens = %q, %q; want two distinct tokens", first, second)
+	}
+
+	if code := del("anon-one", ""); code != http.StatusForbidden {
+		t.Errorf("delete without token status = %d, want 403", code)
+	}
+	if code := del("anon-one", second); code != http.StatusForbidden {
+		t.Errorf("delete with another link's token status = %d, want 403", code)
+	}
+	if code := del("keyed", first); code != http.StatusForbidden {
+		t.Errorf("delete of owned link with a token status = %d, want 403", code)
+	}
+	if code := del("anon-one", first); code != http.StatusOK {
+		t.Errorf("delete with token status = %d, want 200", code)
+	}
+	if srv.checkDeleteToken("anon-one", first) {
+		t.Error("token should be removed with its link")
+	}
+
+	// The token cannot be reused on a link recreated under the same ID.
+	create("", "", "anon-one")
+	if code := del("anon-one", first); code != http.StatusForbidden {
+		t.Errorf("delete with a used token status = %d, want 403", code)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultMaxURLLength = 2048
+
+// errInvalidURL is returned when a destination URL is malformed or not
+// allowed; the wrapping error gives the reason.
+var errInvalidURL = errors.New("invalid URL")
+
+// errInternalTarget is returned for destinations on internal networks or on
+// the shortener itself.
+var errInternalTarget = errors.New("destination points at an internal address")
+
+// resolveTimeout bounds the DNS lookup of a destination host.
+const resolveTimeout = 3 * time.Second
+
+// internalNetworks are special-purpose ranges not covered by the netip
+// predicates used in internalAddr: carrier-grade NAT, IETF protocol
+// assignments and benchmarking.
+var internalNetworks = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// resolver looks up the addresses of a host; net.DefaultResolver is one.
+type resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+var defaultURLSchemes = []string{"http", "https"}
+
+// DestinationConfig restricts the URLs links may point to.
+type DestinationConfig struct {
+	// Schemes lists the allowed URL schemes.
+	Schemes []string `yaml:"schemes"`
+	// MaxLength caps the length of a destination URL in bytes.
+	MaxLength int `yaml:"max_length"`
+	// BlockInternal resolves the host of each new destination and rejects
+	// it when any address is loopback, private, link-local or otherwise
+	// internal, or when the host is the shortener's own.
+	BlockInternal bool `yaml:"block_internal"`
+}
+
+func defaultDestinations() DestinationConfig {
+	return DestinationConfig{
+		Schemes:   append([]string(nil), defaultURLSchemes...),
+		MaxLength: defaultMaxURLLength,
+	}
+}
+
+// parseDestinations validates c and returns it with normalized schemes.
+func parseDestinations(c DestinationConfig) (DestinationConfig, error) {
+	var schemes []string
+	for _, scheme := range c.Schemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme == "" {
+			continue
+		}
+		if u, err := url.Parse(scheme + ":"); err != nil || u.Scheme != scheme {
+			return c, fmt.Errorf("invalid URL scheme %q", scheme)
+		}
+		schemes = append(schemes, scheme)
+	}
+	if len(schemes) == 0 {
+		return c, errors.New("at least one URL scheme must be allowed")
+	}
+	if c.MaxLength <= 0 {
+		return c, fmt.Errorf("invalid maximum URL length %d", c.MaxLength)
+	}
+	c.Schemes = schemes
+	return c, nil
+}
+
+// withDefaultScheme prepends https:// to input that doesn't start with an
+// allowed scheme, so "example.com/page" can be shortened as typed.
+func (c DestinationConfig) withDefaultScheme(raw string) string {
+	if u, err := url.Parse(raw); err == nil && slices.Contains(c.Schemes, strings.ToLower(u.Scheme)) {
+		return raw
+	}
+	if strings.Contains(raw, "://") {
+		// Leave explicit schemes alone so validate can name the reason.
+		return raw
+	}
+	return "https://" + raw
+}
+
+// validate checks a destination URL against the configured length and
+// schemes. Web URLs must also name a host.
+func (c DestinationConfig) validate(raw string) error {
+	if len(raw) > c.MaxLength {
+		return fmt.Errorf("%w: longer than %d characters", errInvalidURL, c.MaxLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidURL, errors.Unwrap(err))
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "" {
+		return fmt.Errorf("%w: missing scheme", errInvalidURL)
+	}
+	if !slices.Contains(c.Schemes, scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed", errInvalidURL, scheme)
+	}
+	if (scheme == "http" || scheme == "https") && u.Hostname() == "" {
+		return fmt.Errorf("%w: missing host", errInvalidURL)
+	}
+	return nil
+}
+
+// ownHosts returns the hostnames the shortener is reachable under, as far
+// as the configuration tells.
+func ownHosts(cfg *Config) map[string]bool {
+	hosts := make(map[string]bool)
+	if u, err := url.Parse(cfg.BaseURL); err == nil && u.Hostname() != "" {
+		hosts[strings.ToLower(u.Hostname())] = true
+	}
+	for _, d := range cfg.Domains {
+		hosts[strings.ToLower(strings.TrimSpace(d.Host))] = true
+	}
+	for _, host := range cfg.TLS.Autocert.Domains {
+		hosts[strings.ToLower(strings.TrimSpace(host))] = true
+	}
+	return hosts
+}
+
+// internalAddr reports whether addr belongs to a network that must not be
+// reachable through a short link.
+func internalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range internalNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkInternalTarget rejects destinations that resolve to internal
+// addresses or point at the shortener itself, when enabled. The check
+// happens at creation only; a host whose DNS changes later is not caught.
+func (s *Server) checkInternalTarget(destination string) error {
+	if !s.destinations.BlockInternal {
+		return nil
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return nil
+	}
+	if s.ownHosts[host] {
+		return fmt.Errorf("%w: %s is this shortener", errInternalTarget, host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := s.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: host %s does not resolve", errInvalidURL, host)
+	}
+	for _, addr := range addrs {
+		if internalAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", errInternalTarget, host, addr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestValidateDestination(t *testing.T) {
+	c := defaultDestinations()
+	c.MaxLength = 64
+
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/page?q=1", true},
+		{"http://example.com", true},
+		{"HTTPS://example.com", true},
+		{"ftp://example.com/file", false},
+		{"javascript:alert(1)", false},
+		{"https://", false},
+		{"https:///path", false},
+		{"https://exa mple.com", false},
+		{"https://example.com/%zz", false},
+		{"example.com", false},
+		{"https://example.com/" + strings.Repeat("a", 64), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := c.validate(tt.url)
+			if tt.valid && err != nil {
+				t.Errorf("validate() error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, errInvalidURL) {
+				t.Errorf("validate() = %v, want errInvalidURL", err)
+			}
+		})
+	}
+}
+
+func TestWithDefaultScheme(t *testing.T) {
+	c := defaultDestinations()
+	c.Schemes = append(c.Schemes, "mailto")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"example.com/page", "https://example.com/page"},
+		{"http://example.com", "http://example.com"},
+		{"mailto:team@example.com", "mailto:team@example.com"},
+		{"ftp://example.com", "ftp://example.com"},
+	}
+	for _, tt := range tests {
+		if got := c.withDefaultScheme(tt.in); got != tt.want {
+			t.Errorf("withDefaultScheme(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDestinations(t *testing.T) {
+	c, err := parseDestinations(DestinationConfig{Schemes: []string{" HTTPS ", "", "mailto"}, MaxLength: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.Schemes, ",") != "https,mailto" {
+		t.Errorf("schemes = %q", c.Schemes)
+	}
+
+	for _, bad := range []DestinationConfig{
+		{MaxLength: 100},
+		{Schemes: []string{"ht tp"}, MaxLength: 100},
+		{Schemes: []string{"https"}},
+	} {
+		if _, err := parseDestinations(bad); err == nil {
+			t.Errorf("parseDestinations(%+v) succeeded", bad)
+		}
+	}
+}
+
+func TestCreateInvalidURL(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", `{"url": "https://example.com"}`, http.StatusOK},
+		{"no scheme", `{"url": "example.com"}`, http.StatusOK},
+		{"disallowed scheme", `{"url": "ftp://example.com"}`, http.StatusUnprocessableEntity},
+		{"unparseable", `{"url": "https://exa mple.com"}`, http.StatusUnprocessableEntity},
+		{"too long", `{"url": "https://example.com/` + strings.Repeat("a", defaultMaxURLLength) + `"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/sui/api/create", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+// staticResolver answers lookups from a fixed table.
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	var addrs []netip.Addr
+	for _, a := range r[host] {
+		addrs = append(addrs, netip.MustParseAddr(a))
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestCheckInternalTarget(t *testing.T) {
+	srv := newTestServer(t)
+	srv.destinations.BlockInternal = true
+	srv.ownHosts = map[string]bool{"go.example.com": true}
+	srv.resolver = staticResolver{
+		"example.com":  {"93.184.215.14"},
+		"intranet":     {"10.1.2.3"},
+		"mixed.test":   {"93.184.215.14", "192.168.1.1"},
+		"metadata.aws": {"169.254.169.254"},
+		"v6.test":      {"2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+		"ula.test":     {"fd00::1"},
+	}
+
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{"https://example.com/page", nil},
+		{"https://v6.test", nil},
+		{"https://intranet/wiki", errInternalTarget},
+		{"https://mixed.test", errInternalTarget},
+		{"http://metadata.aws/latest", errInternalTarget},
+		{"https://ula.test", errInternalTarget},
+		{"http://127.0.0.1:8080/admin", errInternalTarget},
+		{"http://[::1]/", errInternalTarget},
+		{"http://[::ffff:10.0.0.1]/", errInternalTarget},
+		{"http://100.64.0.1/", errInternalTarget},
+		{"https://go.example.com/s/loop", errInternalTarget},
+		{"https://GO.example.com./s/loop", errInternalTarget},
+		{"https://unknown.test", errInvalidURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := srv.checkInternalTarget(tt.url)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("checkInternalTarget() error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkInternalTarget() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/sui/api/create", strings.NewReader(`{"url": "http://intranet/wiki"}`))
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("create status = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	srv.destinations.BlockInternal = false
+	if err := srv.checkInternalTarget("http://intranet/wiki"); err != nil {
+		t.Errorf("disabled check failed: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// discordSystem names the Discord integration as a caller, like
+	// slackSystem.
+	discordSystem = "discord"
+	// discordAPIURL is the Discord REST API slash commands are registered
+	// with.
+	discordAPIURL = "https://discord.com/api/v10"
+
+	// Interaction and response types, and the flag of messages only the
+	// user sees, from https://discord.com/developers/docs/interactions/receiving-and-responding.
+	discordPing                = 1
+	discordApplicationCommand  = 2
+	discordPong                = 1
+	discordChannelMessage      = 4
+	discordEphemeral           = 64
+	discordStringOption        = 3
+	discordMaxSignatureAge     = 5 * time.Minute
+	discordRegistrationTimeout = 10 * time.Second
+)
+
+// DiscordConfig enables the Discord slash commands /shorten and /lookup;
+// see handleDiscordInteraction and runDiscordRegister.
+type DiscordConfig struct {
+	// PublicKey is the hex public key of the Discord application, from its
+	// General Information page. Empty disables the integration.
+	PublicKey string `yaml:"public_key"`
+	// ApplicationID and BotToken are only needed to register the commands
+	// with the discord-register command.
+	ApplicationID string `yaml:"application_id"`
+	BotToken      string `yaml:"bot_token"`
+}
+
+// parseDiscordKey returns the public key interactions are verified with,
+// or nil when the integration is disabled.
+func parseDiscordKey(c DiscordConfig) (ed25519.PublicKey, error) {
+	if c.PublicKey == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(c.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Discord public key: want %d hex-encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// discordCommands are the slash commands the integration answers.
+func discordCommands() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"name":        "shorten",
+			"description": "Shorten a link",
+			"options": []map[string]interface{}{
+				{"type": discordStringOption, "name": "url", "description": "The link to shorten", "required": true},
+				{"type": discordStringOption, "name": "custom_id", "description": "A custom short code"},
+			},
+		},
+		{
+			"name":        "lookup",
+			"description": "Show where a short link leads",
+			"options": []map[string]interface{}{
+				{"type": discordStringOption, "name": "code", "description": "The short code", "required": true},
+			},
+		},
+	}
+}
+
+// discordInteraction is the part of an interaction the handler reads.
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// option returns the value of the named command option, or "".
+func (i *discordInteraction) option(name string) string {
+	for _, o := range i.Data.Options {
+		if o.Name == name {
+			return o.Value
+		}
+	}
+	return ""
+}
+
+// verifyDiscordSignature checks the Ed25519 signature Discord sends with
+// body over its timestamp and the body.
+func verifyDiscordSignature(key ed25519.PublicKey, header http.Header, body []byte, now time.Time) bool {
+	sig, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	ts := header.Get("X-Signature-Timestamp")
+	var unix int64
+	if _, err := fmt.Sscan(ts, &unix); err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > discordMaxSignatureAge || age < -discordMaxSignatureAge {
+		return false
+	}
+	return ed25519.Verify(key, append([]byte(ts), body...), sig)
+}
+
+// handleDiscordInteraction answers Discord's pings and the /shorten and
+// /lookup commands. New links are posted in the channel; lookups and
+// refusals are shown to the user only.
+func (s *Server) handleDiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	if !verifyDiscordSignature(s.discordKey, r.Header, body, time.Now()) {
+		requestLogger(r).Warn("rejected Discord interaction")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case interaction.Type == discordPing:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"type": discordPong})
+	case interaction.Type == discordApplicationCommand && interaction.Data.Name == "shorten":
+		s.discordShorten(w, r, &interaction)
+	case interaction.Type == discordApplicationCommand && interaction.Data.Name == "lookup":
+		s.discordLookup(w, r, interaction.option("code"))
+	default:
+		writeDiscordReply(w, false, "Unknown command")
+	}
+}
+
+func (s *Server) discordShorten(w http.ResponseWriter, r *http.Request, interaction *discordInteraction) {
+	destination := s.destinations.withDefaultScheme(interaction.option("url"))
+	short, err := s.createShortLink(destination, createOptions{
+		CustomID: interaction.option("custom_id"),
+		System:   discordSystem,
+		Owner:    apiKeyOwnerPrefix + discordSystem,
+	})
+	if err != nil {
+		if createErrorStatus(err) == http.StatusInternalServerError {
+			requestLogger(r).Error("failed to create short link from Discord", "err", err)
+			writeDiscordReply(w, false, "Failed to create short link, please try again")
+			return
+		}
+		writeDiscordReply(w, false, capitalize(err.Error()))
+		return
+	}
+	requestLogger(r).Info("short link created from Discord", "short", short)
+	writeDiscordReply(w, true, fmt.Sprintf("%s → %s", s.shortURL(r, "", short), destination))
+}
+
+func (s *Server) discordLookup(w http.ResponseWriter, r *http.Request, short string) {
+	link, err := s.getLink(short)
+	if err != nil || link.Domain != "" {
+		writeDiscordReply(w, false, fmt.Sprintf("No short link %q", short))
+		return
+	}
+	msg := fmt.Sprintf("%s → %s", s.shortURL(r, "", short), link.Original)
+	switch {
+	case link.Flagged != nil || link.Disabled:
+		msg += " (disabled)"
+	case link.Expired():
+		msg += " (expired)"
+	}
+	writeDiscordReply(w, false, msg)
+}
+
+// writeDiscordReply answers an interaction with a message, shown to
+// everyone in the channel or only to the user who ran the command.
+func writeDiscordReply(w http.ResponseWriter, inChannel bool, content string) {
+	data := map[string]interface{}{
+		"content": content,
+		// Short links shouldn't ping anyone named in a destination.
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+	if !inChannel {
+		data["flags"] = discordEphemeral
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"type": discordChannelMessage, "data": data})
+}
+
+// registerDiscordCommands replaces the slash commands of the application
+// with discordCommands, in one guild when guild is set (which applies
+// immediately) or globally.
+func registerDiscordCommands(ctx context.Context, apiURL string, c DiscordConfig, guild string) error {
+	if c.ApplicationID == "" || c.BotToken == "" {
+		return fmt.Errorf("registering commands needs the Discord application ID and bot token")
+	}
+	url := apiURL + "/applications/" + c.ApplicationID + "/commands"
+	if guild != "" {
+		url = apiURL + "/applications/" + c.ApplicationID + "/guilds/" + guild + "/commands"
+	}
+	body, err := json.Marshal(discordCommands())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+c.BotToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Discord answered %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// runDiscordRegister implements the "discord-register" command, which
+// registers /shorten and /lookup with the configured Discord application.
+func runDiscordRegister(args []string) error {
+	fs := flag.NewFlagSet("discord-register", flag.ExitOnError)
+	guild := fs.String("guild", "", "register the commands in this server (guild) ID only, where they show up at once")
+	flags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), discordRegistrationTimeout)
+	defer cancel()
+	if err := registerDiscordCommands(ctx, discordAPIURL, cfg.Discord, *guild); err != nil {
+		return err
+	}
+	fmt.Println("Registered /shorten and /lookup")
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// discordRequest builds an interaction signed with key at ts.
+func discordRequest(key ed25519.PrivateKey, ts time.Time, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/sui/integrations/discord", strings.NewReader(body))
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body))))
+	return req
+}
+
+func TestParseDiscordKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantNil bool
+		wantErr bool
+	}{
+		{"disabled", "", true, false},
+		{"valid", strings.Repeat("ab", ed25519.PublicKeySize), false, false},
+		{"short", "abcd", false, true},
+		{"not hex", strings.Repeat("zz", ed25519.PublicKeySize), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseDiscordKey(DiscordConfig{PublicKey: tt.key})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDiscordKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (key == nil) != tt.wantNil {
+				t.Errorf("parseDiscordKey() = %x", key)
+			}
+		})
+	}
+}
+
+func TestDiscordInteraction(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, _ := ed25519.GenerateKey(nil)
+	t.Setenv("DISCORD_PUBLIC_KEY", hex.EncodeToString(public))
+	srv := newTestServer(t)
+	now := time.Now()
+
+	shorten := `{"type":2,"data":{"name":"shorten","options":[{"name":"url","value":"https://example.com/launch"},{"name":"custom_id","value":"launch"}]}}`
+	tests := []struct {
+		name          string
+		req           *http.Request
+		wantStatus    int
+		wantType      int
+		wantEphemeral bool
+		wantContains  string
+	}{
+		{"ping", discordRequest(private, now, `{"type":1}`), http.StatusOK, discordPong, false, ""},
+		{"shortens", discordRequest(private, now, shorten), http.StatusOK, discordChannelMessage, false, "/s/launch → https://example.com/launch"},
+		{"taken", discordRequest(private, now, shorten), http.StatusOK, discordChannelMessage, true, "already exists"},
+		{"looks up", discordRequest(private, now, `{"type":2,"data":{"name":"lookup","options":[{"name":"code","value":"launch"}]}}`), http.StatusOK, discordChannelMessage, true, "→ https://example.com/launch"},
+		{"unknown code", discordRequest(private, now, `{"type":2,"data":{"name":"lookup","options":[{"name":"code","value":"nope"}]}}`), http.StatusOK, discordChannelMessage, true, `No short link "nope"`},
+		{"wrong key", discordRequest(other, now, `{"type":1}`), http.StatusUnauthorized, 0, false, ""},
+		{"replayed", discordRequest(private, now.Add(-10*time.Minute), `{"type":1}`), http.StatusUnauthorized, 0, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, tt.req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var reply struct {
+				Type int `json:"type"`
+				Data struct {
+					Content string `json:"content"`
+					Flags   int    `json:"flags"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply.Type != tt.wantType || (reply.Data.Flags == discordEphemeral) != tt.wantEphemeral || !strings.Contains(reply.Data.Content, tt.wantContains) {
+				t.Errorf("reply = %+v, want type %d containing %q", reply, tt.wantType, tt.wantContains)
+			}
+		})
+	}
+
+	if link, err := srv.getLink("launch"); err != nil || link.Owner != "key:discord" {
+		t.Errorf("link from Discord = %+v, %v, want it owned by key:discord", link, err)
+	}
+}
+
+func TestRegisterDiscordCommands(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotCommands []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("method = %s, want PUT", r.Method)
+		}
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &gotCommands)
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	c := DiscordConfig{ApplicationID: "42", BotToken: "t0ken"}
+	if err := registerDiscordCommands(context.Background(), ts.URL, c, "7"); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/applications/42/guilds/7/commands" || gotAuth != "Bot t0ken" || len(gotCommands) != 2 {
+		t.Errorf("registered %d commands at %s with %q", len(gotCommands), gotPath, gotAuth)
+	}
+	if err := registerDiscordCommands(context.Background(), ts.URL, c, ""); err != nil || gotPath != "/applications/42/commands" {
+		t.Errorf("global registration at %s, error %v", gotPath, err)
+	}
+	if err := registerDiscordCommands(context.Background(), ts.URL, DiscordConfig{}, ""); err == nil {
+		t.Error("registered without an application ID and token")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// DomainConfig is an additional hostname with its own short links. Links
+// created for a domain only resolve on that host, while any other host
+// serves the links created without one.
+type DomainConfig struct {
+	Host string `yaml:"host"`
+	// Prefix is the path short links are served under on this host. It
+	// defaults to the short prefix; "/" serves them at the root, as in
+	// go.corp.com/docs.
+	Prefix string `yaml:"prefix"`
+	// AppLinks are this host's app association files, in place of the
+	// default ones.
+	AppLinks AppLinksConfig `yaml:"app_links"`
+}
+
+// parseDomains validates the configured domains and maps each host to its
+// short link prefix.
+func parseDomains(domains []DomainConfig, defaultPrefix string) (map[string]string, error) {
+	prefixes := make(map[string]string)
+	for _, d := range domains {
+		host := strings.ToLower(strings.TrimSpace(d.Host))
+		if host == "" || strings.ContainsAny(host, ":/") {
+			return nil, fmt.Errorf("invalid domain %q: give a bare hostname", d.Host)
+		}
+		if _, dup := prefixes[host]; dup {
+			return nil, fmt.Errorf("domain %q is configured twice", host)
+		}
+
+		prefix := strings.TrimSpace(d.Prefix)
+		switch {
+		case prefix == "":
+			prefix = defaultPrefix
+		case prefix == "/":
+			prefix = ""
+		case !strings.HasPrefix(prefix, "/"):
+			return nil, fmt.Errorf("invalid prefix %q for domain %s: must start with /", d.Prefix, host)
+		}
+		prefixes[host] = strings.TrimRight(prefix, "/")
+	}
+	return prefixes, nil
+}
+
+// requestDomain returns the configured domain the request was made to, or
+// "" for any other host.
+func (s *Server) requestDomain(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if _, ok := s.domains[host]; ok {
+		return host
+	}
+	return ""
+}
+
+// domainNames returns the configured domains, sorted.
+func (s *Server) domainNames() []string {
+	names := make([]string, 0, len(s.domains))
+	for host := range s.domains {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createDomain picks the domain a new link belongs to: the one requested,
+// or else the domain the request was made to.
+func (s *Server) createDomain(r *http.Request, requested string, given bool) (string, error) {
+	if !given {
+		return s.requestDomain(r), nil
+	}
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if _, ok := s.domains[requested]; requested != "" && !ok {
+		return "", fmt.Errorf("unknown domain %q", requested)
+	}
+	return requested, nil
+}
+
+// linkCacheKey is the redirect cache key of a short code on domain.
+func linkCacheKey(domain, short string) string {
+	if domain == "" {
+		return short
+	}
+	return domain + "/" + short
+}
+
+// setupDomainRoutes serves redirects under each domain's own prefix. They
+// are registered after every other route, so a domain serving short links
+// at its root doesn't shadow the UI, health and metrics endpoints.
+func (s *Server) setupDomainRoutes() {
+	for _, host := range s.domainNames() {
+		prefix := s.domains[host]
+		if prefix == s.prefix {
+			continue
+		}
+		host := host
+		onHost := func(r *http.Request, _ *mux.RouteMatch) bool {
+			return s.requestDomain(r) == host
+		}
+		s.router.MatcherFunc(onHost).Path(prefix + "/{short}").Methods("GET").HandlerFunc(s.handleRedirect)
+		s.router.MatcherFunc(onHost).Path(prefix + "/{namespace}/{slug}").Methods("GET").HandlerFunc(namespaced(s.handleRedirect))
+	}
+}
+
+// domainBase returns the URL short codes on domain are appended to.
+func (s *Server) domainBase(r *http.Request, domain string) string {
+	if domain == "" {
+		return s.shortBase(r)
+	}
+	scheme := s.scheme(r)
+	if u, err := url.Parse(s.baseURL); err == nil && s.baseURL != "" {
+		scheme = u.Scheme
+	}
+	return scheme + "://" + domain + s.domains[domain]
+}
+
+// shortBases maps each domain, with "" for the default one, to its
+// domainBase, for templates listing links from several domains.
+func (s *Server) shortBases(r *http.Request) map[string]string {
+	bases := map[string]string{"": s.shortBase(r)}
+	for host := range s.domains {
+		bases[host] = s.domainBase(r, host)
+	}
+	return bases
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDomains(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []DomainConfig
+		want    map[string]string
+		wantErr bool
+	}{
+		{"default prefix", []DomainConfig{{Host: "S.Brand.com"}}, map[string]string{"s.brand.com": "/s"}, false},
+		{"root", []DomainConfig{{Host: "go.corp.com", Prefix: "/"}}, map[string]string{"go.corp.com": ""}, false},
+		{"custom prefix", []DomainConfig{{Host: "go.corp.com", Prefix: "/l/"}}, map[string]string{"go.corp.com": "/l"}, false},
+		{"port", []DomainConfig{{Host: "go.corp.com:8080"}}, nil, true},
+		{"empty host", []DomainConfig{{Prefix: "/x"}}, nil, true},
+		{"relative prefix", []DomainConfig{{Host: "go.corp.com", Prefix: "l"}}, nil, true},
+		{"duplicate", []DomainConfig{{Host: "go.corp.com"}, {Host: "GO.corp.com"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDomains(tt.domains, "/s")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDomains() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseDomains() = %v, want %v", got, tt.want)
+			}
+			for host, prefix := range tt.want {
+				if got[host] != prefix {
+					t.Errorf("prefix of %s = %q, want %q", host, got[host], prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestDomainLinks(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DBPath = filepath.Join(t.TempDir(), "links.db")
+	cfg.Domains = []DomainConfig{{Host: "go.corp.com", Prefix: "/"}}
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	srv.setupRoutes()
+
+	create := func(host, body string) (int, string) {
+		req := httptest.NewRequest("POST", "http://"+host+"/sui/api/create", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		var resp struct {
+			ShortURL string `json:"short_url"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp.ShortURL
+	}
+	get := func(url string) int {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		return rr.Code
+	}
+
+	if code, shortURL := create("example.com", `{"url": "https://example.org/docs", "custom_id": "docs", "domain": "go.corp.com"}`); code != http.StatusOK || shortURL != "http://go.corp.com/docs" {
+		t.Fatalf("create on domain = %d, %q", code, shortURL)
+	}
+	// Created on the domain's own host, a link belongs to it by default.
+	if code, shortURL := create("go.corp.com:8080", `{"url": "https://example.org/wiki", "custom_id": "wiki"}`); code != http.StatusOK || shortURL != "http://go.corp.com/wiki" {
+		t.Fatalf("create from domain host = %d, %q", code, shortURL)
+	}
+	if code, shortURL := create("example.com", `{"url": "https://example.org", "custom_id": "plain"}`); code != http.StatusOK || shortURL != "http://example.com/s/plain" {
+		t.Fatalf("create on default domain = %d, %q", code, shortURL)
+	}
+	if code, _ := create("example.com", `{"url": "https://example.org", "domain": "unknown.com"}`); code != http.StatusBadRequest {
+		t.Errorf("create on unknown domain = %d, want 400", code)
+	}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"http://go.corp.com/docs", http.StatusFound},
+		{"http://GO.corp.com:8080/wiki", http.StatusFound},
+		{"http://example.com/s/docs", http.StatusNotFound},
+		{"http://go.corp.com/plain", http.StatusNotFound},
+		{"http://example.com/s/plain", http.StatusFound},
+		{"http://go.corp.com/healthz", http.StatusOK},
+		{"http://go.corp.com/sui/api/version", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := get(tt.url); got != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.url, got, tt.want)
+		}
+	}
+}
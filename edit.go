@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Expired reports whether the link is past its expiry.
+func (l *Link) Expired() bool {
+	return l.ExpiresAt != nil && !time.Now().Before(*l.ExpiresAt)
+}
+
+// linkUpdate is the body of a PATCH request; absent fields are left
+// unchanged.
+type linkUpdate struct {
+	URL  *string   `json:"url"`
+	Tags *[]string `json:"tags"`
+	// ExpiresAt is an RFC 3339 time or date, or null to remove the expiry.
+	ExpiresAt json.RawMessage `json:"expires_at"`
+	Disabled  *bool           `json:"disabled"`
+	// NoMetaRefresh turns the periodic metadata refresh of the link off
+	// or on again.
+	NoMetaRefresh *bool `json:"no_meta_refresh"`
+}
+
+// expiry parses ExpiresAt. set is false when the field is absent, and
+// expires nil when it removes the expiry.
+func (u *linkUpdate) expiry() (expires *time.Time, set bool, err error) {
+	if len(u.ExpiresAt) == 0 {
+		return nil, false, nil
+	}
+	if bytes.Equal(u.ExpiresAt, []byte("null")) {
+		return nil, true, nil
+	}
+	var value string
+	if err := json.Unmarshal(u.ExpiresAt, &value); err != nil {
+		return nil, false, errors.New("expires_at must be a time, a date or null")
+	}
+	if value == "" {
+		return nil, true, nil
+	}
+	t, err := parseTimeParam(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return &t, true, nil
+}
+
+// handleAPIUpdate changes the destination, tags, expiry, disabled state or
+// metadata refresh of a link with PATCH {"url": ..., "tags": [...],
+// "expires_at": ..., "disabled": ..., "no_meta_refresh": ...}, and returns
+// the updated link.
+func (s *Server) handleAPIUpdate(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	short := mux.Vars(r)["short"]
+	link, err := s.getLink(short)
+	if err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+
+	var req linkUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	var destination string
+	if req.URL != nil && link.Paste != nil {
+		http.Error(w, "Pastes have no destination to change", http.StatusBadRequest)
+		return
+	}
+	if req.URL != nil {
+		destination = s.destinations.withDefaultScheme(*req.URL)
+		if err := s.checkDestination(destination); err != nil {
+			http.Error(w, "Failed to update link: "+err.Error(), createErrorStatus(err))
+			return
+		}
+	}
+	var tags []string
+	if req.Tags != nil {
+		if tags, err = normalizeTags(*req.Tags); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	expires, setExpiry, err := req.expiry()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var moved bool
+	err = s.updateLink(short, func(link *Link) {
+		if req.URL != nil && destination != link.Original {
+			moved = true
+			link.Original = destination
+			// The new destination passed the threat check, but an
+			// admin's decisions about the old one don't carry over.
+			link.Trusted = false
+			if link.Flagged != nil && link.Flagged.Source != "admin" {
+				link.Flagged = nil
+			}
+			link.Meta = nil
+		}
+		if req.Tags != nil {
+			link.Tags = tags
+		}
+		if setExpiry {
+			link.ExpiresAt = expires
+		}
+		if req.Disabled != nil {
+			link.Disabled = *req.Disabled
+		}
+		if req.NoMetaRefresh != nil {
+			link.NoMetaRefresh = *req.NoMetaRefresh
+		}
+	})
+	if err != nil {
+		http.Error(w, "Failed to update link", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("link updated", "short", short)
+	if moved {
+		s.metadata.enqueue(short, destination)
+	}
+
+	link, err = s.getLink(short)
+	if err != nil {
+		http.Error(w, "Failed to update link", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
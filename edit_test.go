@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIUpdate(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	if _, err := srv.createShortLink("https://example.com/old", createOptions{CustomID: "promo", Owner: "alice", Tags: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(cookie *http.Cookie, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/sui/api/links/promo", strings.NewReader(body))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+	redirect := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/promo", nil))
+		return rr
+	}
+	// Warm the cache so the update has to invalidate it.
+	redirect()
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		body   string
+		want   int
+	}{
+		{"other user", bob, `{"url": "https://evil.test/"}`, http.StatusForbidden},
+		{"invalid destination", alice, `{"url": "javascript:alert(1)"}`, http.StatusUnprocessableEntity},
+		{"invalid tag", alice, `{"tags": ["no spaces"]}`, http.StatusBadRequest},
+		{"invalid expiry", alice, `{"expires_at": "soon"}`, http.StatusBadRequest},
+		{"invalid body", alice, `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rr := patch(tt.cookie, tt.body); rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.want)
+		}
+	}
+
+	rr := patch(alice, `{"url": "example.com/new", "tags": ["Spring", "sale"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var link Link
+	json.NewDecoder(rr.Body).Decode(&link)
+	if link.Original != "https://example.com/new" || strings.Join(link.Tags, ",") != "spring,sale" || link.ExpiresAt != nil {
+		t.Errorf("updated link = %+v", link)
+	}
+	if loc := redirect().Header().Get("Location"); loc != "https://example.com/new" {
+		t.Errorf("redirect after update = %q", loc)
+	}
+
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	if rr := patch(alice, `{"expires_at": "`+past+`"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expiry update = %d", rr.Code)
+	}
+	if code := redirect().Code; code != http.StatusGone {
+		t.Errorf("redirect of expired link = %d, want 410", code)
+	}
+	if rr := patch(alice, `{"expires_at": null}`); rr.Code != http.StatusOK {
+		t.Fatalf("expiry removal = %d", rr.Code)
+	}
+	if code := redirect().Code; code != http.StatusFound {
+		t.Errorf("redirect after removing the expiry = %d, want 302", code)
+	}
+	if rr := patch(alice, `{"disabled": true}`); rr.Code != http.StatusOK {
+		t.Fatalf("disabling = %d", rr.Code)
+	}
+	if code := redirect().Code; code != http.StatusGone {
+		t.Errorf("redirect of disabled link = %d, want 410", code)
+	}
+	if rr := patch(alice, `{"no_meta_refresh": true}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"no_meta_refresh":true`) {
+		t.Errorf("turning the metadata refresh off = %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpdateClearsThreatFlag(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	threats := fakeThreats{"https://bad.test/": "malware"}
+	srv.threats = threats
+	if _, err := srv.createShortLink("https://fine.test/", createOptions{CustomID: "fix", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	threats["https://fine.test/"] = "malware"
+	if n, _ := srv.scanLinks(context.Background()); n != 1 {
+		t.Fatal("link was not flagged")
+	}
+
+	req := httptest.NewRequest("PATCH", "/sui/api/links/fix", strings.NewReader(`{"url": "https://bad.test/"}`))
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("update to a listed destination = %d, want 403", rr.Code)
+	}
+
+	req = httptest.NewRequest("PATCH", "/sui/api/links/fix", strings.NewReader(`{"url": "https://other.test/"}`))
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if link, _ := srv.getLink("fix"); rr.Code != http.StatusOK || link.Flagged != nil {
+		t.Errorf("update to a clean destination = %d, flag %+v", rr.Code, link.Flagged)
+	}
+}
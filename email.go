@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// emailSystem names the email gateway as a caller, like slackSystem:
+	// links mailed in are owned by "key:email".
+	emailSystem = "email"
+	// defaultEmailPollInterval is how often the mailbox is checked.
+	defaultEmailPollInterval = time.Minute
+	// emailMaxURLs caps the links created from one message.
+	emailMaxURLs = 10
+	// emailMaxBytes is how much of each message is fetched; URLs are
+	// looked for in its text, not in attachments.
+	emailMaxBytes = 256 << 10
+	// emailTimeout bounds one check of the mailbox.
+	emailTimeout = 2 * time.Minute
+)
+
+// errEmailIgnored marks a message the gateway doesn't answer: automatic
+// replies, mailing lists and senders that aren't allowed.
+var errEmailIgnored = errors.New("message ignored")
+
+// emailURLPattern finds the URLs in a message.
+var emailURLPattern = regexp.MustCompile(`https?://[^\s<>"'()\[\]{}]+`)
+
+// EmailConfig enables the email gateway: messages sent to the mailbox are
+// answered with short links for the URLs in them; see answerEmail.
+type EmailConfig struct {
+	// IMAPAddr is the host:port of the IMAP server, reached over TLS
+	// (usually port 993). Empty disables the gateway.
+	IMAPAddr string `yaml:"imap_addr"`
+	// SMTPAddr is the host:port replies are sent through, with STARTTLS
+	// (usually port 587).
+	SMTPAddr string `yaml:"smtp_addr"`
+	// Username and Password log in to both servers.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Mailbox is the IMAP folder checked for new messages.
+	Mailbox string `yaml:"mailbox"`
+	// From is the address replies come from, as "go@example.com" or
+	// "Short links <go@example.com>"; defaults to Username.
+	From string `yaml:"from"`
+	// PollInterval is how often the mailbox is checked.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// AllowedSenders restricts who may use the gateway, as addresses or
+	// "@domain", and is required. Sender addresses are easily forged, so
+	// this keeps out strangers rather than attackers.
+	AllowedSenders []string `yaml:"allowed_senders"`
+}
+
+func (c EmailConfig) enabled() bool {
+	return c.IMAPAddr != ""
+}
+
+// from returns the address replies are sent from, possibly with a name.
+func (c EmailConfig) from() string {
+	if c.From != "" {
+		return c.From
+	}
+	return c.Username
+}
+
+// fromAddress returns the bare address replies are sent from.
+func (c EmailConfig) fromAddress() string {
+	if a, err := mail.ParseAddress(c.from()); err == nil {
+		return a.Address
+	}
+	return c.from()
+}
+
+// checkEmailConfig validates c, which needs baseURL to write short links
+// without a request to derive them from.
+func checkEmailConfig(c EmailConfig, baseURL string) error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.SMTPAddr == "" || c.Username == "" {
+		return errors.New("email gateway needs an SMTP address and a username")
+	}
+	if baseURL == "" {
+		return errors.New("email gateway needs a base URL")
+	}
+	if _, err := mail.ParseAddress(c.from()); err != nil {
+		return fmt.Errorf("invalid email from address %q: %w", c.from(), err)
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("invalid email poll interval %v", c.PollInterval)
+	}
+	// Without a list, anyone could have the gateway create links and send
+	// mail to any address they put in From.
+	if len(c.AllowedSenders) == 0 {
+		return errors.New("email gateway needs allowed senders")
+	}
+	return nil
+}
+
+// senderAllowed reports whether address may use the gateway.
+func (c EmailConfig) senderAllowed(address string) bool {
+	address = strings.ToLower(address)
+	for _, allowed := range c.AllowedSenders {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if address == allowed || strings.HasPrefix(allowed, "@") && strings.HasSuffix(address, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollEmail checks the mailbox now and then every poll interval until ctx
+// is done. Checks are skipped in maintenance mode, which promises not to
+// write.
+func (s *Server) pollEmail(ctx context.Context) {
+	ticker := time.NewTicker(s.email.PollInterval)
+	defer ticker.Stop()
+	for {
+		if !s.maintenance().Enabled {
+			if n, err := s.checkEmail(); err != nil {
+				slog.Error("email check failed", "err", err)
+			} else if n > 0 {
+				slog.Info("email check finished", "answered", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkEmail answers the unread messages in the mailbox, returning how
+// many were answered. Each is marked read before its reply is sent, so a
+// failed reply doesn't create the same links again on the next check.
+func (s *Server) checkEmail() (int, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", s.email.IMAPAddr, nil)
+	if err != nil {
+		return 0, err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+	c, err := newIMAPClient(conn)
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	defer c.logout()
+
+	if err := c.login(s.email.Username, s.email.Password); err != nil {
+		return 0, err
+	}
+	if err := c.selectMailbox(s.email.Mailbox); err != nil {
+		return 0, err
+	}
+	uids, err := c.searchUnseen()
+	if err != nil {
+		return 0, err
+	}
+	answered := 0
+	for _, uid := range uids {
+		raw, err := c.fetch(uid, emailMaxBytes)
+		if err != nil {
+			return answered, err
+		}
+		if err := c.markSeen(uid); err != nil {
+			return answered, err
+		}
+		to, reply, err := s.answerEmail(raw, time.Now())
+		if errors.Is(err, errEmailIgnored) {
+			continue
+		}
+		if err != nil {
+			slog.Warn("failed to read email", "uid", uid, "err", err)
+			continue
+		}
+		if err := s.sendEmail(to, reply); err != nil {
+			slog.Error("failed to send email reply", "to", to, "err", err)
+			continue
+		}
+		answered++
+	}
+	return answered, nil
+}
+
+// sendEmail sends msg to the address to through the SMTP server.
+func (s *Server) sendEmail(to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.email.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	auth := smtp.PlainAuth("", s.email.Username, s.email.Password, host)
+	return smtp.SendMail(s.email.SMTPAddr, auth, s.email.fromAddress(), []string{to}, msg)
+}
+
+// answerEmail creates a short link for each URL in the subject and text
+// of the message raw and returns the reply listing them, along with the
+// address it goes to. Automatic mail and senders that aren't allowed get
+// errEmailIgnored, so the gateway never answers a bounce or another
+// robot. The reply has a fixed subject rather than echoing the sender's,
+// so it can't carry text of the sender's choosing to a forged address.
+func (s *Server) answerEmail(raw []byte, now time.Time) (to string, reply []byte, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", nil, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	if auto := strings.ToLower(msg.Header.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		return "", nil, errEmailIgnored
+	}
+	switch strings.ToLower(msg.Header.Get("Precedence")) {
+	case "bulk", "junk", "list":
+		return "", nil, errEmailIgnored
+	}
+	if msg.Header.Get("List-Id") != "" || strings.EqualFold(from.Address, s.email.fromAddress()) {
+		return "", nil, errEmailIgnored
+	}
+	if !s.email.senderAllowed(from.Address) {
+		slog.Warn("email from sender not allowed", "from", from.Address)
+		return "", nil, errEmailIgnored
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	text := subject + "\n" + emailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+
+	var lines []string
+	for _, destination := range findEmailURLs(text) {
+		short, err := s.createShortLink(destination, createOptions{
+			System: emailSystem,
+			Owner:  apiKeyOwnerPrefix + emailSystem,
+		})
+		if err != nil {
+			if createErrorStatus(err) == http.StatusInternalServerError {
+				slog.Error("failed to create short link from email", "err", err)
+				err = errors.New("failed to create short link, please try again")
+			}
+			lines = append(lines, fmt.Sprintf("%s\n  %s", destination, capitalize(err.Error())))
+			continue
+		}
+		slog.Info("short link created from email", "short", short, "from", from.Address)
+		lines = append(lines, fmt.Sprintf("%s\n  → %s", destination, s.shortURL(nil, "", short)))
+	}
+	body := "Send a message with the links to shorten in its subject or text, and the\nshort links come back by reply.\n"
+	if len(lines) > 0 {
+		body = strings.Join(lines, "\n\n") + "\n"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.email.from())
+	fmt.Fprintf(&b, "To: %s\r\n", from.String())
+	b.WriteString("Subject: Your short links\r\n")
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	if id := msg.Header.Get("Message-Id"); id != "" {
+		fmt.Fprintf(&b, "In-Reply-To: %s\r\n", id)
+		fmt.Fprintf(&b, "References: %s\r\n", strings.TrimSpace(msg.Header.Get("References")+" "+id))
+	}
+	b.WriteString("Auto-Submitted: auto-replied\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return from.Address, b.Bytes(), nil
+}
+
+// findEmailURLs returns the distinct URLs in text, up to emailMaxURLs.
+func findEmailURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range emailURLPattern.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:!?")
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+		if len(urls) == emailMaxURLs {
+			break
+		}
+	}
+	return urls
+}
+
+// emailText returns the text of a message body with the given content
+// type and transfer encoding, preferring its plain text parts. As only the
+// start of each message is fetched, a cut-off body yields what could be
+// read.
+func emailText(contentType, encoding string, body io.Reader) string {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, newlineSkipper{body})
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		if !strings.HasPrefix(mediaType, "text/") {
+			return ""
+		}
+		data, _ := io.ReadAll(body)
+		return string(data)
+	}
+
+	var plain, other []string
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		text := emailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+		if t, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); t == "text/plain" || t == "" {
+			plain = append(plain, text)
+		} else {
+			other = append(other, text)
+		}
+	}
+	if len(plain) > 0 {
+		return strings.Join(plain, "\n")
+	}
+	return strings.Join(other, "\n")
+}
+
+// newlineSkipper drops the line breaks base64 bodies are wrapped with.
+type newlineSkipper struct{ r io.Reader }
+
+func (n newlineSkipper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	kept := p[:0]
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			kept = append(kept, b)
+		}
+	}
+	return len(kept), err
+}
+
+// imapClient speaks just enough IMAP4rev1 (RFC 3501) to read new messages
+// and mark them read.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is an untagged response line, with the literal sent in it,
+// if any.
+type imapResponse struct {
+	line    string
+	literal []byte
+}
+
+// newIMAPClient reads the greeting of the server on conn.
+func newIMAPClient(conn net.Conn) (*imapClient, error) {
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return nil, fmt.Errorf("unexpected IMAP greeting %q", line)
+	}
+	return c, nil
+}
+
+func (c *imapClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// command sends cmd and returns the untagged responses to it, failing
+// unless the server answers OK.
+func (c *imapClient) command(cmd string) ([]imapResponse, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+	var responses []imapResponse
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := strings.CutPrefix(line, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				verb, _, _ := strings.Cut(cmd, " ")
+				return nil, fmt.Errorf("IMAP %s failed: %s", verb, status)
+			}
+			return responses, nil
+		}
+		resp := imapResponse{line: line}
+		// A line ending in {n} is followed by n bytes of data and then the
+		// rest of the line.
+		for strings.HasSuffix(line, "}") {
+			i := strings.LastIndexByte(line, '{')
+			if i < 0 {
+				break
+			}
+			n, err := strconv.Atoi(line[i+1 : len(line)-1])
+			if err != nil || n < 0 {
+				break
+			}
+			literal := make([]byte, n)
+			if _, err := io.ReadFull(c.r, literal); err != nil {
+				return nil, err
+			}
+			resp.literal = append(resp.literal, literal...)
+			if line, err = c.readLine(); err != nil {
+				return nil, err
+			}
+			resp.line += line
+		}
+		responses = append(responses, resp)
+	}
+}
+
+// imapQuote returns s as an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (c *imapClient) login(username, password string) error {
+	_, err := c.command("LOGIN " + imapQuote(username) + " " + imapQuote(password))
+	return err
+}
+
+func (c *imapClient) selectMailbox(name string) error {
+	_, err := c.command("SELECT " + imapQuote(name))
+	return err
+}
+
+// searchUnseen returns the UIDs of the unread messages.
+func (c *imapClient) searchUnseen() ([]uint32, error) {
+	responses, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, resp := range responses {
+		rest, ok := strings.CutPrefix(resp.line, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(rest) {
+			uid, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IMAP search result %q", resp.line)
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns up to the first limit bytes of the message uid, leaving it
+// unread.
+func (c *imapClient) fetch(uid uint32, limit int) ([]byte, error) {
+	responses, err := c.command(fmt.Sprintf("UID FETCH %d (BODY.PEEK[]<0.%d>)", uid, limit))
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range responses {
+		if resp.literal != nil && strings.Contains(resp.line, " FETCH ") {
+			return resp.literal, nil
+		}
+	}
+	return nil, fmt.Errorf("IMAP message %d not found", uid)
+}
+
+func (c *imapClient) markSeen(uid uint32) error {
+	_, err := c.command(fmt.Sprintf(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid))
+	return err
+}
+
+// logout ends the session and closes the connection.
+func (c *imapClient) logout() error {
+	_, err := c.command("LOGOUT")
+	c.conn.Close()
+	return err
+}
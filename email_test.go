@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckEmailConfig(t *testing.T) {
+	valid := EmailConfig{IMAPAddr: "imap.example.com:993", SMTPAddr: "smtp.example.com:587", Username: "go@example.com", PollInterval: time.Minute, AllowedSenders: []string{"@corp.com"}}
+	tests := []struct {
+		name    string
+		modify  func(c *EmailConfig)
+		baseURL string
+		wantErr bool
+	}{
+		{"disabled", func(c *EmailConfig) { *c = EmailConfig{} }, "", false},
+		{"valid", func(c *EmailConfig) {}, "https://go.example.com", false},
+		{"named from", func(c *EmailConfig) { c.From = "Short links <go@example.com>" }, "https://go.example.com", false},
+		{"no base URL", func(c *EmailConfig) {}, "", true},
+		{"no SMTP", func(c *EmailConfig) { c.SMTPAddr = "" }, "https://go.example.com", true},
+		{"invalid from", func(c *EmailConfig) { c.From = "not an address" }, "https://go.example.com", true},
+		{"no interval", func(c *EmailConfig) { c.PollInterval = 0 }, "https://go.example.com", true},
+		{"no allowed senders", func(c *EmailConfig) { c.AllowedSenders = nil }, "https://go.example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			if err := checkEmailConfig(c, tt.baseURL); (err != nil) != tt.wantErr {
+				t.Fatalf("checkEmailConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmailSenderAllowed(t *testing.T) {
+	c := EmailConfig{AllowedSenders: []string{"kiosk@example.org", " @Corp.com"}}
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"kiosk@example.org", true},
+		{"Kiosk@Example.org", true},
+		{"alice@corp.com", true},
+		{"alice@notcorp.com", false},
+		{"other@example.org", false},
+	}
+	for _, tt := range tests {
+		if got := c.senderAllowed(tt.address); got != tt.want {
+			t.Errorf("senderAllowed(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+	if (EmailConfig{}).senderAllowed("anyone@example.net") {
+		t.Error("no allowed senders should allow nobody")
+	}
+}
+
+func TestFindEmailURLs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"nothing here", nil},
+		{"See https://example.com/a.", []string{"https://example.com/a"}},
+		{"<https://example.com/a> and (http://example.org/b?x=1), https://example.com/a", []string{"https://example.com/a", "http://example.org/b?x=1"}},
+	}
+	for _, tt := range tests {
+		if got := findEmailURLs(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findEmailURLs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEmailText(t *testing.T) {
+	multipartBody := "--b\r\n" +
+		"Content-Type: text/html\r\n\r\n" +
+		"<a href=\"https://example.com/html\">link</a>\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"https://example.com/very-long-path-that-is-wrapped-by-quoted-printab=\r\nle\r\n" +
+		"--b--\r\n"
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		want        string
+	}{
+		{"plain", "", "", "https://example.com", "https://example.com"},
+		{"base64", "text/plain", "base64", "aHR0cHM6Ly9leGFt\r\ncGxlLmNvbQ==", "https://example.com"},
+		{"attachment", "application/pdf", "", "%PDF", ""},
+		{"multipart prefers plain text", `multipart/alternative; boundary="b"`, "", multipartBody, "https://example.com/very-long-path-that-is-wrapped-by-quoted-printable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := emailText(tt.contentType, tt.encoding, strings.NewReader(tt.body))
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("emailText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnswerEmail(t *testing.T) {
+	t.Setenv("BASE_URL", "https://go.example.com")
+	srv := newTestServer(t)
+	srv.email = EmailConfig{Username: "go@example.com", AllowedSenders: []string{"@corp.com"}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("shortens each URL", func(t *testing.T) {
+		raw := "From: Alice <alice@corp.com>\r\n" +
+			"Subject: https://example.com/one\r\n" +
+			"Message-ID: <m1@corp.com>\r\n\r\n" +
+			"And https://example.com/two, please.\r\n"
+		to, reply, err := srv.answerEmail([]byte(raw), now)
+		if err != nil {
+			t.Fatalf("answerEmail() error: %v", err)
+		}
+		if to != "alice@corp.com" {
+			t.Errorf("to = %q, want alice@corp.com", to)
+		}
+		links, _ := srv.getAllLinks(func(link *Link) bool { return link.Owner == apiKeyOwnerPrefix+emailSystem })
+		if len(links) != 2 {
+			t.Fatalf("created %d links, want 2", len(links))
+		}
+		for _, want := range []string{
+			"To: \"Alice\" <alice@corp.com>\r\n",
+			"Subject: Your short links\r\n",
+			"In-Reply-To: <m1@corp.com>\r\n",
+			"Auto-Submitted: auto-replied\r\n",
+			"https://go.example.com/s/" + links[0].Short,
+			"https://go.example.com/s/" + links[1].Short,
+		} {
+			if !strings.Contains(string(reply), want) {
+				t.Errorf("reply is missing %q:\n%s", want, reply)
+			}
+		}
+	})
+
+	t.Run("explains usage without URLs", func(t *testing.T) {
+		_, reply, err := srv.answerEmail([]byte("From: alice@corp.com\r\nSubject: hi\r\n\r\nhello\r\n"), now)
+		if err != nil {
+			t.Fatalf("answerEmail() error: %v", err)
+		}
+		if !strings.Contains(string(reply), "Send a message with the links to shorten") {
+			t.Errorf("reply = %s, want usage", reply)
+		}
+	})
+
+	t.Run("reports refused destinations", func(t *testing.T) {
+		long := "https://example.com/" + strings.Repeat("a", srv.destinations.MaxLength)
+		_, reply, err := srv.answerEmail([]byte("From: alice@corp.com\r\n\r\n"+long+"\r\n"), now)
+		if err != nil {
+			t.Fatalf("answerEmail() error: %v", err)
+		}
+		if strings.Contains(string(reply), "go.example.com") || !strings.Contains(string(reply), "longer than") {
+			t.Errorf("reply = %s, want the destination refused", reply)
+		}
+	})
+
+	ignored := []struct {
+		name string
+		raw  string
+	}{
+		{"sender not allowed", "From: mallory@example.net\r\n\r\nhttps://example.com\r\n"},
+		{"automatic reply", "From: alice@corp.com\r\nAuto-Submitted: auto-replied\r\n\r\nhttps://example.com\r\n"},
+		{"mailing list", "From: alice@corp.com\r\nList-Id: <team.corp.com>\r\n\r\nhttps://example.com\r\n"},
+		{"own address", "From: go@example.com\r\n\r\nhttps://example.com\r\n"},
+	}
+	for _, tt := range ignored {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := srv.answerEmail([]byte(tt.raw), now); !errors.Is(err, errEmailIgnored) {
+				t.Errorf("answerEmail() error = %v, want errEmailIgnored", err)
+			}
+		})
+	}
+}
+
+func TestIMAPClient(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	message := "From: alice@corp.com\r\n\r\nhttps://example.com\r\n"
+
+	// The server answers each command it expects with the given lines,
+	// "TAG" standing for the command's tag.
+	script := []struct {
+		command string
+		reply   []string
+	}{
+		{`LOGIN "go@example.com" "p\"w"`, []string{"TAG OK logged in"}},
+		{`SELECT "INBOX"`, []string{"* 2 EXISTS", "TAG OK [READ-WRITE] selected"}},
+		{"UID SEARCH UNSEEN", []string{"* SEARCH 4 7", "TAG OK done"}},
+		{"UID FETCH 4 (BODY.PEEK[]<0.1024>)", []string{"* 1 FETCH (UID 4 BODY[]<0> {" + strconv.Itoa(len(message)) + "}\r\n" + message + ")", "TAG OK done"}},
+		{`UID STORE 4 +FLAGS.SILENT (\Seen)`, []string{"TAG NO read-only"}},
+	}
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		server.Write([]byte("* OK IMAP ready\r\n"))
+		for _, step := range script {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			if command != step.command {
+				server.Write([]byte(tag + " BAD unexpected " + command + "\r\n"))
+				return
+			}
+			for _, reply := range step.reply {
+				server.Write([]byte(strings.Replace(reply, "TAG", tag, 1) + "\r\n"))
+			}
+		}
+	}()
+
+	c, err := newIMAPClient(client)
+	if err != nil {
+		t.Fatalf("newIMAPClient() error: %v", err)
+	}
+	if err := c.login("go@example.com", `p"w`); err != nil {
+		t.Fatalf("login() error: %v", err)
+	}
+	if err := c.selectMailbox("INBOX"); err != nil {
+		t.Fatalf("selectMailbox() error: %v", err)
+	}
+	uids, err := c.searchUnseen()
+	if err != nil || !reflect.DeepEqual(uids, []uint32{4, 7}) {
+		t.Fatalf("searchUnseen() = %v, %v, want [4 7]", uids, err)
+	}
+	raw, err := c.fetch(4, 1024)
+	if err != nil || string(raw) != message {
+		t.Fatalf("fetch() = %q, %v, want %q", raw, err, message)
+	}
+	if err := c.markSeen(4); err == nil || !strings.Contains(err.Error(), "NO read-only") {
+		t.Errorf("markSeen() error = %v, want the server's refusal", err)
+	}
+}
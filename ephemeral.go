@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// ephemeralPrefix starts the short code of every ephemeral link. It
+	// can't appear in generated or custom IDs, so redirects know to verify
+	// the signature instead of looking the code up.
+	ephemeralPrefix = "~"
+
+	// ephemeralMACSize is the length of the truncated HMAC in bytes.
+	ephemeralMACSize = 16
+
+	defaultEphemeralMaxTTL = 24 * time.Hour
+)
+
+// errLinkExpired is returned when resolving an ephemeral link, or a link
+// with an expiry, past that expiry.
+var errLinkExpired = errors.New("link has expired")
+
+// EphemeralConfig enables stateless links: the destination and expiry
+// are encoded in the short code and signed, so redirects need no
+// database lookup and nothing is stored.
+type EphemeralConfig struct {
+	// Secret signs ephemeral links; empty disables them. Every instance
+	// serving redirects needs the same secret, and changing it breaks the
+	// links issued so far.
+	Secret string `yaml:"secret"`
+	// MaxTTL caps how long an ephemeral link stays valid.
+	MaxTTL time.Duration `yaml:"max_ttl"`
+}
+
+// ephemeralSigner issues and verifies ephemeral links.
+type ephemeralSigner struct {
+	key    []byte
+	maxTTL time.Duration
+}
+
+// newEphemeralSigner validates c and returns its signer, or nil when no
+// secret is configured.
+func newEphemeralSigner(c EphemeralConfig) (*ephemeralSigner, error) {
+	if c.Secret == "" {
+		return nil, nil
+	}
+	if len(c.Secret) < 16 {
+		return nil, fmt.Errorf("the ephemeral link secret must be at least 16 characters")
+	}
+	if c.MaxTTL <= 0 {
+		return nil, fmt.Errorf("invalid ephemeral link max TTL %s", c.MaxTTL)
+	}
+	return &ephemeralSigner{key: []byte(c.Secret), maxTTL: c.MaxTTL}, nil
+}
+
+func (e *ephemeralSigner) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:ephemeralMACSize]
+}
+
+// sign returns the short code of an ephemeral link to destination that
+// expires at expires: the prefix, then the MAC and the payload (the
+// expiry as Unix seconds followed by the destination), base64 encoded.
+func (e *ephemeralSigner) sign(destination string, expires time.Time) string {
+	payload := make([]byte, 8, 8+len(destination))
+	binary.BigEndian.PutUint64(payload, uint64(expires.Unix()))
+	payload = append(payload, destination...)
+	return ephemeralPrefix + base64.RawURLEncoding.EncodeToString(append(e.mac(payload), payload...))
+}
+
+// open verifies the ephemeral short code and returns its destination.
+func (e *ephemeralSigner) open(short string, now time.Time) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(short, ephemeralPrefix))
+	if err != nil || len(data) <= ephemeralMACSize+8 {
+		return "", fmt.Errorf("link not found")
+	}
+	sig, payload := data[:ephemeralMACSize], data[ephemeralMACSize:]
+	if !hmac.Equal(sig, e.mac(payload)) {
+		return "", fmt.Errorf("link not found")
+	}
+	if now.Unix() >= int64(binary.BigEndian.Uint64(payload)) {
+		return "", errLinkExpired
+	}
+	return string(payload[8:]), nil
+}
+
+// redirectEphemeral serves the redirect of an ephemeral link. Clicks are
+// not counted, since that would need the database write these links
+// avoid.
+func (s *Server) redirectEphemeral(w http.ResponseWriter, r *http.Request, short string) {
+	url, err := s.ephemeral.open(short, time.Now())
+	if err != nil {
+		s.renderLinkError(w, r, short, err)
+		return
+	}
+	if s.warnExternal(url) {
+		s.renderInterstitial(w, r, interstitialExternal, short, url)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// handleAPIEphemeral issues an ephemeral link for {"url": ..., "ttl":
+// "1h"}; ttl defaults to the configured maximum. Destinations are checked
+// like those of stored links, but nothing is written.
+func (s *Server) handleAPIEphemeral(w http.ResponseWriter, r *http.Request) {
+	if s.ephemeral == nil {
+		http.Error(w, "Ephemeral links are not enabled", http.StatusNotFound)
+		return
+	}
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	if owner, _ := s.callerOwner(r); owner == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		URL string `json:"url"`
+		TTL string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	ttl := s.ephemeral.maxTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > s.ephemeral.maxTTL {
+			http.Error(w, fmt.Sprintf("ttl must be a duration up to %s", s.ephemeral.maxTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	destination := s.destinations.withDefaultScheme(req.URL)
+	if err := s.checkDestination(destination); err != nil {
+		writeCreateError(w, err)
+		return
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	short := s.ephemeral.sign(destination, expires)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short":      short,
+		"short_url":  s.shortURL(r, "", short),
+		"original":   destination,
+		"expires_at": expires,
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEphemeralSigner(t *testing.T) {
+	signer, err := newEphemeralSigner(EphemeralConfig{Secret: "0123456789abcdef", MaxTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	short := signer.sign("https://example.com/a?b=c", now.Add(time.Minute))
+	if !strings.HasPrefix(short, ephemeralPrefix) || validateCustomID(short) == nil {
+		t.Fatalf("short = %q, want the ephemeral prefix outside the custom ID alphabet", short)
+	}
+
+	tampered := []byte(short)
+	tampered[len(tampered)-1] ^= 1
+
+	other, _ := newEphemeralSigner(EphemeralConfig{Secret: "another-secret-key", MaxTTL: time.Hour})
+	tests := []struct {
+		name    string
+		signer  *ephemeralSigner
+		short   string
+		now     time.Time
+		want    string
+		expired bool
+	}{
+		{"valid", signer, short, now, "https://example.com/a?b=c", false},
+		{"expired", signer, short, now.Add(time.Minute), "", true},
+		{"tampered", signer, string(tampered), now, "", false},
+		{"other secret", other, short, now, "", false},
+		{"garbage", signer, "~!!", now, "", false},
+		{"too short", signer, "~AAAA", now, "", false},
+	}
+	for _, tt := range tests {
+		got, err := tt.signer.open(tt.short, tt.now)
+		if got != tt.want || (err == nil) != (tt.want != "") || errors.Is(err, errLinkExpired) != tt.expired {
+			t.Errorf("%s: open() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewEphemeralSigner(t *testing.T) {
+	tests := []struct {
+		cfg     EphemeralConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{EphemeralConfig{MaxTTL: time.Hour}, true, false},
+		{EphemeralConfig{Secret: "short", MaxTTL: time.Hour}, true, true},
+		{EphemeralConfig{Secret: "0123456789abcdef"}, true, true},
+		{EphemeralConfig{Secret: "0123456789abcdef", MaxTTL: time.Hour}, false, false},
+	}
+	for _, tt := range tests {
+		signer, err := newEphemeralSigner(tt.cfg)
+		if (err != nil) != tt.wantErr || (signer == nil) != tt.wantNil {
+			t.Errorf("newEphemeralSigner(%+v) = %v, %v", tt.cfg, signer, err)
+		}
+	}
+}
+
+func TestEphemeralLinks(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	t.Setenv("EPHEMERAL_SECRET", "0123456789abcdef")
+	t.Setenv("EPHEMERAL_MAX_TTL", "1h")
+	srv := newTestServer(t)
+
+	issue := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/api/ephemeral", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := issue("", `{"url": "https://example.com"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous issue = %d, want 401", rr.Code)
+	}
+	if rr := issue("k1", `{"url": "https://example.com", "ttl": "2h"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("ttl over the maximum = %d, want 400", rr.Code)
+	}
+	if rr := issue("k1", `{"url": "ftp://example.com"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid destination = %d, want 422", rr.Code)
+	}
+
+	rr := issue("k1", `{"url": "example.com/landing", "ttl": "10m"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("issue = %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Short     string    `json:"short"`
+		ShortURL  string    `json:"short_url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if !strings.HasSuffix(resp.ShortURL, "/s/"+resp.Short) || time.Until(resp.ExpiresAt) > 10*time.Minute {
+		t.Errorf("response = %+v", resp)
+	}
+
+	// Nothing is stored: the link resolves from its code alone.
+	if links, _ := srv.getAllLinks(nil); len(links) != 0 {
+		t.Errorf("ephemeral link was stored: %v", links)
+	}
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/"+resp.Short, nil))
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://example.com/landing" {
+		t.Errorf("redirect = %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
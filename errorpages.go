@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// linkErrorState is what a visitor of a short link that doesn't redirect
+// is told, and what linkerror.html branches on.
+type linkErrorState string
+
+const (
+	linkNotFound linkErrorState = "not_found"
+	linkExpired  linkErrorState = "expired"
+	linkDisabled linkErrorState = "disabled"
+	// linkUnsafe is a link disabled because a threat list reported its
+	// destination.
+	linkUnsafe linkErrorState = "unsafe"
+)
+
+// linkErrorStateOf returns the state a short link resolving with err is in.
+func linkErrorStateOf(err error) (linkErrorState, int) {
+	switch {
+	case errors.Is(err, errLinkDisabled):
+		return linkUnsafe, http.StatusGone
+	case errors.Is(err, errLinkDisabledByOwner):
+		return linkDisabled, http.StatusGone
+	case errors.Is(err, errLinkExpired):
+		return linkExpired, http.StatusGone
+	}
+	return linkNotFound, http.StatusNotFound
+}
+
+// renderLinkError shows visitors of short why it doesn't redirect, on the
+// linkerror.html page, which UI_DIR can replace.
+func (s *Server) renderLinkError(w http.ResponseWriter, r *http.Request, short string, err error) {
+	state, status := linkErrorStateOf(err)
+	data := s.pageData(r)
+	data["Short"] = short
+	data["State"] = string(state)
+	// Read-only replicas don't serve the UI.
+	data["ShowHome"] = !s.readOnly
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.templates().ExecuteTemplate(w, "linkerror.html", data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
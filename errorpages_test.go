@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinkErrorPages(t *testing.T) {
+	srv := newTestServer(t)
+	past := time.Now().Add(-time.Hour)
+	links := map[string]createOptions{
+		"expired":  {CustomID: "expired", ExpiresAt: &past},
+		"disabled": {CustomID: "disabled"},
+		"unsafe":   {CustomID: "unsafe"},
+	}
+	for short, opts := range links {
+		if _, err := srv.createShortLink("https://example.com/"+short, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.updateLink("disabled", func(link *Link) { link.Disabled = true })
+	srv.updateLink("unsafe", func(link *Link) { link.Flagged = &LinkFlag{} })
+
+	tests := []struct {
+		path   string
+		status int
+		text   string
+	}{
+		{"/s/missing", http.StatusNotFound, "Link not found"},
+		{"/s/expired", http.StatusGone, "This link has expired"},
+		{"/s/disabled", http.StatusGone, "turned off by its owner"},
+		{"/s/unsafe", http.StatusGone, "reported as unsafe"},
+		{"/s/missing/preview", http.StatusNotFound, "Link not found"},
+		{"/s/disabled/preview", http.StatusGone, "turned off by its owner"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.status || !strings.Contains(rr.Body.String(), tt.text) {
+			t.Errorf("%s = %d, want %d with %q", tt.path, rr.Code, tt.status, tt.text)
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("%s content type = %q", tt.path, ct)
+		}
+	}
+}
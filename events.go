@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxEventSubscribers caps the open event streams.
+	maxEventSubscribers = 1000
+	// eventBuffer is how many updates a slow stream may fall behind before
+	// further ones are dropped for it.
+	eventBuffer = 64
+	// eventKeepAlive is how often an idle stream sends a comment, so
+	// proxies don't close it.
+	eventKeepAlive = 25 * time.Second
+)
+
+var errTooManySubscribers = errors.New("too many open event streams")
+
+// clickUpdate is sent to event streams when a link is clicked.
+type clickUpdate struct {
+	Short  string `json:"short"`
+	Clicks int    `json:"clicks"`
+}
+
+// eventSubscriber is one open event stream, receiving the updates of the
+// links match accepts (all links when match is nil).
+type eventSubscriber struct {
+	match   func(*Link) bool
+	updates chan clickUpdate
+}
+
+// eventHub fans click updates out to the open event streams.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[*eventSubscriber]struct{}
+	closed chan struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[*eventSubscriber]struct{}), closed: make(chan struct{})}
+}
+
+func (h *eventHub) subscribe(match func(*Link) bool) (*eventSubscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) >= maxEventSubscribers {
+		return nil, errTooManySubscribers
+	}
+	sub := &eventSubscriber{match: match, updates: make(chan clickUpdate, eventBuffer)}
+	h.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, sub)
+}
+
+// active reports whether any stream is open, so publishers can skip
+// loading what they would publish.
+func (h *eventHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+// publish sends the click count of link to the streams it matches. It
+// never blocks: streams that fell behind miss the update.
+func (h *eventHub) publish(link *Link) {
+	update := clickUpdate{Short: link.Short, Clicks: link.Clicks}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.match != nil && !sub.match(link) {
+			continue
+		}
+		select {
+		case sub.updates <- update:
+		default:
+		}
+	}
+}
+
+// close ends every open stream. Streams never finish on their own, so
+// this must happen before waiting for requests to complete on shutdown.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.closed:
+	default:
+		close(h.closed)
+	}
+}
+
+// handleEvents streams click updates as server-sent events, for the links
+// the list API would return with the same query:
+//
+//	event: click
+//	data: {"short": "abc", "clicks": 42}
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeRead) {
+		return
+	}
+	match, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+	sub, err := s.events.subscribe(match)
+	if err != nil {
+		http.Error(w, "Too many open event streams", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.events.unsubscribe(sub)
+
+	// The stream outlives the server's write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.events.closed:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case update := <-sub.updates:
+			data, _ := json.Marshal(update)
+			fmt.Fprintf(w, "event: click\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
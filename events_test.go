@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub()
+	all, _ := hub.subscribe(nil)
+	mine, _ := hub.subscribe(func(link *Link) bool { return link.Owner == "alice" })
+
+	hub.publish(&Link{Short: "a", Owner: "alice", Clicks: 1})
+	hub.publish(&Link{Short: "b", Owner: "bob", Clicks: 2})
+	if len(all.updates) != 2 || len(mine.updates) != 1 {
+		t.Errorf("updates = %d and %d, want 2 and 1", len(all.updates), len(mine.updates))
+	}
+	if update := <-mine.updates; update != (clickUpdate{Short: "a", Clicks: 1}) {
+		t.Errorf("update = %+v", update)
+	}
+
+	// A stream that falls behind misses updates instead of blocking.
+	for i := 0; i < eventBuffer+10; i++ {
+		hub.publish(&Link{Short: "a", Owner: "alice"})
+	}
+	if len(mine.updates) != eventBuffer {
+		t.Errorf("buffered updates = %d, want %d", len(mine.updates), eventBuffer)
+	}
+
+	hub.unsubscribe(all)
+	hub.unsubscribe(mine)
+	if hub.active() {
+		t.Error("hub is active without streams")
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "root")
+	alice := loginAs(t, srv, "alice")
+	for short, owner := range map[string]string{"mine": "alice", "theirs": "bob"} {
+		if _, err := srv.createShortLink("https://example.com/"+short, createOptions{CustomID: short, Owner: owner}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(srv.router)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/sui/api/events", nil)
+	req.AddCookie(alice)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events = %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	if line := <-lines; line != ": connected" {
+		t.Fatalf("first line = %q", line)
+	}
+
+	srv.incrementClicks("theirs", ClickEvent{At: time.Now()})
+	srv.incrementClicks("mine", ClickEvent{At: time.Now()})
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "data: ") {
+				if line != `data: {"short":"mine","clicks":1}` {
+					t.Fatalf("event data = %q, want only alice's link", line)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("no click event received")
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// writeNginxMap writes links as an nginx map from request URI to
+// destination. The generated file is meant to be included in the http
+// block and used as:
+//
+//	if ($pk_shorts_redirect) { return 302 $pk_shorts_redirect; }
+//
+// nginx interpolates variables in map values and has no escape for "$", so
+// links whose destination contains one are skipped and returned, as are
+// pastes and inactive links.
+func writeNginxMap(w io.Writer, prefix string, links []Link) (skipped []string, err error) {
+	cw := &countingWriter{w: w}
+
+	fmt.Fprintf(cw, "# Generated by pk-shorts export on %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintln(cw, "map $uri $pk_shorts_redirect {")
+	fmt.Fprintln(cw, "    default \"\";")
+	for _, link := range links {
+		if link.Paste != nil || link.inactive() || strings.Contains(link.Original, "$") {
+			skipped = append(skipped, link.Short)
+			continue
+		}
+		fmt.Fprintf(cw, "    %s %s;\n", nginxQuote(prefix+"/"+link.Short), nginxQuote(link.Original))
+	}
+	fmt.Fprintln(cw, "}")
+
+	return skipped, cw.err
+}
+
+func nginxQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// writeCaddyRedirects writes links as a Caddyfile snippet of redir
+// directives, to be used with "import pk_shorts" inside a site block.
+// Caddy expands {placeholders} in redirect targets, so links whose
+// destination contains braces are skipped and returned, as are pastes and
+// inactive links.
+func writeCaddyRedirects(w io.Writer, prefix string, links []Link) (skipped []string, err error) {
+	cw := &countingWriter{w: w}
+
+	fmt.Fprintf(cw, "# Generated by pk-shorts export on %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintln(cw, "(pk_shorts) {")
+	for _, link := range links {
+		if link.Paste != nil || link.inactive() || strings.ContainsAny(link.Original, "{}") {
+			skipped = append(skipped, link.Short)
+			continue
+		}
+		fmt.Fprintf(cw, "    redir %s %s 302\n", caddyQuote(prefix+"/"+link.Short), caddyQuote(link.Original))
+	}
+	fmt.Fprintln(cw, "}")
+
+	return skipped, cw.err
+}
+
+func caddyQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// inactive reports whether the server refuses to redirect the link because
+// it is flagged, disabled or expired, so static exports must leave it out.
+func (l *Link) inactive() bool {
+	return l.Flagged != nil || l.Disabled || l.Expired()
+}
+
+// writeJSONLinks writes links as a JSON array in the format the import
+// command reads. No link is skipped.
+func writeJSONLinks(w io.Writer, prefix string, links []Link) (skipped []string, err error) {
+	if links == nil {
+		links = []Link{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return nil, enc.Encode(links)
+}
+
+// readLinksFromFile loads every link, with its click total, from the
+// database at path without starting a server.
+func readLinksFromFile(path string) ([]Link, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database (is the server still running?): %w", err)
+	}
+	defer db.Close()
+
+	var links []Link
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var link Link
+			if err := json.Unmarshal(v, &link); err != nil {
+				return err
+			}
+			loadClicks(tx, &link)
+			links = append(links, link)
+			return nil
+		})
+	})
+	return links, err
+}
+
+// runExport implements the "export" command.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "nginx-map", "output format: nginx-map, caddy or json")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	flags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	var write func(io.Writer, string, []Link) ([]string, error)
+	switch *format {
+	case "nginx-map":
+		write = writeNginxMap
+	case "caddy":
+		write = writeCaddyRedirects
+	case "json":
+		write = writeJSONLinks
+	default:
+		return fmt.Errorf("unknown format %q: use nginx-map, caddy or json", *format)
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	links, err := readLinksFromFile(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	skipped, err := write(out, cfg.ShortPrefix, links)
+	if err != nil {
+		return err
+	}
+	inactive := make(map[string]bool)
+	for _, link := range links {
+		if link.inactive() {
+			inactive[link.Short] = true
+		}
+	}
+	for _, short := range skipped {
+		if inactive[short] {
+			fmt.Fprintf(os.Stderr, "Skipped %s: link is flagged, disabled or expired\n", short)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Skipped %s: destination cannot be expressed in %s format\n", short, *format)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d of %d links\n", len(links)-len(skipped), len(links))
+	return nil
+}
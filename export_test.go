@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteNginxMap(t *testing.T) {
+	links := []Link{
+		{Short: "abc", Original: "https://example.com/a?q=\"x\""},
+		{Short: "var", Original: "https://example.com/$1"},
+	}
+
+	var sb strings.Builder
+	skipped, err := writeNginxMap(&sb, "/s", links)
+	if err != nil {
+		t.Fatalf("writeNginxMap() error: %v", err)
+	}
+
+	out := sb.String()
+	if !strings.Contains(out, `"/s/abc" "https://example.com/a?q=\"x\"";`) {
+		t.Errorf("missing escaped map entry:\n%s", out)
+	}
+	if len(skipped) != 1 || skipped[0] != "var" {
+		t.Errorf("skipped = %v, want [var]", skipped)
+	}
+	if !strings.Contains(out, "map $uri $pk_shorts_redirect {") || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("unexpected map framing:\n%s", out)
+	}
+}
+
+func TestWriteCaddyRedirects(t *testing.T) {
+	links := []Link{
+		{Short: "abc", Original: "https://example.com/a"},
+		{Short: "tpl", Original: "https://example.com/{path}"},
+	}
+
+	var sb strings.Builder
+	skipped, err := writeCaddyRedirects(&sb, "/go", links)
+	if err != nil {
+		t.Fatalf("writeCaddyRedirects() error: %v", err)
+	}
+
+	if !strings.Contains(sb.String(), `redir "/go/abc" "https://example.com/a" 302`) {
+		t.Errorf("missing redir directive:\n%s", sb.String())
+	}
+	if len(skipped) != 1 || skipped[0] != "tpl" {
+		t.Errorf("skipped = %v, want [tpl]", skipped)
+	}
+}
+
+func TestStaticExportsSkipInactiveLinks(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	links := []Link{
+		{Short: "live", Original: "https://example.com/live"},
+		{Short: "flagged", Original: "https://example.com/f", Flagged: &LinkFlag{}},
+		{Short: "off", Original: "https://example.com/d", Disabled: true},
+		{Short: "old", Original: "https://example.com/e", ExpiresAt: &past},
+	}
+	for name, write := range map[string]func(io.Writer, string, []Link) ([]string, error){
+		"nginx": writeNginxMap,
+		"caddy": writeCaddyRedirects,
+	} {
+		var sb strings.Builder
+		skipped, err := write(&sb, "/s", links)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if strings.Join(skipped, ",") != "flagged,off,old" {
+			t.Errorf("%s: skipped = %v, want [flagged off old]", name, skipped)
+		}
+		if out := sb.String(); !strings.Contains(out, "/s/live") || strings.Contains(out, "example.com/f") ||
+			strings.Contains(out, "example.com/d") || strings.Contains(out, "example.com/e") {
+			t.Errorf("%s: inactive links exported:\n%s", name, out)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// extensionTokenName labels the personal tokens issued to browser
+// extensions on the account page.
+const extensionTokenName = "Browser extension"
+
+// extensionRedirectHosts are the domains browsers reserve for the redirect
+// URLs of extension sign-in flows (identity.launchWebAuthFlow), in Chrome
+// and Firefox. Tokens are only handed to these, never to web pages.
+var extensionRedirectHosts = []string{".chromiumapp.org", ".extensions.allizom.org"}
+
+// extensionOriginSchemes are the origins extension pages send requests
+// from.
+var extensionOriginSchemes = []string{"chrome-extension://", "moz-extension://", "safari-web-extension://"}
+
+// validExtensionRedirect reports whether a token may be sent to redirect.
+func validExtensionRedirect(redirect string) bool {
+	u, err := url.Parse(redirect)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, suffix := range extensionRedirectHosts {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionOrigin reports whether origin is a browser extension.
+func extensionOrigin(origin string) bool {
+	for _, scheme := range extensionOriginSchemes {
+		if strings.HasPrefix(origin, scheme) && len(origin) > len(scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleExtensionAuthorize shows the account page asking to connect the
+// extension that opened it with ?redirect_uri=.
+func (s *Server) handleExtensionAuthorize(w http.ResponseWriter, r *http.Request) {
+	if !validExtensionRedirect(r.FormValue("redirect_uri")) {
+		s.renderAccount(w, r, http.StatusBadRequest, "Invalid extension redirect URL", nil, "")
+		return
+	}
+	s.renderAccount(w, r, http.StatusOK, "", nil, "")
+}
+
+// handleExtensionConnect issues a personal token limited to creating links
+// and sends it to the extension's redirect URL, in the fragment so it
+// never reaches a server.
+func (s *Server) handleExtensionConnect(w http.ResponseWriter, r *http.Request) {
+	redirect := r.FormValue("redirect_uri")
+	if !validExtensionRedirect(redirect) {
+		s.renderAccount(w, r, http.StatusBadRequest, "Invalid extension redirect URL", nil, "")
+		return
+	}
+	user := s.currentUser(r)
+	secret, _, err := s.createAPIKey(extensionTokenName, user.Username, []string{scopeCreate})
+	if err != nil {
+		s.renderAccount(w, r, http.StatusBadRequest, err.Error(), nil, "")
+		return
+	}
+	requestLogger(r).Info("browser extension connected", "user", user.Username)
+	u, _ := url.Parse(redirect)
+	u.Fragment = ""
+	http.Redirect(w, r, u.String()+"#token="+url.QueryEscape(secret), http.StatusSeeOther)
+}
+
+// extensionCORS lets extension pages call next with a token. Preflight
+// requests are answered here. Credentials are not allowed cross-origin,
+// so a token is the only way in.
+func extensionCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); extensionOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Allow-Methods", "POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleExtensionCreate is /api/create for browser extensions: the same
+// request and answer, but only with an API token, so a page the user is
+// logged in to can't be turned against them.
+func (s *Server) handleExtensionCreate(w http.ResponseWriter, r *http.Request) {
+	cred, ok := s.requestCredential(r)
+	if !ok || cred == nil {
+		http.Error(w, "API token required", http.StatusUnauthorized)
+		return
+	}
+	// The token, not a session the browser may attach, decides the owner.
+	r.Header.Del("Cookie")
+	s.handleAPICreate(w, r)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidExtensionRedirect(t *testing.T) {
+	tests := []struct {
+		redirect string
+		want     bool
+	}{
+		{"https://abcdefghijklmnop.chromiumapp.org/", true},
+		{"https://0123abcd.extensions.allizom.org/callback", true},
+		{"https://chromiumapp.org/", false},
+		{"http://abcdefghijklmnop.chromiumapp.org/", false},
+		{"https://evil.example.com/?x=.chromiumapp.org", false},
+		{"https://abcdefghijklmnop.chromiumapp.org.evil.example.com/", false},
+		{"https://user@abcdefghijklmnop.chromiumapp.org/", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validExtensionRedirect(tt.redirect); got != tt.want {
+			t.Errorf("validExtensionRedirect(%q) = %v, want %v", tt.redirect, got, tt.want)
+		}
+	}
+}
+
+func TestExtensionConnect(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	redirect := "https://abcdefghijklmnop.chromiumapp.org/"
+
+	req := httptest.NewRequest("GET", "/sui/account/extension?redirect_uri="+url.QueryEscape(redirect), nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Connect browser extension") {
+		t.Fatalf("authorize page = %d, want the connect prompt", rr.Code)
+	}
+
+	for _, target := range []string{"https://evil.example.com/", redirect} {
+		req = httptest.NewRequest("POST", "/sui/account/extension", strings.NewReader(url.Values{"redirect_uri": {target}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rr = httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if target != redirect {
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("connecting to %s = %d, want 400", target, rr.Code)
+			}
+			continue
+		}
+		if rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), redirect+"#token=") {
+			t.Fatalf("connect = %d to %q, want a redirect with the token", rr.Code, rr.Header().Get("Location"))
+		}
+	}
+
+	_, fragment, _ := strings.Cut(rr.Header().Get("Location"), "#")
+	values, _ := url.ParseQuery(fragment)
+	token := values.Get("token")
+	keys, err := srv.listAPIKeys("alice")
+	if err != nil || len(keys) != 1 || keys[0].Name != extensionTokenName || !keys[0].Allows(scopeCreate) || keys[0].Allows(scopeDelete) {
+		t.Fatalf("issued keys = %+v, %v, want one create-only token", keys, err)
+	}
+
+	// Preflight from the extension.
+	req = httptest.NewRequest("OPTIONS", "/sui/api/ext/create", nil)
+	req.Header.Set("Origin", "chrome-extension://abcdefghijklmnop")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "chrome-extension://abcdefghijklmnop" ||
+		!strings.Contains(rr.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("preflight = %d %v", rr.Code, rr.Header())
+	}
+
+	create := func(token string, cookie *http.Cookie, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/sui/api/ext/create", strings.NewReader(`{"url":"https://example.com/tab"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", origin)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := create("", cookie, "https://evil.example.com"); rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("create with a session only = %d, allowed origin %q; want 401 without CORS", rr.Code, rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+	rr = create(token, nil, "moz-extension://0123abcd")
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "moz-extension://0123abcd" {
+		t.Fatalf("create = %d %s", rr.Code, rr.Body)
+	}
+	var resp struct {
+		Short string `json:"short"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if link, err := srv.getLink(resp.Short); err != nil || link.Owner != "alice" {
+		t.Errorf("created link = %+v, %v, want it owned by alice", link, err)
+	}
+}
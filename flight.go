@@ -0,0 +1,114 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// flightGenerations is how many generation counters a flightGroup keeps;
+// keys share them by hash.
+const flightGenerations = 256
+
+// flightGroup makes concurrent lookups of the same key share one call:
+// while a call for a key runs, other callers asking for it wait and get
+// its result instead of reading the database themselves. This keeps a
+// burst of redirects to a link that isn't cached yet, such as one just
+// published, from turning into as many reads. The zero value is ready to
+// use.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+	// gens counts the invalidations of keys, so a call can tell whether
+	// what it read changed meanwhile. Keys share a fixed set of counters
+	// rather than growing a map with every key ever changed; a key bumped
+	// along with another just misses caching once.
+	gens [flightGenerations]uint64
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// do returns the result of fn for key, calling it unless a call for key is
+// running already. shared reports whether the result came from another
+// caller's call.
+func (g *flightGroup) do(key string, fn func() (string, error)) (value string, err error, shared bool) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.forget(key, c)
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
+
+// forget removes the finished call c for key, unless invalidate has
+// replaced it already.
+func (g *flightGroup) forget(key string, c *flightCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+func flightSlot(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % flightGenerations)
+}
+
+// generation returns the invalidation count of key, to hand to
+// ifUnchanged once a read of it is done.
+func (g *flightGroup) generation(key string) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.gens[flightSlot(key)]
+}
+
+// ifUnchanged calls fn unless key was invalidated since generation gen.
+// Invalidations of key wait for fn, so it can't store what turned stale
+// after the check.
+func (g *flightGroup) ifUnchanged(key string, gen uint64, fn func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.gens[flightSlot(key)] == gen {
+		fn()
+	}
+}
+
+// invalidate makes later callers of key start a new call rather than wait
+// for the running one, for when what it reads has just changed, and bumps
+// the generation of key so calls reading it meanwhile know their result
+// is stale.
+func (g *flightGroup) invalidate(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gens[flightSlot(key)]++
+	delete(g.calls, key)
+}
+
+// forgetLink drops the cached destination of short on domain and any
+// lookup of it under way. It must be called whenever a link changes or is
+// deleted.
+func (s *Server) forgetLink(domain, short string) {
+	key := linkCacheKey(domain, short)
+	// Invalidating first means a lookup that read the link before the
+	// change either skips caching it or has cached it by the Remove.
+	s.lookups.invalidate(key)
+	s.cache.Remove(key)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (string, error) {
+		calls.Add(1)
+		<-release
+		return "https://example.com", nil
+	}
+
+	const callers = 50
+	var wg sync.WaitGroup
+	var shared atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err, wasShared := g.do("abc", fn)
+			if value != "https://example.com" || err != nil {
+				t.Errorf("do() = %q, %v", value, err)
+			}
+			if wasShared {
+				shared.Add(1)
+			}
+		}()
+	}
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Give the other callers time to join the running call.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 || shared.Load() != callers-1 {
+		t.Errorf("%d calls, %d shared results; want 1 call shared by the rest", n, shared.Load())
+	}
+	if len(g.calls) != 0 {
+		t.Errorf("%d calls left running", len(g.calls))
+	}
+}
+
+func TestFlightGroupInvalidate(t *testing.T) {
+	var g flightGroup
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.do("abc", func() (string, error) {
+			close(started)
+			<-release
+			return "stale", nil
+		})
+	}()
+	<-started
+
+	gen := g.generation("abc")
+	g.invalidate("abc")
+	if g.generation("abc") == gen {
+		t.Error("invalidate() left the generation unchanged")
+	}
+	g.ifUnchanged("abc", gen, func() { t.Error("ifUnchanged() ran after an invalidation") })
+	value, err, shared := g.do("abc", func() (string, error) { return "", errors.New("link not found") })
+	if value != "" || err == nil || shared {
+		t.Errorf("do() after forget = %q, %v, %v; want a new call", value, err, shared)
+	}
+	close(release)
+	<-done
+}
+
+func TestRedirectLookupsForgotten(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/old", createOptions{CustomID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if url, err := srv.getOriginalURL("", "abc"); err != nil || url != "https://example.com/old" {
+		t.Fatalf("getOriginalURL() = %q, %v", url, err)
+	}
+	if err := srv.deleteLink("abc", "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if url, err := srv.getOriginalURL("", "abc"); err == nil {
+		t.Errorf("getOriginalURL() after delete = %q, want an error", url)
+	}
+}
+
+func TestRedirectLookupSkipsCachingStaleRead(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/old", createOptions{CustomID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	key := linkCacheKey("", "abc")
+	// The link changes while a lookup reads it: the read's result must
+	// not be cached.
+	gen := srv.lookups.generation(key)
+	if err := srv.updateLink("abc", func(link *Link) { link.Original = "https://example.com/new" }); err != nil {
+		t.Fatal(err)
+	}
+	srv.lookups.ifUnchanged(key, gen, func() { srv.cache.Set(key, "https://example.com/old") })
+	if url, err := srv.getOriginalURL("", "abc"); err != nil || url != "https://example.com/new" {
+		t.Errorf("getOriginalURL() = %q, %v, want the new destination", url, err)
+	}
+}
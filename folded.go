@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// foldedIndexBucket maps the lowercased form of every short code to the
+// code as created, so codes can be resolved regardless of case when
+// IDConfig.CaseInsensitive is set. It is kept up to date either way, so
+// the option can be turned on at any time.
+const foldedIndexBucket = "links_by_folded"
+
+// foldShort returns the normalized form of short used as index key.
+func foldShort(short string) string {
+	return strings.ToLower(short)
+}
+
+// foldedShort returns the code stored under the normalized form of short,
+// or "" when there is none.
+func foldedShort(tx *bolt.Tx, short string) string {
+	return string(tx.Bucket([]byte(foldedIndexBucket)).Get([]byte(foldShort(short))))
+}
+
+// putFoldedShort indexes short. When codes differing only in case exist,
+// the first one keeps the entry.
+func putFoldedShort(tx *bolt.Tx, short string) error {
+	b := tx.Bucket([]byte(foldedIndexBucket))
+	key := []byte(foldShort(short))
+	if b.Get(key) != nil {
+		return nil
+	}
+	return b.Put(key, []byte(short))
+}
+
+// deleteFoldedShort removes short from the index, unless its entry belongs
+// to another code differing in case.
+func deleteFoldedShort(tx *bolt.Tx, short string) error {
+	b := tx.Bucket([]byte(foldedIndexBucket))
+	key := []byte(foldShort(short))
+	if string(b.Get(key)) != short {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+// backfillFoldedIndex populates the case-insensitive index from the links
+// bucket, for databases created before it existed.
+func backfillFoldedIndex(tx *bolt.Tx) error {
+	return tx.Bucket([]byte(bucketName)).ForEach(func(k, v []byte) error {
+		var link Link
+		if err := json.Unmarshal(v, &link); err != nil {
+			return err
+		}
+		return putFoldedShort(tx, link.Short)
+	})
+}
+
+// resolveShort returns the code short was created as when codes are
+// case-insensitive and only its case differs, or "" otherwise.
+func (s *Server) resolveShort(short string) string {
+	if !s.ids.caseInsensitive {
+		return ""
+	}
+	var canonical string
+	s.db.View(func(tx *bolt.Tx) error {
+		canonical = foldedShort(tx, short)
+		return nil
+	})
+	if canonical == short {
+		return ""
+	}
+	return canonical
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCaseInsensitiveCodes(t *testing.T) {
+	t.Setenv("ID_CASE_INSENSITIVE", "true")
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/promo", createOptions{CustomID: "Promo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/s/Promo", "/s/promo", "/s/PROMO"} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://example.com/promo" {
+			t.Errorf("GET %s = %d %q, want a redirect to the link", path, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+	if link, _ := srv.getLink("Promo"); link.Clicks != 3 {
+		t.Errorf("Promo has %d clicks, want 3", link.Clicks)
+	}
+
+	if _, err := srv.createShortLink("https://example.com/other", createOptions{CustomID: "PROMO"}); !errors.Is(err, errCustomIDTaken) {
+		t.Errorf("creating PROMO error = %v, want errCustomIDTaken", err)
+	}
+
+	if err := srv.deleteLink("Promo", "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	srv.db.View(func(tx *bolt.Tx) error {
+		if got := foldedShort(tx, "promo"); got != "" {
+			t.Errorf("deleted link still indexed as %q", got)
+		}
+		return nil
+	})
+}
+
+func TestCaseSensitiveCodes(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/promo", createOptions{CustomID: "Promo"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/other", createOptions{CustomID: "promo"}); err != nil {
+		t.Errorf("creating promo next to Promo: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/PROMO", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("GET /s/PROMO = %d, want 404 without the option", rr.Code)
+	}
+}
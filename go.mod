@@ -3,8 +3,19 @@ module github.com/pkoptilin/pk-shorts
 go 1.23
 
 require (
-	go.etcd.io/bbolt v1.3.11
+	github.com/go-ldap/ldap/v3 v3.4.8
 	github.com/gorilla/mux v1.8.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/sys v0.25.0 // indirect
\ No newline at end of file
+require (
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
+	github.com/go-asn1-ber/asn1-ber v1.5.5 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Targets of the Grafana datasource: every link the caller may see, one
+// link, or the links with a tag.
+const (
+	grafanaAllTarget  = "all"
+	grafanaLinkPrefix = "link:"
+	grafanaTagPrefix  = "tag:"
+)
+
+// setupGrafanaRoutes registers a datasource for Grafana's JSON plugins
+// (simpod-json-datasource and the older SimpleJSON) under
+// /api/grafana, serving daily click counts as time series.
+func (s *Server) setupGrafanaRoutes() {
+	base := s.uiPrefix + "/api/grafana"
+	s.router.HandleFunc(base, s.handleGrafanaTest).Methods("GET")
+	s.router.HandleFunc(base+"/", s.handleGrafanaTest).Methods("GET")
+	s.router.HandleFunc(base+"/search", s.handleGrafanaMetrics).Methods("POST")
+	s.router.HandleFunc(base+"/metrics", s.handleGrafanaMetrics).Methods("POST")
+	s.router.HandleFunc(base+"/query", s.handleGrafanaQuery).Methods("POST")
+}
+
+// grafanaLinks returns the links the caller may manage. It writes an
+// error response and returns ok=false when the caller is anonymous.
+func (s *Server) grafanaLinks(w http.ResponseWriter, r *http.Request) (links []Link, ok bool) {
+	if !s.requireScope(w, r, scopeRead) {
+		return nil, false
+	}
+	if owner, _ := s.callerOwner(r); owner == "" && !s.isAdmin(r) {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+	links, err := s.getAllLinks(func(link *Link) bool {
+		status, _ := s.checkCanManage(r, link)
+		return status == http.StatusOK
+	})
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		return nil, false
+	}
+	return links, true
+}
+
+// handleGrafanaTest answers the datasource's connection test.
+func (s *Server) handleGrafanaTest(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.grafanaLinks(w, r); ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
+
+// handleGrafanaMetrics lists the targets the caller can query, filtered
+// by the text typed so far. SimpleJSON wants plain strings and simpod
+// label/value pairs, told apart by the path.
+func (s *Server) handleGrafanaMetrics(w http.ResponseWriter, r *http.Request) {
+	links, ok := s.grafanaLinks(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Target string `json:"target"`
+		Metric string `json:"metric"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	filter := strings.ToLower(req.Target + req.Metric)
+
+	tags := make(map[string]bool)
+	targets := []string{grafanaAllTarget}
+	for _, link := range links {
+		targets = append(targets, grafanaLinkPrefix+link.Short)
+		for _, tag := range link.Tags {
+			tags[tag] = true
+		}
+	}
+	for tag := range tags {
+		targets = append(targets, grafanaTagPrefix+tag)
+	}
+	sort.Strings(targets[1:])
+
+	matched := []string{}
+	for _, target := range targets {
+		if strings.Contains(strings.ToLower(target), filter) {
+			matched = append(matched, target)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/search") {
+		json.NewEncoder(w).Encode(matched)
+		return
+	}
+	options := make([]map[string]string, len(matched))
+	for i, target := range matched {
+		options[i] = map[string]string{"label": target, "value": target}
+	}
+	json.NewEncoder(w).Encode(options)
+}
+
+// grafanaQuery is the part of a Grafana query request the datasource
+// reads.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Interval string `json:"interval"`
+	Targets  []struct {
+		Target string `json:"target"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+// grafanaSeries is a time series in Grafana's format: [value, epoch ms]
+// pairs.
+type grafanaSeries struct {
+	Target     string      `json:"target"`
+	Datapoints [][2]uint64 `json:"datapoints"`
+}
+
+// parseGrafanaInterval turns a Grafana interval such as "30s", "1d" or
+// "1w" into a number of days, at least one as clicks are counted daily.
+func parseGrafanaInterval(interval string) (int, error) {
+	if interval == "" {
+		return 1, nil
+	}
+	// Milliseconds are below a day like seconds.
+	if strings.HasSuffix(interval, "ms") {
+		interval = strings.TrimSuffix(interval, "ms") + "s"
+	}
+	n, err := strconv.Atoi(interval[:len(interval)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	switch interval[len(interval)-1] {
+	case 's', 'm', 'h':
+		return 1, nil
+	case 'd':
+		return n, nil
+	case 'w':
+		return 7 * n, nil
+	case 'M':
+		return 30 * n, nil
+	case 'y':
+		return 365 * n, nil
+	}
+	return 0, fmt.Errorf("invalid interval %q", interval)
+}
+
+// rangeDays returns the UTC dates from from to to, both included.
+func rangeDays(from, to time.Time) []string {
+	var days []string
+	last := to.UTC().Truncate(24 * time.Hour)
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(dayKeyLayout))
+	}
+	return days
+}
+
+// handleGrafanaQuery returns the clicks of each target over the requested
+// range, summed per interval. Points are stamped with the start of their
+// interval.
+func (s *Server) handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	links, ok := s.grafanaLinks(w, r)
+	if !ok {
+		return
+	}
+	var req grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "Invalid query")
+		return
+	}
+	step, err := parseGrafanaInterval(req.Interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Range.To.IsZero() {
+		req.Range.To = time.Now()
+	}
+	if req.Range.From.IsZero() || req.Range.From.After(req.Range.To) {
+		http.Error(w, "Invalid range", http.StatusBadRequest)
+		return
+	}
+	days := rangeDays(req.Range.From, req.Range.To)
+	if len(days) > maxStatsRangeDays {
+		http.Error(w, fmt.Sprintf("Range must not exceed %d days", maxStatsRangeDays), http.StatusBadRequest)
+		return
+	}
+
+	series := []grafanaSeries{}
+	for _, target := range req.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+		var shorts []string
+		for _, link := range links {
+			if grafanaTargetMatches(target.Target, &link) {
+				shorts = append(shorts, link.Short)
+			}
+		}
+		totals := make([]uint64, len(days))
+		for _, short := range shorts {
+			counts, err := s.getDailyClicks(short, days)
+			if err != nil {
+				continue
+			}
+			for i, c := range counts {
+				totals[i] += c
+			}
+		}
+
+		out := grafanaSeries{Target: target.Target, Datapoints: [][2]uint64{}}
+		for i := 0; i < len(days); i += step {
+			var sum uint64
+			for _, c := range totals[i:min(i+step, len(days))] {
+				sum += c
+			}
+			at, _ := time.Parse(dayKeyLayout, days[i])
+			out.Datapoints = append(out.Datapoints, [2]uint64{sum, uint64(at.UnixMilli())})
+		}
+		series = append(series, out)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// grafanaTargetMatches reports whether link is part of target.
+func grafanaTargetMatches(target string, link *Link) bool {
+	switch {
+	case target == grafanaAllTarget:
+		return true
+	case strings.HasPrefix(target, grafanaLinkPrefix):
+		return link.Short == strings.TrimPrefix(target, grafanaLinkPrefix)
+	case strings.HasPrefix(target, grafanaTagPrefix):
+		return link.hasTag(strings.ToLower(strings.TrimPrefix(target, grafanaTagPrefix)))
+	}
+	return false
+}
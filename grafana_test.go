@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseGrafanaInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     int
+		wantErr  bool
+	}{
+		{"", 1, false},
+		{"500ms", 1, false},
+		{"30s", 1, false},
+		{"12h", 1, false},
+		{"1d", 1, false},
+		{"2w", 14, false},
+		{"1M", 30, false},
+		{"d", 0, true},
+		{"5x", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseGrafanaInterval(tt.interval)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseGrafanaInterval(%q) = %d, %v, want %d", tt.interval, got, err, tt.want)
+		}
+	}
+}
+
+func TestGrafanaDatasource(t *testing.T) {
+	t.Setenv("API_KEYS", "grafana:s3cret,other:0ther")
+	srv := newTestServer(t)
+	for _, l := range []struct{ short, owner, tag string }{
+		{"spring", "key:grafana", "sale"},
+		{"summer", "key:grafana", "sale"},
+		{"docs", "key:grafana", ""},
+		{"theirs", "key:other", "sale"},
+	} {
+		var tags []string
+		if l.tag != "" {
+			tags = []string{l.tag}
+		}
+		if _, err := srv.createShortLink("https://example.com/"+l.short, createOptions{CustomID: l.short, Owner: l.owner, Tags: tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	srv.db.Update(func(tx *bolt.Tx) error {
+		recordDailyClick(tx, "spring", day)
+		recordDailyClick(tx, "spring", day.AddDate(0, 0, 1))
+		recordDailyClick(tx, "summer", day.AddDate(0, 0, 2))
+		recordDailyClick(tx, "docs", day)
+		return recordDailyClick(tx, "theirs", day)
+	})
+
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/sui/api/grafana"+path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("/query", "", `{}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous query = %d, want 401", rr.Code)
+	}
+
+	rr := post("/search", "s3cret", `{"target":""}`)
+	if want := `["all","link:docs","link:spring","link:summer","tag:sale"]`; strings.TrimSpace(rr.Body.String()) != want {
+		t.Errorf("search = %s, want %s", rr.Body, want)
+	}
+	rr = post("/metrics", "s3cret", `{"metric":"sum"}`)
+	if want := `[{"label":"link:summer","value":"link:summer"}]`; strings.TrimSpace(rr.Body.String()) != want {
+		t.Errorf("metrics = %s, want %s", rr.Body, want)
+	}
+
+	query := `{"range":{"from":"2024-05-01T00:00:00Z","to":"2024-05-04T23:59:59Z"},"interval":"2d",
+		"targets":[{"target":"tag:sale","refId":"A"},{"target":"all","refId":"B"},{"target":"link:theirs","refId":"C"}]}`
+	rr = post("/query", "s3cret", query)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("query = %d %s", rr.Code, rr.Body)
+	}
+	var series []grafanaSeries
+	json.NewDecoder(rr.Body).Decode(&series)
+	first := uint64(day.Truncate(24 * time.Hour).UnixMilli())
+	second := uint64(day.AddDate(0, 0, 2).Truncate(24 * time.Hour).UnixMilli())
+	want := []grafanaSeries{
+		{"tag:sale", [][2]uint64{{2, first}, {1, second}}},
+		{"all", [][2]uint64{{3, first}, {1, second}}},
+		{"link:theirs", [][2]uint64{{0, first}, {0, second}}},
+	}
+	if len(series) != len(want) {
+		t.Fatalf("query = %+v, want %+v", series, want)
+	}
+	for i := range want {
+		if series[i].Target != want[i].Target || len(series[i].Datapoints) != 2 ||
+			series[i].Datapoints[0] != want[i].Datapoints[0] || series[i].Datapoints[1] != want[i].Datapoints[1] {
+			t.Errorf("series %d = %+v, want %+v", i, series[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// healthCheck is the outcome of one readiness check.
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Entries and Size describe the redirect cache.
+	Entries *int `json:"entries,omitempty"`
+	Size    *int `json:"size,omitempty"`
+}
+
+func checkResult(err error) healthCheck {
+	if err != nil {
+		return healthCheck{Status: "fail", Error: err.Error()}
+	}
+	return healthCheck{Status: "ok"}
+}
+
+// handleHealth is the liveness probe, served on /healthz and the older
+// /health. It only reports that the process is up and serving HTTP.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+}
+
+// handleReady is the readiness probe. It reads from the database and checks
+// that the templates are loaded, answering 503 when either fails so load
+// balancers stop routing to the instance. Cache usage is reported for
+// information only.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"database":  checkResult(s.checkDatabase()),
+		"templates": checkResult(s.checkTemplates()),
+	}
+	entries, size := s.cache.Len(), s.cache.Size()
+	checks["cache"] = healthCheck{Status: "ok", Entries: &entries, Size: &size}
+
+	status, code := "ready", http.StatusOK
+	for name, check := range checks {
+		if check.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			requestLogger(r).Error("readiness check failed", "check", name, "err", check.Error)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
+
+// checkDatabase runs a read transaction against the links bucket.
+func (s *Server) checkDatabase() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return fmt.Errorf("bucket %q not found", bucketName)
+		}
+		b.Cursor().First()
+		return nil
+	})
+}
+
+// checkTemplates verifies the HTML templates are parsed.
+func (s *Server) checkTemplates() error {
+	tmpl := s.templates()
+	if tmpl == nil || tmpl.Lookup("index.html") == nil {
+		return fmt.Errorf("templates not loaded")
+	}
+	return nil
+}
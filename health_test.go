@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, path := range []string{"/health", "/healthz"} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", path, rr.Code)
+		}
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		breakIt    func(*Server)
+		wantStatus int
+		failing    string
+	}{
+		{
+			name:       "ready",
+			breakIt:    func(*Server) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "templates missing",
+			breakIt: func(s *Server) {
+				s.tmpl = template.New("empty")
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			failing:    "templates",
+		},
+		{
+			name: "database closed",
+			breakIt: func(s *Server) {
+				s.db.Close()
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			failing:    "database",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			tt.breakIt(srv)
+
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			var resp struct {
+				Status string                 `json:"status"`
+				Checks map[string]healthCheck `json:"checks"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			for name, check := range resp.Checks {
+				if want := name != tt.failing; (check.Status == "ok") != want {
+					t.Errorf("check %s = %+v", name, check)
+				}
+			}
+			if cache := resp.Checks["cache"]; cache.Size == nil || *cache.Size != defaultCacheSize {
+				t.Errorf("cache check = %+v, want size %d", cache, defaultCacheSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// readyzURL returns the local readiness endpoint of a server started with
+// cfg.
+func readyzURL(cfg *Config) string {
+	scheme := "http"
+	if cfg.TLS.enabled() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%s/readyz", scheme, cfg.Port)
+}
+
+// checkReady fetches url and fails unless it answers 200.
+func checkReady(url string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// The certificate is issued for the public name, not localhost.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// runHealthcheck implements the "healthcheck" command, meant for
+// container HEALTHCHECK instructions in images without curl or wget. It
+// reads the same configuration as the server to find its port.
+func runHealthcheck(args []string) error {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	url := fs.String("url", "", "readiness URL to check (default: /readyz on the configured local port)")
+	timeout := fs.Duration("timeout", 3*time.Second, "how long to wait for an answer")
+	fs.Parse(args)
+
+	if *url == "" {
+		cfg, err := flags.load()
+		if err != nil {
+			return err
+		}
+		*url = readyzURL(cfg)
+	}
+	return checkReady(*url, *timeout)
+}
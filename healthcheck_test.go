@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyzURL(t *testing.T) {
+	cfg := defaultConfig()
+	if got := readyzURL(cfg); got != "http://localhost:8080/readyz" {
+		t.Errorf("readyzURL() = %q", got)
+	}
+	cfg.Port = "443"
+	cfg.TLS.Cert, cfg.TLS.Key = "cert.pem", "key.pem"
+	if got := readyzURL(cfg); got != "https://localhost:443/readyz" {
+		t.Errorf("readyzURL() with TLS = %q", got)
+	}
+}
+
+func TestCheckReady(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv.router)
+	defer ts.Close()
+
+	if err := checkReady(ts.URL+"/readyz", time.Second); err != nil {
+		t.Errorf("checkReady() on a healthy server error: %v", err)
+	}
+
+	srv.db.Close()
+	if err := checkReady(ts.URL+"/readyz", time.Second); err == nil {
+		t.Error("checkReady() should fail when the database is unavailable")
+	}
+
+	ts.Close()
+	if err := checkReady(ts.URL+"/readyz", time.Second); err == nil {
+		t.Error("checkReady() should fail when nothing is listening")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// idSequenceBucket holds the counter of the sequential ID strategy, as the
+// bucket's sequence.
+const idSequenceBucket = "id_sequence"
+
+// Alphabets generated short codes can be drawn from.
+const (
+	base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	base62Alphabet    = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	// base58Alphabet is base62 without the lookalikes 0, O, I and l, for
+	// codes that are printed or read out.
+	base58Alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz123456789"
+	// sequentialAlphabet is base62 in the usual digit order, so sequential
+	// codes count 1, 2, ... 9, a, b, ... Z, 10.
+	sequentialAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// ID strategies.
+const (
+	idStrategyRandom     = "random"
+	idStrategySequential = "sequential"
+	idStrategyMemorable  = "memorable"
+	idStrategyHash       = "hash"
+)
+
+// confusableReplacer removes characters that are easily mistaken for one
+// another when printed.
+var confusableReplacer = strings.NewReplacer("0", "", "O", "", "1", "", "I", "", "l", "")
+
+var namedAlphabets = map[string]string{
+	"base64url": base64URLAlphabet,
+	"base62":    base62Alphabet,
+	"base58":    base58Alphabet,
+}
+
+const (
+	// minIDLength and maxIDLength bound the configurable code lengths.
+	minIDLength = 4
+	maxIDLength = 64
+	// minSecureIDLength keeps secure codes hard to guess.
+	minSecureIDLength = 12
+	// minAlphabetSize keeps short codes from running out quickly.
+	minAlphabetSize = 16
+	// idLengthenAfter is how many taken codes make generated codes a
+	// character longer, and idMaxAttempts how many make a create fail.
+	idLengthenAfter = 10
+	idMaxAttempts   = 100
+)
+
+// errIDSpaceFull is returned when no free code was found in idMaxAttempts
+// tries, a sign the configured length is too short for the links stored.
+var errIDSpaceFull = errors.New("no free short ID found, try again or use a custom ID")
+
+// IDConfig shapes the randomly generated short codes. Custom IDs are not
+// affected.
+type IDConfig struct {
+	// Strategy is "random" (the default), "sequential", which counts up in
+	// base62 for the shortest possible codes, "memorable", which makes
+	// codes like "brave-otter-42" that are easy to read out, or "hash",
+	// which derives codes from the destination so shortening a URL again
+	// returns the same link. Sequential and hash codes are easy to guess,
+	// and secure links stay random.
+	Strategy string `yaml:"strategy"`
+	// Length of random codes; defaults to 8.
+	Length int `yaml:"length"`
+	// SecureLength of codes created as secure; defaults to 16.
+	SecureLength int `yaml:"secure_length"`
+	// Alphabet is "base64url", "base62", "base58" (base62 without 0, O, I
+	// and l) or the characters themselves, e.g. "abcdefghjkmnpqrstuvwxyz23456789".
+	// By default random codes use base64url, and sequential and secure
+	// codes base62.
+	Alphabet string `yaml:"alphabet"`
+	// ExcludeConfusable leaves the lookalikes 0, O, 1, I and l out of the
+	// alphabet of generated codes.
+	ExcludeConfusable bool `yaml:"exclude_confusable"`
+	// CaseInsensitive resolves codes whatever their case, so "/s/AbC"
+	// leads to "abc", and refuses new codes differing from an existing
+	// one only in case. Codes keep the case they were created with.
+	CaseInsensitive bool `yaml:"case_insensitive"`
+}
+
+// idGenerator draws random short codes as configured.
+type idGenerator struct {
+	// strategy is one of the idStrategy constants.
+	strategy             string
+	length, secureLength int
+	caseInsensitive      bool
+	// alphabet and secureAlphabet hold the characters codes use.
+	alphabet, secureAlphabet string
+}
+
+// parseIDConfig validates c and returns the generator it describes.
+func parseIDConfig(c IDConfig) (idGenerator, error) {
+	g := idGenerator{
+		strategy:        idStrategyRandom,
+		caseInsensitive: c.CaseInsensitive,
+		length:          shortIDLength,
+		secureLength:    secureIDLength,
+		alphabet:        base64URLAlphabet,
+		secureAlphabet:  base62Alphabet,
+	}
+	if c.Length != 0 {
+		if c.Length < minIDLength || c.Length > maxIDLength {
+			return g, fmt.Errorf("invalid ID length %d: must be between %d and %d", c.Length, minIDLength, maxIDLength)
+		}
+		g.length = c.Length
+	}
+	if c.SecureLength != 0 {
+		if c.SecureLength < minSecureIDLength || c.SecureLength > maxIDLength {
+			return g, fmt.Errorf("invalid secure ID length %d: must be between %d and %d", c.SecureLength, minSecureIDLength, maxIDLength)
+		}
+		g.secureLength = c.SecureLength
+	}
+	switch strategy := strings.ToLower(c.Strategy); strategy {
+	case "", idStrategyRandom:
+	case idStrategySequential:
+		g.strategy = strategy
+		g.alphabet = sequentialAlphabet
+	case idStrategyMemorable, idStrategyHash:
+		g.strategy = strategy
+	default:
+		return g, fmt.Errorf("invalid ID strategy %q: want %s, %s, %s or %s", c.Strategy,
+			idStrategyRandom, idStrategySequential, idStrategyMemorable, idStrategyHash)
+	}
+	if c.Alphabet != "" {
+		alphabet, err := parseAlphabet(c.Alphabet)
+		if err != nil {
+			return g, err
+		}
+		g.alphabet, g.secureAlphabet = alphabet, alphabet
+	}
+	if c.ExcludeConfusable {
+		g.alphabet = confusableReplacer.Replace(g.alphabet)
+		g.secureAlphabet = confusableReplacer.Replace(g.secureAlphabet)
+		if len(g.alphabet) < minAlphabetSize {
+			return g, fmt.Errorf("invalid ID alphabet: needs at least %d characters besides 0, O, 1, I and l", minAlphabetSize)
+		}
+	}
+	return g, nil
+}
+
+// parseAlphabet resolves an alphabet name, or checks a literal alphabet
+// only has distinct characters that custom IDs may contain too.
+func parseAlphabet(alphabet string) (string, error) {
+	if named, ok := namedAlphabets[strings.ToLower(alphabet)]; ok {
+		return named, nil
+	}
+	seen := make(map[rune]bool)
+	for _, ch := range alphabet {
+		if !strings.ContainsRune(base64URLAlphabet, ch) {
+			return "", fmt.Errorf("invalid ID alphabet: %q is not a letter, digit, dash or underscore", ch)
+		}
+		if seen[ch] {
+			return "", fmt.Errorf("invalid ID alphabet: %q appears twice", ch)
+		}
+		seen[ch] = true
+	}
+	if len(seen) < minAlphabetSize {
+		return "", fmt.Errorf("invalid ID alphabet: needs at least %d characters", minAlphabetSize)
+	}
+	return alphabet, nil
+}
+
+// next returns the code to try for a new link to destination in tx, after
+// attempt codes were found taken: the following value of the counter with
+// the sequential strategy, the attempt-th code derived from destination
+// with the hash strategy, a generated code otherwise. Secure codes are
+// always random. Random and hash codes get a character longer every
+// idLengthenAfter attempts, so a crowded keyspace still has room.
+func (g idGenerator) next(tx *bolt.Tx, secure bool, destination string, attempt int) (string, error) {
+	extra := attempt / idLengthenAfter
+	if g.strategy == idStrategyHash && !secure {
+		return hashID(destination, attempt, g.alphabet, g.length+extra), nil
+	}
+	if g.strategy != idStrategySequential || secure {
+		return g.generate(secure, extra), nil
+	}
+	n, err := tx.Bucket([]byte(idSequenceBucket)).NextSequence()
+	if err != nil {
+		return "", err
+	}
+	return encodeSequence(n, g.alphabet), nil
+}
+
+// encodeSequence writes n in the base of alphabet's length, most
+// significant digit first.
+func encodeSequence(n uint64, alphabet string) string {
+	base := uint64(len(alphabet))
+	var digits []byte
+	for {
+		digits = append(digits, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+// exhaustible reports whether generating codes can run out of attempts.
+// The sequential counter always reaches a free code in the end.
+func (g idGenerator) exhaustible(secure bool) bool {
+	return secure || g.strategy != idStrategySequential
+}
+
+// generate returns a new random code, a longer one when secure. Random
+// codes get extra characters on top of the configured length.
+func (g idGenerator) generate(secure bool, extra int) string {
+	if secure {
+		return randomID(g.secureAlphabet, g.secureLength+extra)
+	}
+	if g.strategy == idStrategyMemorable {
+		return memorableID()
+	}
+	return randomID(g.alphabet, g.length+extra)
+}
+
+// randomID returns n characters drawn uniformly from alphabet, which
+// holds at most 256 single-byte characters.
+func randomID(alphabet string, n int) string {
+	return drawID(rand.Reader, alphabet, n)
+}
+
+// hashID returns the code of length characters from alphabet derived from
+// destination, after normalizing it with normalizeDestination. Each
+// attempt gives a different code, for when earlier ones are taken.
+func hashID(destination string, attempt int, alphabet string, length int) string {
+	seed := sha256.Sum256([]byte(normalizeDestination(destination)))
+	return drawID(&hashStream{seed: seed[:], block: uint64(attempt) << 32}, alphabet, length)
+}
+
+// normalizeDestination lowercases the scheme and host of destination and
+// drops default ports, so spellings of the same URL hash alike.
+func normalizeDestination(destination string) string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// hashStream is an endless reader of the SHA-256 hashes of seed followed
+// by a block counter.
+type hashStream struct {
+	seed  []byte
+	block uint64
+	buf   []byte
+}
+
+func (h *hashStream) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(h.buf) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], h.block)
+			sum := sha256.Sum256(append(append([]byte{}, h.seed...), counter[:]...))
+			h.buf = sum[:]
+			h.block++
+		}
+		c := copy(p[n:], h.buf)
+		h.buf = h.buf[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// drawID returns n characters of alphabet, which holds at most 256
+// single-byte characters, drawn uniformly from the bytes r produces.
+func drawID(r io.Reader, alphabet string, n int) string {
+	// Bytes at or above limit would favor the first characters.
+	limit := 256 - 256%len(alphabet)
+	id := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(id) < n {
+		io.ReadFull(r, buf)
+		for _, b := range buf {
+			if int(b) < limit && len(id) < n {
+				id = append(id, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(id)
+}
+
+// sameHashedLink reports whether the stored link data is what shortening
+// link again with opts would create, so the hash strategy can return it
+// instead. Links with a delete token are never shared, as the new token
+// could not delete them.
+func sameHashedLink(data []byte, link Link, opts createOptions) bool {
+	var existing Link
+	if err := json.Unmarshal(data, &existing); err != nil {
+		return false
+	}
+	return opts.DeleteToken == "" && existing.Original == link.Original && samePaste(existing.Paste, link.Paste) &&
+		existing.Domain == link.Domain && existing.Owner == link.Owner && !existing.Expired()
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseIDConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         IDConfig
+		wantLength     int
+		wantSecure     int
+		wantAlphabet   string
+		wantSecureAlph string
+		wantErr        bool
+	}{
+		{"defaults", IDConfig{}, shortIDLength, secureIDLength, base64URLAlphabet, base62Alphabet, false},
+		{"short base58", IDConfig{Length: 5, Alphabet: "base58"}, 5, secureIDLength, base58Alphabet, base58Alphabet, false},
+		{"named alphabet in capitals", IDConfig{Alphabet: "Base62"}, shortIDLength, secureIDLength, base62Alphabet, base62Alphabet, false},
+		{"literal alphabet", IDConfig{Alphabet: "abcdefghjkmnpqrstuvwxyz23456789"}, shortIDLength, secureIDLength, "abcdefghjkmnpqrstuvwxyz23456789", "abcdefghjkmnpqrstuvwxyz23456789", false},
+		{"longer secure", IDConfig{SecureLength: 24}, shortIDLength, 24, base64URLAlphabet, base62Alphabet, false},
+		{"too short", IDConfig{Length: 3}, 0, 0, "", "", true},
+		{"too long", IDConfig{Length: 65}, 0, 0, "", "", true},
+		{"weak secure", IDConfig{SecureLength: 8}, 0, 0, "", "", true},
+		{"small alphabet", IDConfig{Alphabet: "abcdef"}, 0, 0, "", "", true},
+		{"repeated character", IDConfig{Alphabet: "abcdefghijklmnopa"}, 0, 0, "", "", true},
+		{"unsafe character", IDConfig{Alphabet: "abcdefghijklmnop/"}, 0, 0, "", "", true},
+		{"sequential", IDConfig{Strategy: "sequential"}, shortIDLength, secureIDLength, sequentialAlphabet, base62Alphabet, false},
+		{"sequential base58", IDConfig{Strategy: "Sequential", Alphabet: "base58"}, shortIDLength, secureIDLength, base58Alphabet, base58Alphabet, false},
+		{"memorable", IDConfig{Strategy: "memorable"}, shortIDLength, secureIDLength, base64URLAlphabet, base62Alphabet, false},
+		{"hash", IDConfig{Strategy: "hash", Length: 6}, 6, secureIDLength, base64URLAlphabet, base62Alphabet, false},
+		{"exclude confusable", IDConfig{ExcludeConfusable: true}, shortIDLength, secureIDLength,
+			"ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789-_", "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789", false},
+		{"too few without confusable", IDConfig{Alphabet: "0123456789abcdefO", ExcludeConfusable: true}, 0, 0, "", "", true},
+		{"unknown strategy", IDConfig{Strategy: "uuid"}, 0, 0, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := parseIDConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIDConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if g.length != tt.wantLength || g.secureLength != tt.wantSecure || g.alphabet != tt.wantAlphabet || g.secureAlphabet != tt.wantSecureAlph {
+				t.Errorf("parseIDConfig() = %+v", g)
+			}
+		})
+	}
+}
+
+func TestRandomID(t *testing.T) {
+	counts := make(map[rune]int)
+	for i := 0; i < 2000; i++ {
+		id := randomID(base58Alphabet, 5)
+		if len(id) != 5 {
+			t.Fatalf("randomID() = %q, want 5 characters", id)
+		}
+		for _, ch := range id {
+			if !strings.ContainsRune(base58Alphabet, ch) {
+				t.Fatalf("randomID() = %q, has %q outside the alphabet", id, ch)
+			}
+			counts[ch]++
+		}
+	}
+	if len(counts) != len(base58Alphabet) {
+		t.Errorf("10000 characters drew %d of the %d in the alphabet", len(counts), len(base58Alphabet))
+	}
+}
+
+func TestConfiguredIDs(t *testing.T) {
+	t.Setenv("ID_LENGTH", "5")
+	t.Setenv("ID_ALPHABET", "base58")
+	srv := newTestServer(t)
+
+	for _, secure := range []bool{false, true} {
+		short, err := srv.createShortLink("https://example.com", createOptions{Secure: secure})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantLength := 5
+		if secure {
+			wantLength = secureIDLength
+		}
+		if len(short) != wantLength || strings.ContainsAny(short, "0OIl-_") {
+			t.Errorf("created %q (secure %v), want %d base58 characters", short, secure, wantLength)
+		}
+	}
+}
+
+func TestEncodeSequence(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{10, "a"},
+		{61, "Z"},
+		{62, "10"},
+		{62*62 - 1, "ZZ"},
+		{62 * 62, "100"},
+	}
+	for _, tt := range tests {
+		if got := encodeSequence(tt.n, sequentialAlphabet); got != tt.want {
+			t.Errorf("encodeSequence(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSequentialIDs(t *testing.T) {
+	t.Setenv("ID_STRATEGY", "sequential")
+	srv := newTestServer(t)
+
+	// A link imported under a short code the counter will reach.
+	err := srv.db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(Link{Short: "2", Original: "https://example.com/imported", CreatedAt: time.Now()})
+		return tx.Bucket([]byte(bucketName)).Put([]byte("2"), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		short, err := srv.createShortLink(fmt.Sprintf("https://example.com/%d", i), createOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, short)
+	}
+	if want := []string{"1", "3", "4"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("created %q, want %q", got, want)
+	}
+
+	secure, err := srv.createShortLink("https://example.com/secret", createOptions{Secure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secure) != secureIDLength {
+		t.Errorf("secure link got %q, want a random code", secure)
+	}
+}
+
+func TestHashID(t *testing.T) {
+	id := hashID("https://example.com/page?q=1", 0, base62Alphabet, 8)
+	if len(id) != 8 || strings.Trim(id, base62Alphabet) != "" {
+		t.Fatalf("hashID() = %q, want 8 base62 characters", id)
+	}
+	tests := []struct {
+		destination string
+		attempt     int
+		same        bool
+	}{
+		{"https://example.com/page?q=1", 0, true},
+		{"HTTPS://Example.COM:443/page?q=1", 0, true},
+		{"https://example.com/page?q=2", 0, false},
+		{"https://example.com/page?q=1", 1, false},
+	}
+	for _, tt := range tests {
+		if got := hashID(tt.destination, tt.attempt, base62Alphabet, 8); (got == id) != tt.same {
+			t.Errorf("hashID(%q, %d) = %q, same as %q: %v, want %v", tt.destination, tt.attempt, got, id, got == id, tt.same)
+		}
+	}
+	if long := hashID("https://example.com/", 0, base64URLAlphabet, maxIDLength); len(long) != maxIDLength {
+		t.Errorf("hashID() of %d characters = %q", maxIDLength, long)
+	}
+}
+
+func TestHashIDs(t *testing.T) {
+	t.Setenv("ID_STRATEGY", "hash")
+	srv := newTestServer(t)
+
+	create := func(destination string, opts createOptions) string {
+		t.Helper()
+		short, err := srv.createShortLink(destination, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return short
+	}
+	first := create("https://example.com/report", createOptions{Owner: "alice"})
+	if first != hashID("https://example.com/report", 0, base64URLAlphabet, shortIDLength) {
+		t.Errorf("created %q, want the code derived from the destination", first)
+	}
+	if again := create("https://example.com/report", createOptions{Owner: "alice"}); again != first {
+		t.Errorf("shortening again gave %q, want %q", again, first)
+	}
+	if other := create("https://example.com/report", createOptions{Owner: "bob"}); other == first || other != hashID("https://example.com/report", 1, base64URLAlphabet, shortIDLength) {
+		t.Errorf("another owner got %q, want the next derived code", other)
+	}
+	if secure := create("https://example.com/report", createOptions{Owner: "alice", Secure: true}); len(secure) != secureIDLength {
+		t.Errorf("secure link got %q, want a random code", secure)
+	}
+	if links, _ := srv.getAllLinks(nil); len(links) != 3 {
+		t.Errorf("%d links stored, want 3", len(links))
+	}
+}
+
+func TestIDSpaceFull(t *testing.T) {
+	t.Setenv("ID_STRATEGY", "hash")
+	srv := newTestServer(t)
+	const destination = "https://example.com/crowded"
+
+	// Take every code the destination could get, as other links would in
+	// a nearly full keyspace.
+	err := srv.db.Update(func(tx *bolt.Tx) error {
+		for attempt := 0; attempt < idMaxAttempts; attempt++ {
+			short := hashID(destination, attempt, base64URLAlphabet, shortIDLength+attempt/idLengthenAfter)
+			data, _ := json.Marshal(Link{Short: short, Original: "https://example.com/other", CreatedAt: time.Now()})
+			if err := tx.Bucket([]byte(bucketName)).Put([]byte(short), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = srv.createShortLink(destination, createOptions{})
+	if !errors.Is(err, errIDSpaceFull) || createErrorStatus(err) != http.StatusServiceUnavailable {
+		t.Fatalf("createShortLink() error = %v, want errIDSpaceFull", err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		fmt.Sprintf("pkshorts_id_collisions_total %d", idMaxAttempts),
+		"pkshorts_id_exhausted_total 1",
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestLongerIDsAfterCollisions(t *testing.T) {
+	gen, _ := parseIDConfig(IDConfig{})
+	tests := []struct {
+		attempt int
+		secure  bool
+		want    int
+	}{
+		{0, false, shortIDLength},
+		{idLengthenAfter - 1, false, shortIDLength},
+		{idLengthenAfter, false, shortIDLength + 1},
+		{3 * idLengthenAfter, true, secureIDLength + 3},
+	}
+	for _, tt := range tests {
+		if id, _ := gen.next(nil, tt.secure, "", tt.attempt); len(id) != tt.want {
+			t.Errorf("next() at attempt %d = %q, want %d characters", tt.attempt, id, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// importable reports whether link leads to an http(s) destination, or is a
+// valid paste without one.
+func importable(link *Link) bool {
+	if link.Paste != nil {
+		return link.Original == "" && link.Paste.normalize() == nil
+	}
+	return strings.HasPrefix(link.Original, "http://") || strings.HasPrefix(link.Original, "https://")
+}
+
+// validateImportID checks the short code of an imported link: namespaced
+// codes such as "docs/install" need their namespace to exist already.
+func validateImportID(tx *bolt.Tx, short string) error {
+	namespace, _, ok := splitNamespace(short)
+	if !ok {
+		return validateCustomID(short)
+	}
+	if err := validateNamespacedID(short); err != nil {
+		return err
+	}
+	if tx.Bucket([]byte(namespacesBucket)).Get([]byte(namespace)) == nil {
+		return fmt.Errorf("namespace %q not found", namespace)
+	}
+	return nil
+}
+
+// importLinks stores links that don't exist yet, as read from a JSON
+// export or the list API, keeping their owners, tags and click totals.
+// Quotas are not charged. It returns the number imported and the short
+// codes skipped because they are taken or invalid, or name a namespace
+// that doesn't exist.
+func importLinks(db *bolt.DB, links []Link) (imported int, skipped []string, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		idx := tx.Bucket([]byte(createdIndexBucket))
+
+		for _, link := range links {
+			if validateImportID(tx, link.Short) != nil || b.Get([]byte(link.Short)) != nil || !importable(&link) {
+				skipped = append(skipped, link.Short)
+				continue
+			}
+			if link.CreatedAt.IsZero() {
+				link.CreatedAt = time.Now()
+			}
+			clicks := link.Clicks
+			link.Clicks = 0
+
+			// A recently deleted link with this code can no longer be
+			// restored, and must not leave its clicks or deletion token
+			// to the imported one.
+			if err := purgeLinkData(tx, link.Short); err != nil {
+				return err
+			}
+			data, err := json.Marshal(link)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(link.Short), data); err != nil {
+				return err
+			}
+			if err := idx.Put(createdIndexKey(link.CreatedAt, link.Short), []byte{}); err != nil {
+				return err
+			}
+			if err := putFoldedShort(tx, link.Short); err != nil {
+				return err
+			}
+			if clicks > 0 {
+				if err := addClicks(tx, link.Short, uint64(clicks)); err != nil {
+					return err
+				}
+			}
+			imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return imported, skipped, nil
+}
+
+// runImport implements the "import" command.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	input := fs.String("input", "", "JSON file with an array of links (default: stdin)")
+	noSync := fs.Bool("no-sync", false, "write without syncing each commit to disk, syncing once at the end (env DB_NO_SYNC)")
+	flags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	var links []Link
+	if err := json.NewDecoder(in).Decode(&links); err != nil {
+		return fmt.Errorf("failed to parse links: %w", err)
+	}
+
+	if *noSync {
+		cfg.Database.NoSync = true
+	}
+	db, err := openDB(cfg.DBPath, cfg.Database, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database (is the server still running?): %w", err)
+	}
+	defer db.Close()
+	if err := db.Update(migrate); err != nil {
+		return fmt.Errorf("failed to prepare database: %w", err)
+	}
+
+	imported, skipped, err := importLinks(db, links)
+	if err != nil {
+		return err
+	}
+	// Without a sync per commit, the imported links may still be in the
+	// page cache only.
+	if cfg.Database.NoSync {
+		if err := db.Sync(); err != nil {
+			return fmt.Errorf("failed to sync database: %w", err)
+		}
+	}
+	for _, short := range skipped {
+		fmt.Fprintf(os.Stderr, "Skipped %s: short code taken or link invalid\n", short)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d of %d links\n", imported, len(links))
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/a", createOptions{CustomID: "first", Owner: "alice", Tags: []string{"docs"}}); err != nil {
+		t.Fatal(err)
+	}
+	srv.incrementClicks("first", ClickEvent{At: time.Now()})
+	srv.incrementClicks("first", ClickEvent{At: time.Now()})
+	if _, err := srv.createTeam("writers"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createNamespace("docs", "writers"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/install", createOptions{CustomID: "docs/install", Owner: "team:writers"}); err != nil {
+		t.Fatal(err)
+	}
+	path := srv.db.Path()
+	srv.Close()
+
+	links, err := readLinksFromFile(path)
+	if err != nil {
+		t.Fatalf("readLinksFromFile() error: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := writeJSONLinks(&buf, "/s", links); err != nil {
+		t.Fatalf("writeJSONLinks() error: %v", err)
+	}
+
+	var exported []Link
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatalf("invalid JSON export: %v", err)
+	}
+	exported = append(exported,
+		Link{Short: "first", Original: "https://example.com/taken"},
+		Link{Short: "bad id!", Original: "https://example.com"},
+		Link{Short: "script", Original: "javascript:alert(1)"},
+		Link{Short: "blog/post", Original: "https://example.com/post"},
+		Link{Short: "docs/bad id", Original: "https://example.com"},
+	)
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "imported.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Update(migrate); err != nil {
+		t.Fatal(err)
+	}
+	// Namespaces aren't exported; the target instance must have them.
+	err = db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(Namespace{Name: "docs", Team: "writers"})
+		return tx.Bucket([]byte(namespacesBucket)).Put([]byte("docs"), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, skipped, err := importLinks(db, exported)
+	if err != nil {
+		t.Fatalf("importLinks() error: %v", err)
+	}
+	if imported != 2 || len(skipped) != 5 {
+		t.Errorf("imported %d, skipped %v; want 2 imported and 5 skipped", imported, skipped)
+	}
+
+	restored := &Server{db: db}
+	link, err := restored.getLink("first")
+	if err != nil {
+		t.Fatalf("getLink() after import error: %v", err)
+	}
+	if link.Owner != "alice" || link.Clicks != 2 || len(link.Tags) != 1 || link.Original != "https://example.com/a" {
+		t.Errorf("imported link = %+v", link)
+	}
+	if link, err := restored.getLink("docs/install"); err != nil || link.Owner != "team:writers" {
+		t.Errorf("imported namespaced link = %+v, %v", link, err)
+	}
+	recent, err := restored.getLinksCreatedBetween(time.Time{}, time.Time{}, 0, nil)
+	if err != nil || len(recent) != 2 {
+		t.Errorf("created index after import = %v, %v", recent, err)
+	}
+}
+
+func TestImportOverDeletedLink(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/old", createOptions{CustomID: "gone"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.incrementClicks("gone", ClickEvent{At: time.Now()})
+	token, err := newDeleteToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.db.Update(func(tx *bolt.Tx) error { return putDeleteToken(tx, "gone", token) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.deleteLink("gone", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, skipped, err := importLinks(srv.db, []Link{{Short: "gone", Original: "https://example.com/new"}})
+	if err != nil || imported != 1 || len(skipped) != 0 {
+		t.Fatalf("importLinks() = %d, %v, %v; want the link imported", imported, skipped, err)
+	}
+	link, err := srv.getLink("gone")
+	if err != nil || link.Original != "https://example.com/new" || link.Clicks != 0 {
+		t.Errorf("imported link = %+v, %v; want no clicks of the deleted one", link, err)
+	}
+	if srv.checkDeleteToken("gone", token) {
+		t.Error("the deleted link's token can delete the imported one")
+	}
+	srv.db.View(func(tx *bolt.Tx) error {
+		if getDeletedLink(tx, "gone") != nil {
+			t.Error("the deleted link can still be restored over the imported one")
+		}
+		if tx.Bucket([]byte(dailyClicksBucket)).Bucket([]byte("gone")) != nil {
+			t.Error("the imported link has the deleted one's daily clicks")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ExternalWarningConfig shows a confirmation page before redirecting to
+// destinations outside a trusted-domain list, for deployments that must
+// tell users they are leaving.
+type ExternalWarningConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// TrustedDomains redirect directly, subdomains included; entries may
+	// be wildcard patterns like the domain blocklist. The instance's own
+	// hostnames are always trusted.
+	TrustedDomains []string `yaml:"trusted_domains"`
+}
+
+// parseExternalWarning validates c and returns it with its domains
+// normalized.
+func parseExternalWarning(c ExternalWarningConfig) (ExternalWarningConfig, error) {
+	c.TrustedDomains = normalizeList(c.TrustedDomains)
+	if err := validateDomainPatterns(c.TrustedDomains); err != nil {
+		return c, fmt.Errorf("trusted domains: %w", err)
+	}
+	return c, nil
+}
+
+// interstitialKind selects what the interstitial page says.
+type interstitialKind int
+
+const (
+	// interstitialPreview shows the destination on request.
+	interstitialPreview interstitialKind = iota
+	// interstitialReported warns about a link reported as abusive.
+	interstitialReported
+	// interstitialReportSent thanks the visitor who just reported it.
+	interstitialReportSent
+	// interstitialExternal tells the visitor they are leaving for an
+	// untrusted destination.
+	interstitialExternal
+)
+
+// warnExternal reports whether redirecting to destination needs the
+// external link confirmation page.
+func (s *Server) warnExternal(destination string) bool {
+	if !s.externalWarning.Enabled {
+		return false
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return true
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return !s.ownHosts[host] && !matchDomain(host, s.externalWarning.TrustedDomains)
+}
+
+// renderInterstitial shows the destination of short before leaving, with a
+// form to report the link.
+func (s *Server) renderInterstitial(w http.ResponseWriter, r *http.Request, kind interstitialKind, short, destination string) {
+	data := s.pageData(r)
+	data["Short"] = short
+	data["Destination"] = destination
+	data["Reported"] = kind == interstitialReported || kind == interstitialReportSent
+	data["Thanks"] = kind == interstitialReportSent
+	data["External"] = kind == interstitialExternal
+	data["ReportURL"] = s.prefix + "/" + short + "/report"
+	data["CanReport"] = !s.readOnly && kind != interstitialReportSent && !strings.HasPrefix(short, ephemeralPrefix)
+	data["MaxReason"] = maxReportReason
+	if kind == interstitialPreview && !strings.HasPrefix(short, ephemeralPrefix) {
+		data["QRURL"] = s.uiPrefix + "/qr/" + short
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := s.templates().ExecuteTemplate(w, "interstitial.html", data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWarnExternal(t *testing.T) {
+	srv := newTestServer(t)
+	srv.ownHosts = map[string]bool{"go.example.com": true}
+	if srv.warnExternal("https://evil.test/") {
+		t.Error("warned with the warning disabled")
+	}
+
+	srv.externalWarning = ExternalWarningConfig{Enabled: true, TrustedDomains: []string{"example.org", "*.corp.test"}}
+	tests := []struct {
+		dest string
+		want bool
+	}{
+		{"https://example.org/page", false},
+		{"https://docs.EXAMPLE.org./page", false},
+		{"https://wiki.corp.test/", false},
+		{"https://corp.test/", true},
+		{"https://go.example.com/s/abc", false},
+		{"https://example.org.evil.test/", true},
+		{"https://evil.test/", true},
+	}
+	for _, tt := range tests {
+		if got := srv.warnExternal(tt.dest); got != tt.want {
+			t.Errorf("warnExternal(%q) = %v, want %v", tt.dest, got, tt.want)
+		}
+	}
+}
+
+func TestExternalWarningPage(t *testing.T) {
+	t.Setenv("EXTERNAL_LINK_WARNING", "true")
+	t.Setenv("TRUSTED_DOMAINS", "Example.org")
+	srv := newTestServer(t)
+	for short, dest := range map[string]string{"trusted": "https://example.org/", "outside": "https://elsewhere.test/"} {
+		if _, err := srv.createShortLink(dest, createOptions{CustomID: short}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/trusted", nil))
+	if rr.Code != http.StatusFound {
+		t.Errorf("trusted destination = %d, want 302", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/outside", nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "You are leaving") || !strings.Contains(body, `href="https://elsewhere.test/"`) {
+		t.Errorf("untrusted destination = %d %q, want the confirmation page", rr.Code, body)
+	}
+	if link, _ := srv.getLink("outside"); link.Clicks != 1 {
+		t.Errorf("clicks = %d, want 1", link.Clicks)
+	}
+}
+
+func TestParseExternalWarning(t *testing.T) {
+	if _, err := parseExternalWarning(ExternalWarningConfig{TrustedDomains: []string{"[a-"}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultLDAPUserFilter = "(uid=%s)"
+	ldapTimeout           = 10 * time.Second
+)
+
+// LDAPConfig describes how to authenticate users against a directory. The
+// service account (BindDN/BindPassword) is used to look the user up with
+// UserFilter under BaseDN; the user's password is then verified by binding
+// as the entry that was found.
+type LDAPConfig struct {
+	URL          string `yaml:"url"`
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// UserFilter is an LDAP filter with a single %s for the escaped
+	// username, e.g. "(sAMAccountName=%s)" for Active Directory.
+	UserFilter string `yaml:"user_filter"`
+	// AdminFilter, when set, is checked the same way after a successful
+	// login; users matching it are given the admin role, e.g.
+	// "(&(uid=%s)(memberOf=cn=shorts-admins,ou=groups,dc=corp,dc=com))".
+	AdminFilter        string `yaml:"admin_filter"`
+	StartTLS           bool   `yaml:"start_tls"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// resolve checks the configuration and fills in the default user filter.
+// It returns nil when no URL is set, leaving only local accounts.
+func (c LDAPConfig) resolve() (*LDAPConfig, error) {
+	if c.URL == "" {
+		return nil, nil
+	}
+	if c.BaseDN == "" {
+		return nil, fmt.Errorf("LDAP base DN (LDAP_BASE_DN) is required when an LDAP URL is set")
+	}
+	if c.UserFilter == "" {
+		c.UserFilter = defaultLDAPUserFilter
+	}
+	if strings.Count(c.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP user filter (LDAP_USER_FILTER) must contain exactly one %%s")
+	}
+	if c.AdminFilter != "" && strings.Count(c.AdminFilter, "%s") != 1 {
+		return nil, fmt.Errorf("LDAP admin filter (LDAP_ADMIN_FILTER) must contain exactly one %%s")
+	}
+	return &c, nil
+}
+
+// ldapFilter substitutes the escaped username into filter, so input such as
+// "*)(uid=*" cannot widen the search.
+func ldapFilter(filter, username string) string {
+	return fmt.Sprintf(filter, ldap.EscapeFilter(username))
+}
+
+func (c *LDAPConfig) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+
+	conn, err := ldap.DialURL(c.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if c.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// search runs filter for username with the service account and returns the
+// matching entry DNs.
+func (c *LDAPConfig) search(conn *ldap.Conn, filter, username string) ([]string, error) {
+	if c.BindDN != "" {
+		if err := conn.Bind(c.BindDN, c.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind failed: %w", err)
+		}
+	} else if err := conn.UnauthenticatedBind(""); err != nil {
+		return nil, fmt.Errorf("anonymous bind failed: %w", err)
+	}
+
+	req := ldap.NewSearchRequest(
+		c.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		ldapFilter(filter, username),
+		[]string{"dn"},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+
+	var dns []string
+	if res != nil {
+		for _, e := range res.Entries {
+			dns = append(dns, e.DN)
+		}
+	}
+	return dns, nil
+}
+
+// Authenticate verifies username and password against the directory and
+// reports whether the user matches the admin filter. It returns
+// errInvalidCredentials when the user is unknown, ambiguous, or the
+// password is wrong.
+func (c *LDAPConfig) Authenticate(username, password string) (isAdmin bool, err error) {
+	// An empty password would turn the user bind into an unauthenticated
+	// bind, which many servers accept.
+	if password == "" {
+		return false, errInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return false, fmt.Errorf("ldap connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	dns, err := c.search(conn, c.UserFilter, username)
+	if err != nil {
+		return false, err
+	}
+	if len(dns) != 1 {
+		return false, errInvalidCredentials
+	}
+
+	if err := conn.Bind(dns[0], password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return false, errInvalidCredentials
+		}
+		return false, err
+	}
+
+	if c.AdminFilter == "" {
+		return false, nil
+	}
+	admins, err := c.search(conn, c.AdminFilter, username)
+	if err != nil {
+		return false, err
+	}
+	return len(admins) > 0, nil
+}
+
+// authenticateLDAP checks the credentials against the directory and
+// provisions the matching local account on first login, which then holds
+// the user's role and owns their links. With an admin filter configured
+// the role follows the directory on every login; otherwise it is managed
+// from the admin panel, starting from the ADMIN_USER bootstrap.
+func (s *Server) authenticateLDAP(username, password string) (*User, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	isAdmin, err := s.ldap.Authenticate(username, password)
+	if err != nil {
+		if !errors.Is(err, errInvalidCredentials) {
+			slog.Error("LDAP authentication error", "username", username, "err", err)
+		}
+		return nil, errInvalidCredentials
+	}
+
+	var user User
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		if data := b.Get([]byte(username)); data != nil {
+			if err := json.Unmarshal(data, &user); err != nil {
+				return err
+			}
+		} else {
+			user = User{Username: username, Role: s.initialRole(username), Source: userSourceLDAP, CreatedAt: time.Now()}
+		}
+
+		if s.ldap.AdminFilter != "" {
+			user.Role = roleUser
+			if isAdmin {
+				user.Role = roleAdmin
+			}
+		}
+
+		data, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(username), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
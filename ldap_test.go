@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLDAPConfigResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantNil    bool
+		wantErr    bool
+		wantFilter string
+	}{
+		{name: "unset", env: map[string]string{}, wantNil: true},
+		{name: "missing base DN", env: map[string]string{"LDAP_URL": "ldap://dc"}, wantErr: true},
+		{
+			name:       "default filter",
+			env:        map[string]string{"LDAP_URL": "ldap://dc", "LDAP_BASE_DN": "dc=corp"},
+			wantFilter: "(uid=%s)",
+		},
+		{
+			name:       "custom filter",
+			env:        map[string]string{"LDAP_URL": "ldap://dc", "LDAP_BASE_DN": "dc=corp", "LDAP_USER_FILTER": "(sAMAccountName=%s)"},
+			wantFilter: "(sAMAccountName=%s)",
+		},
+		{
+			name:    "filter without placeholder",
+			env:     map[string]string{"LDAP_URL": "ldap://dc", "LDAP_BASE_DN": "dc=corp", "LDAP_USER_FILTER": "(uid=admin)"},
+			wantErr: true,
+		},
+		{
+			name:    "admin filter with two placeholders",
+			env:     map[string]string{"LDAP_URL": "ldap://dc", "LDAP_BASE_DN": "dc=corp", "LDAP_ADMIN_FILTER": "(|(uid=%s)(cn=%s))"},
+			wantErr: true,
+		},
+	}
+
+	vars := []string{"LDAP_URL", "LDAP_BIND_DN", "LDAP_BIND_PASSWORD", "LDAP_BASE_DN", "LDAP_USER_FILTER", "LDAP_ADMIN_FILTER"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range vars {
+				t.Setenv(v, tt.env[v])
+			}
+
+			config, err := loadConfig("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := config.Auth.LDAP.resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (cfg == nil) != tt.wantNil {
+				t.Fatalf("resolve() = %+v, wantNil %v", cfg, tt.wantNil)
+			}
+			if cfg != nil && cfg.UserFilter != tt.wantFilter {
+				t.Errorf("UserFilter = %q, want %q", cfg.UserFilter, tt.wantFilter)
+			}
+		})
+	}
+}
+
+func TestLDAPFilterEscapesUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "(uid=alice)"},
+		{"*", `(uid=\2a)`},
+		{"a*)(uid=*", `(uid=a\2a\29\28uid=\2a)`},
+	}
+
+	for _, tt := range tests {
+		if got := ldapFilter("(uid=%s)", tt.username); got != tt.want {
+			t.Errorf("ldapFilter(%q) = %q, want %q", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateWithLDAPConfigured(t *testing.T) {
+	srv := newTestServer(t)
+	// Nothing listens on port 1, so every directory login fails.
+	srv.ldap = &LDAPConfig{URL: "ldap://127.0.0.1:1", BaseDN: "dc=corp", UserFilter: defaultLDAPUserFilter}
+
+	if _, err := srv.createUser("alice", "correct horse"); err != nil {
+		t.Fatalf("createUser() error: %v", err)
+	}
+	if _, err := srv.authenticate("alice", "correct horse"); err != nil {
+		t.Errorf("local account authenticate() error: %v", err)
+	}
+	if _, err := srv.authenticate("bob", "whatever1"); err != errInvalidCredentials {
+		t.Errorf("authenticate() with unreachable directory error = %v, want errInvalidCredentials", err)
+	}
+	if _, err := srv.getUser("bob"); err == nil {
+		t.Error("failed directory login should not provision an account")
+	}
+
+	if srv.registrationOpen() {
+		t.Error("registration should be closed while LDAP is configured")
+	}
+}
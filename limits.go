@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultMaxBodyBytes   = 1 << 20
+	defaultMaxHeaderBytes = 64 << 10
+	defaultMaxQueued      = 100
+	defaultQueueTimeout   = time.Second
+)
+
+// LimitsConfig bounds how much a single request can make the server read
+// and how long it may take, so a misbehaving client can't tie it up.
+type LimitsConfig struct {
+	// MaxBodyBytes caps request bodies; larger ones get 413. 0 disables
+	// the limit.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// MaxHeaderBytes caps the request line and headers.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+
+	// RequestTimeout bounds how long a handler may run before the client
+	// gets 503. RouteTimeouts overrides it for single routes, keyed by
+	// route template as in the metrics (e.g. "/sui/api/create"). 0 means
+	// no timeout.
+	RequestTimeout time.Duration            `yaml:"request_timeout"`
+	RouteTimeouts  map[string]time.Duration `yaml:"route_timeouts"`
+
+	// MaxConcurrent caps how many requests are handled at once.
+	// RouteConcurrency caps single routes, keyed by route template like
+	// RouteTimeouts, so a spike on one (such as redirects) leaves room for
+	// the UI and API. A request over a cap waits up to QueueTimeout behind
+	// at most MaxQueued others, then gets 503. 0 means no cap.
+	MaxConcurrent    int            `yaml:"max_concurrent"`
+	RouteConcurrency map[string]int `yaml:"route_concurrency"`
+	MaxQueued        int            `yaml:"max_queued"`
+	QueueTimeout     time.Duration  `yaml:"queue_timeout"`
+}
+
+func defaultLimits() LimitsConfig {
+	return LimitsConfig{
+		MaxBodyBytes:   defaultMaxBodyBytes,
+		MaxHeaderBytes: defaultMaxHeaderBytes,
+		ReadTimeout:    15 * time.Second,
+		WriteTimeout:   15 * time.Second,
+		IdleTimeout:    60 * time.Second,
+		MaxQueued:      defaultMaxQueued,
+		QueueTimeout:   defaultQueueTimeout,
+	}
+}
+
+// httpServer returns a server for handler with the configured limits.
+func (c LimitsConfig) httpServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    c.ReadTimeout,
+		WriteTimeout:   c.WriteTimeout,
+		IdleTimeout:    c.IdleTimeout,
+		MaxHeaderBytes: c.MaxHeaderBytes,
+	}
+}
+
+// timeoutFor returns the handler timeout of route.
+func (c LimitsConfig) timeoutFor(route string) time.Duration {
+	if d, ok := c.RouteTimeouts[route]; ok {
+		return d
+	}
+	return c.RequestTimeout
+}
+
+// limitsMiddleware rejects request bodies over the size limit and applies
+// the handler timeout of the matched route.
+func (s *Server) limitsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if max := s.limits.MaxBodyBytes; max > 0 {
+			if r.ContentLength > max {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			// Bodies without a Content-Length are cut off while being read;
+			// handlers report that through writeBodyError.
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+
+		var route string
+		if cur := mux.CurrentRoute(r); cur != nil {
+			route, _ = cur.GetPathTemplate()
+		}
+		release, ok := s.concurrency.acquire(r.Context(), route, s.limits.QueueTimeout)
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server is busy, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		// The timeout handler buffers the whole response, which event
+		// streams never finish.
+		if timeout := s.limits.timeoutFor(route); timeout > 0 && route != s.uiPrefix+"/api/events" {
+			http.TimeoutHandler(next, timeout, "Request timed out").ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// slotQueue hands out a fixed number of slots, letting a bounded number of
+// callers wait for one.
+type slotQueue struct {
+	slots     chan struct{}
+	waiting   atomic.Int64
+	maxQueued int64
+}
+
+func newSlotQueue(size, maxQueued int) *slotQueue {
+	return &slotQueue{slots: make(chan struct{}, size), maxQueued: int64(maxQueued)}
+}
+
+// acquire takes a slot, waiting up to timeout when there is room in the
+// queue. It reports whether it got one.
+func (q *slotQueue) acquire(ctx context.Context, timeout time.Duration) bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+	if q.waiting.Add(1) > q.maxQueued {
+		q.waiting.Add(-1)
+		return false
+	}
+	defer q.waiting.Add(-1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (q *slotQueue) release() {
+	<-q.slots
+}
+
+// requestLimiter applies MaxConcurrent and RouteConcurrency. A nil
+// *requestLimiter lets every request through.
+type requestLimiter struct {
+	all    *slotQueue
+	routes map[string]*slotQueue
+	// exempt routes don't count towards MaxConcurrent: health checks,
+	// so an overloaded instance isn't restarted, and event streams, which
+	// stay open.
+	exempt map[string]bool
+}
+
+// newRequestLimiter returns the limiter for c, or nil when c caps nothing.
+func newRequestLimiter(c LimitsConfig, uiPrefix string) *requestLimiter {
+	l := &requestLimiter{routes: make(map[string]*slotQueue)}
+	if c.MaxConcurrent > 0 {
+		l.all = newSlotQueue(c.MaxConcurrent, c.MaxQueued)
+	}
+	for route, n := range c.RouteConcurrency {
+		if n > 0 {
+			l.routes[route] = newSlotQueue(n, c.MaxQueued)
+		}
+	}
+	if l.all == nil && len(l.routes) == 0 {
+		return nil
+	}
+	l.exempt = map[string]bool{
+		"/health": true, "/healthz": true, "/readyz": true, "/metrics": true,
+		uiPrefix + "/api/events": true,
+	}
+	return l
+}
+
+// acquire takes the slots a request on route needs, the route's own before
+// the shared one so requests queued on a busy route don't hold up others.
+// It returns the function giving them back, or false when the request
+// should be turned away.
+func (l *requestLimiter) acquire(ctx context.Context, route string, timeout time.Duration) (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	q := l.routes[route]
+	if q != nil && !q.acquire(ctx, timeout) {
+		return nil, false
+	}
+	if l.all == nil || l.exempt[route] {
+		if q == nil {
+			return func() {}, true
+		}
+		return q.release, true
+	}
+	if !l.all.acquire(ctx, timeout) {
+		if q != nil {
+			q.release()
+		}
+		return nil, false
+	}
+	return func() {
+		l.all.release()
+		if q != nil {
+			q.release()
+		}
+	}, true
+}
+
+// writeBodyError reports a failure to read or parse the request body:
+// 413 when the body exceeded the size limit, otherwise 400 with msg.
+func writeBodyError(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, msg, http.StatusBadRequest)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBodyLimit(t *testing.T) {
+	srv := newTestServer(t)
+	srv.limits.MaxBodyBytes = 64
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength bool
+		want          int
+	}{
+		{"small", `{"url": "https://example.com"}`, true, http.StatusOK},
+		{"large with length", `{"url": "https://example.com/` + strings.Repeat("a", 64) + `"}`, true, http.StatusRequestEntityTooLarge},
+		{"large chunked", `{"url": "https://example.com/` + strings.Repeat("a", 64) + `"}`, false, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/sui/api/create", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if !tt.contentLength {
+				req.ContentLength = -1
+			}
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	limits := LimitsConfig{
+		RequestTimeout: time.Minute,
+		RouteTimeouts:  map[string]time.Duration{"/slow": 10 * time.Millisecond, "/stream": 0},
+	}
+	if got := limits.timeoutFor("/other"); got != time.Minute {
+		t.Errorf("timeoutFor(/other) = %v, want the request timeout", got)
+	}
+	if got := limits.timeoutFor("/stream"); got != 0 {
+		t.Errorf("timeoutFor(/stream) = %v, want 0", got)
+	}
+
+	srv := &Server{limits: limits}
+	release := make(chan struct{})
+	defer close(release)
+	router := mux.NewRouter()
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	router.Use(srv.limitsMiddleware)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/slow", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("/slow status = %d, want 503", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/fast", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+		t.Errorf("/fast = %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	limits := LimitsConfig{
+		MaxConcurrent:    2,
+		RouteConcurrency: map[string]int{"/busy": 1},
+		MaxQueued:        1,
+		QueueTimeout:     20 * time.Millisecond,
+	}
+	srv := &Server{limits: limits, concurrency: newRequestLimiter(limits, "/sui")}
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	router := mux.NewRouter()
+	for _, path := range []string{"/busy", "/other", "/healthz"} {
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			if r.URL.Query().Has("block") {
+				<-release
+			}
+		})
+	}
+	router.Use(srv.limitsMiddleware)
+
+	serve := func(target string) int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		return rr.Code
+	}
+	block := func(target string) chan int {
+		done := make(chan int, 1)
+		go func() { done <- serve(target + "?block") }()
+		<-started
+		return done
+	}
+
+	busy := block("/busy")
+	if got := serve("/busy"); got != http.StatusServiceUnavailable {
+		t.Errorf("second /busy = %d, want 503 once the route is full", got)
+	}
+	if got := serve("/other"); got != http.StatusOK {
+		t.Errorf("/other = %d, want 200 while /busy is full", got)
+	}
+	<-started
+	other := block("/other")
+	if got := serve("/other"); got != http.StatusServiceUnavailable {
+		t.Errorf("third request = %d, want 503 over max_concurrent", got)
+	}
+	if got := serve("/healthz"); got != http.StatusOK {
+		t.Errorf("/healthz = %d, want it exempt", got)
+	}
+	<-started
+
+	// A queued request gets the slot freed while it waits.
+	srv.limits.QueueTimeout = time.Minute
+	queued := make(chan int, 1)
+	go func() { queued <- serve("/busy") }()
+	for srv.concurrency.routes["/busy"].waiting.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for _, done := range []chan int{busy, other, queued} {
+		if got := <-done; got != http.StatusOK {
+			t.Errorf("status = %d, want 200", got)
+		}
+	}
+}
+
+func TestRequestLimiterDisabled(t *testing.T) {
+	if l := newRequestLimiter(LimitsConfig{RouteConcurrency: map[string]int{"/s/{short}": 0}}, "/sui"); l != nil {
+		t.Errorf("newRequestLimiter() = %v, want nil without caps", l)
+	}
+	var l *requestLimiter
+	release, ok := l.acquire(context.Background(), "/s/{short}", 0)
+	if !ok {
+		t.Fatal("nil limiter turned a request away")
+	}
+	release()
+}
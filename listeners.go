@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes, after
+// stdin, stdout and stderr.
+const sdListenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd socket
+// activation, in the order of the ListenStream= lines of the socket unit,
+// or nil when the process was not socket-activated.
+func systemdListeners() ([]net.Listener, error) {
+	listeners, err := activationListeners(os.Getenv, os.Getpid(), sdListenFDsStart)
+	// Like sd_listen_fds(3), don't let child processes inherit the sockets.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return listeners, err
+}
+
+// activationListeners implements the LISTEN_PID/LISTEN_FDS protocol: the
+// variables are only meant for pid, and the sockets are numbered from
+// firstFD.
+func activationListeners(getenv func(string) string, pid, firstFD int) ([]net.Listener, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		fd := firstFD + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		// FileListener dups the descriptor, so the original can go.
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s passed by systemd is not a listener: %w", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// serve runs s on ln, or on a new listener for s.Addr when ln is nil,
+// with TLS when s has a TLS config.
+func serve(s *http.Server, ln net.Listener) error {
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", s.Addr); err != nil {
+			return err
+		}
+	}
+	if s.TLSConfig != nil {
+		return s.ServeTLS(ln, "", "")
+	}
+	return s.Serve(ln)
+}
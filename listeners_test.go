@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+// passedSocket returns a raw descriptor for a new listening socket, as
+// systemd would pass it, and the socket's address.
+func passedSocket(t *testing.T) (int, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd, ln.Addr().String()
+}
+
+func TestActivationListeners(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(k string) string { return vars[k] }
+	}
+
+	if lns, err := activationListeners(env(map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}), 42, 3); lns != nil || err != nil {
+		t.Errorf("sockets meant for another process = %v, %v; want none", lns, err)
+	}
+	if _, err := activationListeners(env(map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "x"}), 42, 3); err == nil {
+		t.Error("expected an error for an invalid LISTEN_FDS")
+	}
+
+	fd, addr := passedSocket(t)
+	lns, err := activationListeners(env(map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "web",
+	}), 42, fd)
+	if err != nil || len(lns) != 1 {
+		t.Fatalf("activationListeners() = %v, %v; want one listener", lns, err)
+	}
+	if lns[0].Addr().String() != addr {
+		t.Errorf("listener address = %s, want %s", lns[0].Addr(), addr)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})}
+	go serve(srv, lns[0])
+	defer srv.Close()
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("request over the passed socket failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusTeapot)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// listPageSize is how many links the list page shows by default, and
+	// maxListPageSize the most ?per_page= may ask for.
+	listPageSize    = 50
+	maxListPageSize = 500
+)
+
+// matchesSearch reports whether q, lowercased, appears in the short code,
+// destination, page title or tags of l.
+func (l *Link) matchesSearch(q string) bool {
+	if strings.Contains(strings.ToLower(l.Short), q) || strings.Contains(strings.ToLower(l.Original), q) {
+		return true
+	}
+	if l.Meta != nil && strings.Contains(strings.ToLower(l.Meta.Title), q) {
+		return true
+	}
+	for _, tag := range l.Tags {
+		if strings.Contains(tag, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// listPage is the slice of links the list page shows and how to reach
+// the neighbouring pages.
+type listPage struct {
+	Links   []Link
+	Total   int
+	Page    int
+	Pages   int
+	PrevURL string
+	NextURL string
+}
+
+// listCountMaxAge bounds how long a cached list total is trusted, for
+// changes that don't go through linksChanged, such as a namespace moving
+// to another team.
+const listCountMaxAge = time.Minute
+
+// listCountCache remembers the number of links each list filter matches,
+// so paging doesn't count them all again. Every change to the links
+// empties it.
+type listCountCache struct {
+	mu      sync.Mutex
+	version uint64
+	counts  map[string]listCount
+}
+
+type listCount struct {
+	n  int
+	at time.Time
+}
+
+func (c *listCountCache) get(key string, version uint64, now time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.counts[key]
+	if !ok || c.version != version || now.Sub(count.at) > listCountMaxAge {
+		return 0, false
+	}
+	return count.n, true
+}
+
+func (c *listCountCache) set(key string, version uint64, n int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version || c.counts == nil {
+		c.version = version
+		c.counts = make(map[string]listCount)
+	}
+	c.counts[key] = listCount{n: n, at: now}
+}
+
+// linksChanged marks that links were created, changed or deleted, which
+// outdates the cached list totals.
+func (s *Server) linksChanged() {
+	s.linksVersion.Add(1)
+}
+
+// listCountKey identifies the links owner sees on the list page with the
+// filters of query: the total depends on them, not on the page.
+func listCountKey(owner string, query url.Values) string {
+	key := url.Values{"owner": {owner}}
+	for _, k := range []string{"all", "team", "namespace", "tag", "campaign", "q", "from", "to"} {
+		key.Set(k, query.Get(k))
+	}
+	return key.Encode()
+}
+
+// listCursor is where a list page starts: just past the index key after,
+// for the next page, or just before before, for the previous one. With
+// neither, the page is found by counting links from the newest.
+type listCursor struct {
+	after, before []byte
+}
+
+// parseListCursor reads the ?after= or ?before= cursor of the list page.
+func parseListCursor(query url.Values) (listCursor, error) {
+	var c listCursor
+	var err error
+	if v := query.Get("after"); v != "" {
+		if c.after, err = base64.RawURLEncoding.DecodeString(v); err != nil {
+			return c, fmt.Errorf("invalid cursor %q", v)
+		}
+	}
+	if v := query.Get("before"); v != "" {
+		if c.before, err = base64.RawURLEncoding.DecodeString(v); err != nil {
+			return c, fmt.Errorf("invalid cursor %q", v)
+		}
+	}
+	return c, nil
+}
+
+// listLinks returns page (1-based, clamped to the available pages) of
+// perPage links created in [from, to) that match, newest first. The total
+// is cached under countKey, which must identify match. Following a cursor
+// seeks straight to the page, so the cost of a page doesn't grow with
+// its number; page URLs carry the cursors along with the rest of query.
+func (s *Server) listLinks(from, to time.Time, page, perPage int, cursor listCursor, match func(*Link) bool, countKey, base string, query url.Values) (listPage, error) {
+	p := listPage{}
+	version := s.linksVersion.Load()
+	now := time.Now()
+	var first, last []byte
+	hasNext := false
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		walk := createdWalk{from: from, to: to, match: match}
+		total, ok := s.listCounts.get(countKey, version, now)
+		if !ok {
+			total = 0
+			if err := walkCreatedIndex(tx, walk, func([]byte, *Link) bool { total++; return true }); err != nil {
+				return err
+			}
+			s.listCounts.set(countKey, version, total, now)
+		}
+		p.Total = total
+		p.Pages = max((total+perPage-1)/perPage, 1)
+		p.Page = min(max(page, 1), p.Pages)
+		if p.Page != page {
+			cursor = listCursor{}
+		}
+
+		walk.decode = true
+		var keys [][]byte
+		collect := func(k []byte, link *Link) bool {
+			if len(p.Links) == perPage {
+				hasNext = true
+				return false
+			}
+			loadClicks(tx, link)
+			p.Links = append(p.Links, *link)
+			keys = append(keys, k)
+			return true
+		}
+		switch {
+		case cursor.before != nil:
+			// Walking back towards newer links collects the page oldest
+			// first.
+			walk.after, walk.newer = cursor.before, true
+			if err := walkCreatedIndex(tx, walk, collect); err != nil {
+				return err
+			}
+			slices.Reverse(p.Links)
+			slices.Reverse(keys)
+			hasNext = true
+		case cursor.after != nil:
+			walk.after = cursor.after
+			if err := walkCreatedIndex(tx, walk, collect); err != nil {
+				return err
+			}
+		default:
+			skip := (p.Page - 1) * perPage
+			if skip > 0 {
+				// Skipping only reads index keys when nothing is filtered.
+				walk.decode = false
+				if err := walkCreatedIndex(tx, walk, func(k []byte, _ *Link) bool {
+					walk.after = k
+					skip--
+					return skip > 0
+				}); err != nil {
+					return err
+				}
+				walk.decode = true
+			}
+			if err := walkCreatedIndex(tx, walk, collect); err != nil {
+				return err
+			}
+		}
+		if len(keys) > 0 {
+			first, last = keys[0], keys[len(keys)-1]
+		}
+		return nil
+	})
+	if err != nil {
+		return listPage{}, err
+	}
+
+	pageURL := func(n int, cursorParam string, key []byte) string {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Del("after")
+		q.Del("before")
+		q.Set("page", strconv.Itoa(n))
+		// The first page is always the newest links, without a cursor.
+		if n > 1 && key != nil {
+			q.Set(cursorParam, base64.RawURLEncoding.EncodeToString(key))
+		}
+		return base + "?" + q.Encode()
+	}
+	if p.Page > 1 {
+		p.PrevURL = pageURL(p.Page-1, "before", first)
+	}
+	if hasNext && p.Page < p.Pages {
+		p.NextURL = pageURL(p.Page+1, "after", last)
+	}
+	return p, nil
+}
+
+// parsePageParams reads ?page= and ?per_page=, defaulting to the first
+// page of listPageSize links.
+func parsePageParams(query url.Values) (page, perPage int, err error) {
+	page, perPage = 1, listPageSize
+	if v := query.Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("invalid page %q", v)
+		}
+	}
+	if v := query.Get("per_page"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil || perPage < 1 || perPage > maxListPageSize {
+			return 0, 0, fmt.Errorf("invalid per_page %q: use 1 to %d", v, maxListPageSize)
+		}
+	}
+	return page, perPage, nil
+}
+
+// parseDateRange reads the ?from= and ?to= filters of the list page. Unlike
+// the API's exclusive bound, a plain date in to includes that whole day.
+func parseDateRange(query url.Values) (from, to time.Time, err error) {
+	if from, err = parseTimeParam(query.Get("from")); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	v := query.Get("to")
+	if to, err = parseTimeParam(v); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if _, err := time.Parse("2006-01-02", v); err == nil {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
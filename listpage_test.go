@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListLinks(t *testing.T) {
+	srv := newTestServer(t)
+	for i := 0; i < 7; i++ {
+		if _, err := srv.createShortLink(fmt.Sprintf("https://example.com/%d", i), createOptions{CustomID: fmt.Sprint("lnk", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := url.Values{"q": {"x"}, "per_page": {"3"}}
+	shorts := func(p listPage) string {
+		var s []string
+		for _, link := range p.Links {
+			s = append(s, link.Short)
+		}
+		return strings.Join(s, ",")
+	}
+	list := func(page, perPage int, cursor listCursor) listPage {
+		t.Helper()
+		p, err := srv.listLinks(time.Time{}, time.Time{}, page, perPage, cursor, nil, "all", "/sui/list", query)
+		if err != nil {
+			t.Fatalf("listLinks() error: %v", err)
+		}
+		return p
+	}
+
+	tests := []struct {
+		page, perPage       int
+		wantPage, wantPages int
+		wantShorts          string
+		wantPrev, wantNext  bool
+	}{
+		{1, 3, 1, 3, "lnk6,lnk5,lnk4", false, true},
+		{2, 3, 2, 3, "lnk3,lnk2,lnk1", true, true},
+		{3, 3, 3, 3, "lnk0", true, false},
+		{9, 3, 3, 3, "lnk0", true, false},
+		{1, 10, 1, 1, "lnk6,lnk5,lnk4,lnk3,lnk2,lnk1,lnk0", false, false},
+	}
+	for _, tt := range tests {
+		p := list(tt.page, tt.perPage, listCursor{})
+		if p.Page != tt.wantPage || p.Pages != tt.wantPages || p.Total != 7 || shorts(p) != tt.wantShorts ||
+			(p.PrevURL != "") != tt.wantPrev || (p.NextURL != "") != tt.wantNext {
+			t.Errorf("listLinks(page %d, per %d) = %+v", tt.page, tt.perPage, p)
+		}
+	}
+
+	// Following the page URLs seeks to the cursor they carry.
+	first := list(1, 3, listCursor{})
+	if !strings.HasPrefix(first.NextURL, "/sui/list?after=") || !strings.HasSuffix(first.NextURL, "&page=2&per_page=3&q=x") {
+		t.Fatalf("NextURL = %q", first.NextURL)
+	}
+	follow := func(pageURL string) listPage {
+		t.Helper()
+		u, _ := url.Parse(pageURL)
+		cursor, err := parseListCursor(u.Query())
+		if err != nil {
+			t.Fatalf("parseListCursor(%q) error: %v", pageURL, err)
+		}
+		page, perPage, _ := parsePageParams(u.Query())
+		return list(page, perPage, cursor)
+	}
+	second := follow(first.NextURL)
+	if shorts(second) != "lnk3,lnk2,lnk1" {
+		t.Errorf("next page = %s, want lnk3,lnk2,lnk1", shorts(second))
+	}
+	third := follow(second.NextURL)
+	if shorts(third) != "lnk0" || third.NextURL != "" {
+		t.Errorf("last page = %s, next %q", shorts(third), third.NextURL)
+	}
+	if back := follow(third.PrevURL); shorts(back) != "lnk3,lnk2,lnk1" || back.Page != 2 {
+		t.Errorf("previous page = %s (page %d), want lnk3,lnk2,lnk1", shorts(back), back.Page)
+	}
+	if second.PrevURL != "/sui/list?page=1&per_page=3&q=x" {
+		t.Errorf("PrevURL to the first page = %q, want no cursor", second.PrevURL)
+	}
+
+	// A new link outdates the cached total.
+	if _, err := srv.createShortLink("https://example.com/7", createOptions{CustomID: "lnk7"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := list(1, 3, listCursor{}); p.Total != 8 || shorts(p) != "lnk7,lnk6,lnk5" {
+		t.Errorf("after creating a link: total %d, links %s", p.Total, shorts(p))
+	}
+	if p, err := srv.listLinks(time.Time{}, time.Time{}, 1, 3, listCursor{}, func(l *Link) bool { return l.Short == "lnk1" }, "lnk1 only", "/sui/list", nil); err != nil || p.Total != 1 || shorts(p) != "lnk1" {
+		t.Errorf("filtered list = %+v, %v", p, err)
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	from, to, err := parseDateRange(url.Values{"from": {"2024-03-01"}, "to": {"2024-03-31"}})
+	if err != nil || !from.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseDateRange() = %v, %v, %v", from, to, err)
+	}
+	if _, _, err := parseDateRange(url.Values{"to": {"March"}}); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+	if _, _, err := parsePageParams(url.Values{"per_page": {"1000"}}); err == nil {
+		t.Error("expected an error for per_page over the maximum")
+	}
+	if _, err := parseListCursor(url.Values{"after": {"not base64!"}}); err == nil {
+		t.Error("expected an error for an invalid cursor")
+	}
+}
+
+func TestListPageSearch(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	for i := 0; i < 5; i++ {
+		opts := createOptions{CustomID: fmt.Sprintf("link-%d", i), Owner: "alice", Tags: []string{"docs"}}
+		dest := fmt.Sprintf("https://docs.example.com/%d", i)
+		if i == 4 {
+			dest = "https://blog.example.com/post"
+			opts.Campaign = "spring"
+		}
+		if _, err := srv.createShortLink(dest, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(query string) string {
+		req := httptest.NewRequest("GET", "/sui/list?"+query, nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list?%s status = %d", query, rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	body := get("per_page=2&page=2")
+	if !strings.Contains(body, "Page 2 of 3") || !strings.Contains(body, `/link-2"`) || !strings.Contains(body, `/link-1"`) {
+		t.Errorf("page 2 does not show the middle links")
+	}
+	if strings.Contains(body, "blog.example.com") {
+		t.Error("page 2 shows the newest link")
+	}
+	if !strings.Contains(body, `data-copy="http://example.com/s/link-2"`) {
+		t.Error("list rows have no copy button for the short URL")
+	}
+
+	body = get("q=BLOG")
+	if !strings.Contains(body, "blog.example.com/post") || strings.Contains(body, "docs.example.com/0") || !strings.Contains(body, "1 links") {
+		t.Error("search does not narrow the list to the matching link")
+	}
+	// The cached total of the unfiltered list doesn't stand in for a
+	// campaign's.
+	if body := get(""); !strings.Contains(body, "5 links") {
+		t.Error("unfiltered list does not count every link")
+	}
+	if body := get("campaign=spring"); !strings.Contains(body, "1 links") || strings.Contains(body, "docs.example.com/0") {
+		t.Error("campaign filter does not narrow the list and its total")
+	}
+	if body := get("q=nothing"); !strings.Contains(body, "No links match") {
+		t.Error("empty search result not reported")
+	}
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	if body := get("from=" + tomorrow); !strings.Contains(body, "No links match") {
+		t.Error("date filter does not exclude older links")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// loadResult sums up a load test.
+type loadResult struct {
+	elapsed   time.Duration
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    int
+	// skipped counts requests that were due while every connection was
+	// still busy, so the instance couldn't keep up with the rate.
+	skipped int
+}
+
+// runLoadtest implements the "loadtest" command, which sends GET requests
+// to a running instance at a steady rate and reports their latency.
+func runLoadtest(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	rps := fs.Int("rps", 100, "requests per second")
+	duration := fs.Duration("duration", 10*time.Second, "how long to send requests")
+	concurrency := fs.Int("concurrency", 64, "most requests in flight at once")
+	timeout := fs.Duration("timeout", 10*time.Second, "time limit of each request")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s loadtest [flags] <url>...\n\n", os.Args[0])
+		fmt.Fprintln(out, "Requests the URLs in turn, such as short links of a running instance, without")
+		fmt.Fprintln(out, "following redirects, and reports the status codes and latency percentiles.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseInterspersed(fs, args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no URL given")
+	}
+	if *rps <= 0 || *duration <= 0 || *concurrency <= 0 {
+		return errors.New("rps, duration and concurrency must be positive")
+	}
+	for _, raw := range fs.Args() {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", raw)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	client := &http.Client{
+		Timeout:       *timeout,
+		Transport:     &http.Transport{MaxIdleConnsPerHost: *concurrency},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	result := runLoad(ctx, client, fs.Args(), *rps, *concurrency)
+	result.print(os.Stdout)
+	return nil
+}
+
+// runLoad requests urls in turn at rps requests per second, with at most
+// concurrency in flight, until ctx is done.
+func runLoad(ctx context.Context, client *http.Client, urls []string, rps, concurrency int) loadResult {
+	result := loadResult{statuses: make(map[int]int)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	request := func(target string) {
+		defer wg.Done()
+		defer func() { <-slots }()
+		start := time.Now()
+		req, err := http.NewRequest("GET", target, nil)
+		var resp *http.Response
+		if err == nil {
+			resp, err = client.Do(req)
+		}
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		latency := time.Since(start)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.errors++
+			return
+		}
+		result.statuses[resp.StatusCode]++
+		result.latencies = append(result.latencies, latency)
+	}
+
+	// Requests are sent as they fall due, checked every millisecond or
+	// every request at low rates, so the rate holds beyond what a ticker
+	// could fire.
+	ticker := time.NewTicker(max(time.Second/time.Duration(rps), time.Millisecond))
+	defer ticker.Stop()
+	start := time.Now()
+	sent := 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+		due := int(time.Since(start).Seconds()*float64(rps)) - sent
+		for ; due > 0; due-- {
+			target := urls[sent%len(urls)]
+			sent++
+			select {
+			case slots <- struct{}{}:
+				wg.Add(1)
+				go request(target)
+			default:
+				mu.Lock()
+				result.skipped++
+				mu.Unlock()
+			}
+		}
+	}
+	result.elapsed = time.Since(start)
+	wg.Wait()
+	return result
+}
+
+// percentile returns the latency p percent of requests were faster than,
+// from sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// print writes the summary of r to w.
+func (r loadResult) print(w io.Writer) {
+	slices.Sort(r.latencies)
+	completed := len(r.latencies)
+	rate := 0.0
+	if r.elapsed > 0 {
+		rate = float64(completed) / r.elapsed.Seconds()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "requests\t%d in %s (%.1f/s), %d errors, %d skipped\n", completed, r.elapsed.Round(time.Millisecond), rate, r.errors, r.skipped)
+	codes := make([]int, 0, len(r.statuses))
+	for code := range r.statuses {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		fmt.Fprintf(tw, "status %d\t%d\n", code, r.statuses[code])
+	}
+	if completed > 0 {
+		fmt.Fprintf(tw, "latency\tp50 %s  p90 %s  p99 %s  max %s\n",
+			percentile(r.latencies, 50), percentile(r.latencies, 90), percentile(r.latencies, 99), r.latencies[completed-1])
+	}
+	tw.Flush()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(n ...int) []time.Duration {
+		var d []time.Duration
+		for _, v := range n {
+			d = append(d, time.Duration(v)*time.Millisecond)
+		}
+		return d
+	}
+	sorted := ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	tests := []struct {
+		latencies []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{nil, 50, 0},
+		{ms(7), 99, 7 * time.Millisecond},
+		{sorted, 50, 5 * time.Millisecond},
+		{sorted, 90, 9 * time.Millisecond},
+		{sorted, 99, 10 * time.Millisecond},
+		{sorted, 1, 1 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.latencies, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestRunLoad(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/s/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "https://example.com", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	result := runLoad(ctx, client, []string{ts.URL + "/s/abc", ts.URL + "/s/missing"}, 100, 4)
+
+	total := result.statuses[http.StatusFound] + result.statuses[http.StatusNotFound]
+	if total < 5 || total > 30 || result.errors != 0 {
+		t.Fatalf("statuses = %v, errors = %d; want about 20 requests", result.statuses, result.errors)
+	}
+	if diff := result.statuses[http.StatusFound] - result.statuses[http.StatusNotFound]; diff < -1 || diff > 1 {
+		t.Errorf("statuses = %v, want the URLs requested in turn", result.statuses)
+	}
+
+	var out strings.Builder
+	result.print(&out)
+	for _, want := range []string{"requests", "status 302", "status 404", "p99"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary is missing %q:\n%s", want, out.String())
+		}
+	}
+}
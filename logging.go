@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// LogConfig selects the log output.
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is text (logfmt-style key=value pairs) or json.
+	Format string `yaml:"format"`
+	// File, when set, receives the logs instead of stderr. It is reopened
+	// on SIGHUP, so it can be rotated by logrotate.
+	File string `yaml:"file"`
+}
+
+type loggerKey struct{}
+
+// newLogger builds a logger writing to w as configured.
+func newLogger(w io.Writer, cfg LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: use debug, info, warn or error", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch cfg.Format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: use text or json", cfg.Format)
+	}
+}
+
+// requestLogger returns the logger carrying the fields of the request,
+// or the default logger outside of routed requests.
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// loggingMiddleware logs every routed request once it completes, and makes
+// a logger with the request's method, path and short code available to
+// handlers through requestLogger.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := slog.Default().With("method", r.Method, "path", r.URL.Path)
+		if short := mux.Vars(r)["short"]; short != "" {
+			logger = logger.With("short", short)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(r.Context(), level, "request",
+			"status", rec.status,
+			"latency", time.Since(start),
+			"remote", s.clientIP(r),
+		)
+	})
+}
+
+// logFile is a log file opened for appending that can be reopened after
+// it has been rotated away.
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	l := &logFile{path: path}
+	if err := l.Reopen(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// Reopen closes the file and opens path again, creating it if needed.
+func (l *logFile) Reopen() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	l.mu.Lock()
+	old := l.f
+	l.f = f
+	l.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
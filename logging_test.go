@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		cfg     LogConfig
+		wantErr bool
+	}{
+		{LogConfig{Level: "info", Format: "text"}, false},
+		{LogConfig{Level: "DEBUG", Format: "json"}, false},
+		{LogConfig{Level: "warn", Format: "xml"}, true},
+		{LogConfig{Level: "loud", Format: "text"}, true},
+	}
+
+	for _, tt := range tests {
+		if _, err := newLogger(&bytes.Buffer{}, tt.cfg); (err != nil) != tt.wantErr {
+			t.Errorf("newLogger(%+v) error = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger, _ := newLogger(&buf, LogConfig{Level: "warn", Format: "json"})
+	logger.Info("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("info message logged at warn level: %s", buf.String())
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "logged"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger, _ := newLogger(&buf, LogConfig{Level: "info", Format: "json"})
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	srv.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", srv.prefix+"/logged", nil))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log output is not one JSON entry: %q", buf.String())
+	}
+	want := map[string]interface{}{
+		"msg":    "request",
+		"method": "GET",
+		"path":   srv.prefix + "/logged",
+		"short":  "logged",
+		"status": float64(http.StatusFound),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("log field %s = %v, want %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Error("log entry has no latency")
+	}
+}
+
+func TestLogFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pk-shorts.log")
+	lf, err := openLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(lf, "before rotation")
+
+	// Rotate the way logrotate does: rename, then signal a reopen.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Reopen(); err != nil {
+		t.Fatalf("Reopen() error: %v", err)
+	}
+	fmt.Fprintln(lf, "after rotation")
+
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if string(rotated) != "before rotation\n" || string(current) != "after rotation\n" {
+		t.Errorf("rotated = %q, current = %q", rotated, current)
+	}
+}
@@ -1,19 +1,24 @@
 package main
 
 import (
-	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
-	"os/signal"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 	bolt "go.etcd.io/bbolt"
@@ -33,6 +38,36 @@ type Link struct {
 	Original  string    `json:"original"`
 	CreatedAt time.Time `json:"created_at"`
 	Clicks    int       `json:"clicks"`
+	Owner     string    `json:"owner,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	// Domain is the configured hostname the link is served on, or "" for
+	// the default one.
+	Domain string `json:"domain,omitempty"`
+	// Flagged is set when a threat list reported the destination; the
+	// link then stops redirecting until an admin clears it.
+	Flagged *LinkFlag `json:"flagged,omitempty"`
+	// Trusted marks a flagged link an admin restored; rescans skip it.
+	Trusted bool `json:"trusted,omitempty"`
+	// Reported collects abuse reports from visitors; the link shows a
+	// warning before redirecting until an admin reviews them.
+	Reported *LinkReport `json:"reported,omitempty"`
+	// ExpiresAt, when set, is when the link stops redirecting.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Disabled links were turned off by someone managing them and don't
+	// redirect until enabled again.
+	Disabled bool `json:"disabled,omitempty"`
+	// Meta describes the destination page, when link metadata fetching
+	// is enabled and the page could be fetched.
+	Meta *LinkMeta `json:"meta,omitempty"`
+	// NoMetaRefresh keeps Meta from being fetched again by the periodic
+	// refresh, such as for pages showing bots another title.
+	NoMetaRefresh bool `json:"no_meta_refresh,omitempty"`
+	// Paste makes the link a text snippet shown at its short URL; Original
+	// is then empty.
+	Paste *Paste `json:"paste,omitempty"`
+	// Campaign is the name of the owner's campaign the link was created
+	// for, if any.
+	Campaign string `json:"campaign,omitempty"`
 }
 
 type Server struct {
@@ -40,177 +75,712 @@ type Server struct {
 	router   *mux.Router
 	prefix   string
 	uiPrefix string
+	metrics  *Metrics
+
+	// reloadMu guards what a SIGHUP reloads; see reload.
+	reloadMu sync.RWMutex
+	assets   fs.FS
 	tmpl     *template.Template
+	apiKeys  map[string]string
+	reserved []reservedPrefix
+	branding BrandingConfig
+
+	// ids generates the random short codes.
+	ids idGenerator
+	// idCollisions counts generated codes found taken, and idExhausted the
+	// creates that found no free code; both grow as the keyspace fills.
+	idCollisions, idExhausted atomic.Uint64
+
+	adminToken string
+	// adminUser is the account given the admin role when it is created.
+	adminUser string
+
+	// ldap is nil unless directory authentication is configured.
+	ldap *LDAPConfig
+
+	cache *lruCache
+	// lookups shares the database reads of redirects missing the cache.
+	lookups flightGroup
+
+	// baseURL, when set, replaces the scheme and host of the request in
+	// generated short URLs.
+	baseURL string
+
+	// trustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Forwarded-Proto headers are believed.
+	trustedProxies []netip.Prefix
+	// countryHeader is the request header a trusted proxy puts the
+	// client's country in, e.g. CF-IPCountry.
+	countryHeader string
+
+	// access restricts the UI and admin routes to client IP ranges.
+	access accessRanges
+
+	limits LimitsConfig
+	// concurrency turns requests away once too many are being handled;
+	// nil when unlimited.
+	concurrency *requestLimiter
+	// disableCompression turns off gzip for responses, e.g. when a
+	// reverse proxy compresses them.
+	disableCompression bool
+
+	// destinations restricts the URLs links may point to. With
+	// BlockInternal set, hosts are looked up with resolver and compared
+	// against ownHosts.
+	destinations DestinationConfig
+	resolver     resolver
+	ownHosts     map[string]bool
+
+	// threats checks destinations against a threat list; nil when no
+	// safe browsing provider is configured.
+	threats threatChecker
+
+	// createLimiter limits link creation per client IP; nil when no limit
+	// is configured. bans holds the banned ranges, see loadBans.
+	createLimiter *rateLimiter
+	bans          atomic.Pointer[[]netip.Prefix]
+
+	// captcha guards the create form for anonymous visitors and pow the
+	// API; either is nil when not configured.
+	captcha       *captcha
+	captchaSecret string
+	pow           *powIssuer
+
+	// ephemeral signs and verifies stateless links; nil when disabled.
+	ephemeral *ephemeralSigner
+
+	// slack configures the Slack slash command.
+	slack SlackConfig
+	// discordKey verifies Discord interactions; nil when disabled.
+	discordKey ed25519.PublicKey
+	// shlink configures the Shlink-compatible REST API.
+	shlink ShlinkConfig
+	// bitly configures the Bitly-compatible endpoints.
+	bitly BitlyConfig
+	// email configures the email gateway.
+	email EmailConfig
+	// yourls configures the YOURLS-compatible API.
+	yourls YOURLSConfig
+
+	// externalWarning confirms redirects to untrusted destinations.
+	externalWarning ExternalWarningConfig
+
+	// metadata fetches the title and icon of destinations; nil when
+	// disabled.
+	metadata *metadataFetcher
+	// previewTransport fetches destinations for moderator previews.
+	previewTransport http.RoundTripper
+
+	// drainers flush background write queues on shutdown; see onShutdown.
+	drainers []drainer
+	// clickQueue batches the clicks of redirects; nil when clicks are
+	// written as they happen.
+	clickQueue *clickQueue
+
+	// linksVersion counts changes to links, and listCounts caches the
+	// list page totals until the next one.
+	linksVersion atomic.Uint64
+	listCounts   listCountCache
+
+	// events fans click updates out to the list page's event streams.
+	events *eventHub
+
+	// domains maps each configured extra hostname to its short prefix.
+	domains map[string]string
+	// appLinks holds the app association files of each domain, with ""
+	// for the default ones.
+	appLinks map[string]appLinkFiles
+
+	// readOnly marks a replica that opened the database read-only and
+	// serves redirects only.
+	readOnly bool
+
+	maintenanceMode atomic.Pointer[Maintenance]
+
+	settingsMu sync.RWMutex
+	settings   Settings
 }
 
-func NewServer() (*Server, error) {
-	dbFile := os.Getenv("DB_PATH")
-	if dbFile == "" {
-		dbFile = defaultDBFile
+// NewServer opens the database and builds a server from cfg. Pending
+// schema migrations are applied on open. With cfg.ReadOnly set the
+// database is opened read-only, must already be fully migrated, and only
+// redirects are served; this is meant for replicas running against a copy
+// of the primary's database file.
+func NewServer(cfg *Config) (*Server, error) {
+	readOnly := cfg.ReadOnly
+	db, err := openDB(cfg.DBPath, cfg.Database, readOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if readOnly {
+		err = checkSchema(db)
+	} else {
+		err = db.Update(migrate)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare database: %w", err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
-		return err
-	})
+	assets := uiAssets(cfg.UIDir)
+	tmpl, err := parseTemplates(assets)
 	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create bucket: %w", err)
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
 	}
 
-	prefix := os.Getenv("SHORT_PREFIX")
-	if prefix == "" {
-		prefix = defaultPrefix
+	apiKeys, err := cfg.apiKeyMap()
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	uiPrefix := os.Getenv("UI_PREFIX")
-	if uiPrefix == "" {
-		uiPrefix = defaultUIPrefix
+	reserved, err := cfg.reservedPrefixes()
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	tmpl, err := template.ParseGlob("templates/*.html")
+	baseURL, err := parseBaseURL(cfg.BaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse templates: %w", err)
+		db.Close()
+		return nil, err
+	}
+
+	access, err := parseAccess(cfg.Access)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	domains, err := parseDomains(cfg.Domains, cfg.ShortPrefix)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	appLinks, err := parseAppLinks(cfg.AppLinks, cfg.Domains)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	destinations, err := parseDestinations(cfg.Destinations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	threats, err := newThreatChecker(cfg.SafeBrowsing)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	captcha, err := newCaptcha(cfg.Captcha)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ephemeral, err := newEphemeralSigner(cfg.Ephemeral)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	discordKey, err := parseDiscordKey(cfg.Discord)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := checkEmailConfig(cfg.Email, baseURL); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	externalWarning, err := parseExternalWarning(cfg.ExternalWarning)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	branding, err := parseBranding(cfg.Branding)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ids, err := parseIDConfig(cfg.IDs)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ldapConfig, err := cfg.Auth.LDAP.resolve()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	settings, err := loadSettings(db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load settings: %w", err)
 	}
 
-	return &Server{
+	if !readOnly {
+		if err := purgeExpiredSessions(db); err != nil {
+			slog.Error("failed to purge expired sessions", "err", err)
+		}
+	}
+
+	s := &Server{
 		db:       db,
-		prefix:   prefix,
-		uiPrefix: uiPrefix,
+		prefix:   cfg.ShortPrefix,
+		uiPrefix: cfg.UIPrefix,
+		assets:   assets,
 		tmpl:     tmpl,
-	}, nil
+		metrics:  NewMetrics(),
+		apiKeys:  apiKeys,
+		reserved: reserved,
+		branding: branding,
+		ids:      ids,
+
+		adminToken: cfg.Auth.AdminToken,
+		adminUser:  strings.ToLower(strings.TrimSpace(cfg.Auth.AdminUser)),
+		ldap:       ldapConfig,
+
+		cache: newLRUCache(cfg.Cache.Size, cfg.Cache.TTL),
+
+		baseURL:        baseURL,
+		trustedProxies: trustedProxies,
+		countryHeader:  cfg.CountryHeader,
+		access:         access,
+		domains:        domains,
+		appLinks:       appLinks,
+		limits:         cfg.Limits,
+		concurrency:    newRequestLimiter(cfg.Limits, cfg.UIPrefix),
+		destinations:   destinations,
+		resolver:       net.DefaultResolver,
+		ownHosts:       ownHosts(cfg),
+		threats:        threats,
+		createLimiter:  newRateLimiter(cfg.RateLimit),
+		captcha:        captcha,
+		captchaSecret:  cfg.Captcha.Secret,
+		pow:            newPowIssuer(cfg.Captcha.PowDifficulty),
+		ephemeral:      ephemeral,
+		slack:          cfg.Slack,
+		shlink:         cfg.Shlink,
+		bitly:          cfg.Bitly,
+		yourls:         cfg.YOURLS,
+		email:          cfg.Email,
+		discordKey:     discordKey,
+
+		externalWarning:  externalWarning,
+		metadata:         newMetadataFetcher(cfg.Metadata),
+		previewTransport: externalTransport(),
+		events:           newEventHub(),
+
+		readOnly:           readOnly,
+		disableCompression: cfg.DisableCompression,
+
+		settings: settings,
+	}
+	if err := s.loadBans(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load bans: %w", err)
+	}
+	if cfg.Maintenance {
+		s.setMaintenance(true, "")
+	}
+	if !readOnly {
+		s.clickQueue = newClickQueue(cfg.Clicks.FlushInterval, s.writeClicks)
+		if s.clickQueue != nil {
+			s.onShutdown("clicks", s.drainClicks)
+		}
+	}
+	return s, nil
 }
 
 func (s *Server) Close() error {
+	s.clickQueue.close()
 	return s.db.Close()
 }
 
 func (s *Server) setupRoutes() {
 	s.router = mux.NewRouter()
 
-	s.router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
+	s.router.HandleFunc(s.prefix+"/{short}", s.handleRedirect).Methods("GET")
+	s.router.HandleFunc(s.prefix+"/{short}/preview", s.handlePreview).Methods("GET")
+	s.router.HandleFunc(s.prefix+"/{short}/raw", s.handlePasteRaw).Methods("GET")
+	s.router.HandleFunc(s.prefix+"/{short}/pixel.gif", s.handleConversionPixel).Methods("GET")
+	s.router.HandleFunc("/health", s.handleHealth).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleHealth).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReady).Methods("GET")
+	s.router.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/version", s.handleVersion).Methods("GET")
+	s.setupAppLinkRoutes()
+	s.router.Use(s.metricsMiddleware)
+	s.router.Use(s.loggingMiddleware)
+	s.router.Use(s.accessMiddleware)
+	s.router.Use(s.limitsMiddleware)
+	s.router.Use(s.compressMiddleware)
+	s.router.Use(s.maintenanceMiddleware)
+
+	if s.readOnly {
+		s.setupNamespaceRoutes()
+		s.setupDomainRoutes()
+		return
+	}
 
 	s.router.HandleFunc(s.uiPrefix, s.handleHome).Methods("GET")
 	s.router.HandleFunc(s.uiPrefix+"/", s.handleHome).Methods("GET")
-	s.router.HandleFunc(s.uiPrefix+"/create", s.handleCreate).Methods("POST")
+	s.router.PathPrefix(s.uiPrefix+"/static/").HandlerFunc(s.handleStatic).Methods("GET", "HEAD")
+	s.router.HandleFunc(s.uiPrefix+"/create", s.limitCreate(s.handleCreate)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/quick", s.limitCreate(s.handleQuick)).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/share", s.handleShare).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/manifest.webmanifest", s.handleManifest).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/sw.js", s.handleServiceWorker).Methods("GET")
 	s.router.HandleFunc(s.uiPrefix+"/list", s.handleList).Methods("GET")
-	s.router.HandleFunc(s.uiPrefix+"/api/create", s.handleAPICreate).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/links/{short}", s.handleLinkPage).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/tools", s.handleTools).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/tools", s.limitCreate(s.handleTools)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/create", s.limitCreate(s.handleAPICreate)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/paste", s.limitCreate(s.handleAPIPaste)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/pow", s.handlePowChallenge).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/available/{short}", s.handleAvailable).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/ext/create", extensionCORS(s.limitCreate(s.handleExtensionCreate))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc(s.uiPrefix+"/api/ephemeral", s.limitCreate(s.handleAPIEphemeral)).Methods("POST")
+	if s.slack.SigningSecret != "" {
+		s.router.HandleFunc(s.uiPrefix+"/integrations/slack", s.limitCreate(s.handleSlackCommand)).Methods("POST")
+	}
+	if s.discordKey != nil {
+		s.router.HandleFunc(s.uiPrefix+"/integrations/discord", s.limitCreate(s.handleDiscordInteraction)).Methods("POST")
+	}
+	s.router.HandleFunc(s.prefix+"/{short}/report", s.limitCreate(s.handleReport)).Methods("POST")
 	s.router.HandleFunc(s.uiPrefix+"/api/list", s.handleAPIList).Methods("GET")
 	s.router.HandleFunc(s.uiPrefix+"/api/delete/{short}", s.handleAPIDelete).Methods("DELETE")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{short}", s.handleAPIUpdate).Methods("PATCH")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{short}/stats", s.handleLinkStats).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{short}/conversion", s.handleAPIConversion).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{short}/restore", s.handleAPIRestore).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/bulk", s.handleAPIBulk).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/import", s.limitCreate(s.handleAPIImport)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/export", s.handleAPIExport).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/campaigns", s.handleAPICampaigns).Methods("GET", "POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/campaigns/{name}", s.handleAPICampaign).Methods("GET", "PUT", "DELETE")
+	s.router.HandleFunc(s.uiPrefix+"/api/stats/compare", s.handleStatsCompare).Methods("GET")
+	s.setupGrafanaRoutes()
+	s.router.HandleFunc(s.uiPrefix+"/api/events", s.handleEvents).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/qr/{short}.{format:png|svg}", s.handleQR).Methods("GET")
 	s.router.HandleFunc(s.uiPrefix+"/delete/{short}", s.handleDelete).Methods("POST")
-
-	s.router.HandleFunc(s.prefix+"/{short}", s.handleRedirect).Methods("GET")
-
-	s.router.HandleFunc("/health", s.handleHealth).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/login", s.handleLoginPage).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/login", s.handleLogin).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/login/2fa", s.handleLoginTwoFactor).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/register", s.handleRegisterPage).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/register", s.handleRegister).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/logout", s.handleLogout).Methods("POST")
+
+	account := s.router.PathPrefix(s.uiPrefix + "/account").Subrouter()
+	account.Use(s.requireUser)
+	account.HandleFunc("", s.handleAccount).Methods("GET")
+	account.HandleFunc("/2fa/enable", s.handleEnableTwoFactor).Methods("POST")
+	account.HandleFunc("/2fa/disable", s.handleDisableTwoFactor).Methods("POST")
+	account.HandleFunc("/2fa/backup-codes", s.handleRegenerateBackupCodes).Methods("POST")
+	account.HandleFunc("/tokens", s.handleCreateUserAPIKey).Methods("POST")
+	account.HandleFunc("/tokens/{id}/revoke", s.handleRevokeUserAPIKey).Methods("POST")
+	account.HandleFunc("/extension", s.handleExtensionAuthorize).Methods("GET")
+	account.HandleFunc("/extension", s.handleExtensionConnect).Methods("POST")
+
+	adminAPI := s.router.PathPrefix(s.uiPrefix + "/api/admin").Subrouter()
+	adminAPI.Use(s.requireAdmin)
+	adminAPI.HandleFunc("/preview/{short}", s.handleAdminPreview).Methods("GET")
+	adminAPI.HandleFunc("/maintenance", s.handleAdminMaintenance).Methods("GET", "POST")
+	adminAPI.HandleFunc("/bans", s.handleAdminBans).Methods("GET", "POST", "DELETE")
+	adminAPI.HandleFunc("/deletions", s.handleAdminTombstones).Methods("GET")
+
+	admin := s.router.PathPrefix(s.uiPrefix + "/admin").Subrouter()
+	admin.Use(s.requireAdmin)
+	admin.HandleFunc("", s.handleAdmin).Methods("GET")
+	admin.HandleFunc("/users/{username}/role", s.handleAdminSetRole).Methods("POST")
+	admin.HandleFunc("/users/{username}/delete", s.handleAdminDeleteUser).Methods("POST")
+	admin.HandleFunc("/users/{username}/reset-2fa", s.handleAdminResetTwoFactor).Methods("POST")
+	admin.HandleFunc("/keys", s.handleAdminCreateKey).Methods("POST")
+	admin.HandleFunc("/keys/{id}/revoke", s.handleAdminRevokeKey).Methods("POST")
+	admin.HandleFunc("/settings", s.handleAdminSettings).Methods("POST")
+	admin.HandleFunc("/links/{short}/unflag", s.handleAdminUnflag).Methods("POST")
+	admin.HandleFunc("/links/{short}/review", s.handleAdminReview).Methods("POST")
+	admin.HandleFunc("/teams", s.handleAdminCreateTeam).Methods("POST")
+	admin.HandleFunc("/teams/{team}/members", s.handleAdminAddTeamMember).Methods("POST")
+	admin.HandleFunc("/teams/{team}/members/{username}/remove", s.handleAdminRemoveTeamMember).Methods("POST")
+	admin.HandleFunc("/teams/{team}/delete", s.handleAdminDeleteTeam).Methods("POST")
+	admin.HandleFunc("/namespaces", s.handleAdminCreateNamespace).Methods("POST")
+	admin.HandleFunc("/namespaces/{namespace}/delete", s.handleAdminDeleteNamespace).Methods("POST")
+
+	if s.shlink.Enabled {
+		s.setupShlinkRoutes()
+	}
+	if s.bitly.Enabled {
+		s.setupBitlyRoutes()
+	}
+	if s.yourls.Enabled {
+		s.router.HandleFunc("/yourls-api.php", s.handleYOURLS).Methods("GET", "POST")
+	}
+	s.setupNamespaceRoutes()
+	s.setupDomainRoutes()
 }
 
-// scheme returns the request scheme, honoring reverse-proxy headers so that
-// links generated behind a TLS-terminating proxy use https. It checks
-// X-Forwarded-Proto first, then falls back to the request's TLS state.
-func scheme(r *http.Request) string {
-	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
-		// May be a comma-separated list (proto, proto); take the first.
-		if i := strings.IndexByte(proto, ','); i >= 0 {
-			proto = proto[:i]
-		}
-		return strings.TrimSpace(proto)
+// pageData returns the template data shared by every UI page.
+func (s *Server) pageData(r *http.Request) map[string]interface{} {
+	user := s.currentUser(r)
+	maintenance := s.maintenance()
+	return map[string]interface{}{
+		"UIPrefix":         s.uiPrefix,
+		"Prefix":           s.prefix,
+		"ShortBases":       s.shortBases(r),
+		"Domains":          s.domainNames(),
+		"Domain":           s.requestDomain(r),
+		"User":             user,
+		"IsAdmin":          user.IsAdmin(),
+		"RegistrationOpen": s.registrationOpen(),
+		"CanCreate":        (user != nil || s.getSettings().AnonymousCreate) && !maintenance.Enabled,
+		"Teams":            s.callerTeams(user),
+		"Maintenance":      maintenance,
+		"Captcha":          s.formCaptcha(user),
+		"Brand":            s.brand(),
+		"SecureIDLength":   s.ids.secureLength,
 	}
-	if r.TLS != nil {
-		return "https"
-	}
-	return "http"
+}
+
+// wantsPartial reports whether r asks for only the part of the page it
+// changes, as the UI's scripts do with an X-Partial header, rather than
+// the whole page.
+func wantsPartial(r *http.Request) bool {
+	return r.Header.Get("X-Partial") == "true"
 }
 
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
-	data := map[string]interface{}{
-		"UIPrefix": s.uiPrefix,
-		"Prefix":   s.prefix,
-		"Host":     r.Host,
-		"Scheme":   scheme(r),
-	}
+	data := s.pageData(r)
 
-	if err := s.tmpl.ExecuteTemplate(w, "index.html", data); err != nil {
+	if err := s.templates().ExecuteTemplate(w, "index.html", data); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		log.Printf("Template error: %v", err)
+		requestLogger(r).Error("template error", "err", err)
 	}
 }
 
 func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
-	url := r.FormValue("url")
+	url := strings.TrimSpace(r.FormValue("url"))
 	if url == "" {
-		http.Error(w, "URL is required", http.StatusBadRequest)
+		s.writeCreateFormError(w, r, http.StatusBadRequest, "url", "URL is required")
 		return
 	}
 
 	secure := r.FormValue("secure") == "on"
 	customID := strings.TrimSpace(r.FormValue("custom_id"))
 
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
+	url = s.destinations.withDefaultScheme(url)
+
+	tags, err := normalizeTags(splitLines(r.FormValue("tags")))
+	if err != nil {
+		s.writeCreateFormError(w, r, http.StatusBadRequest, "tags", err.Error())
+		return
 	}
 
-	short, err := s.createShortLink(url, secure, customID)
+	_, domainGiven := r.Form["domain"]
+	domain, err := s.createDomain(r, r.FormValue("domain"), domainGiven)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create short link: %v", err), http.StatusInternalServerError)
+		s.writeCreateFormError(w, r, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	opts := createOptions{Secure: secure, CustomID: customID, Tags: tags, Domain: domain}
+	if user := s.currentUser(r); user != nil {
+		opts.Owner = user.Username
+	} else if !s.getSettings().AnonymousCreate {
+		http.Redirect(w, r, s.uiPrefix+"/login", http.StatusSeeOther)
 		return
+	} else if s.captcha != nil {
+		if err := s.verifyCaptcha(r); err != nil {
+			writeNotHumanError(w, err)
+			return
+		}
+	}
+	if team := r.FormValue("team"); team != "" {
+		if opts.Owner, err = s.teamOwner(r, team); err != nil {
+			s.writeCreateFormError(w, r, http.StatusForbidden, "", err.Error())
+			return
+		}
+	}
+	if opts.Owner == "" {
+		if opts.DeleteToken, err = newDeleteToken(); err != nil {
+			http.Error(w, "Failed to create short link", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	data := map[string]interface{}{
-		"UIPrefix": s.uiPrefix,
-		"Prefix":   s.prefix,
-		"Host":     r.Host,
-		"Scheme":   scheme(r),
-		"Success":  true,
-		"ShortURL": fmt.Sprintf("%s://%s%s/%s", scheme(r), r.Host, s.prefix, short),
-		"Original": url,
+	short, err := s.createShortLink(url, opts)
+	if err != nil {
+		if errors.Is(err, errDailyQuota) {
+			w.Header().Set("Retry-After", strconv.Itoa(secondsUntilNextDay(time.Now())))
+		}
+		field := createErrorField(err)
+		msg := fmt.Sprintf("Failed to create short link: %v", err)
+		if field != "" {
+			// Next to the field, what failed goes without saying.
+			msg = capitalize(err.Error())
+		}
+		s.writeCreateFormError(w, r, createErrorStatus(err), field, msg)
+		return
 	}
 
-	if err := s.tmpl.ExecuteTemplate(w, "index.html", data); err != nil {
+	data := s.pageData(r)
+	data["Success"] = true
+	data["ShortURL"] = s.shortURL(r, domain, short)
+	data["Original"] = url
+	data["Short"] = short
+	data["DeleteToken"] = opts.DeleteToken
+	data["RequireDeleteReason"] = s.getSettings().RequireDeleteReason
+
+	name := "index.html"
+	if wantsPartial(r) {
+		name = "create-result"
+	}
+	if err := s.templates().ExecuteTemplate(w, name, data); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		log.Printf("Template error: %v", err)
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
+
+// writeCreateFormError answers a create form the server refused, with msg
+// shown next to field ("" for the form as a whole). The UI's scripts get
+// msg as text and the field in X-Error-Field; other browsers get the home
+// page again with what was entered kept.
+func (s *Server) writeCreateFormError(w http.ResponseWriter, r *http.Request, status int, field, msg string) {
+	if wantsPartial(r) {
+		w.Header().Set("X-Error-Field", field)
+		http.Error(w, msg, status)
+		return
+	}
+
+	data := s.pageData(r)
+	data["Error"] = msg
+	data["ErrorField"] = field
+	data["Form"] = r.Form
+	if _, ok := r.Form["domain"]; ok {
+		data["Domain"] = r.FormValue("domain")
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.templates().ExecuteTemplate(w, "index.html", data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
 	}
 }
 
+// capitalize returns msg with its first letter in upper case, for showing
+// an error on its own.
+func capitalize(msg string) string {
+	if msg == "" {
+		return msg
+	}
+	r, size := utf8.DecodeRuneInString(msg)
+	return string(unicode.ToUpper(r)) + msg[size:]
+}
+
 func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
-	links, err := s.getAllLinks()
+	match, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := parseDateRange(query)
 	if err != nil {
-		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, perPage, err := parsePageParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	data := map[string]interface{}{
-		"UIPrefix": s.uiPrefix,
-		"Prefix":   s.prefix,
-		"Host":     r.Host,
-		"Scheme":   scheme(r),
-		"Links":    links,
+	cursor, err := parseListCursor(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	owner, _ := s.callerOwner(r)
+	p, err := s.listLinks(from, to, page, perPage, cursor, match, listCountKey(owner, query), s.uiPrefix+"/list", query)
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		return
 	}
 
-	if err := s.tmpl.ExecuteTemplate(w, "list.html", data); err != nil {
+	data := s.pageData(r)
+	data["Page"] = p
+	data["All"] = query.Get("all") == "true"
+	data["Team"] = query.Get("team")
+	data["Namespace"] = query.Get("namespace")
+	data["Namespaces"] = s.callerNamespaces(s.currentUser(r))
+	data["Tag"] = query.Get("tag")
+	data["Query"] = query.Get("q")
+	data["From"] = query.Get("from")
+	data["To"] = query.Get("to")
+	data["RequireDeleteReason"] = s.getSettings().RequireDeleteReason
+
+	name := "list.html"
+	if wantsPartial(r) {
+		name = "links"
+	}
+	w.Header().Set("Vary", "X-Partial")
+	if err := s.templates().ExecuteTemplate(w, name, data); err != nil {
 		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-		log.Printf("Template error: %v", err)
+		requestLogger(r).Error("template error", "err", err)
 	}
 }
 
 func (s *Server) handleAPICreate(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	system, _ := s.apiKeySystem(r)
+	owner, _ := s.callerOwner(r)
+	if owner == "" && !s.getSettings().AnonymousCreate {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if owner == "" && s.pow != nil {
+		if err := s.verifyPow(r); err != nil {
+			writeNotHumanError(w, err)
+			return
+		}
+	}
+
 	var req struct {
-		URL      string `json:"url"`
-		Secure   bool   `json:"secure"`
-		CustomID string `json:"custom_id"`
+		URL      string   `json:"url"`
+		Secure   bool     `json:"secure"`
+		CustomID string   `json:"custom_id"`
+		Team     string   `json:"team"`
+		Tags     []string `json:"tags"`
+		Domain   string   `json:"domain"`
+		Campaign string   `json:"campaign"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeBodyError(w, err, "Invalid request")
 		return
 	}
 
@@ -219,29 +789,111 @@ func (s *Server) handleAPICreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
-		req.URL = "https://" + req.URL
+	req.URL = s.destinations.withDefaultScheme(req.URL)
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Team != "" {
+		if owner, err = s.teamOwner(r, req.Team); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	domain, err := s.createDomain(r, req.Domain, req.Domain != "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := createOptions{
+		Secure:   req.Secure,
+		CustomID: strings.TrimSpace(req.CustomID),
+		System:   system,
+		Owner:    owner,
+		Tags:     tags,
+		Domain:   domain,
+	}
+	if req.Campaign != "" {
+		if req.URL, err = s.applyCampaign(req.Campaign, req.URL, &opts); err != nil {
+			writeCampaignError(w, err)
+			return
+		}
+	}
+	if owner == "" {
+		if opts.DeleteToken, err = newDeleteToken(); err != nil {
+			http.Error(w, "Failed to create short link", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	short, err := s.createShortLink(req.URL, req.Secure, strings.TrimSpace(req.CustomID))
+	short, err := s.createShortLink(req.URL, opts)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create short link: %v", err), http.StatusInternalServerError)
+		writeCreateError(w, err)
 		return
 	}
 
 	resp := map[string]interface{}{
 		"short":     short,
-		"short_url": fmt.Sprintf("%s://%s%s/%s", scheme(r), r.Host, s.prefix, short),
+		"short_url": s.shortURL(r, domain, short),
 		"original":  req.URL,
 		"secure":    req.Secure,
 	}
+	if opts.Campaign != "" {
+		resp["campaign"] = opts.Campaign
+	}
+	if opts.ExpiresAt != nil {
+		resp["expires_at"] = opts.ExpiresAt
+	}
+	if opts.DeleteToken != "" {
+		resp["delete_token"] = opts.DeleteToken
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 func (s *Server) handleAPIList(w http.ResponseWriter, r *http.Request) {
-	links, err := s.getAllLinks()
+	if !s.requireScope(w, r, scopeRead) {
+		return
+	}
+	match, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	var links []Link
+	var err error
+
+	// Time-range and limit queries are served from the creation-date
+	// index, newest first; a plain request still lists everything.
+	if query.Has("from") || query.Has("to") || query.Has("limit") {
+		from, perr := parseTimeParam(query.Get("from"))
+		if perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		to, perr := parseTimeParam(query.Get("to"))
+		if perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := 0
+		if v := query.Get("limit"); v != "" {
+			limit, perr = strconv.Atoi(v)
+			if perr != nil || limit < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		links, err = s.getLinksCreatedBetween(from, to, limit, match)
+	} else {
+		links, err = s.getAllLinks(match)
+	}
 	if err != nil {
 		http.Error(w, "Failed to get links", http.StatusInternalServerError)
 		return
@@ -255,28 +907,64 @@ func (s *Server) handleRedirect(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	short := vars["short"]
 
-	url, err := s.getOriginalURL(short)
+	if s.ephemeral != nil && strings.HasPrefix(short, ephemeralPrefix) {
+		s.redirectEphemeral(w, r, short)
+		return
+	}
+
+	url, err := s.getOriginalURL(s.requestDomain(r), short)
+	if err != nil && err.Error() == "link not found" {
+		if canonical := s.resolveShort(short); canonical != "" {
+			short = canonical
+			url, err = s.getOriginalURL(s.requestDomain(r), short)
+		}
+	}
+	// Only pastes have no destination; reports on them show on the page.
+	if url == "" && (err == nil || errors.Is(err, errLinkReported)) {
+		s.servePaste(w, r, short, false)
+		return
+	}
+	if errors.Is(err, errLinkReported) {
+		s.renderInterstitial(w, r, interstitialReported, short, url)
+		return
+	}
 	if err != nil {
-		http.NotFound(w, r)
+		s.renderLinkError(w, r, short, err)
+		return
+	}
+	// Preview crawlers are not visitors, so they don't count as clicks.
+	if s.renderUnfurl(w, r, short, url) {
 		return
 	}
 
-	s.incrementClicks(short)
+	// Clicks are not counted in maintenance mode, which promises not to
+	// write to the database.
+	if !s.readOnly && !s.maintenance().Enabled {
+		s.countClick(short, s.clickEvent(r))
+	}
 
+	if s.warnExternal(url) {
+		s.renderInterstitial(w, r, interstitialExternal, short, url)
+		return
+	}
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-}
-
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	short := vars["short"]
 
-	if err := s.deleteLink(short); err != nil {
+	if status, msg := s.checkCanDelete(r, short); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	reason, err := s.deleteReason(r)
+	if err != nil {
+		http.Error(w, "A reason is required to delete links", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.deleteLink(short, s.deleteActor(r), reason); err != nil {
 		http.Error(w, "Failed to delete link", http.StatusInternalServerError)
 		return
 	}
@@ -285,10 +973,23 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeDelete) {
+		return
+	}
 	vars := mux.Vars(r)
 	short := vars["short"]
 
-	if err := s.deleteLink(short); err != nil {
+	if status, msg := s.checkCanDelete(r, short); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	reason, err := s.deleteReason(r)
+	if err != nil {
+		http.Error(w, "A reason is required to delete links", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.deleteLink(short, s.deleteActor(r), reason); err != nil {
 		if err.Error() == "link not found" {
 			http.Error(w, "Link not found", http.StatusNotFound)
 		} else {
@@ -301,52 +1002,180 @@ func (s *Server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "short": short})
 }
 
-func (s *Server) createShortLink(originalURL string, secure bool, customID string) (string, error) {
+// writeCreateError reports a createShortLink failure to the client.
+func writeCreateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errDailyQuota) {
+		w.Header().Set("Retry-After", strconv.Itoa(secondsUntilNextDay(time.Now())))
+	}
+	http.Error(w, fmt.Sprintf("Failed to create short link: %v", err), createErrorStatus(err))
+}
+
+// createErrorStatus maps a createShortLink error to an HTTP status code.
+func createErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errReservedPrefix), errors.Is(err, errNamespaceDenied), errors.Is(err, errBlockedDomain), errors.Is(err, errDomainNotAllowed), errors.Is(err, errInternalTarget),
+		errors.Is(err, errUnsafeURL):
+		return http.StatusForbidden
+	case errors.Is(err, errReservedWord), errors.Is(err, errInvalidCustomID), errors.Is(err, errInvalidPaste):
+		return http.StatusBadRequest
+	case errors.Is(err, errCustomIDTaken):
+		return http.StatusConflict
+	case errors.Is(err, errInvalidURL):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errDailyQuota):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errTotalQuota):
+		return http.StatusForbidden
+	case errors.Is(err, errIDSpaceFull):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// createErrorField returns the create form field a createShortLink error
+// is about, or "" when it isn't about a single field.
+func createErrorField(err error) string {
+	switch {
+	case errors.Is(err, errInvalidCustomID), errors.Is(err, errCustomIDTaken), errors.Is(err, errReservedPrefix), errors.Is(err, errReservedWord),
+		errors.Is(err, errNamespaceDenied):
+		return "custom_id"
+	case errors.Is(err, errInvalidURL), errors.Is(err, errBlockedDomain), errors.Is(err, errDomainNotAllowed), errors.Is(err, errInternalTarget),
+		errors.Is(err, errUnsafeURL):
+		return "url"
+	case errors.Is(err, errInvalidPaste):
+		return "text"
+	}
+	return ""
+}
+
+// createOptions describes how a new link's ID is chosen and who creates it.
+type createOptions struct {
+	Secure   bool
+	CustomID string
+	// System is the name of the API key the request was made with, or ""
+	// for other callers; it decides access to reserved short code prefixes.
+	System string
+	// Owner identifies the creator, as returned by callerOwner, or the
+	// team the link is created for.
+	Owner string
+	// Tags are already normalized by normalizeTags.
+	Tags []string
+	// Domain is the configured hostname the link is created for, or "".
+	Domain string
+	// DeleteToken, when set, lets whoever holds it delete the link without
+	// owning it. It is issued for anonymous links.
+	DeleteToken string
+	// ExpiresAt, when set, is when the link stops redirecting.
+	ExpiresAt *time.Time
+	// Paste creates a paste link showing it, with no destination.
+	Paste *Paste
+	// Campaign names the campaign the link is created for; its settings
+	// are already applied by applyCampaign.
+	Campaign string
+}
+
+// checkDestination refuses destinations links may not point to.
+func (s *Server) checkDestination(destination string) error {
+	if err := s.destinations.validate(destination); err != nil {
+		return err
+	}
+	if err := s.checkBlockedDomain(destination); err != nil {
+		return err
+	}
+	if err := s.checkInternalTarget(destination); err != nil {
+		return err
+	}
+	return s.checkThreats(destination)
+}
+
+// createShortLink stores a new link and returns its short code.
+func (s *Server) createShortLink(originalURL string, opts createOptions) (string, error) {
 	var short string
+	secure, customID := opts.Secure, opts.CustomID
+
+	// Hashed IDs of pastes come from their text.
+	hashed := originalURL
+	if opts.Paste != nil {
+		if err := opts.Paste.normalize(); err != nil {
+			return "", err
+		}
+		originalURL, hashed = "", opts.Paste.Text
+	} else if err := s.checkDestination(originalURL); err != nil {
+		return "", err
+	}
 
 	// Use custom ID if provided
 	if customID != "" {
-		// Validate custom ID
-		if err := validateCustomID(customID); err != nil {
+		if err := s.checkCustomID(customID, opts.System); err != nil {
 			return "", err
 		}
-		short = customID
-	} else if secure {
-		short = generateSecureID()
-	} else {
-		short = generateShortID()
+		// Links in a namespace belong to its team.
+		owner, err := s.namespaceOwner(customID, opts.Owner)
+		if err != nil {
+			return "", err
+		}
+		short, opts.Owner = customID, owner
 	}
 
 	link := Link{
 		Short:     short,
 		Original:  originalURL,
 		CreatedAt: time.Now(),
-		Clicks:    0,
+		Owner:     opts.Owner,
+		Tags:      opts.Tags,
+		Domain:    opts.Domain,
+		ExpiresAt: opts.ExpiresAt,
+		Paste:     opts.Paste,
+		Campaign:  opts.Campaign,
 	}
+	quota := s.getSettings().quotaFor(opts.Owner)
+	// reused is set when the hash strategy found the link already created.
+	var reused bool
 
 	err := s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 
 		// Check if custom ID already exists
 		if customID != "" {
-			existing := b.Get([]byte(short))
-			if existing != nil {
-				return fmt.Errorf("custom ID '%s' already exists", short)
+			if err := s.checkCustomIDFree(tx, short); err != nil {
+				return err
+			}
+			// A recently deleted link with this ID can no longer be
+			// restored, and must not leave its clicks to the new one.
+			if err := purgeLinkData(tx, short); err != nil {
+				return err
 			}
 		} else {
-			// For random IDs, keep generating until we find a unique one
-			for {
+			// For generated IDs, keep generating until we find a unique
+			// one that stays out of reserved namespaces and doesn't take
+			// the place of a deleted link that may still be restored
+			for attempt := 0; ; attempt++ {
+				if attempt == idMaxAttempts && s.ids.exhaustible(secure) {
+					s.idExhausted.Add(1)
+					return errIDSpaceFull
+				}
+				var err error
+				if short, err = s.ids.next(tx, secure, hashed, attempt); err != nil {
+					return err
+				}
 				existing := b.Get([]byte(short))
-				if existing == nil {
-					break
+				if existing != nil && s.ids.strategy == idStrategyHash && !secure && sameHashedLink(existing, link, opts) {
+					reused = true
+					return nil
+				}
+				if existing != nil || getDeletedLink(tx, short) != nil || (s.ids.caseInsensitive && foldedShort(tx, short) != "") {
+					s.idCollisions.Add(1)
+					continue
 				}
-				if secure {
-					short = generateSecureID()
-				} else {
-					short = generateShortID()
+				if _, reserved := s.reservedFor(short); !reserved && !isProfane(short) {
+					break
 				}
-				link.Short = short
 			}
+			link.Short = short
+		}
+
+		if err := chargeQuota(tx, link.Owner, quota, link.CreatedAt); err != nil {
+			return err
 		}
 
 		data, err := json.Marshal(link)
@@ -354,60 +1183,131 @@ func (s *Server) createShortLink(originalURL string, secure bool, customID strin
 			return err
 		}
 
-		return b.Put([]byte(short), data)
+		if err := b.Put([]byte(short), data); err != nil {
+			return err
+		}
+		if err := putFoldedShort(tx, short); err != nil {
+			return err
+		}
+		if opts.DeleteToken != "" {
+			if err := putDeleteToken(tx, short, opts.DeleteToken); err != nil {
+				return err
+			}
+		}
+
+		idx := tx.Bucket([]byte(createdIndexBucket))
+		return idx.Put(createdIndexKey(link.CreatedAt, short), []byte{})
 	})
 
 	if err != nil {
 		return "", err
 	}
+	if reused {
+		return short, nil
+	}
+	s.linksChanged()
 
+	if opts.Paste == nil {
+		s.metadata.enqueue(short, originalURL)
+	}
 	return short, nil
 }
 
-func (s *Server) getOriginalURL(short string) (string, error) {
+// getLink loads a single link with its click total.
+func (s *Server) getLink(short string) (*Link, error) {
 	var link Link
 
 	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		data := b.Get([]byte(short))
+		data := tx.Bucket([]byte(bucketName)).Get([]byte(short))
 		if data == nil {
 			return fmt.Errorf("link not found")
 		}
-		return json.Unmarshal(data, &link)
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		loadClicks(tx, &link)
+		return nil
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return link.Original, nil
+	return &link, nil
+}
+
+// getOriginalURL returns the destination of short as served on domain.
+// For reported links it returns the destination with errLinkReported, and
+// doesn't cache it so the warning shows on every visit. Expired links
+// return errLinkExpired, and links disabled by their owner
+// errLinkDisabledByOwner.
+func (s *Server) getOriginalURL(domain, short string) (string, error) {
+	key := linkCacheKey(domain, short)
+	if url, ok := s.cache.Get(key); ok {
+		return url, nil
+	}
+	url, err, _ := s.lookups.do(key, func() (string, error) {
+		return s.loadOriginalURL(domain, short)
+	})
+	return url, err
 }
 
-func (s *Server) incrementClicks(short string) {
-	s.db.Update(func(tx *bolt.Tx) error {
+// loadOriginalURL reads the destination of short on domain from the
+// database and caches it, unless the link changed during the read.
+func (s *Server) loadOriginalURL(domain, short string) (string, error) {
+	key := linkCacheKey(domain, short)
+	gen := s.lookups.generation(key)
+	var link Link
+
+	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		data := b.Get([]byte(short))
 		if data == nil {
-			return nil
+			return fmt.Errorf("link not found")
 		}
-
-		var link Link
 		if err := json.Unmarshal(data, &link); err != nil {
 			return err
 		}
+		if link.Domain != domain {
+			return fmt.Errorf("link not found")
+		}
+		if link.Flagged != nil {
+			return errLinkDisabled
+		}
+		if link.Disabled {
+			return errLinkDisabledByOwner
+		}
+		if link.Expired() {
+			return errLinkExpired
+		}
+		if link.Reported != nil {
+			return errLinkReported
+		}
+		return nil
+	})
 
-		link.Clicks++
+	if errors.Is(err, errLinkReported) {
+		return link.Original, err
+	}
+	if err != nil {
+		return "", err
+	}
 
-		data, err := json.Marshal(link)
-		if err != nil {
-			return err
+	// Links that expire are cached until then at most, so they stop
+	// redirecting on time.
+	s.lookups.ifUnchanged(key, gen, func() {
+		if link.ExpiresAt != nil {
+			s.cache.SetUntil(key, link.Original, *link.ExpiresAt)
+		} else {
+			s.cache.Set(key, link.Original)
 		}
-
-		return b.Put([]byte(short), data)
 	})
+	return link.Original, nil
 }
 
-func (s *Server) getAllLinks() ([]Link, error) {
+// getAllLinks returns every link accepted by match, or every link when match
+// is nil.
+func (s *Server) getAllLinks(match func(*Link) bool) ([]Link, error) {
 	var links []Link
 
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -418,6 +1318,10 @@ func (s *Server) getAllLinks() ([]Link, error) {
 			if err := json.Unmarshal(v, &link); err != nil {
 				return err
 			}
+			if match != nil && !match(&link) {
+				return nil
+			}
+			loadClicks(tx, &link)
 			links = append(links, link)
 			return nil
 		})
@@ -430,7 +1334,17 @@ func (s *Server) getAllLinks() ([]Link, error) {
 	return links, nil
 }
 
-func (s *Server) deleteLink(short string) error {
+// deleteLink removes short, leaving a tombstone recording that deletedBy
+// removed it for reason. The link is kept aside with its clicks and
+// statistics for undoDeleteWindow, so restoreLink can undo the deletion;
+// deleted links older than that are purged along the way.
+func (s *Server) deleteLink(short, deletedBy, reason string) error {
+	var domain string
+	defer func() {
+		s.forgetLink(domain, short)
+		s.linksChanged()
+	}()
+
 	return s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 
@@ -439,103 +1353,107 @@ func (s *Server) deleteLink(short string) error {
 			return fmt.Errorf("link not found")
 		}
 
+		var link Link
+		if err := json.Unmarshal(existing, &link); err != nil {
+			return err
+		}
+		domain = link.Domain
+		now := time.Now()
+		if err := purgeDeletedLinks(tx, now); err != nil {
+			return err
+		}
+
+		tokens := tx.Bucket([]byte(deleteTokensBucket))
+		deleted, err := json.Marshal(deletedLink{Link: link, DeletedAt: now, DeleteTokenHash: tokens.Get([]byte(short))})
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(deletedLinksBucket)).Put([]byte(short), deleted); err != nil {
+			return err
+		}
+		if err := tokens.Delete([]byte(short)); err != nil {
+			return err
+		}
+
+		loadClicks(tx, &link)
+		err = putTombstone(tx, Tombstone{
+			Short:     short,
+			Original:  link.Original,
+			Domain:    link.Domain,
+			Owner:     link.Owner,
+			CreatedAt: link.CreatedAt,
+			Clicks:    link.Clicks,
+			DeletedBy: deletedBy,
+			DeletedAt: now,
+			Reason:    reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		idx := tx.Bucket([]byte(createdIndexBucket))
+		if err := idx.Delete(createdIndexKey(link.CreatedAt, short)); err != nil {
+			return err
+		}
+		if err := releaseQuota(tx, link.Owner); err != nil {
+			return err
+		}
+		if err := deleteFoldedShort(tx, short); err != nil {
+			return err
+		}
+
 		return b.Delete([]byte(short))
 	})
 }
 
+var (
+	errInvalidCustomID = errors.New("invalid custom ID")
+	errCustomIDTaken   = errors.New("custom ID is already taken")
+)
+
 func validateCustomID(id string) error {
 	// Check length
 	if len(id) < 3 {
-		return fmt.Errorf("custom ID must be at least 3 characters long")
+		return fmt.Errorf("%w: must be at least 3 characters long", errInvalidCustomID)
 	}
 	if len(id) > 50 {
-		return fmt.Errorf("custom ID must be no more than 50 characters long")
+		return fmt.Errorf("%w: must be no more than 50 characters long", errInvalidCustomID)
 	}
 
 	// Check for valid characters (alphanumeric, dash, underscore)
 	for _, ch := range id {
 		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
 			(ch >= '0' && ch <= '9') || ch == '-' || ch == '_') {
-			return fmt.Errorf("custom ID can only contain letters, numbers, dashes, and underscores")
+			return fmt.Errorf("%w: can only contain letters, numbers, dashes, and underscores", errInvalidCustomID)
 		}
 	}
 
 	// Check for reserved words (add more as needed)
-	reserved := []string{"api", "admin", "health", "static", "assets", "js", "css"}
+	reserved := []string{"api", "admin", "health", "healthz", "readyz", "static", "assets", "js", "css"}
 	lowerID := strings.ToLower(id)
 	for _, r := range reserved {
 		if lowerID == r {
-			return fmt.Errorf("'%s' is a reserved word and cannot be used as a custom ID", id)
+			return fmt.Errorf("%w: '%s' is a reserved word", errInvalidCustomID, id)
 		}
 	}
 
 	return nil
 }
 
-func generateShortID() string {
-	b := make([]byte, shortIDLength)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)[:shortIDLength]
-}
-
-func generateSecureID() string {
-	b := make([]byte, secureIDLength)
-	rand.Read(b)
-	// Use a longer string and replace problematic characters for URL safety
-	id := base64.URLEncoding.EncodeToString(b)
-	// Remove padding and ensure consistent length
-	id = strings.ReplaceAll(id, "=", "")
-	id = strings.ReplaceAll(id, "-", "x")
-	id = strings.ReplaceAll(id, "_", "y")
-	if len(id) > secureIDLength {
-		return id[:secureIDLength]
-	}
-	return id
-}
-
 func main() {
-	srv, err := NewServer()
-	if err != nil {
-		log.Fatal("Failed to create server:", err)
-	}
-	defer srv.Close()
-
-	srv.setupRoutes()
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	httpServer := &http.Server{
-		Addr:         ":" + port,
-		Handler:      srv.router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
-
-	go func() {
-		log.Printf("Server starting on port %s", port)
-		log.Printf("Short link prefix: %s", srv.prefix)
-		log.Printf("UI prefix: %s", srv.uiPrefix)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Server failed to start:", err)
-		}
-	}()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	if err := cmd.run(args); err != nil {
+		fatal(cmd.name+" failed", "err", err)
 	}
-
-	log.Println("Server exited")
-}
\ No newline at end of file
+}
@@ -1,42 +1,52 @@
 package main
 
 import (
-	"crypto/tls"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
 )
 
-func TestScheme(t *testing.T) {
-	tests := []struct {
-		name     string
-		header   string
-		tls      bool
-		expected string
-	}{
-		{"forwarded https", "https", false, "https"},
-		{"forwarded http", "http", false, "http"},
-		{"forwarded list takes first", "https, http", false, "https"},
-		{"tls fallback", "", true, "https"},
-		{"plain fallback", "", false, "http"},
+// testConfig loads the configuration from the environment of the test.
+func testConfig(t testing.TB) *Config {
+	t.Helper()
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
 	}
+	// Clicks are written as they happen, so tests can check them right
+	// after a redirect.
+	cfg.Clicks.FlushInterval = 0
+	cfg.Database.MaxBatchDelay = time.Millisecond
+	// Tests log in as root to use the admin panel.
+	cfg.Auth.AdminUser = "root"
+	return cfg
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			r, _ := http.NewRequest("GET", "/", nil)
-			if tt.header != "" {
-				r.Header.Set("X-Forwarded-Proto", tt.header)
-			}
-			if tt.tls {
-				r.TLS = &tls.ConnectionState{}
-			}
-			if got := scheme(r); got != tt.expected {
-				t.Errorf("scheme() = %q, want %q", got, tt.expected)
-			}
-		})
+// newTestServer opens a server backed by a fresh database in a temporary
+// directory and closes it when the test finishes.
+func newTestServer(t testing.TB) *Server {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "links.db"))
+
+	srv, err := NewServer(testConfig(t))
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
 	}
+	t.Cleanup(func() { srv.Close() })
+	srv.setupRoutes()
+	return srv
 }
 
 func TestGenerateShortID(t *testing.T) {
+	gen, _ := parseIDConfig(IDConfig{})
+	generateShortID := func() string { return gen.generate(false, 0) }
 	id1 := generateShortID()
 	id2 := generateShortID()
 
@@ -57,6 +67,8 @@ func TestGenerateShortID(t *testing.T) {
 }
 
 func TestGenerateSecureID(t *testing.T) {
+	gen, _ := parseIDConfig(IDConfig{})
+	generateSecureID := func() string { return gen.generate(true, 0) }
 	id1 := generateSecureID()
 	id2 := generateSecureID()
 
@@ -128,4 +140,201 @@ func TestValidateCustomID(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestReadOnlyServer(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "replicated"}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	path := srv.db.Path()
+	srv.Close()
+
+	t.Setenv("DB_PATH", path)
+	cfg := testConfig(t)
+	cfg.ReadOnly = true
+	replica, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer(true) error: %v", err)
+	}
+	defer replica.Close()
+	replica.setupRoutes()
+
+	rr := httptest.NewRecorder()
+	replica.router.ServeHTTP(rr, httptest.NewRequest("GET", replica.prefix+"/replicated", nil))
+	if rr.Code != http.StatusFound {
+		t.Errorf("redirect status = %d, want 302", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	replica.router.ServeHTTP(rr, httptest.NewRequest("POST", replica.uiPrefix+"/api/create", strings.NewReader(`{"url":"https://example.org"}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("create status on replica = %d, want 404", rr.Code)
+	}
+}
+
+func TestReadOnlyServerRequiresInitializedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() error: %v", err)
+	}
+	db.Close()
+
+	t.Setenv("DB_PATH", path)
+	cfg := testConfig(t)
+	cfg.ReadOnly = true
+	if srv, err := NewServer(cfg); err == nil {
+		srv.Close()
+		t.Error("expected error opening an uninitialized database read-only")
+	}
+}
+
+func TestPartialResponses(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	if _, err := srv.createShortLink("https://example.com/listed", createOptions{CustomID: "listed", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req.AddCookie(cookie)
+		req.Header.Set("X-Partial", "true")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+	create := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/sui/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(req)
+	}
+
+	rr := create(url.Values{"url": {"https://example.com/new"}, "custom_id": {"fresh"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("partial create = %d: %s", rr.Code, rr.Body)
+	}
+	if body := rr.Body.String(); strings.Contains(body, "<html") || !strings.Contains(body, "http://example.com/s/fresh") {
+		t.Errorf("partial create body = %q, want only the result", body)
+	}
+
+	rr = create(url.Values{"url": {"https://example.com/new"}, "custom_id": {"listed"}})
+	if rr.Code != http.StatusConflict || strings.Contains(rr.Body.String(), "<html") || rr.Header().Get("X-Error-Field") != "custom_id" {
+		t.Errorf("partial create of a taken ID = %d %q, want a plain error about the custom ID", rr.Code, rr.Body)
+	}
+
+	rr = serve(httptest.NewRequest("GET", "/sui/list", nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || strings.Contains(body, "<html") || !strings.Contains(body, `class="links-table"`) {
+		t.Errorf("partial list = %d %q, want only the table", rr.Code, body)
+	}
+	if rr.Header().Get("Vary") != "X-Partial" {
+		t.Errorf("partial list Vary = %q", rr.Header().Get("Vary"))
+	}
+}
+
+func TestCreateFormErrors(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	if _, err := srv.createShortLink("https://example.com/taken", createOptions{CustomID: "taken", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantField  string
+		wantError  string
+	}{
+		{"missing URL", url.Values{"custom_id": {"kept-id"}}, http.StatusBadRequest, "url", "URL is required"},
+		{"taken ID", url.Values{"url": {"https://example.com/new"}, "custom_id": {"taken"}}, http.StatusConflict, "custom_id", "already exists"},
+		{"invalid ID", url.Values{"url": {"https://example.com/new"}, "custom_id": {"no spaces"}}, http.StatusBadRequest, "custom_id", "can only contain"},
+		{"reserved word", url.Values{"url": {"https://example.com/new"}, "custom_id": {"admin"}}, http.StatusBadRequest, "custom_id", "reserved word"},
+		{"invalid URL", url.Values{"url": {"ftp://example.com/file"}}, http.StatusUnprocessableEntity, "url", "Invalid URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("tags", "spring-sale")
+			req := httptest.NewRequest("POST", "/sui/create", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(cookie)
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			body := rr.Body.String()
+			if !strings.Contains(body, `id="`+tt.wantField+`-error" role="alert">`) || !strings.Contains(body, tt.wantError) {
+				t.Errorf("page does not show %q next to %s", tt.wantError, tt.wantField)
+			}
+			for _, value := range []string{tt.form.Get("url"), tt.form.Get("custom_id"), "spring-sale"} {
+				if value != "" && !strings.Contains(body, `value="`+value+`"`) {
+					t.Errorf("entered value %q is not kept", value)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCreateShortLink(b *testing.B) {
+	srv := newTestServer(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := srv.createShortLink(fmt.Sprintf("https://example.com/%d", i), createOptions{Owner: "bench"}); err != nil {
+			b.Fatalf("createShortLink() error: %v", err)
+		}
+	}
+}
+
+// BenchmarkRedirect measures the redirect path as served, with the cache
+// warm and clicks queued.
+func BenchmarkRedirect(b *testing.B) {
+	cfg := testConfig(b)
+	cfg.DBPath = filepath.Join(b.TempDir(), "links.db")
+	cfg.Clicks.FlushInterval = time.Second
+	srv, err := NewServer(cfg)
+	if err != nil {
+		b.Fatalf("NewServer() error: %v", err)
+	}
+	b.Cleanup(func() { srv.Close() })
+	srv.setupRoutes()
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "bench"}); err != nil {
+		b.Fatalf("createShortLink() error: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/bench", nil))
+			if rr.Code != http.StatusFound {
+				b.Errorf("status = %d, want %d", rr.Code, http.StatusFound)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkAPIList(b *testing.B) {
+	srv := newTestServer(b)
+	cookie := loginAs(b, srv, "bench")
+	for i := 0; i < 1000; i++ {
+		if _, err := srv.createShortLink(fmt.Sprintf("https://example.com/%d", i), createOptions{Owner: "bench"}); err != nil {
+			b.Fatalf("createShortLink() error: %v", err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", "/sui/api/list?limit=50", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			b.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+		}
+	}
+}
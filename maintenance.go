@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultMaintenanceMessage = "Down for maintenance: links cannot be created, changed or deleted right now. Short links keep redirecting."
+
+// Maintenance describes the maintenance mode of the instance. While it is
+// enabled redirects keep working, but every request that would write to
+// the database is refused with 503, so backups and migrations see a quiet
+// database.
+type Maintenance struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// maintenance returns the current maintenance mode.
+func (s *Server) maintenance() Maintenance {
+	if m := s.maintenanceMode.Load(); m != nil {
+		return *m
+	}
+	return Maintenance{}
+}
+
+// setMaintenance turns maintenance mode on or off. An empty message
+// selects the default one.
+func (s *Server) setMaintenance(enabled bool, message string) Maintenance {
+	m := Maintenance{Enabled: enabled}
+	if enabled {
+		// Clicks counted before are written now rather than during
+		// maintenance.
+		s.clickQueue.flush()
+		m.Message = strings.TrimSpace(message)
+		if m.Message == "" {
+			m.Message = defaultMaintenanceMessage
+		}
+		now := time.Now()
+		m.Since = &now
+	}
+	s.maintenanceMode.Store(&m)
+	return m
+}
+
+// maintenanceExempt reports whether route stays available in maintenance
+// mode although it is not a GET: logging in and out, turning maintenance
+// mode off again, issuing ephemeral links, which are signed rather than
+// stored, and Grafana's queries, which only read but are POSTed.
+func (s *Server) maintenanceExempt(route string) bool {
+	switch route {
+	case s.uiPrefix + "/login", s.uiPrefix + "/login/2fa", s.uiPrefix + "/logout", s.uiPrefix + "/api/admin/maintenance",
+		s.uiPrefix + "/api/ephemeral", s.uiPrefix + "/api/grafana/search", s.uiPrefix + "/api/grafana/metrics", s.uiPrefix + "/api/grafana/query":
+		return true
+	}
+	return false
+}
+
+// maintenanceMiddleware refuses writing requests in maintenance mode.
+func (s *Server) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := s.maintenance()
+		if !m.Enabled || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if route, err := cur.GetPathTemplate(); err == nil && s.maintenanceExempt(route) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Retry-After", "300")
+		http.Error(w, m.Message, http.StatusServiceUnavailable)
+	})
+}
+
+// handleAdminMaintenance reports the maintenance mode on GET and changes
+// it on POST with {"enabled": true, "message": "..."}.
+func (s *Server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Enabled bool   `json:"enabled"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+		s.setMaintenance(req.Enabled, req.Message)
+		requestLogger(r).Info("maintenance mode changed", "enabled", req.Enabled)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.maintenance())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, body string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if admin {
+			req.Header.Set("X-Admin-Token", "s3cret")
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("POST", "/sui/api/admin/maintenance", `{"enabled": true}`, false); rr.Code != http.StatusForbidden {
+		t.Errorf("toggle without admin = %d, want 403", rr.Code)
+	}
+	rr := do("POST", "/sui/api/admin/maintenance", `{"enabled": true, "message": "Back at noon"}`, true)
+	var m Maintenance
+	if err := json.NewDecoder(rr.Body).Decode(&m); err != nil || !m.Enabled || m.Message != "Back at noon" || m.Since == nil {
+		t.Fatalf("enable maintenance = %d %+v, %v", rr.Code, m, err)
+	}
+
+	rr = do("POST", "/sui/api/create", `{"url": "https://example.org"}`, false)
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "Back at noon") {
+		t.Errorf("create in maintenance = %d %q, want 503 with the message", rr.Code, rr.Body.String())
+	}
+	if rr := do("DELETE", "/sui/api/delete/kept", "", true); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("delete in maintenance = %d, want 503", rr.Code)
+	}
+	if rr := do("GET", "/s/kept", "", false); rr.Code != http.StatusFound {
+		t.Errorf("redirect in maintenance = %d, want 302", rr.Code)
+	}
+	if link, _ := srv.getLink("kept"); link.Clicks != 0 {
+		t.Errorf("clicks counted in maintenance: %d", link.Clicks)
+	}
+	if rr := do("GET", "/sui/api/list?all=true", "", true); rr.Code != http.StatusOK {
+		t.Errorf("list in maintenance = %d, want 200", rr.Code)
+	}
+
+	if rr := do("POST", "/sui/api/admin/maintenance", `{"enabled": false}`, true); rr.Code != http.StatusOK {
+		t.Fatalf("disable maintenance = %d", rr.Code)
+	}
+	if rr := do("POST", "/sui/api/create", `{"url": "https://example.org"}`, false); rr.Code != http.StatusOK {
+		t.Errorf("create after maintenance = %d, want 200", rr.Code)
+	}
+}
+
+func TestMaintenanceFromConfig(t *testing.T) {
+	t.Setenv("MAINTENANCE", "true")
+	srv := newTestServer(t)
+	if m := srv.maintenance(); !m.Enabled || m.Message != defaultMaintenanceMessage {
+		t.Errorf("maintenance() = %+v, want enabled with the default message", m)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// metadataQueueSize is how many new links may wait for the metadata of
+	// their destination; links created while the queue is full go without.
+	metadataQueueSize = 256
+	// metadataTitleLength caps stored page titles, in runes.
+	metadataTitleLength = 200
+	// metadataCardLength caps the stored values of Open Graph and Twitter
+	// Card tags, in runes.
+	metadataCardLength = 500
+	// defaultMetadataRefreshInterval is how often metadata is fetched
+	// again.
+	defaultMetadataRefreshInterval = 7 * 24 * time.Hour
+)
+
+// cardKeys are the Open Graph and Twitter Card tags kept for link previews;
+// cardImageKeys among them hold URLs, resolved against the page.
+var (
+	cardKeys = map[string]bool{
+		"description": true, "og:title": true, "og:description": true, "og:image": true, "og:image:alt": true,
+		"og:site_name": true, "og:type": true, "twitter:card": true, "twitter:title": true,
+		"twitter:description": true, "twitter:image": true, "twitter:image:alt": true,
+	}
+	cardImageKeys = map[string]bool{"og:image": true, "twitter:image": true}
+)
+
+var (
+	reLinkTag  = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	reLinkAttr = regexp.MustCompile(`(?is)(rel|href)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// MetadataConfig controls fetching the title and icon of destinations, so
+// the list page can show them next to each link.
+type MetadataConfig struct {
+	// Enabled fetches the destination of each new or edited link in the
+	// background. Destinations on internal networks are never fetched.
+	Enabled bool `yaml:"enabled"`
+	// Passthrough serves the Open Graph and Twitter Card tags fetched from
+	// destinations to the link preview bots of chat apps and social
+	// networks requesting a short link, so shared links show the real
+	// title and image. It implies Enabled.
+	Passthrough bool `yaml:"passthrough"`
+	// RefreshInterval is how often the metadata of every link is fetched
+	// again, so titles follow pages that were renamed; links created
+	// before fetching was enabled get theirs too. 0 disables the refresh.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// LinkMeta describes the page a link leads to.
+type LinkMeta struct {
+	Title   string `json:"title,omitempty"`
+	Favicon string `json:"favicon,omitempty"`
+	// Cards holds the page's Open Graph and Twitter Card tags by name,
+	// such as "og:image".
+	Cards     map[string]string `json:"cards,omitempty"`
+	FetchedAt time.Time         `json:"fetched_at"`
+}
+
+type metadataJob struct {
+	short, destination string
+}
+
+// metadataFetcher fetches link metadata in the background, one link at a
+// time; see fetchMetadata.
+type metadataFetcher struct {
+	client *http.Client
+	queue  chan metadataJob
+	// passthrough serves the fetched cards to link preview bots.
+	passthrough bool
+}
+
+// newMetadataFetcher returns the fetcher for c, or nil when fetching is
+// disabled.
+func newMetadataFetcher(c MetadataConfig) *metadataFetcher {
+	if !c.Enabled && !c.Passthrough {
+		return nil
+	}
+	return &metadataFetcher{
+		client: &http.Client{
+			Timeout:   previewTimeout,
+			Transport: externalTransport(),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > previewMaxRedirects {
+					return fmt.Errorf("stopped after %d redirects", previewMaxRedirects)
+				}
+				return nil
+			},
+		},
+		queue:       make(chan metadataJob, metadataQueueSize),
+		passthrough: c.Passthrough,
+	}
+}
+
+// externalTransport returns the transport destinations are fetched with,
+// which refuses to connect to internal addresses.
+func externalTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: previewTimeout, Control: refuseInternal}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would hide the destination's address from refuseInternal.
+	transport.Proxy = nil
+	return transport
+}
+
+// refuseInternal is a net.Dialer Control function refusing connections to
+// internal addresses. It sees the address after name resolution, so it
+// also covers redirects and hosts whose DNS changed since the link was
+// created.
+func refuseInternal(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if internalAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errInternalTarget, addrPort.Addr())
+	}
+	return nil
+}
+
+// enqueue asks for the metadata of short without waiting for it. It does
+// nothing when fetching is disabled.
+func (m *metadataFetcher) enqueue(short, destination string) {
+	if m == nil {
+		return
+	}
+	select {
+	case m.queue <- metadataJob{short: short, destination: destination}:
+	default:
+		slog.Debug("link metadata queue full, skipping", "short", short)
+	}
+}
+
+// fetchMetadata works through the queued links until ctx is done.
+func (s *Server) fetchMetadata(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.metadata.queue:
+			changed, err := s.refreshLinkMeta(ctx, job.short, job.destination)
+			if err != nil {
+				slog.Debug("failed to fetch link metadata", "short", job.short, "err", err)
+			} else if changed {
+				s.linksChanged()
+			}
+		}
+	}
+}
+
+// refreshLinkMeta fetches destination and stores what it found on short,
+// unless the link was pointed elsewhere in the meantime or the page still
+// shows the same. It reports whether the link changed; callers mark the
+// links changed, as the metadata shows in the list and its search. The
+// redirect cache is left alone, since the destination stays the same.
+func (s *Server) refreshLinkMeta(ctx context.Context, short, destination string) (changed bool, err error) {
+	meta, err := fetchLinkMeta(ctx, s.metadata.client, destination)
+	if err != nil {
+		return false, err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		data := b.Get([]byte(short))
+		if data == nil {
+			return fmt.Errorf("link not found")
+		}
+		var link Link
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		if link.Original != destination || link.Meta.same(meta) {
+			return nil
+		}
+		link.Meta = meta
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		changed = true
+		return b.Put([]byte(short), data)
+	})
+	return changed && err == nil, err
+}
+
+// same reports whether m and other describe the page alike, whenever they
+// were fetched.
+func (m *LinkMeta) same(other *LinkMeta) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+	return m.Title == other.Title && m.Favicon == other.Favicon && maps.Equal(m.Cards, other.Cards)
+}
+
+// refreshMetadata runs refreshStaleMeta every interval until ctx is done,
+// skipping runs in maintenance mode, which promises not to write. Each run
+// refreshes what is older than half the interval, so every link is
+// fetched about once per interval whenever it was last fetched.
+func (s *Server) refreshMetadata(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.maintenance().Enabled {
+			continue
+		}
+		n, err := s.refreshStaleMeta(ctx, time.Now().Add(-interval/2))
+		if err != nil {
+			slog.Error("link metadata refresh failed", "err", err)
+			continue
+		}
+		slog.Info("link metadata refresh finished", "refreshed", n)
+	}
+}
+
+// refreshStaleMeta fetches, one link at a time, the metadata of links
+// without any or with metadata fetched before cutoff. Pastes, links whose
+// refresh was turned off and those that don't redirect are left alone. It
+// returns how many were refreshed; links that couldn't be fetched keep
+// what they had, and links whose page is unchanged aren't written.
+func (s *Server) refreshStaleMeta(ctx context.Context, cutoff time.Time) (int, error) {
+	links, err := s.getAllLinks(func(l *Link) bool {
+		return l.Paste == nil && !l.NoMetaRefresh && l.Flagged == nil && !l.Disabled && !l.Expired() &&
+			(l.Meta == nil || l.Meta.FetchedAt.Before(cutoff))
+	})
+	if err != nil {
+		return 0, err
+	}
+	refreshed, changed := 0, false
+	defer func() {
+		if changed {
+			s.linksChanged()
+		}
+	}()
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return refreshed, err
+		}
+		if s.maintenance().Enabled {
+			break
+		}
+		updated, err := s.refreshLinkMeta(ctx, link.Short, link.Original)
+		if err != nil {
+			slog.Debug("failed to refresh link metadata", "short", link.Short, "err", err)
+			continue
+		}
+		changed = changed || updated
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// fetchLinkMeta retrieves destination and returns its title and icon. A
+// page without a declared icon gets the site's /favicon.ico.
+func fetchLinkMeta(ctx context.Context, client *http.Client, destination string) (*LinkMeta, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", destination, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", previewUserAgent)
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9,*/*;q=0.1")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("destination answered %s", resp.Status)
+	}
+
+	final := resp.Request.URL
+	meta := &LinkMeta{
+		Favicon:   final.ResolveReference(&url.URL{Path: "/favicon.ico"}).String(),
+		FetchedAt: time.Now(),
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return meta, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, previewMaxBody))
+	if err != nil {
+		return nil, err
+	}
+	page := string(body)
+
+	var p Preview
+	summarizeHTML(&p, page)
+	meta.Title = p.Title
+	if meta.Title == "" {
+		meta.Title = p.Meta["og:title"]
+	}
+	if runes := []rune(meta.Title); len(runes) > metadataTitleLength {
+		meta.Title = string(runes[:metadataTitleLength]) + "…"
+	}
+	if icon := pageIcon(page, final); icon != "" {
+		meta.Favicon = icon
+	}
+	meta.Cards = pageCards(page, final)
+	return meta, nil
+}
+
+// pageCards returns the Open Graph and Twitter Card tags of page among
+// cardKeys, with image URLs made absolute. Images that aren't http(s) are
+// dropped.
+func pageCards(page string, base *url.URL) map[string]string {
+	var cards map[string]string
+	for _, tag := range reMeta.FindAllString(page, -1) {
+		var key, content string
+		for _, attr := range reMetaAttr.FindAllStringSubmatch(tag, -1) {
+			value := strings.Trim(attr[2], `"'`)
+			switch strings.ToLower(attr[1]) {
+			case "name", "property":
+				key = strings.ToLower(value)
+			case "content":
+				content = cleanText(value)
+			}
+		}
+		if !cardKeys[key] || content == "" || cards[key] != "" {
+			continue
+		}
+		if cardImageKeys[key] {
+			u, err := base.Parse(content)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			content = u.String()
+		}
+		if runes := []rune(content); len(runes) > metadataCardLength {
+			content = string(runes[:metadataCardLength]) + "…"
+		}
+		if cards == nil {
+			cards = make(map[string]string)
+		}
+		cards[key] = content
+	}
+	return cards
+}
+
+// pageIcon returns the absolute URL of the first icon page declares with
+// <link rel="icon">, or "" when there is none.
+func pageIcon(page string, base *url.URL) string {
+	for _, tag := range reLinkTag.FindAllString(page, -1) {
+		var isIcon bool
+		var href string
+		for _, attr := range reLinkAttr.FindAllStringSubmatch(tag, -1) {
+			value := strings.Trim(attr[2], `"'`)
+			switch strings.ToLower(attr[1]) {
+			case "rel":
+				for _, rel := range strings.Fields(strings.ToLower(value)) {
+					isIcon = isIcon || rel == "icon"
+				}
+			case "href":
+				href = cleanText(value)
+			}
+		}
+		if !isIcon || href == "" {
+			continue
+		}
+		u, err := base.Parse(href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		return u.String()
+	}
+	return ""
+}
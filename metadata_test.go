@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageIcon(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"relative", `<link rel="icon" href="/img/icon.png">`, "https://example.com/img/icon.png"},
+		{"shortcut icon", `<LINK REL='shortcut icon' HREF='favicon.gif'>`, "https://example.com/blog/favicon.gif"},
+		{"unquoted", `<link rel=icon href=https://cdn.example.com/i.svg>`, "https://cdn.example.com/i.svg"},
+		{"skips other links", `<link rel="stylesheet" href="/a.css"><link href="/i.ico" rel="icon">`, "https://example.com/i.ico"},
+		{"touch icon only", `<link rel="apple-touch-icon" href="/touch.png">`, ""},
+		{"script URL", `<link rel="icon" href="javascript:alert(1)">`, ""},
+		{"none", `<title>No icon</title>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageIcon(tt.page, base); got != tt.want {
+				t.Errorf("pageIcon() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageCards(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+	page := `<meta property="og:title" content="Spring &amp; Summer">
+		<meta property="og:image" content="/img/cover.png">
+		<meta name="twitter:image" content="javascript:alert(1)">
+		<meta name="twitter:card" content="summary_large_image">
+		<meta property="og:title" content="Second title">
+		<meta name="viewport" content="width=device-width">`
+	want := map[string]string{
+		"og:title":     "Spring & Summer",
+		"og:image":     "https://example.com/img/cover.png",
+		"twitter:card": "summary_large_image",
+	}
+	if got := pageCards(page, base); !reflect.DeepEqual(got, want) {
+		t.Errorf("pageCards() = %v, want %v", got, want)
+	}
+	if got := pageCards("<title>No cards</title>", base); got != nil {
+		t.Errorf("pageCards() without tags = %v, want nil", got)
+	}
+}
+
+func TestFetchLinkMeta(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			fmt.Fprint(w, `<html><head><title> Spring &amp; Summer Sale </title><link rel="icon" href="/icon.svg"></head></html>`)
+		case "/og":
+			fmt.Fprint(w, `<html><head><meta property="og:title" content="From Open Graph"></head></html>`)
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF-1.7")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		path        string
+		wantTitle   string
+		wantFavicon string
+		wantErr     bool
+	}{
+		{"/page", "Spring & Summer Sale", ts.URL + "/icon.svg", false},
+		{"/og", "From Open Graph", ts.URL + "/favicon.ico", false},
+		{"/report.pdf", "", ts.URL + "/favicon.ico", false},
+		{"/missing", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			meta, err := fetchLinkMeta(context.Background(), ts.Client(), ts.URL+tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchLinkMeta() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if meta.Title != tt.wantTitle || meta.Favicon != tt.wantFavicon || meta.FetchedAt.IsZero() {
+				t.Errorf("fetchLinkMeta() = %+v, want title %q and favicon %q", meta, tt.wantTitle, tt.wantFavicon)
+			}
+		})
+	}
+}
+
+func TestMetadataSkipsInternalTargets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>Internal dashboard</title>")
+	}))
+	defer ts.Close()
+
+	fetcher := newMetadataFetcher(MetadataConfig{Enabled: true})
+	if _, err := fetchLinkMeta(context.Background(), fetcher.client, ts.URL); !errors.Is(err, errInternalTarget) {
+		t.Errorf("fetching a loopback destination error = %v, want errInternalTarget", err)
+	}
+	if newMetadataFetcher(MetadataConfig{}) != nil {
+		t.Error("fetcher created while disabled")
+	}
+}
+
+func TestLinkMetaInList(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<title>Quarterly Report</title><link rel="icon" href="/q.png">`)
+	}))
+	defer ts.Close()
+
+	t.Setenv("FETCH_METADATA", "true")
+	srv := newTestServer(t)
+	srv.metadata.client = ts.Client()
+	cookie := loginAs(t, srv, "alice")
+	if _, err := srv.createShortLink(ts.URL+"/report", createOptions{CustomID: "report", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	job := <-srv.metadata.queue
+	if job.short != "report" || job.destination != ts.URL+"/report" {
+		t.Fatalf("queued %+v, want the new link", job)
+	}
+	if _, err := srv.refreshLinkMeta(context.Background(), job.short, job.destination); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"", "?q=quarterly"} {
+		req := httptest.NewRequest("GET", "/sui/list"+query, nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		body := rr.Body.String()
+		if !strings.Contains(body, `Quarterly Report</span>`) || !strings.Contains(body, `src="`+ts.URL+`/q.png"`) {
+			t.Errorf("list%s does not show the page title and icon", query)
+		}
+	}
+
+	// A destination changed while the page was fetched keeps no stale title.
+	srv.updateLink("report", func(link *Link) { link.Original = "https://example.com/other"; link.Meta = nil })
+	if _, err := srv.refreshLinkMeta(context.Background(), "report", ts.URL+"/report"); err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := srv.getLink("report"); link.Meta != nil {
+		t.Errorf("metadata of the old destination stored: %+v", link.Meta)
+	}
+}
+
+func TestRefreshStaleMeta(t *testing.T) {
+	title := "Old Title"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "<title>%s</title>", title)
+	}))
+	defer ts.Close()
+
+	t.Setenv("FETCH_METADATA", "true")
+	srv := newTestServer(t)
+	srv.metadata.client = ts.Client()
+	now := time.Now()
+	old := &LinkMeta{Title: "Old Title", FetchedAt: now.Add(-48 * time.Hour)}
+	links := []struct {
+		short  string
+		path   string
+		modify func(link *Link)
+		want   string
+	}{
+		{"stale", "/a", func(link *Link) { link.Meta = old }, "New Title"},
+		{"never", "/b", func(link *Link) { link.Meta = nil }, "New Title"},
+		{"fresh", "/c", func(link *Link) { link.Meta = &LinkMeta{Title: "Old Title", FetchedAt: now} }, "Old Title"},
+		{"kept", "/d", func(link *Link) { link.Meta = old; link.NoMetaRefresh = true }, "Old Title"},
+		{"off", "/e", func(link *Link) { link.Meta = old; link.Disabled = true }, "Old Title"},
+		{"failing", "/gone", func(link *Link) { link.Meta = old }, "Old Title"},
+	}
+	for _, l := range links {
+		if _, err := srv.createShortLink(ts.URL+l.path, createOptions{CustomID: l.short}); err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.updateLink(l.short, l.modify); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	title = "New Title"
+	n, err := srv.refreshStaleMeta(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("refreshStaleMeta() error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("refreshed %d links, want 2", n)
+	}
+	for _, l := range links {
+		link, err := srv.getLink(l.short)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Meta == nil || link.Meta.Title != l.want {
+			t.Errorf("%s: meta = %+v, want title %q", l.short, link.Meta, l.want)
+		}
+	}
+
+	// Refreshing again writes only the link whose page changed, "fresh",
+	// and marks the links changed once: the cached redirects of the
+	// others survive.
+	if url, err := srv.getOriginalURL("", "stale"); err != nil || url != ts.URL+"/a" {
+		t.Fatalf("getOriginalURL() = %q, %v", url, err)
+	}
+	before, _ := srv.getLink("stale")
+	version := srv.linksVersion.Load()
+	if n, err := srv.refreshStaleMeta(context.Background(), time.Now().Add(time.Hour)); err != nil || n != 3 {
+		t.Errorf("refreshStaleMeta() = %d, %v; want 3 links fetched", n, err)
+	}
+	if got := srv.linksVersion.Load() - version; got != 1 {
+		t.Errorf("links marked changed %d times, want once", got)
+	}
+	if _, ok := srv.cache.Get(linkCacheKey("", "stale")); !ok {
+		t.Error("unchanged metadata dropped the cached redirect")
+	}
+	if link, _ := srv.getLink("stale"); !link.Meta.FetchedAt.Equal(before.Meta.FetchedAt) {
+		t.Errorf("unchanged metadata was written again: %+v", link.Meta)
+	}
+	if link, _ := srv.getLink("fresh"); link.Meta.Title != "New Title" {
+		t.Errorf("fresh: meta = %+v, want the new title", link.Meta)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request duration
+// histogram. They are tuned for redirects (sub-millisecond) as well as the
+// slower UI and API pages.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+type routeKey struct {
+	route  string
+	method string
+}
+
+type routeStats struct {
+	codes    map[string]uint64 // keyed by status class, e.g. "2xx"
+	errors   uint64
+	buckets  []uint64
+	count    uint64
+	duration float64
+}
+
+// Metrics collects per-route request counters and latency histograms. Routes
+// are identified by their mux path template (e.g. "/s/{short}") rather than
+// the raw request path, so the number of series stays bounded no matter how
+// many links exist.
+type Metrics struct {
+	mu     sync.Mutex
+	routes map[routeKey]*routeStats
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{routes: make(map[routeKey]*routeStats)}
+}
+
+// Observe records one completed request.
+func (m *Metrics) Observe(route, method string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := routeKey{route: route, method: method}
+	st, ok := m.routes[key]
+	if !ok {
+		st = &routeStats{
+			codes:   make(map[string]uint64),
+			buckets: make([]uint64, len(latencyBuckets)),
+		}
+		m.routes[key] = st
+	}
+
+	st.codes[statusClass(status)]++
+	if status >= 500 {
+		st.errors++
+	}
+
+	seconds := elapsed.Seconds()
+	for i, upper := range latencyBuckets {
+		if seconds <= upper {
+			st.buckets[i]++
+		}
+	}
+	st.count++
+	st.duration += seconds
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]routeKey, 0, len(m.routes))
+	for k := range m.routes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	cw := &countingWriter{w: w}
+
+	fmt.Fprintln(cw, "# HELP pkshorts_http_requests_total Total HTTP requests by route template, method and status class.")
+	fmt.Fprintln(cw, "# TYPE pkshorts_http_requests_total counter")
+	for _, k := range keys {
+		st := m.routes[k]
+		classes := make([]string, 0, len(st.codes))
+		for c := range st.codes {
+			classes = append(classes, c)
+		}
+		sort.Strings(classes)
+		for _, c := range classes {
+			fmt.Fprintf(cw, "pkshorts_http_requests_total{route=%q,method=%q,code=%q} %d\n", k.route, k.method, c, st.codes[c])
+		}
+	}
+
+	fmt.Fprintln(cw, "# HELP pkshorts_http_request_errors_total HTTP requests that ended with a 5xx status.")
+	fmt.Fprintln(cw, "# TYPE pkshorts_http_request_errors_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "pkshorts_http_request_errors_total{route=%q,method=%q} %d\n", k.route, k.method, m.routes[k].errors)
+	}
+
+	fmt.Fprintln(cw, "# HELP pkshorts_http_request_duration_seconds HTTP request latency by route template.")
+	fmt.Fprintln(cw, "# TYPE pkshorts_http_request_duration_seconds histogram")
+	for _, k := range keys {
+		st := m.routes[k]
+		for i, upper := range latencyBuckets {
+			le := strconv.FormatFloat(upper, 'g', -1, 64)
+			fmt.Fprintf(cw, "pkshorts_http_request_duration_seconds_bucket{route=%q,method=%q,le=%q} %d\n", k.route, k.method, le, st.buckets[i])
+		}
+		fmt.Fprintf(cw, "pkshorts_http_request_duration_seconds_bucket{route=%q,method=%q,le=\"+Inf\"} %d\n", k.route, k.method, st.count)
+		fmt.Fprintf(cw, "pkshorts_http_request_duration_seconds_sum{route=%q,method=%q} %g\n", k.route, k.method, st.duration)
+		fmt.Fprintf(cw, "pkshorts_http_request_duration_seconds_count{route=%q,method=%q} %d\n", k.route, k.method, st.count)
+	}
+
+	return cw.n, cw.err
+}
+
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// countingWriter tracks bytes written and the first error, so WriteTo can
+// use fmt.Fprintf freely and still report an accurate result.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, to
+// flush event streams.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// metricsMiddleware records every routed request under its path template.
+func (s *Server) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		s.metrics.Observe(route, r.Method, rec.status, time.Since(start))
+	})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.WriteTo(w)
+	s.writeRuntimeMetrics(w)
+}
+
+// writeRuntimeMetrics writes gauges and counters read at scrape time from
+// the database, the redirect cache and the Go runtime, so growing free
+// lists, stuck transactions or a cold cache show up before redirect
+// latency does.
+func (s *Server) writeRuntimeMetrics(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	sample := func(name, kind, help string, value any) {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+
+	db := s.db.Stats()
+	sample("pkshorts_bolt_free_pages", "gauge", "Pages on the BoltDB freelist.", db.FreePageN)
+	sample("pkshorts_bolt_pending_pages", "gauge", "Pages freed by transactions still visible to readers.", db.PendingPageN)
+	sample("pkshorts_bolt_free_alloc_bytes", "gauge", "Bytes allocated in free pages.", db.FreeAlloc)
+	sample("pkshorts_bolt_freelist_inuse_bytes", "gauge", "Bytes used by the freelist.", db.FreelistInuse)
+	sample("pkshorts_bolt_read_tx_total", "counter", "Read transactions started.", db.TxN)
+	sample("pkshorts_bolt_open_read_tx", "gauge", "Read transactions currently open.", db.OpenTxN)
+	sample("pkshorts_bolt_page_writes_total", "counter", "Pages written by committed transactions.", db.TxStats.GetWrite())
+	sample("pkshorts_bolt_write_seconds_total", "counter", "Time spent writing pages to disk.", db.TxStats.GetWriteTime().Seconds())
+	if info, err := os.Stat(s.db.Path()); err == nil {
+		sample("pkshorts_bolt_file_size_bytes", "gauge", "Size of the database file.", info.Size())
+	}
+
+	hits, misses := s.cache.Stats()
+	sample("pkshorts_cache_hits_total", "counter", "Redirect lookups served from the cache.", hits)
+	sample("pkshorts_cache_misses_total", "counter", "Redirect lookups that missed the cache.", misses)
+	sample("pkshorts_cache_entries", "gauge", "Entries in the redirect cache.", s.cache.Len())
+	sample("pkshorts_cache_size", "gauge", "Maximum entries in the redirect cache.", s.cache.Size())
+
+	sample("pkshorts_id_collisions_total", "counter", "Generated short codes that were already taken.", s.idCollisions.Load())
+	sample("pkshorts_id_exhausted_total", "counter", "Links not created because no free short code was found.", s.idExhausted.Load())
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	sample("pkshorts_goroutines", "gauge", "Goroutines that currently exist.", runtime.NumGoroutine())
+	sample("pkshorts_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.", mem.HeapAlloc)
+	sample("pkshorts_gc_cycles_total", "counter", "Completed garbage collection cycles.", mem.NumGC)
+
+	return cw.n, cw.err
+}
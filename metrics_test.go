@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsObserve(t *testing.T) {
+	m := NewMetrics()
+	m.Observe("/s/{short}", "GET", http.StatusFound, 200*time.Microsecond)
+	m.Observe("/s/{short}", "GET", http.StatusNotFound, 2*time.Millisecond)
+	m.Observe("/sui/api/create", "POST", http.StatusInternalServerError, 30*time.Millisecond)
+
+	var sb strings.Builder
+	if _, err := m.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo() error: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		`pkshorts_http_requests_total{route="/s/{short}",method="GET",code="3xx"} 1`,
+		`pkshorts_http_requests_total{route="/s/{short}",method="GET",code="4xx"} 1`,
+		`pkshorts_http_request_errors_total{route="/sui/api/create",method="POST"} 1`,
+		`pkshorts_http_request_errors_total{route="/s/{short}",method="GET"} 0`,
+		`pkshorts_http_request_duration_seconds_bucket{route="/s/{short}",method="GET",le="0.0005"} 1`,
+		`pkshorts_http_request_duration_seconds_bucket{route="/s/{short}",method="GET",le="+Inf"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
+
+func TestMetricsMiddlewareUsesRouteTemplate(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, short := range []string{"one", "two", "three"} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", srv.prefix+"/"+short, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	out := rr.Body.String()
+
+	want := `pkshorts_http_requests_total{route="/s/{short}",method="GET",code="4xx"} 3`
+	if !strings.Contains(out, want) {
+		t.Errorf("metrics output missing %q:\n%s", want, out)
+	}
+	if strings.Contains(out, `route="/s/one"`) {
+		t.Error("metrics should not be labeled with raw paths")
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "cached"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/cached", nil))
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	out := rr.Body.String()
+
+	for _, want := range []string{
+		"# TYPE pkshorts_bolt_free_pages gauge",
+		"# TYPE pkshorts_bolt_read_tx_total counter",
+		"pkshorts_bolt_file_size_bytes ",
+		"pkshorts_cache_hits_total 2\n",
+		"pkshorts_cache_misses_total 1\n",
+		"pkshorts_cache_entries 1\n",
+		"pkshorts_goroutines ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	metaBucket       = "meta"
+	schemaVersionKey = "schema_version"
+)
+
+// errStopIteration ends a bucket ForEach early without signalling failure.
+var errStopIteration = errors.New("stop iteration")
+
+// migration upgrades the database by one schema version. Migrations run in
+// order inside a single write transaction, so a failure leaves the database
+// at its previous version. They must tolerate databases that already contain
+// some of their buckets, since versions before 1 were not tracked.
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *bolt.Tx) error
+}
+
+// migrations lists every schema change. Append new entries with the next
+// version number; never reorder or edit released ones.
+var migrations = []migration{
+	{1, "create links bucket", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		return err
+	}},
+	{2, "add creation-date index", func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(createdIndexBucket)) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket([]byte(createdIndexBucket)); err != nil {
+			return err
+		}
+		return backfillCreatedIndex(tx)
+	}},
+	{3, "add daily click counters", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(dailyClicksBucket))
+		return err
+	}},
+	{4, "move click totals into their own bucket", func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(clicksBucket)) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket([]byte(clicksBucket)); err != nil {
+			return err
+		}
+		return migrateClicks(tx)
+	}},
+	{5, "add users and sessions", func(tx *bolt.Tx) error {
+		for _, name := range []string{usersBucket, sessionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{6, "add settings, managed API keys and the admin role", func(tx *bolt.Tx) error {
+		for _, name := range []string{settingsBucket, apiKeysBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return promoteFirstUser(tx)
+	}},
+	{7, "add per-owner quota usage", func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(quotaUsageBucket)) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket([]byte(quotaUsageBucket)); err != nil {
+			return err
+		}
+		return backfillQuotaUsage(tx)
+	}},
+	{8, "add teams", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(teamsBucket))
+		return err
+	}},
+	{9, "add deletion tokens for anonymous links", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(deleteTokensBucket))
+		return err
+	}},
+	{10, "add IP bans", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bansBucket))
+		return err
+	}},
+	{11, "add deletion tombstones", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(tombstonesBucket))
+		return err
+	}},
+	{12, "add recent clicks and click sources", func(tx *bolt.Tx) error {
+		for _, name := range []string{clickEventsBucket, clickSourcesBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{13, "add deleted links for undo", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(deletedLinksBucket))
+		return err
+	}},
+	{14, "add the sequential ID counter", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(idSequenceBucket))
+		return err
+	}},
+	{15, "index short codes case-insensitively", func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(foldedIndexBucket)); err != nil {
+			return err
+		}
+		return backfillFoldedIndex(tx)
+	}},
+	{16, "add namespaces", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(namespacesBucket))
+		return err
+	}},
+	{17, "add campaigns", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(campaignsBucket))
+		return err
+	}},
+	{18, "add conversions", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(conversionsBucket))
+		return err
+	}},
+}
+
+// promoteFirstUser makes the earliest registered account an admin when no
+// admin exists yet, so instances upgraded from before roles keep someone
+// able to reach the admin panel.
+func promoteFirstUser(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(usersBucket))
+	var first *User
+	err := b.ForEach(func(k, v []byte) error {
+		var user User
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+		if user.Role == roleAdmin {
+			first = nil
+			return errStopIteration
+		}
+		if first == nil || user.CreatedAt.Before(first.CreatedAt) {
+			first = &user
+		}
+		return nil
+	})
+	if err != nil && err != errStopIteration {
+		return err
+	}
+	if first == nil {
+		return nil
+	}
+
+	first.Role = roleAdmin
+	data, err := json.Marshal(first)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(first.Username), data)
+}
+
+// latestSchemaVersion is the version a fully migrated database reports.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// schemaVersion reads the stored schema version, which is 0 for databases
+// that predate versioning.
+func schemaVersion(tx *bolt.Tx) int {
+	b := tx.Bucket([]byte(metaBucket))
+	if b == nil {
+		return 0
+	}
+	v := b.Get([]byte(schemaVersionKey))
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+	return b.Put([]byte(schemaVersionKey), buf)
+}
+
+// migrate brings the database up to the latest schema version.
+func migrate(tx *bolt.Tx) error {
+	current := schemaVersion(tx)
+	if current > latestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		slog.Info("applying migration", "version", m.version, "description", m.description)
+		if err := m.apply(tx); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+		if err := setSchemaVersion(tx, m.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSchema verifies that a database opened read-only is at the schema
+// version this build expects, since a read-only replica cannot migrate it.
+func checkSchema(db *bolt.DB) error {
+	return db.View(func(tx *bolt.Tx) error {
+		current := schemaVersion(tx)
+		if current != latestSchemaVersion() {
+			return fmt.Errorf("database schema version %d does not match %d; run a writable instance of this build to migrate it", current, latestSchemaVersion())
+		}
+		return nil
+	})
+}
+
+// runMigrate implements the "migrate" command, applying pending migrations
+// without starting the server, e.g. before rolling out replicas.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.DBPath, cfg.Database, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database (is the server still running?): %w", err)
+	}
+	defer db.Close()
+
+	var before, after int
+	err = db.Update(func(tx *bolt.Tx) error {
+		before = schemaVersion(tx)
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		after = schemaVersion(tx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if before == after {
+		fmt.Printf("%s is up to date at schema version %d\n", cfg.DBPath, after)
+	} else {
+		fmt.Printf("Migrated %s from schema version %d to %d\n", cfg.DBPath, before, after)
+	}
+	return nil
+}
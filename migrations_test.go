@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.version, i+1)
+		}
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A database as written by the original release: only the links
+	// bucket, with click totals inside the link JSON.
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() error: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		data, _ := json.Marshal(Link{Short: "old", Original: "https://example.com", CreatedAt: time.Now(), Clicks: 7})
+		return b.Put([]byte("old"), data)
+	})
+	if err != nil {
+		t.Fatalf("seed error: %v", err)
+	}
+	db.Close()
+
+	t.Setenv("DB_PATH", path)
+	srv, err := NewServer(testConfig(t))
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	defer srv.Close()
+
+	srv.db.View(func(tx *bolt.Tx) error {
+		if v := schemaVersion(tx); v != latestSchemaVersion() {
+			t.Errorf("schema version = %d, want %d", v, latestSchemaVersion())
+		}
+		return nil
+	})
+
+	links, err := srv.getLinksCreatedBetween(time.Time{}, time.Time{}, 0, nil)
+	if err != nil {
+		t.Fatalf("getLinksCreatedBetween() error: %v", err)
+	}
+	if len(links) != 1 || links[0].Clicks != 7 {
+		t.Errorf("expected backfilled index and clicks, got %+v", links)
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	srv := newTestServer(t)
+
+	err := srv.db.Update(func(tx *bolt.Tx) error {
+		if err := setSchemaVersion(tx, latestSchemaVersion()+1); err != nil {
+			return err
+		}
+		return migrate(tx)
+	})
+	if err == nil {
+		t.Error("expected error for a schema newer than the build")
+	}
+}
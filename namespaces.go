@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const namespacesBucket = "namespaces"
+
+var (
+	errNamespaceExists = errors.New("namespace already exists")
+	errNamespaceDenied = errors.New("you cannot create links in this namespace")
+)
+
+// namespaceReservedSlugs would be taken for the routes of the link named by
+// the namespace alone, e.g. /s/docs/preview.
+var namespaceReservedSlugs = []string{"preview", "report", "stats", "restore", "pixel.gif", "raw"}
+
+// Namespace is the first segment of two-segment short codes such as
+// "docs/install". It belongs to a team: only its members (and admins)
+// create links in it, and those links are owned by the team.
+type Namespace struct {
+	Name      string    `json:"name"`
+	Team      string    `json:"team"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// splitNamespace splits a namespaced short code into its namespace and
+// slug; ok is false for codes without a namespace.
+func splitNamespace(short string) (namespace, slug string, ok bool) {
+	return strings.Cut(short, "/")
+}
+
+// validateNamespacedID checks the format of a namespaced custom ID.
+func validateNamespacedID(id string) error {
+	name, slug, _ := splitNamespace(id)
+	if err := validateHandle("namespace", name); err != nil || strings.Contains(name, ".") {
+		return fmt.Errorf("%w: '%s' is not a valid namespace", errInvalidCustomID, name)
+	}
+	if err := validateCustomID(slug); err != nil {
+		return err
+	}
+	for _, reserved := range namespaceReservedSlugs {
+		if strings.EqualFold(slug, reserved) {
+			return fmt.Errorf("%w: '%s' is a reserved word", errInvalidCustomID, slug)
+		}
+	}
+	return nil
+}
+
+// createNamespace adds a namespace for the links of team.
+func (s *Server) createNamespace(name, team string) (*Namespace, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := validateHandle("namespace", name); err != nil {
+		return nil, err
+	}
+	if strings.Contains(name, ".") {
+		return nil, fmt.Errorf("namespace can only contain lowercase letters, numbers, dashes, and underscores")
+	}
+	ns := &Namespace{Name: name, Team: strings.ToLower(strings.TrimSpace(team)), CreatedAt: time.Now()}
+	data, err := json.Marshal(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(teamsBucket)).Get([]byte(ns.Team)) == nil {
+			return fmt.Errorf("team not found")
+		}
+		b := tx.Bucket([]byte(namespacesBucket))
+		if b.Get([]byte(name)) != nil {
+			return errNamespaceExists
+		}
+		return b.Put([]byte(name), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// getNamespace loads a namespace by name.
+func (s *Server) getNamespace(name string) (*Namespace, error) {
+	var ns *Namespace
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(namespacesBucket)).Get([]byte(name))
+		if data == nil {
+			return fmt.Errorf("namespace not found")
+		}
+		ns = &Namespace{}
+		return json.Unmarshal(data, ns)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// listNamespaces returns every namespace, ordered by name.
+func (s *Server) listNamespaces() ([]Namespace, error) {
+	var namespaces []Namespace
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(namespacesBucket)).ForEach(func(k, v []byte) error {
+			var ns Namespace
+			if err := json.Unmarshal(v, &ns); err != nil {
+				return err
+			}
+			namespaces = append(namespaces, ns)
+			return nil
+		})
+	})
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	return namespaces, err
+}
+
+// callerNamespaces returns the names of the namespaces of the teams a
+// logged-in user belongs to.
+func (s *Server) callerNamespaces(user *User) []string {
+	teams := s.callerTeams(user)
+	if len(teams) == 0 {
+		return nil
+	}
+	namespaces, err := s.listNamespaces()
+	if err != nil {
+		slog.Error("failed to list namespaces", "err", err)
+		return nil
+	}
+	var names []string
+	for _, ns := range namespaces {
+		for _, team := range teams {
+			if ns.Team == team {
+				names = append(names, ns.Name)
+			}
+		}
+	}
+	return names
+}
+
+// deleteNamespace removes a namespace. Its links keep working, but no new
+// ones can be created in it.
+func (s *Server) deleteNamespace(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(namespacesBucket))
+		if b.Get([]byte(name)) == nil {
+			return fmt.Errorf("namespace not found")
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// namespaceOwner returns the owner of a new link with custom ID id created
+// by owner: the namespace's team for namespaced IDs, which owner must be,
+// belong to or administer; owner itself otherwise.
+func (s *Server) namespaceOwner(id, owner string) (string, error) {
+	name, _, ok := splitNamespace(id)
+	if !ok {
+		return owner, nil
+	}
+	ns, err := s.getNamespace(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: namespace '%s' does not exist", errInvalidCustomID, name)
+	}
+	team, err := s.getTeam(ns.Team)
+	if err != nil {
+		return "", fmt.Errorf("%w '%s'", errNamespaceDenied, name)
+	}
+	if owner == team.Owner() || team.HasMember(owner) {
+		return team.Owner(), nil
+	}
+	if user, err := s.getUser(owner); err == nil && user.IsAdmin() {
+		return team.Owner(), nil
+	}
+	return "", fmt.Errorf("%w '%s'", errNamespaceDenied, name)
+}
+
+// namespaced adapts a handler of a {short} route to the matching
+// {namespace}/{slug} route of namespaced links.
+func namespaced(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		vars["short"] = vars["namespace"] + "/" + vars["slug"]
+		h(w, mux.SetURLVars(r, vars))
+	}
+}
+
+// setupNamespaceRoutes serves the redirects, pages and API endpoints of
+// single links for namespaced links too. They come after the other routes,
+// so /s/docs/preview stays the preview of the link "docs".
+func (s *Server) setupNamespaceRoutes() {
+	s.router.HandleFunc(s.prefix+"/{namespace}/{slug}", namespaced(s.handleRedirect)).Methods("GET")
+	s.router.HandleFunc(s.prefix+"/{namespace}/{slug}/preview", namespaced(s.handlePreview)).Methods("GET")
+	s.router.HandleFunc(s.prefix+"/{namespace}/{slug}/pixel.gif", namespaced(s.handleConversionPixel)).Methods("GET")
+	s.router.HandleFunc(s.prefix+"/{namespace}/{slug}/raw", namespaced(s.handlePasteRaw)).Methods("GET")
+	if s.readOnly {
+		return
+	}
+	s.router.HandleFunc(s.prefix+"/{namespace}/{slug}/report", s.limitCreate(namespaced(s.handleReport))).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/links/{namespace}/{slug}", namespaced(s.handleLinkPage)).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/available/{namespace}/{slug}", namespaced(s.handleAvailable)).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/delete/{namespace}/{slug}", namespaced(s.handleAPIDelete)).Methods("DELETE")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{namespace}/{slug}", namespaced(s.handleAPIUpdate)).Methods("PATCH")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{namespace}/{slug}/stats", namespaced(s.handleLinkStats)).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{namespace}/{slug}/conversion", namespaced(s.handleAPIConversion)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/api/links/{namespace}/{slug}/restore", namespaced(s.handleAPIRestore)).Methods("POST")
+	s.router.HandleFunc(s.uiPrefix+"/qr/{namespace}/{slug}.{format:png|svg}", namespaced(s.handleQR)).Methods("GET")
+	s.router.HandleFunc(s.uiPrefix+"/delete/{namespace}/{slug}", namespaced(s.handleDelete)).Methods("POST")
+}
+
+func (s *Server) handleAdminCreateNamespace(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.createNamespace(r.FormValue("name"), r.FormValue("team")); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNamespaceExists) {
+			status = http.StatusConflict
+		}
+		s.renderAdmin(w, r, status, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminDeleteNamespace(w http.ResponseWriter, r *http.Request) {
+	if err := s.deleteNamespace(mux.Vars(r)["namespace"]); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
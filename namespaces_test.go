@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateNamespacedID(t *testing.T) {
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{"docs/install", false},
+		{"docs/Getting_Started-2", false},
+		{"Docs/install", true},
+		{"do/install", true},
+		{"docs.v2/install", true},
+		{"docs/in", true},
+		{"docs/preview", true},
+		{"docs/raw", true},
+		{"docs/a/b", true},
+	}
+	for _, tt := range tests {
+		if err := validateNamespacedID(tt.id); (err != nil) != tt.wantErr {
+			t.Errorf("validateNamespacedID(%q) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNamespacedLinks(t *testing.T) {
+	srv := newTestServer(t)
+	root := loginAs(t, srv, "root")
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	if _, err := srv.createTeam("writers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.addTeamMember("writers", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createNamespace("docs", "nobody"); err == nil {
+		t.Error("namespace created for a missing team")
+	}
+	if _, err := srv.createNamespace("docs", "writers"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createNamespace("docs", "writers"); !errors.Is(err, errNamespaceExists) {
+		t.Errorf("duplicate createNamespace() error = %v, want errNamespaceExists", err)
+	}
+
+	short, err := srv.createShortLink("https://example.com/install", createOptions{CustomID: "docs/install", Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := srv.getLink(short); link.Owner != "team:writers" {
+		t.Errorf("namespaced link owned by %q, want the team", link.Owner)
+	}
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "docs/faq", Owner: "bob"}); !errors.Is(err, errNamespaceDenied) {
+		t.Errorf("non-member create error = %v, want errNamespaceDenied", err)
+	}
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "blog/post", Owner: "alice"}); !errors.Is(err, errInvalidCustomID) {
+		t.Errorf("missing namespace create error = %v, want errInvalidCustomID", err)
+	}
+	if _, err := srv.createShortLink("https://example.com/faq", createOptions{CustomID: "docs/faq", Owner: "root"}); err != nil {
+		t.Errorf("admin create error = %v", err)
+	}
+	// A plain link named like the namespace stays separate.
+	if _, err := srv.createShortLink("https://example.com/docs", createOptions{CustomID: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/raw", createOptions{CustomID: "docs/raw", Owner: "alice"}); !errors.Is(err, errInvalidCustomID) {
+		t.Errorf("create of docs/raw error = %v, want errInvalidCustomID", err)
+	}
+
+	// Namespaced pastes serve their text at the raw URL they are given.
+	req := httptest.NewRequest("POST", "/sui/api/paste", strings.NewReader(`{"text": "hello", "custom_id": "docs/snip"}`))
+	req.AddCookie(alice)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	var paste struct {
+		RawURL string `json:"raw_url"`
+	}
+	json.NewDecoder(rr.Body).Decode(&paste)
+	if rr.Code != http.StatusOK || !strings.HasSuffix(paste.RawURL, "/s/docs/snip/raw") {
+		t.Fatalf("namespaced paste = %d, raw URL %q", rr.Code, paste.RawURL)
+	}
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/docs/snip/raw", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "hello" {
+		t.Errorf("raw namespaced paste = %d %q", rr.Code, rr.Body.String())
+	}
+
+	for path, want := range map[string]string{
+		"/s/docs/install": "https://example.com/install",
+		"/s/docs":         "https://example.com/docs",
+	} {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusFound || rr.Header().Get("Location") != want {
+			t.Errorf("GET %s = %d %q, want a redirect to %s", path, rr.Code, rr.Header().Get("Location"), want)
+		}
+	}
+
+	list := func(cookie *http.Cookie) (int, string) {
+		req := httptest.NewRequest("GET", "/sui/api/list?namespace=docs", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code, rr.Body.String()
+	}
+	if code, body := list(alice); code != http.StatusOK || !strings.Contains(body, `"docs/install"`) || !strings.Contains(body, `"docs/faq"`) {
+		t.Errorf("member listing = %d %s, want both namespaced links", code, body)
+	}
+	if code, _ := list(bob); code != http.StatusForbidden {
+		t.Errorf("non-member listing status = %d, want 403", code)
+	}
+
+	req = httptest.NewRequest("PATCH", "/sui/api/links/docs/install", strings.NewReader(`{"url": "https://example.com/changed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(alice)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if link, _ := srv.getLink("docs/install"); rr.Code != http.StatusOK || link.Original != "https://example.com/changed" {
+		t.Errorf("member update = %d %s, want the link changed", rr.Code, rr.Body)
+	}
+
+	req = httptest.NewRequest("GET", "/sui/admin", nil)
+	req.AddCookie(root)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), `namespace=docs">docs/</a>`) {
+		t.Error("admin page does not list the namespace")
+	}
+}
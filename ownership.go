@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiKeyOwnerPrefix marks links created with a configured API key rather
+// than by a logged-in user.
+const apiKeyOwnerPrefix = "key:"
+
+// callerOwner returns the owner identity of the request: the username of a
+// logged-in user or of a personal API token's owner, "key:<name>" for
+// requests made with a system API key, or "" for anonymous callers. ok is
+// false if an unknown API key was sent.
+func (s *Server) callerOwner(r *http.Request) (owner string, ok bool) {
+	if user := s.currentUser(r); user != nil {
+		return user.Username, true
+	}
+	cred, ok := s.requestCredential(r)
+	switch {
+	case cred == nil:
+		return "", ok
+	case cred.User != "":
+		return cred.User, true
+	default:
+		return apiKeyOwnerPrefix + cred.System, true
+	}
+}
+
+// callerUser returns the user making the request, logged in with a session
+// or authenticated with a personal API token, or nil.
+func (s *Server) callerUser(r *http.Request) *User {
+	if user := s.currentUser(r); user != nil {
+		return user
+	}
+	cred, _ := s.requestCredential(r)
+	if cred == nil || cred.User == "" {
+		return nil
+	}
+	user, err := s.getUser(cred.User)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// listFilter returns the filter applied to link listings for the caller.
+// By default callers only see their own links (anonymous callers see
+// anonymous links); team=<name> lists a team's links for its members, and
+// admins may pass all=true to see everything. tag=<tag>, campaign=<name>
+// and a q=<text> search further narrow any of these. It writes an error
+// response and returns ok=false when the request is not allowed.
+func (s *Server) listFilter(w http.ResponseWriter, r *http.Request) (match func(*Link) bool, ok bool) {
+	query := r.URL.Query()
+	all := query.Get("all") == "true"
+	tag := strings.ToLower(query.Get("tag"))
+	search := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	campaign := strings.ToLower(query.Get("campaign"))
+
+	var ns *Namespace
+	if name := query.Get("namespace"); name != "" {
+		var err error
+		if ns, err = s.getNamespace(strings.ToLower(name)); err != nil {
+			http.Error(w, "Namespace not found", http.StatusNotFound)
+			return nil, false
+		}
+	}
+
+	var owner string
+	switch {
+	case all:
+		if !s.isAdmin(r) {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return nil, false
+		}
+	case ns != nil:
+		// A namespace lists its team's links in it.
+		var err error
+		if owner, err = s.teamOwner(r, ns.Team); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return nil, false
+		}
+	case query.Get("team") != "":
+		var err error
+		if owner, err = s.teamOwner(r, query.Get("team")); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return nil, false
+		}
+	default:
+		if owner, ok = s.callerOwner(r); !ok {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return nil, false
+		}
+	}
+	if all && ns == nil && tag == "" && search == "" && campaign == "" {
+		return nil, true
+	}
+	return func(link *Link) bool {
+		if !all && link.Owner != owner {
+			return false
+		}
+		if ns != nil && !strings.HasPrefix(link.Short, ns.Name+"/") {
+			return false
+		}
+		if search != "" && !link.matchesSearch(search) {
+			return false
+		}
+		if campaign != "" && link.Campaign != campaign {
+			return false
+		}
+		return tag == "" || link.hasTag(tag)
+	}, true
+}
+
+// checkCanDelete reports whether the caller may delete short: admins may
+// delete anything, team members their team's links, holders of a link's
+// deletion token that link, and everyone else only links they own. It
+// returns http.StatusOK when allowed, or an error status and message.
+func (s *Server) checkCanDelete(r *http.Request, short string) (int, string) {
+	link, err := s.getLink(short)
+	if err != nil {
+		return http.StatusNotFound, "Link not found"
+	}
+	if s.isAdmin(r) || s.isTeamMember(r, link.Owner) || s.checkDeleteToken(short, r.FormValue("token")) {
+		return http.StatusOK, ""
+	}
+
+	owner, ok := s.callerOwner(r)
+	if !ok {
+		return http.StatusUnauthorized, "Invalid API key"
+	}
+	// Anonymous links are shared by every anonymous caller, so only their
+	// deletion token proves who created them.
+	if link.Owner == "" {
+		return http.StatusForbidden, "A valid deletion token is required to delete this link"
+	}
+	if link.Owner != owner {
+		return http.StatusForbidden, "You can only delete your own links"
+	}
+	return http.StatusOK, ""
+}
+
+// checkCanManage reports whether the caller may change link or see its
+// detailed statistics: admins may for every link, team members for their
+// team's links, and everyone else only for links they own. Anonymous links
+// are left to admins. It returns http.StatusOK when allowed, or an error
+// status and message.
+func (s *Server) checkCanManage(r *http.Request, link *Link) (int, string) {
+	if s.isAdmin(r) || s.isTeamMember(r, link.Owner) {
+		return http.StatusOK, ""
+	}
+	owner, ok := s.callerOwner(r)
+	if !ok {
+		return http.StatusUnauthorized, "Invalid API key"
+	}
+	if link.Owner == "" || link.Owner != owner {
+		return http.StatusForbidden, "You can only manage your own links"
+	}
+	return http.StatusOK, ""
+}
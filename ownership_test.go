@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestListIsScopedToCaller(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	t.Setenv("ADMIN_TOKEN", "admin")
+	srv := newTestServer(t)
+
+	if _, err := srv.createShortLink("https://example.com/a", createOptions{CustomID: "alice-link", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/k", createOptions{CustomID: "crm-link", Owner: "key:crm"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/x", createOptions{CustomID: "anon-link"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(header, value, query string) (int, []Link) {
+		req := httptest.NewRequest("GET", srv.uiPrefix+"/api/list"+query, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		var links []Link
+		json.NewDecoder(rr.Body).Decode(&links)
+		return rr.Code, links
+	}
+
+	if _, links := list("", "", ""); len(links) != 1 || links[0].Short != "anon-link" {
+		t.Errorf("anonymous list = %+v, want only anon-link", links)
+	}
+	if _, links := list("X-API-Key", "k1", ""); len(links) != 1 || links[0].Short != "crm-link" {
+		t.Errorf("API key list = %+v, want only crm-link", links)
+	}
+	if code, _ := list("", "", "?all=true"); code != http.StatusForbidden {
+		t.Errorf("all=true without admin status = %d, want 403", code)
+	}
+	if _, links := list("X-Admin-Token", "admin", "?all=true"); len(links) != 3 {
+		t.Errorf("admin all=true list has %d links, want 3", len(links))
+	}
+}
+
+func TestDeleteRequiresOwnership(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "crm-link", Owner: "key:crm"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("DELETE", srv.uiPrefix+"/api/delete/crm-link", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("anonymous delete status = %d, want 403", rr.Code)
+	}
+
+	req := httptest.NewRequest("DELETE", srv.uiPrefix+"/api/delete/crm-link", nil)
+	req.Header.Set("X-API-Key", "k1")
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("owner delete status = %d, want 200", rr.Code)
+	}
+}
+
+func TestAnonymousCreateToggle(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	t.Setenv("DISABLE_ANONYMOUS_CREATE", "true")
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	short, err := srv.createShortLink("https://example.com", createOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiCreate := func(key string) int {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/api/create", strings.NewReader(`{"url":"https://example.com"}`))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := apiCreate(""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous API create status = %d, want 401", code)
+	}
+	if code := apiCreate("k1"); code != http.StatusOK {
+		t.Errorf("API key create status = %d, want 200", code)
+	}
+
+	uiCreate := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{"url": {"https://example.com"}}
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := uiCreate(nil); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != srv.uiPrefix+"/login" {
+		t.Errorf("anonymous UI create = %d to %q, want redirect to login", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := uiCreate(cookie); rr.Code != http.StatusOK {
+		t.Errorf("logged-in UI create status = %d, want 200", rr.Code)
+	}
+
+	// Redirects stay public.
+	req := httptest.NewRequest("GET", srv.prefix+"/"+short, nil)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Errorf("redirect status = %d", rr.Code)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPasteBytes caps the text of a paste.
+const maxPasteBytes = 64 << 10
+
+var errInvalidPaste = errors.New("invalid paste")
+
+// Paste is the text snippet a paste link shows at its short URL instead of
+// redirecting. Paste links have no destination.
+type Paste struct {
+	Text string `json:"text"`
+	// Language is the syntax Text is highlighted as, one of
+	// pasteSyntaxes, or "" for plain text.
+	Language string `json:"language,omitempty"`
+}
+
+// pasteSyntax describes a language well enough to highlight comments,
+// strings, numbers and keywords; comment and str are regexp alternatives.
+type pasteSyntax struct {
+	comment  string
+	str      string
+	keywords []string
+	// foldCase matches keywords in any case, as in SQL.
+	foldCase bool
+}
+
+const (
+	cComments     = `//[^\n]*|/\*[\s\S]*?\*/`
+	hashComments  = `#[^\n]*`
+	quotedStrings = `"(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'`
+)
+
+var pasteSyntaxes = map[string]pasteSyntax{
+	"go": {cComments, quotedStrings + "|`[^`]*`", strings.Fields(`break case chan const continue default defer else
+		fallthrough for func go goto if import interface map package range return select struct switch type var
+		nil true false iota`), false},
+	"javascript": {cComments, quotedStrings + "|`(?:\\\\.|[^`\\\\])*`", strings.Fields(`async await break case catch class
+		const continue default delete do else export extends finally for function if import in instanceof let new
+		of return switch this throw try typeof var void while yield null undefined true false`), false},
+	"python": {hashComments, `"""[\s\S]*?"""|'''[\s\S]*?'''|` + quotedStrings, strings.Fields(`and as assert async await
+		break class continue def del elif else except finally for from global if import in is lambda nonlocal not
+		or pass raise return try while with yield None True False`), false},
+	"bash": {hashComments, quotedStrings, strings.Fields(`if then else elif fi for while until do done case esac in
+		function return local export readonly`), false},
+	"sql": {`--[^\n]*|/\*[\s\S]*?\*/`, `'(?:''|[^'])*'`, strings.Fields(`select from where and or not insert into
+		values update set delete create table index view drop alter add join left right inner outer on group by
+		order having limit offset as distinct union all null is in like between case when then else end`), true},
+	"json": {``, `"(?:\\.|[^"\\\n])*"`, strings.Fields(`true false null`), false},
+	"yaml": {hashComments, quotedStrings, strings.Fields(`true false null yes no`), false},
+}
+
+// pasteLanguageAliases maps other common names to pasteSyntaxes keys.
+var pasteLanguageAliases = map[string]string{
+	"golang": "go", "js": "javascript", "py": "python", "sh": "bash", "shell": "bash", "yml": "yaml",
+	"text": "", "plain": "",
+}
+
+// pasteHighlighters are the compiled pasteSyntaxes; the name of the group
+// that matched is the token class.
+var pasteHighlighters = func() map[string]*regexp.Regexp {
+	compiled := make(map[string]*regexp.Regexp, len(pasteSyntaxes))
+	for name, syntax := range pasteSyntaxes {
+		var parts []string
+		if syntax.comment != "" {
+			parts = append(parts, `(?P<comment>`+syntax.comment+`)`)
+		}
+		parts = append(parts, `(?P<string>`+syntax.str+`)`, `(?P<number>\b\d+(?:\.\d+)?\b)`)
+		keywords := `\b(?:` + strings.Join(syntax.keywords, "|") + `)\b`
+		if syntax.foldCase {
+			keywords = `(?i:` + keywords + `)`
+		}
+		parts = append(parts, `(?P<keyword>`+keywords+`)`)
+		compiled[name] = regexp.MustCompile(strings.Join(parts, "|"))
+	}
+	return compiled
+}()
+
+// normalize checks p and puts its language in canonical form.
+func (p *Paste) normalize() error {
+	if strings.TrimSpace(p.Text) == "" {
+		return fmt.Errorf("%w: text is empty", errInvalidPaste)
+	}
+	if len(p.Text) > maxPasteBytes {
+		return fmt.Errorf("%w: text is longer than %d bytes", errInvalidPaste, maxPasteBytes)
+	}
+	if !utf8.ValidString(p.Text) {
+		return fmt.Errorf("%w: text is not valid UTF-8", errInvalidPaste)
+	}
+	language := strings.ToLower(strings.TrimSpace(p.Language))
+	if alias, ok := pasteLanguageAliases[language]; ok {
+		language = alias
+	}
+	if _, ok := pasteSyntaxes[language]; language != "" && !ok {
+		return fmt.Errorf("%w: unknown language %q", errInvalidPaste, p.Language)
+	}
+	p.Language = language
+	return nil
+}
+
+// samePaste reports whether a and b are the same snippet, or both nil.
+func samePaste(a, b *Paste) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// highlightPaste returns text as HTML, with the tokens of language wrapped
+// in spans of class "tok-comment", "tok-string", "tok-number" or
+// "tok-keyword". Unknown languages are only escaped.
+func highlightPaste(text, language string) template.HTML {
+	re := pasteHighlighters[language]
+	if re == nil {
+		return template.HTML(html.EscapeString(text))
+	}
+	names := re.SubexpNames()
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:m[0]]))
+		for i, name := range names {
+			if name != "" && m[2*i] >= 0 {
+				fmt.Fprintf(&b, `<span class="tok-%s">%s</span>`, name, html.EscapeString(text[m[0]:m[1]]))
+				break
+			}
+		}
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// handleAPIPaste creates a paste link with POST {"text": ..., "language":
+// ..., "custom_id": ..., "team": ..., "tags": [...], "domain": ...,
+// "campaign": ..., "expires_in": "24h"} and returns its short URL.
+// "expires_at" takes an RFC 3339 time or date instead of "expires_in".
+func (s *Server) handleAPIPaste(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	system, _ := s.apiKeySystem(r)
+	owner, _ := s.callerOwner(r)
+	if owner == "" && !s.getSettings().AnonymousCreate {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if owner == "" && s.pow != nil {
+		if err := s.verifyPow(r); err != nil {
+			writeNotHumanError(w, err)
+			return
+		}
+	}
+
+	var req struct {
+		Text      string   `json:"text"`
+		Language  string   `json:"language"`
+		Secure    bool     `json:"secure"`
+		CustomID  string   `json:"custom_id"`
+		Team      string   `json:"team"`
+		Tags      []string `json:"tags"`
+		Domain    string   `json:"domain"`
+		ExpiresIn string   `json:"expires_in"`
+		ExpiresAt string   `json:"expires_at"`
+		Campaign  string   `json:"campaign"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+
+	paste := &Paste{Text: req.Text, Language: req.Language}
+	if err := paste.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expires, err := pasteExpiry(req.ExpiresIn, req.ExpiresAt, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Team != "" {
+		if owner, err = s.teamOwner(r, req.Team); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	domain, err := s.createDomain(r, req.Domain, req.Domain != "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := createOptions{
+		Secure:    req.Secure,
+		CustomID:  strings.TrimSpace(req.CustomID),
+		System:    system,
+		Owner:     owner,
+		Tags:      tags,
+		Domain:    domain,
+		ExpiresAt: expires,
+		Paste:     paste,
+	}
+	if req.Campaign != "" {
+		if _, err := s.applyCampaign(req.Campaign, "", &opts); err != nil {
+			writeCampaignError(w, err)
+			return
+		}
+	}
+	if owner == "" {
+		if opts.DeleteToken, err = newDeleteToken(); err != nil {
+			http.Error(w, "Failed to create short link", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	short, err := s.createShortLink("", opts)
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+	shortURL := s.shortURL(r, domain, short)
+	resp := map[string]interface{}{
+		"short":     short,
+		"short_url": shortURL,
+		"raw_url":   shortURL + "/raw",
+		"language":  paste.Language,
+		"secure":    req.Secure,
+	}
+	if opts.Campaign != "" {
+		resp["campaign"] = opts.Campaign
+	}
+	if opts.ExpiresAt != nil {
+		resp["expires_at"] = opts.ExpiresAt
+	}
+	if opts.DeleteToken != "" {
+		resp["delete_token"] = opts.DeleteToken
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// pasteExpiry parses the expiry of a new paste, given as a duration from
+// now or as a time; it returns nil for none.
+func pasteExpiry(in, at string, now time.Time) (*time.Time, error) {
+	switch {
+	case in != "" && at != "":
+		return nil, errors.New("give expires_in or expires_at, not both")
+	case in != "":
+		d, err := time.ParseDuration(in)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid expires_in %q", in)
+		}
+		t := now.Add(d)
+		return &t, nil
+	case at != "":
+		t, err := parseTimeParam(at)
+		if err != nil {
+			return nil, err
+		}
+		if !t.After(now) {
+			return nil, errors.New("expires_at is in the past")
+		}
+		return &t, nil
+	}
+	return nil, nil
+}
+
+// servePaste shows the paste of short, counting the view like a click.
+// The raw text is served instead when raw is set.
+func (s *Server) servePaste(w http.ResponseWriter, r *http.Request, short string, raw bool) {
+	link, err := s.getLink(short)
+	if err != nil || link.Paste == nil {
+		s.renderLinkError(w, r, short, fmt.Errorf("link not found"))
+		return
+	}
+	if !s.readOnly && !s.maintenance().Enabled {
+		s.countClick(short, s.clickEvent(r))
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if raw {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(link.Paste.Text))
+		return
+	}
+	data := s.pageData(r)
+	data["Link"] = link
+	data["ShortURL"] = s.shortURL(r, link.Domain, short)
+	data["Code"] = highlightPaste(link.Paste.Text, link.Paste.Language)
+	data["Lines"] = strings.Count(strings.TrimRight(link.Paste.Text, "\n"), "\n") + 1
+	if err := s.templates().ExecuteTemplate(w, "paste.html", data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
+
+// handlePasteRaw serves the text of a paste as plain text, for curl and
+// scripts. Links that aren't pastes are not found here.
+func (s *Server) handlePasteRaw(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	url, err := s.getOriginalURL(s.requestDomain(r), short)
+	if errors.Is(err, errLinkReported) {
+		err = nil
+	}
+	if err == nil && url != "" {
+		err = fmt.Errorf("link not found")
+	}
+	if err != nil {
+		s.renderLinkError(w, r, short, err)
+		return
+	}
+	s.servePaste(w, r, short, true)
+}
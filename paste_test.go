@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasteNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		paste   Paste
+		want    string
+		wantErr bool
+	}{
+		{"plain", Paste{Text: "hello"}, "", false},
+		{"language", Paste{Text: "x := 1", Language: "Go"}, "go", false},
+		{"alias", Paste{Text: "let x", Language: "js"}, "javascript", false},
+		{"text alias", Paste{Text: "hello", Language: "text"}, "", false},
+		{"unknown language", Paste{Text: "hello", Language: "cobol"}, "", true},
+		{"empty", Paste{Text: " \n"}, "", true},
+		{"too long", Paste{Text: strings.Repeat("a", maxPasteBytes+1)}, "", true},
+		{"invalid UTF-8", Paste{Text: "\xff"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.paste
+			err := p.normalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidPaste) {
+				t.Errorf("normalize() error = %v, want errInvalidPaste", err)
+			}
+			if err == nil && p.Language != tt.want {
+				t.Errorf("language = %q, want %q", p.Language, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightPaste(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		language string
+		want     string
+	}{
+		{"plain text is escaped", `<b>"hi"</b>`, "", `&lt;b&gt;&#34;hi&#34;&lt;/b&gt;`},
+		{"go", `return "a<b" // done`, "go", `<span class="tok-keyword">return</span> <span class="tok-string">&#34;a&lt;b&#34;</span> <span class="tok-comment">// done</span>`},
+		{"keywords in strings stay strings", `x = "if"`, "python", `x = <span class="tok-string">&#34;if&#34;</span>`},
+		{"sql keywords in any case", `SELECT 1`, "sql", `<span class="tok-keyword">SELECT</span> <span class="tok-number">1</span>`},
+		{"no partial keywords", `format`, "go", `format`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(highlightPaste(tt.text, tt.language)); got != tt.want {
+				t.Errorf("highlightPaste() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	for name := range pasteSyntaxes {
+		if pasteHighlighters[name] == nil {
+			t.Errorf("no highlighter for %s", name)
+		}
+	}
+}
+
+func TestPasteExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		in, at  string
+		want    *time.Time
+		wantErr bool
+	}{
+		{"none", "", "", nil, false},
+		{"duration", "2h", "", ptrTime(now.Add(2 * time.Hour)), false},
+		{"time", "", "2024-05-02T00:00:00Z", ptrTime(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)), false},
+		{"both", "2h", "2024-05-02", nil, true},
+		{"negative", "-2h", "", nil, true},
+		{"past", "", "2024-04-01", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pasteExpiry(tt.in, tt.at, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pasteExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("pasteExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
+
+func TestAPIPaste(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/sui/api/paste", `{"text": "package main\n\nfunc main() {}\n", "language": "go", "custom_id": "snip", "tags": ["demo"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]any
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp["short"] != "snip" || !strings.HasSuffix(resp["raw_url"].(string), "/s/snip/raw") {
+		t.Errorf("response = %v", resp)
+	}
+
+	rr = serve("GET", "/s/snip", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `<span class="tok-keyword">func</span>`) {
+		t.Errorf("paste page = %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = serve("GET", "/s/snip/raw", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "package main\n\nfunc main() {}\n" || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("raw paste = %d %q, %v", rr.Code, rr.Body.String(), rr.Header())
+	}
+	if link, _ := srv.getLink("snip"); link.Clicks != 2 || link.Owner != "alice" || link.Original != "" {
+		t.Errorf("link = %+v, want two views by alice's paste", link)
+	}
+	if rr := serve("PATCH", "/sui/api/links/snip", `{"url": "https://example.com"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("changing the destination of a paste = %d, want 400", rr.Code)
+	}
+	if rr := serve("GET", "/sui/list", ""); !strings.Contains(rr.Body.String(), "Text snippet (go)") {
+		t.Error("list does not show the paste")
+	}
+
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "site"}); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve("GET", "/s/site/raw", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("raw of a redirect = %d, want 404", rr.Code)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	if _, err := srv.createShortLink("", createOptions{CustomID: "old", Paste: &Paste{Text: "gone"}, ExpiresAt: &expired}); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve("GET", "/s/old", ""); rr.Code != http.StatusGone {
+		t.Errorf("expired paste = %d, want 410", rr.Code)
+	}
+
+	invalid := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", `{"text": ""}`, http.StatusBadRequest},
+		{"unknown language", `{"text": "x", "language": "cobol"}`, http.StatusBadRequest},
+		{"bad expiry", `{"text": "x", "expires_in": "soon"}`, http.StatusBadRequest},
+		{"taken ID", `{"text": "x", "custom_id": "snip"}`, http.StatusConflict},
+	}
+	for _, tt := range invalid {
+		if rr := serve("POST", "/sui/api/paste", tt.body); rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestPasteLinksSkipDestinationChecks(t *testing.T) {
+	srv := newTestServer(t)
+	// A paste has no destination to look up.
+	srv.threats = fakeThreats{"": "malware"}
+	if _, err := srv.createShortLink("", createOptions{CustomID: "note", Paste: &Paste{Text: "hello"}}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	if n, err := srv.scanLinks(context.Background()); err != nil || n != 0 {
+		t.Errorf("scanLinks() = %d, %v", n, err)
+	}
+	var b strings.Builder
+	links, _ := srv.getAllLinks(nil)
+	if skipped, _ := writeNginxMap(&b, "/s", links); len(skipped) != 1 || skipped[0] != "note" {
+		t.Errorf("nginx map skipped %v, want the paste", skipped)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	previewTimeout      = 10 * time.Second
+	previewMaxBody      = 1 << 20
+	previewMaxRedirects = 5
+	previewTextLength   = 1000
+	previewUserAgent    = "pk-shorts-preview/1.0"
+)
+
+var (
+	reTitle       = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	reMeta        = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	reMetaAttr    = regexp.MustCompile(`(?is)(name|property|content)\s*=\s*("[^"]*"|'[^']*')`)
+	reNonText     = regexp.MustCompile(`(?is)<(script|style|noscript|template|svg|iframe|object)[^>]*>.*?</(script|style|noscript|template|svg|iframe|object)>`)
+	reComment     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	reTag         = regexp.MustCompile(`(?s)<[^>]*>`)
+	reSpace       = regexp.MustCompile(`\s+`)
+	rePreviewForm = regexp.MustCompile(`(?is)<form[\s>]`)
+)
+
+// Preview is a sanitized, text-only summary of a link destination. Nothing
+// from the page is executed or rendered; scripts, styles and markup are
+// stripped before anything is returned.
+type Preview struct {
+	Short       string            `json:"short"`
+	Destination string            `json:"destination"`
+	FinalURL    string            `json:"final_url"`
+	Redirects   []string          `json:"redirects"`
+	Status      int               `json:"status"`
+	ContentType string            `json:"content_type"`
+	Title       string            `json:"title,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	HasForms    bool              `json:"has_forms"`
+	Truncated   bool              `json:"truncated"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// fetchPreview retrieves destination server-side and summarizes it. Fetch
+// failures are reported in Preview.Error rather than returned, since an
+// unreachable destination is itself useful information for a moderator.
+// The request goes through transport, normally externalTransport, so a
+// reported link can't make the server fetch internal addresses for the
+// moderator.
+func fetchPreview(destination string, transport http.RoundTripper) *Preview {
+	p := &Preview{Destination: destination, FinalURL: destination}
+
+	client := &http.Client{
+		Timeout:   previewTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > previewMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", previewMaxRedirects)
+			}
+			p.Redirects = append(p.Redirects, req.URL.String())
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", destination, nil)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	req.Header.Set("User-Agent", previewUserAgent)
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9,*/*;q=0.1")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	defer resp.Body.Close()
+
+	p.Status = resp.StatusCode
+	p.FinalURL = resp.Request.URL.String()
+	p.ContentType = resp.Header.Get("Content-Type")
+
+	if !strings.HasPrefix(p.ContentType, "text/") && !strings.Contains(p.ContentType, "html") {
+		// Binary downloads are described, never read.
+		return p
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, previewMaxBody+1))
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	if len(body) > previewMaxBody {
+		body = body[:previewMaxBody]
+		p.Truncated = true
+	}
+
+	summarizeHTML(p, string(body))
+	return p
+}
+
+// summarizeHTML fills in the title, interesting meta tags and visible text
+// of page.
+func summarizeHTML(p *Preview, page string) {
+	if m := reTitle.FindStringSubmatch(page); m != nil {
+		p.Title = cleanText(m[1])
+	}
+
+	for _, tag := range reMeta.FindAllString(page, -1) {
+		var key, content string
+		for _, attr := range reMetaAttr.FindAllStringSubmatch(tag, -1) {
+			value := strings.Trim(attr[2], `"'`)
+			switch strings.ToLower(attr[1]) {
+			case "name", "property":
+				key = strings.ToLower(value)
+			case "content":
+				content = value
+			}
+		}
+		switch key {
+		case "description", "og:title", "og:description", "og:site_name", "twitter:title", "twitter:description", "refresh":
+			if p.Meta == nil {
+				p.Meta = make(map[string]string)
+			}
+			p.Meta[key] = cleanText(content)
+		}
+	}
+
+	p.HasForms = rePreviewForm.MatchString(page)
+
+	text := reNonText.ReplaceAllString(page, " ")
+	text = reComment.ReplaceAllString(text, " ")
+	text = cleanText(reTag.ReplaceAllString(text, " "))
+	if len(text) > previewTextLength {
+		text = strings.ToValidUTF8(text[:previewTextLength], "") + "…"
+	}
+	p.Text = text
+}
+
+// cleanText decodes entities and collapses whitespace.
+func cleanText(s string) string {
+	return strings.TrimSpace(reSpace.ReplaceAllString(html.UnescapeString(s), " "))
+}
+
+// handleAdminPreview fetches a link's destination on behalf of a moderator
+// and returns a sanitized summary, so reported links can be assessed without
+// opening them in a browser.
+func (s *Server) handleAdminPreview(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+
+	link, err := s.getLink(short)
+	if err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	p := fetchPreview(link.Original, s.previewTransport)
+	p.Short = short
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
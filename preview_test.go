@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeHTML(t *testing.T) {
+	page := `<html><head><title> Win a &amp; Prize </title>
+<meta name="description" content="Totally legit">
+<meta property="og:title" content='Prize page'>
+<script>steal(document.cookie)</script><style>body{}</style></head>
+<body><!-- hidden --><h1>Enter your   password</h1><form action="/x"><input></form></body></html>`
+
+	p := &Preview{}
+	summarizeHTML(p, page)
+
+	if p.Title != "Win a & Prize" {
+		t.Errorf("Title = %q", p.Title)
+	}
+	if p.Meta["description"] != "Totally legit" || p.Meta["og:title"] != "Prize page" {
+		t.Errorf("Meta = %v", p.Meta)
+	}
+	if !p.HasForms {
+		t.Error("expected HasForms to be true")
+	}
+	if strings.Contains(p.Text, "steal") || strings.Contains(p.Text, "hidden") || strings.Contains(p.Text, "<") {
+		t.Errorf("Text was not sanitized: %q", p.Text)
+	}
+	if !strings.Contains(p.Text, "Enter your password") {
+		t.Errorf("Text = %q, want visible body text", p.Text)
+	}
+}
+
+func TestHandleAdminPreview(t *testing.T) {
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/landing", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Landing</title><p>Hello</p>"))
+	}))
+	defer dest.Close()
+
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink(dest.URL+"/start", createOptions{CustomID: "reported"}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	preview := func() Preview {
+		req := httptest.NewRequest("GET", srv.uiPrefix+"/api/admin/preview/reported", nil)
+		req.Header.Set("X-Admin-Token", "s3cret")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+		}
+		var p Preview
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return p
+	}
+
+	// The test destination listens on loopback, which previews refuse.
+	if p := preview(); !strings.Contains(p.Error, errInternalTarget.Error()) || p.Title != "" {
+		t.Errorf("preview of an internal address = %+v, want it refused", p)
+	}
+	srv.previewTransport = http.DefaultTransport
+
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", srv.uiPrefix+"/api/admin/preview/reported", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("status without token = %d, want 403", rr.Code)
+	}
+
+	if p := preview(); p.Title != "Landing" || p.Status != 200 || len(p.Redirects) != 1 || !strings.HasSuffix(p.FinalURL, "/landing") {
+		t.Errorf("unexpected preview: %+v", p)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// defaultTrustedProxies trusts reverse proxies on the same host only.
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+// parseTrustedProxies parses CIDR ranges; a bare address is a range of one.
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	return parseRanges("trusted proxy", entries)
+}
+
+// parseRanges parses CIDR ranges, or bare addresses as ranges of one;
+// kind names what they are in errors.
+func parseRanges(kind string, entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", kind, entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", kind, entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether addr is one of the trusted proxies.
+func (s *Server) isTrustedProxy(addr netip.Addr) bool {
+	return inRanges(s.trustedProxies, addr)
+}
+
+// remoteAddr returns the address of the peer the request came from.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// fromTrustedProxy reports whether the request was sent by a trusted proxy,
+// whose forwarding headers may then be believed.
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	addr, ok := remoteAddr(r)
+	return ok && s.isTrustedProxy(addr)
+}
+
+// clientIP returns the address of the client that made the request. When
+// the request comes through trusted proxies, X-Forwarded-For is walked from
+// the right, skipping the trusted hops, and the first untrusted address is
+// the client; anything further left could have been sent by the client
+// itself.
+func (s *Server) clientIP(r *http.Request) string {
+	addr, ok := remoteAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !s.isTrustedProxy(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed entry ends the chain we can trust.
+			break
+		}
+		addr = hop.Unmap()
+		if !s.isTrustedProxy(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// scheme returns the request scheme, so that links generated behind a
+// TLS-terminating proxy use https. X-Forwarded-Proto is honored only from
+// trusted proxies; otherwise the request's own TLS state decides.
+func (s *Server) scheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && s.fromTrustedProxy(r) {
+		// May be a comma-separated list (proto, proto); take the first.
+		if i := strings.IndexByte(proto, ','); i >= 0 {
+			proto = proto[:i]
+		}
+		return strings.TrimSpace(proto)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+)
+
+func newProxyTestServer(t *testing.T, proxies ...string) *Server {
+	t.Helper()
+	trusted, err := parseTrustedProxies(proxies)
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error: %v", err)
+	}
+	return &Server{trustedProxies: trusted}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		entries []string
+		want    []string
+		wantErr bool
+	}{
+		{[]string{"10.0.0.0/8", " 192.168.1.7 ", ""}, []string{"10.0.0.0/8", "192.168.1.7/32"}, false},
+		{[]string{"10.1.2.3/8"}, []string{"10.0.0.0/8"}, false},
+		{[]string{"fd00::/8", "::1"}, []string{"fd00::/8", "::1/128"}, false},
+		{[]string{"10.0.0.0/33"}, nil, true},
+		{[]string{"proxy.internal"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTrustedProxies(tt.entries)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTrustedProxies(%q) error = %v, wantErr %v", tt.entries, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseTrustedProxies(%q) = %v, want %v", tt.entries, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].String() != tt.want[i] {
+				t.Errorf("parseTrustedProxies(%q)[%d] = %s, want %s", tt.entries, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	srv := newProxyTestServer(t, "10.0.0.0/8", "::1")
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"untrusted peer ignores header", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entries left of the client", "10.0.0.2:4000", []string{"1.2.3.4, 198.51.100.1, 10.0.0.9"}, "198.51.100.1"},
+		{"multiple headers", "[::1]:4000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.2:4000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"malformed entry", "10.0.0.2:4000", []string{"198.51.100.1, bogus"}, "10.0.0.2"},
+		{"trusted proxy without header", "10.0.0.2:4000", nil, "10.0.0.2"},
+		{"mapped IPv4", "[::ffff:203.0.113.5]:4000", nil, "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := srv.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheme(t *testing.T) {
+	srv := newProxyTestServer(t, defaultTrustedProxies...)
+
+	tests := []struct {
+		name     string
+		remote   string
+		header   string
+		tls      bool
+		expected string
+	}{
+		{"forwarded https", "127.0.0.1:4000", "https", false, "https"},
+		{"forwarded http", "127.0.0.1:4000", "http", false, "http"},
+		{"forwarded list takes first", "127.0.0.1:4000", "https, http", false, "https"},
+		{"untrusted peer ignored", "203.0.113.5:4000", "https", false, "http"},
+		{"untrusted peer over tls", "203.0.113.5:4000", "http", true, "https"},
+		{"tls fallback", "127.0.0.1:4000", "", true, "https"},
+		{"plain fallback", "127.0.0.1:4000", "", false, "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.header != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.header)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := srv.scheme(r); got != tt.expected {
+				t.Errorf("scheme() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// handleManifest serves the web app manifest that makes the UI installable.
+// It registers the share page as a Web Share Target, so sharing a page to
+// the installed app shortens it.
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	brand := s.brand()
+	themeColor := "#667eea"
+	if brand.AccentColor != "" {
+		themeColor = brand.AccentColor
+	}
+	manifest := map[string]interface{}{
+		"name":             brand.Name,
+		"short_name":       "Shorts",
+		"description":      "Shorten links",
+		"start_url":        s.uiPrefix + "/",
+		"scope":            s.uiPrefix + "/",
+		"display":          "standalone",
+		"theme_color":      themeColor,
+		"background_color": "#ffffff",
+		"icons": []map[string]string{
+			{"src": s.uiPrefix + "/static/icon.svg", "sizes": "any", "type": "image/svg+xml", "purpose": "any maskable"},
+		},
+		"share_target": map[string]interface{}{
+			"action": s.uiPrefix + "/share",
+			"method": "GET",
+			"params": map[string]string{"title": "title", "text": "text", "url": "url"},
+		},
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// handleServiceWorker serves static/sw.js from the UI prefix rather than
+// under /static/, since a service worker only controls pages below its own
+// path.
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	s.reloadMu.RLock()
+	assets := s.assets
+	s.reloadMu.RUnlock()
+
+	data, err := fs.ReadFile(assets, "static/sw.js")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
+
+// sharedURL returns the link in what a Web Share Target received: the url
+// field, or else the first link in the text or title, where apps that
+// share a page with a caption often put it.
+func sharedURL(q url.Values) string {
+	if u := strings.TrimSpace(q.Get("url")); u != "" {
+		return u
+	}
+	for _, field := range []string{"text", "title"} {
+		for _, word := range strings.Fields(q.Get(field)) {
+			if strings.HasPrefix(word, "http://") || strings.HasPrefix(word, "https://") {
+				return word
+			}
+		}
+	}
+	return ""
+}
+
+// handleShare receives pages shared to the installed app and shortens them
+// with the quick page.
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	shared := sharedURL(r.URL.Query())
+	if shared == "" {
+		http.Error(w, "The shared item has no link", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/quick?url="+url.QueryEscape(shared), http.StatusSeeOther)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSharedURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+		want  string
+	}{
+		{"url field", url.Values{"url": {"https://example.com/a"}, "text": {"https://example.com/b"}}, "https://example.com/a"},
+		{"link in text", url.Values{"title": {"A page"}, "text": {"Look at this https://example.com/b"}}, "https://example.com/b"},
+		{"link in title", url.Values{"title": {"http://example.com/c"}}, "http://example.com/c"},
+		{"no link", url.Values{"text": {"just words"}}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := sharedURL(tt.query); got != tt.want {
+			t.Errorf("%s: sharedURL() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPWARoutes(t *testing.T) {
+	srv := newTestServer(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	rr := get("/sui/manifest.webmanifest")
+	var manifest struct {
+		StartURL    string `json:"start_url"`
+		ShareTarget struct {
+			Action string `json:"action"`
+		} `json:"share_target"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&manifest); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if manifest.StartURL != "/sui/" || manifest.ShareTarget.Action != "/sui/share" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	rr = get("/sui/sw.js")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/javascript") || !strings.Contains(rr.Body.String(), "addEventListener") {
+		t.Errorf("service worker = %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	rr = get("/sui/share?title=Hi&text=Read+https%3A%2F%2Fexample.com%2Fpost")
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/sui/quick?url=https%3A%2F%2Fexample.com%2Fpost" {
+		t.Errorf("share = %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := get("/sui/share?text=nothing"); rr.Code != http.StatusBadRequest {
+		t.Errorf("share without a link = %d, want 400", rr.Code)
+	}
+}
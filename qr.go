@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// defaultQRSize is the side of QR code PNGs in pixels unless ?size=
+	// asks for another one between minQRSize and maxQRSize.
+	defaultQRSize = 256
+	minQRSize     = 128
+	maxQRSize     = 2048
+)
+
+// qrSVG renders q as an SVG with one unit per module, so it scales to any
+// print size without blurring.
+func qrSVG(q *qrcode.QRCode) []byte {
+	bitmap := q.Bitmap()
+	n := len(bitmap)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return []byte(b.String())
+}
+
+// handleQR serves the QR code of a short link's public URL as
+// /qr/{short}.png or /qr/{short}.svg. ?size= sets the PNG size and
+// ?download=true asks the browser to save the file.
+func (s *Server) handleQR(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	short, format := vars["short"], vars["format"]
+	link, err := s.getLink(short)
+	if err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	size := defaultQRSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		if size, err = strconv.Atoi(v); err != nil || size < minQRSize || size > maxQRSize {
+			http.Error(w, fmt.Sprintf("Invalid size: use %d to %d pixels", minQRSize, maxQRSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	q, err := qrcode.New(s.shortURL(r, link.Domain, short), qrcode.Medium)
+	if err != nil {
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		requestLogger(r).Error("qr code error", "short", short, "err", err)
+		return
+	}
+	var body []byte
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		body = qrSVG(q)
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		if body, err = q.PNG(size); err != nil {
+			http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+			requestLogger(r).Error("qr code error", "short", short, "err", err)
+			return
+		}
+	}
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, short, format))
+	}
+	w.Write(body)
+}
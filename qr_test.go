@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleQR(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/poster", createOptions{CustomID: "poster"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantType    string
+		wantAttach  bool
+		wantPNGSize int
+	}{
+		{"/sui/qr/poster.png", http.StatusOK, "image/png", false, defaultQRSize},
+		{"/sui/qr/poster.png?size=1024&download=true", http.StatusOK, "image/png", true, 1024},
+		{"/sui/qr/poster.svg?download=true", http.StatusOK, "image/svg+xml", true, 0},
+		{"/sui/qr/poster.png?size=10", http.StatusBadRequest, "", false, 0},
+		{"/sui/qr/missing.png", http.StatusNotFound, "", false, 0},
+		{"/sui/qr/poster.gif", http.StatusNotFound, "", false, 0},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, rr.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+		if got := rr.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.path, got, tt.wantType)
+		}
+		if got := strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment"); got != tt.wantAttach {
+			t.Errorf("%s: attachment = %v, want %v", tt.path, got, tt.wantAttach)
+		}
+		if tt.wantPNGSize > 0 {
+			img, err := png.Decode(bytes.NewReader(rr.Body.Bytes()))
+			if err != nil || img.Bounds().Dx() != tt.wantPNGSize {
+				t.Errorf("%s: decoded PNG %v, %v", tt.path, img.Bounds(), err)
+			}
+		} else if !strings.HasPrefix(rr.Body.String(), "<svg") || !strings.Contains(rr.Body.String(), "h1v1h-1z") {
+			t.Errorf("%s: body is not an SVG QR code", tt.path)
+		}
+	}
+}
+
+func TestQRShownAfterCreate(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+	req := httptest.NewRequest("POST", "/sui/create", strings.NewReader("url=https://example.com&custom_id=flyer"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, `/sui/qr/flyer.png`) || !strings.Contains(body, `/sui/qr/flyer.svg?download=true`) {
+		t.Error("create result does not show the QR code with download links")
+	}
+
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/flyer/preview", nil))
+	if !strings.Contains(rr.Body.String(), `/sui/qr/flyer.png`) {
+		t.Error("preview page does not show the QR code")
+	}
+}
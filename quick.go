@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// quickReuseWindow is how many of the newest links findReusableLink looks
+// through, so /quick stays cheap on a large instance; a destination last
+// shortened before them just gets a new link.
+const quickReuseWindow = 1000
+
+// findReusableLink returns the newest link owner already has to
+// destination on domain that still redirects, or nil. Only the newest
+// quickReuseWindow links are considered.
+func (s *Server) findReusableLink(owner, destination, domain string) (*Link, error) {
+	var found *Link
+	err := s.db.View(func(tx *bolt.Tx) error {
+		scanned := 0
+		return walkCreatedIndex(tx, createdWalk{decode: true}, func(_ []byte, link *Link) bool {
+			if link.Owner == owner && link.Original == destination && link.Domain == domain && !link.inactive() {
+				found = link
+				return false
+			}
+			scanned++
+			return scanned < quickReuseWindow
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// handleQuick shortens ?url= for the logged-in user and shows the result,
+// reusing the user's existing link to the same destination. It is what the
+// bookmarklet on the home page opens, so it works with a plain GET.
+func (s *Server) handleQuick(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, s.uiPrefix+"/login", http.StatusSeeOther)
+		return
+	}
+	destination := r.URL.Query().Get("url")
+	if destination == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	destination = s.destinations.withDefaultScheme(destination)
+	domain := s.requestDomain(r)
+
+	link, err := s.findReusableLink(user.Username, destination, domain)
+	if err != nil {
+		http.Error(w, "Failed to look up links", http.StatusInternalServerError)
+		return
+	}
+	short := ""
+	if link != nil {
+		short = link.Short
+	} else {
+		// The maintenance middleware only stops writes that aren't GETs.
+		if m := s.maintenance(); m.Enabled {
+			w.Header().Set("Retry-After", "300")
+			http.Error(w, m.Message, http.StatusServiceUnavailable)
+			return
+		}
+		if short, err = s.createShortLink(destination, createOptions{Owner: user.Username, Domain: domain}); err != nil {
+			writeCreateError(w, err)
+			return
+		}
+	}
+
+	data := s.pageData(r)
+	data["Success"] = true
+	data["Reused"] = link != nil
+	data["ShortURL"] = s.shortURL(r, domain, short)
+	data["Original"] = destination
+	data["Short"] = short
+
+	if err := s.templates().ExecuteTemplate(w, "index.html", data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestHandleQuick(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+
+	get := func(cookie *http.Cookie, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/sui/quick"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get(nil, "?url=https://example.com/page"); rr.Code != http.StatusSeeOther {
+		t.Errorf("logged out status = %d, want 303", rr.Code)
+	}
+	if rr := get(alice, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("missing url status = %d, want 400", rr.Code)
+	}
+
+	rr := get(alice, "?url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Short URL Created") {
+		t.Fatalf("first quick = %d, want a created link", rr.Code)
+	}
+	links, _ := srv.getAllLinks(nil)
+	if len(links) != 1 || links[0].Owner != "alice" || links[0].Original != "https://example.com/page?a=1" {
+		t.Fatalf("links = %+v", links)
+	}
+
+	rr = get(alice, "?url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "already shortened") || !strings.Contains(rr.Body.String(), links[0].Short) {
+		t.Errorf("second quick = %d, want the existing link", rr.Code)
+	}
+	if links, _ := srv.getAllLinks(nil); len(links) != 1 {
+		t.Errorf("quick created %d links, want the first reused", len(links))
+	}
+
+	// Links that no longer redirect are not reused.
+	past := time.Now().Add(-time.Hour)
+	srv.updateLink(links[0].Short, func(link *Link) { link.ExpiresAt = &past })
+	get(alice, "?url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1")
+	if links, _ := srv.getAllLinks(nil); len(links) != 2 {
+		t.Errorf("got %d links, want a new one replacing the expired link", len(links))
+	}
+}
+
+func TestHomeShowsBookmarklet(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+
+	req := httptest.NewRequest("GET", "/sui/", nil)
+	req.AddCookie(alice)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), `data-bookmarklet="/sui/quick"`) {
+		t.Error("home page has no bookmarklet")
+	}
+}
+
+func TestFindReusableLinkWindow(t *testing.T) {
+	srv := newTestServer(t)
+	start := time.Now().Add(-time.Hour)
+	err := srv.db.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket([]byte(bucketName))
+		idx := tx.Bucket([]byte(createdIndexBucket))
+		for i := 0; i <= quickReuseWindow; i++ {
+			link := Link{Short: fmt.Sprintf("l%d", i), Original: fmt.Sprintf("https://example.com/%d", i), Owner: "alice", CreatedAt: start.Add(time.Duration(i) * time.Second)}
+			data, _ := json.Marshal(link)
+			if err := links.Put([]byte(link.Short), data); err != nil {
+				return err
+			}
+			if err := idx.Put(createdIndexKey(link.CreatedAt, link.Short), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if link, err := srv.findReusableLink("alice", "https://example.com/1", ""); err != nil || link == nil || link.Short != "l1" {
+		t.Errorf("findReusableLink() = %+v, %v, want l1", link, err)
+	}
+	if link, _ := srv.findReusableLink("bob", "https://example.com/1", ""); link != nil {
+		t.Errorf("found another user's link %s", link.Short)
+	}
+	// The oldest link is past the window.
+	if link, _ := srv.findReusableLink("alice", "https://example.com/0", ""); link != nil {
+		t.Errorf("found %s beyond the reuse window", link.Short)
+	}
+}
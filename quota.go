@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const quotaUsageBucket = "quota_usage"
+
+var (
+	errDailyQuota = errors.New("daily link quota exceeded")
+	errTotalQuota = errors.New("link quota exceeded")
+)
+
+// Quota limits how many links one owner (a user or an API key) may create.
+// Zero means unlimited.
+type Quota struct {
+	LinksPerDay int `json:"links_per_day" yaml:"links_per_day"`
+	TotalLinks  int `json:"total_links" yaml:"total_links"`
+}
+
+// quotaUsage is what an owner has used so far. Total counts links that still
+// exist; DayCount counts links created on Day (UTC), deleted or not.
+type quotaUsage struct {
+	Total    int    `json:"total"`
+	Day      string `json:"day"`
+	DayCount int    `json:"day_count"`
+}
+
+// parseQuotaLimit parses a non-negative limit; empty means 0 (unlimited).
+func parseQuotaLimit(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative number", value)
+	}
+	return n, nil
+}
+
+// quotaFor returns the quota applying to owner: its override if one is set,
+// otherwise the default.
+func (settings Settings) quotaFor(owner string) Quota {
+	if q, ok := settings.QuotaOverrides[owner]; ok {
+		return q
+	}
+	return settings.Quota
+}
+
+// parseQuotaOverrides parses one "owner=per_day/total" entry per line, e.g.
+// "key:billing=1000/0" or "alice=10/100".
+func parseQuotaOverrides(lines []string) (map[string]Quota, error) {
+	overrides := make(map[string]Quota)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		owner, limits, ok := strings.Cut(line, "=")
+		perDay, total, ok2 := strings.Cut(limits, "/")
+		owner = strings.TrimSpace(owner)
+		if !ok || !ok2 || owner == "" {
+			return nil, fmt.Errorf("invalid quota override %q, want owner=per_day/total", line)
+		}
+		d, err1 := parseQuotaLimit(perDay)
+		t, err2 := parseQuotaLimit(total)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid quota override %q, limits must be non-negative numbers", line)
+		}
+		overrides[owner] = Quota{LinksPerDay: d, TotalLinks: t}
+	}
+	return overrides, nil
+}
+
+// formatQuotaOverrides renders overrides back into parseQuotaOverrides
+// input, sorted by owner.
+func formatQuotaOverrides(overrides map[string]Quota) string {
+	var lines []string
+	for owner, q := range overrides {
+		lines = append(lines, fmt.Sprintf("%s=%d/%d", owner, q.LinksPerDay, q.TotalLinks))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func getQuotaUsage(tx *bolt.Tx, owner string) quotaUsage {
+	var usage quotaUsage
+	if data := tx.Bucket([]byte(quotaUsageBucket)).Get([]byte(owner)); data != nil {
+		json.Unmarshal(data, &usage)
+	}
+	return usage
+}
+
+func putQuotaUsage(tx *bolt.Tx, owner string, usage quotaUsage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(quotaUsageBucket)).Put([]byte(owner), data)
+}
+
+// chargeQuota counts a new link against owner's quota, or returns
+// errTotalQuota/errDailyQuota when the quota is used up. Anonymous links
+// (empty owner) are not counted.
+func chargeQuota(tx *bolt.Tx, owner string, quota Quota, now time.Time) error {
+	if owner == "" {
+		return nil
+	}
+
+	usage := getQuotaUsage(tx, owner)
+	if day := now.UTC().Format(dayKeyLayout); usage.Day != day {
+		usage.Day, usage.DayCount = day, 0
+	}
+
+	if quota.TotalLinks > 0 && usage.Total >= quota.TotalLinks {
+		return fmt.Errorf("%w: limit is %d links", errTotalQuota, quota.TotalLinks)
+	}
+	if quota.LinksPerDay > 0 && usage.DayCount >= quota.LinksPerDay {
+		return fmt.Errorf("%w: limit is %d links per day", errDailyQuota, quota.LinksPerDay)
+	}
+
+	usage.Total++
+	usage.DayCount++
+	return putQuotaUsage(tx, owner, usage)
+}
+
+// releaseQuota frees one link of owner's total quota after a deletion. The
+// daily count is kept, so deleting doesn't allow creating more per day.
+func releaseQuota(tx *bolt.Tx, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	usage := getQuotaUsage(tx, owner)
+	if usage.Total == 0 {
+		return nil
+	}
+	usage.Total--
+	return putQuotaUsage(tx, owner, usage)
+}
+
+// backfillQuotaUsage counts the existing links of every owner, including
+// those created today.
+func backfillQuotaUsage(tx *bolt.Tx) error {
+	today := time.Now().UTC().Format(dayKeyLayout)
+	usage := make(map[string]quotaUsage)
+
+	err := tx.Bucket([]byte(bucketName)).ForEach(func(k, v []byte) error {
+		var link Link
+		if err := json.Unmarshal(v, &link); err != nil {
+			return err
+		}
+		if link.Owner == "" {
+			return nil
+		}
+		u := usage[link.Owner]
+		u.Total++
+		u.Day = today
+		if link.CreatedAt.UTC().Format(dayKeyLayout) == today {
+			u.DayCount++
+		}
+		usage[link.Owner] = u
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for owner, u := range usage {
+		if err := putQuotaUsage(tx, owner, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secondsUntilNextDay is the Retry-After value for errDailyQuota.
+func secondsUntilNextDay(now time.Time) int {
+	now = now.UTC()
+	next := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return int(next.Sub(now).Seconds()) + 1
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseQuotaOverrides(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      map[string]Quota
+		shouldErr bool
+	}{
+		{"", map[string]Quota{}, false},
+		{"alice=10/100\n key:billing = 0/0 ", map[string]Quota{
+			"alice":       {LinksPerDay: 10, TotalLinks: 100},
+			"key:billing": {},
+		}, false},
+		{"alice=10", nil, true},
+		{"=1/2", nil, true},
+		{"alice=-1/2", nil, true},
+		{"alice=x/2", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseQuotaOverrides(strings.Split(tt.input, "\n"))
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("parseQuotaOverrides(%q) error = %v, shouldErr %v", tt.input, err, tt.shouldErr)
+			continue
+		}
+		if tt.shouldErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseQuotaOverrides(%q) = %v, want %v", tt.input, got, tt.want)
+			continue
+		}
+		for owner, q := range tt.want {
+			if got[owner] != q {
+				t.Errorf("parseQuotaOverrides(%q)[%q] = %+v, want %+v", tt.input, owner, got[owner], q)
+			}
+		}
+	}
+
+	overrides := map[string]Quota{"bob": {1, 2}, "alice": {3, 4}}
+	if got := formatQuotaOverrides(overrides); got != "alice=3/4\nbob=1/2" {
+		t.Errorf("formatQuotaOverrides() = %q", got)
+	}
+}
+
+func TestSecondsUntilNextDay(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	if got := secondsUntilNextDay(now); got != 61 {
+		t.Errorf("secondsUntilNextDay() = %d, want 61", got)
+	}
+}
+
+func TestQuotasAreEnforced(t *testing.T) {
+	srv := newTestServer(t)
+	settings := srv.getSettings()
+	settings.Quota = Quota{TotalLinks: 2}
+	settings.QuotaOverrides = map[string]Quota{"bob": {LinksPerDay: 1}}
+	if err := srv.saveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := createOptions{Owner: "alice"}
+	first, err := srv.createShortLink("https://example.com/1", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/2", alice); err != nil {
+		t.Fatal(err)
+	}
+	_, err = srv.createShortLink("https://example.com/3", alice)
+	if createErrorStatus(err) != http.StatusForbidden {
+		t.Fatalf("over total quota error = %v, want 403", err)
+	}
+
+	// Deleting a link frees its slot.
+	if err := srv.deleteLink(first, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/3", alice); err != nil {
+		t.Errorf("create after delete error: %v", err)
+	}
+
+	// The override replaces the default quota.
+	bob := createOptions{Owner: "bob"}
+	if _, err := srv.createShortLink("https://example.com/bob", bob); err != nil {
+		t.Fatal(err)
+	}
+	_, err = srv.createShortLink("https://example.com/bob", bob)
+	if createErrorStatus(err) != http.StatusTooManyRequests {
+		t.Errorf("over daily quota error = %v, want 429", err)
+	}
+
+	// Anonymous links are not counted.
+	for i := 0; i < 3; i++ {
+		if _, err := srv.createShortLink("https://example.com/anon", createOptions{}); err != nil {
+			t.Fatalf("anonymous create error: %v", err)
+		}
+	}
+}
+
+func TestAPICreateQuotaResponse(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+	settings := srv.getSettings()
+	settings.Quota = Quota{LinksPerDay: 1}
+	if err := srv.saveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/api/create", strings.NewReader(`{"url":"https://example.com"}`))
+		req.Header.Set("X-API-Key", "k1")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := create(); rr.Code != http.StatusOK {
+		t.Fatalf("first create status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	rr := create()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second create status = %d, want 429", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("429 response should set Retry-After")
+	}
+}
+
+func TestBackfillQuotaUsage(t *testing.T) {
+	srv := newTestServer(t)
+	for _, owner := range []string{"alice", "alice", "key:crm", ""} {
+		if _, err := srv.createShortLink("https://example.com", createOptions{Owner: owner}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var usage quotaUsage
+	err := srv.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(quotaUsageBucket)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(quotaUsageBucket)); err != nil {
+			return err
+		}
+		if err := backfillQuotaUsage(tx); err != nil {
+			return err
+		}
+		usage = getQuotaUsage(tx, "alice")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 2 || usage.DayCount != 2 {
+		t.Errorf("backfilled usage = %+v, want 2 total and 2 today", usage)
+	}
+}
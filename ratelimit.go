@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig limits how fast a single client IP can create links.
+type RateLimitConfig struct {
+	// CreatesPerMinute is the sustained rate; 0 disables the limit.
+	CreatesPerMinute int `yaml:"creates_per_minute"`
+	// Burst is how many links can be created back to back before the
+	// rate applies. It defaults to CreatesPerMinute.
+	Burst int `yaml:"burst"`
+}
+
+// rateLimiter is a token bucket per client key.
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for c, or nil when c disables limiting.
+func newRateLimiter(c RateLimitConfig) *rateLimiter {
+	if c.CreatesPerMinute <= 0 {
+		return nil
+	}
+	burst := c.Burst
+	if burst <= 0 {
+		burst = c.CreatesPerMinute
+	}
+	return &rateLimiter{
+		rate:    float64(c.CreatesPerMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of key. When none is left it
+// returns false and how long until the next one.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops, at most once a minute, the buckets that have refilled
+// completely, so memory stays bounded by the clients active recently.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitCreate guards a handler that writes on behalf of anonymous clients,
+// link creation and abuse reports: banned client IPs get 403, and clients
+// over the creation rate 429. Admins and system API keys, which are
+// trusted integrations, are exempt.
+func (s *Server) limitCreate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.isAdmin(r) {
+			next(w, r)
+			return
+		}
+		ip := s.clientIP(r)
+		if addr, err := netip.ParseAddr(ip); err == nil && s.isBanned(addr) {
+			http.Error(w, "Requests from your network are not allowed", http.StatusForbidden)
+			return
+		}
+		if s.createLimiter != nil {
+			if cred, _ := s.requestCredential(r); cred == nil || cred.System == "" {
+				if ok, wait := s.createLimiter.allow(ip, time.Now()); !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+					return
+				}
+			}
+		}
+		next(w, r)
+	}
+}
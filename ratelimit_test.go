@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(RateLimitConfig{}) != nil {
+		t.Fatal("a zero rate should disable the limiter")
+	}
+
+	l := newRateLimiter(RateLimitConfig{CreatesPerMinute: 6, Burst: 2})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.allow("a", now)
+	if ok || wait <= 0 || wait > 10*time.Second {
+		t.Errorf("allow() over the burst = %v, %v; want refused with a wait up to 10s", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another client shares the bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(10*time.Second)); !ok {
+		t.Error("the bucket did not refill")
+	}
+
+	l.allow("b", now.Add(2*time.Minute))
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("a refilled bucket was not swept")
+	}
+}
+
+func TestCreateRateLimit(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+	srv.createLimiter = newRateLimiter(RateLimitConfig{CreatesPerMinute: 1})
+
+	create := func(remote, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/sui/api/create", strings.NewReader(`{"url": "https://example.com"}`))
+		req.RemoteAddr = remote
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := create("198.51.100.1:1234", ""); rr.Code != http.StatusOK {
+		t.Fatalf("first create status = %d", rr.Code)
+	}
+	rr := create("198.51.100.1:1234", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("second create status = %d, Retry-After %q; want 429 with Retry-After", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := create("198.51.100.2:1234", ""); rr.Code != http.StatusOK {
+		t.Errorf("create from another IP status = %d", rr.Code)
+	}
+	if rr := create("198.51.100.1:1234", "k1"); rr.Code != http.StatusOK {
+		t.Errorf("create with a system API key status = %d, want exempt", rr.Code)
+	}
+}
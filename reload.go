@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"sort"
+)
+
+// templates returns the current HTML templates.
+func (s *Server) templates() *template.Template {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	return s.tmpl
+}
+
+// staticAPIKey looks up a key from the configuration and returns its
+// system name.
+func (s *Server) staticAPIKey(secret string) (string, bool) {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	name, ok := s.apiKeys[secret]
+	return name, ok
+}
+
+// staticAPIKeyNames returns the sorted system names of the configured keys.
+func (s *Server) staticAPIKeyNames() []string {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	var names []string
+	for _, name := range s.apiKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reservations returns the reserved short code prefixes.
+func (s *Server) reservations() []reservedPrefix {
+	s.reloadMu.RLock()
+	defer s.reloadMu.RUnlock()
+	return s.reserved
+}
+
+// reload applies cfg to a running server, as done on SIGHUP: templates are
+// parsed again (from a possibly changed UI directory), static API keys and
+// reserved prefixes replaced, and the settings defaults for reserved words
+// and blocked domains refreshed. Settings saved from the admin panel still
+// take precedence. Everything is validated first, so a broken template or
+// config keeps the server on its previous state. Options such as the port,
+// prefixes and database path need a restart.
+func (s *Server) reload(cfg *Config) error {
+	assets := uiAssets(cfg.UIDir)
+	tmpl, err := parseTemplates(assets)
+	if err != nil {
+		return err
+	}
+	apiKeys, err := cfg.apiKeyMap()
+	if err != nil {
+		return err
+	}
+	reserved, err := cfg.reservedPrefixes()
+	if err != nil {
+		return err
+	}
+	branding, err := parseBranding(cfg.Branding)
+	if err != nil {
+		return err
+	}
+	settings, err := loadSettings(s.db, cfg)
+	if err != nil {
+		return err
+	}
+
+	s.reloadMu.Lock()
+	s.assets = assets
+	s.tmpl = tmpl
+	s.apiKeys = apiKeys
+	s.reserved = reserved
+	s.branding = branding
+	s.reloadMu.Unlock()
+
+	s.settingsMu.Lock()
+	s.settings = settings
+	s.settingsMu.Unlock()
+
+	slog.Info("configuration reloaded", "api_keys", len(apiKeys), "reserved_prefixes", len(reserved))
+	return nil
+}
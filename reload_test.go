@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+
+	cfg := testConfig(t)
+	cfg.Auth.APIKeys = []APIKeyConfig{{Name: "billing", Key: "k2"}}
+	cfg.ReservedPrefixes = []ReservedPrefixConfig{{Prefix: "bill-", Systems: []string{"billing"}}}
+	cfg.BlockedDomains = []string{"evil.example"}
+	if err := srv.reload(cfg); err != nil {
+		t.Fatalf("reload() error: %v", err)
+	}
+
+	if _, ok := srv.staticAPIKey("k1"); ok {
+		t.Error("removed API key still accepted")
+	}
+	if name, ok := srv.staticAPIKey("k2"); !ok || name != "billing" {
+		t.Errorf("staticAPIKey(k2) = %q, %v; want billing", name, ok)
+	}
+	if err := srv.checkReserved("bill-1", ""); err == nil {
+		t.Error("reloaded reserved prefix not enforced")
+	}
+	if err := srv.checkBlockedDomain("https://evil.example/x"); err == nil {
+		t.Error("reloaded blocked domain not enforced")
+	}
+
+	bad := testConfig(t)
+	bad.ReservedPrefixes = []ReservedPrefixConfig{{Prefix: " "}}
+	if err := srv.reload(bad); err == nil {
+		t.Fatal("expected an error for an invalid config")
+	}
+	if _, ok := srv.staticAPIKey("k2"); !ok {
+		t.Error("a failed reload should keep the previous configuration")
+	}
+}
+
+func TestReloadKeepsSavedSettings(t *testing.T) {
+	srv := newTestServer(t)
+	settings := srv.getSettings()
+	settings.BlockedDomains = []string{"saved.example"}
+	if err := srv.saveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t)
+	cfg.BlockedDomains = []string{"file.example"}
+	if err := srv.reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.getSettings().BlockedDomains; len(got) != 1 || got[0] != "saved.example" {
+		t.Errorf("blocked domains after reload = %q, want the saved ones", got)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// maxReportReason caps the length of a single report's reason, and
+	// maxReportReasons how many reasons a link keeps.
+	maxReportReason  = 500
+	maxReportReasons = 20
+)
+
+// errLinkReported is returned, together with the destination, when
+// resolving a link reported as abusive that no admin has reviewed yet.
+var errLinkReported = errors.New("link is reported")
+
+// LinkReport collects the abuse reports of a link until an admin reviews
+// them.
+type LinkReport struct {
+	Count int `json:"count"`
+	// Reasons holds the most recent non-empty reasons.
+	Reasons []string  `json:"reasons,omitempty"`
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// updateLink applies fn to the stored link short and drops its cached
+// target.
+func (s *Server) updateLink(short string, fn func(*Link)) error {
+	var domain string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		data := b.Get([]byte(short))
+		if data == nil {
+			return fmt.Errorf("link not found")
+		}
+		var link Link
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		domain = link.Domain
+		fn(&link)
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(short), data)
+	})
+	s.forgetLink(domain, short)
+	s.linksChanged()
+	return err
+}
+
+// reportLink records an abuse report of short with an optional reason.
+func (s *Server) reportLink(short, reason string, now time.Time) error {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxReportReason {
+		reason = reason[:maxReportReason]
+	}
+	return s.updateLink(short, func(link *Link) {
+		if link.Reported == nil {
+			link.Reported = &LinkReport{FirstAt: now}
+		}
+		link.Reported.Count++
+		link.Reported.LastAt = now
+		if reason != "" {
+			link.Reported.Reasons = append(link.Reported.Reasons, reason)
+			if n := len(link.Reported.Reasons); n > maxReportReasons {
+				link.Reported.Reasons = link.Reported.Reasons[n-maxReportReasons:]
+			}
+		}
+	})
+}
+
+// handlePreview shows where a short link leads without following it, with
+// a form to report it.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	url, err := s.getOriginalURL(s.requestDomain(r), short)
+	if err != nil && !errors.Is(err, errLinkReported) {
+		s.renderLinkError(w, r, short, err)
+		return
+	}
+	// A paste previews itself.
+	if url == "" {
+		s.servePaste(w, r, short, false)
+		return
+	}
+	kind := interstitialPreview
+	if errors.Is(err, errLinkReported) {
+		kind = interstitialReported
+	}
+	s.renderInterstitial(w, r, kind, short, url)
+}
+
+// handleReport records an abuse report. JSON requests send {"reason": ...}
+// and get 202; the interstitial's form gets a thank-you page.
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	link, err := s.getLink(short)
+	if err != nil || link.Domain != s.requestDomain(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	asJSON := false
+	var reason string
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/json" {
+		asJSON = true
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+		reason = req.Reason
+	} else {
+		if err := r.ParseForm(); err != nil {
+			writeBodyError(w, err, "Invalid form")
+			return
+		}
+		reason = r.PostFormValue("reason")
+	}
+
+	if err := s.reportLink(short, reason, time.Now()); err != nil {
+		http.Error(w, "Failed to report link", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Warn("link reported", "short", short, "ip", s.clientIP(r))
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "reported"})
+		return
+	}
+	s.renderInterstitial(w, r, interstitialReportSent, short, link.Original)
+}
+
+// handleAdminReview resolves the reports of a link: "dismiss" clears them
+// so the link redirects directly again, "disable" stops it redirecting
+// like a link flagged by the threat list.
+func (s *Server) handleAdminReview(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	action := r.FormValue("action")
+	var fn func(*Link)
+	switch action {
+	case "dismiss":
+		fn = func(link *Link) { link.Reported = nil }
+	case "disable":
+		fn = func(link *Link) {
+			link.Reported = nil
+			link.Flagged = &LinkFlag{Threat: "abuse report", Source: "admin", At: time.Now()}
+		}
+	default:
+		http.Error(w, "Unknown review action", http.StatusBadRequest)
+		return
+	}
+	if err := s.updateLink(short, fn); err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	requestLogger(r).Info("link reports reviewed", "short", short, "action", action)
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportLink(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/offer", createOptions{CustomID: "offer"}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+	if rr := get("/s/offer"); rr.Code != http.StatusFound {
+		t.Fatalf("redirect status = %d, want 302", rr.Code)
+	}
+
+	rr := get("/s/offer/preview")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "https://example.com/offer") || strings.Contains(rr.Body.String(), "reported as abusive") {
+		t.Fatalf("preview = %d %q", rr.Code, rr.Body.String())
+	}
+
+	req := httptest.NewRequest("POST", "/s/offer/report", strings.NewReader(`{"reason": "phishing"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("report status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The cached target must not bypass the warning.
+	rr = get("/s/offer")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "reported as abusive") {
+		t.Fatalf("redirect of reported link = %d, want the warning page", rr.Code)
+	}
+
+	form := url.Values{"reason": {strings.Repeat("x", maxReportReason+100)}}
+	req = httptest.NewRequest("POST", "/s/offer/report", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Thank you") {
+		t.Fatalf("form report = %d", rr.Code)
+	}
+	link, _ := srv.getLink("offer")
+	if link.Reported == nil || link.Reported.Count != 2 || len(link.Reported.Reasons) != 2 || len(link.Reported.Reasons[1]) != maxReportReason {
+		t.Fatalf("Reported = %+v", link.Reported)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("POST", "/s/missing/report", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("report of missing link = %d, want 404", rr.Code)
+	}
+
+	adminCookie := loginAs(t, srv, "root")
+	req = httptest.NewRequest("GET", srv.uiPrefix+"/admin", nil)
+	req.AddCookie(adminCookie)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "phishing") {
+		t.Error("admin panel does not list the report")
+	}
+
+	review := func(action string) int {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/admin/links/offer/review", strings.NewReader("action="+action))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(adminCookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := review("ignore"); code != http.StatusBadRequest {
+		t.Errorf("unknown action = %d, want 400", code)
+	}
+	if code := review("dismiss"); code != http.StatusSeeOther {
+		t.Fatalf("dismiss = %d", code)
+	}
+	if rr := get("/s/offer"); rr.Code != http.StatusFound {
+		t.Errorf("redirect after dismiss = %d, want 302", rr.Code)
+	}
+
+	if err := srv.reportLink("offer", "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if code := review("disable"); code != http.StatusSeeOther {
+		t.Fatalf("disable = %d", code)
+	}
+	if rr := get("/s/offer"); rr.Code != http.StatusGone {
+		t.Errorf("redirect after disable = %d, want 410", rr.Code)
+	}
+}
+
+func TestReportRateLimit(t *testing.T) {
+	t.Setenv("CREATE_RATE_LIMIT", "1")
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/", createOptions{CustomID: "exa"}); err != nil {
+		t.Fatal(err)
+	}
+	codes := make([]int, 2)
+	for i := range codes {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("POST", "/s/exa/report", nil))
+		codes[i] = rr.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("report statuses = %v, want [200 429]", codes)
+	}
+}
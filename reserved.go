@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// errReservedPrefix is returned when a custom ID falls inside a namespace
+// reserved for other systems.
+var errReservedPrefix = errors.New("short code prefix is reserved")
+
+// reservedPrefix reserves every short code starting with prefix for the
+// listed API key names.
+type reservedPrefix struct {
+	prefix  string
+	systems []string
+}
+
+// parseAPIKeys parses API_KEYS, a comma-separated list of name:key pairs,
+// into a map from key to system name.
+func parseAPIKeys(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key entry %q: expected name:key", entry)
+		}
+		keys[key] = name
+	}
+	return keys, nil
+}
+
+// parseReservedPrefixes parses RESERVED_PREFIXES, a comma-separated list of
+// prefix=system1|system2 entries. A prefix listed without systems blocks
+// custom IDs in that namespace for every caller.
+func parseReservedPrefixes(value string) ([]reservedPrefix, error) {
+	var reserved []reservedPrefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, systems, _ := strings.Cut(entry, "=")
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			return nil, fmt.Errorf("invalid reserved prefix entry %q: empty prefix", entry)
+		}
+		rp := reservedPrefix{prefix: strings.ToLower(prefix)}
+		for _, sys := range strings.Split(systems, "|") {
+			if sys = strings.TrimSpace(sys); sys != "" {
+				rp.systems = append(rp.systems, sys)
+			}
+		}
+		reserved = append(reserved, rp)
+	}
+	return reserved, nil
+}
+
+// reservedFor returns the reservation covering id, if any. Matching is
+// case-insensitive so "SYS-1" cannot sneak into a "sys-" namespace.
+func (s *Server) reservedFor(id string) (reservedPrefix, bool) {
+	lower := strings.ToLower(id)
+	for _, rp := range s.reservations() {
+		if strings.HasPrefix(lower, rp.prefix) {
+			return rp, true
+		}
+	}
+	return reservedPrefix{}, false
+}
+
+// checkReserved rejects id if it falls in a reserved namespace that the
+// calling system is not allowed to use.
+func (s *Server) checkReserved(id, system string) error {
+	rp, ok := s.reservedFor(id)
+	if !ok {
+		return nil
+	}
+	for _, allowed := range rp.systems {
+		if system != "" && system == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q is reserved for other systems", errReservedPrefix, rp.prefix)
+}
+
+// apiKeySystem resolves the API key sent with the request to its system
+// name. It returns "" when no key or a personal token is sent, and ok=false
+// when an unknown key is sent.
+func (s *Server) apiKeySystem(r *http.Request) (string, bool) {
+	cred, ok := s.requestCredential(r)
+	if cred == nil {
+		return "", ok
+	}
+	return cred.System, true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys("billing:k1, crm:k2,")
+	if err != nil {
+		t.Fatalf("parseAPIKeys() error: %v", err)
+	}
+	if keys["k1"] != "billing" || keys["k2"] != "crm" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	if _, err := parseAPIKeys("billing"); err == nil {
+		t.Error("expected error for entry without key")
+	}
+}
+
+func TestCheckReserved(t *testing.T) {
+	reserved, err := parseReservedPrefixes("sys-=billing|crm, tmp-")
+	if err != nil {
+		t.Fatalf("parseReservedPrefixes() error: %v", err)
+	}
+	srv := &Server{reserved: reserved}
+
+	tests := []struct {
+		id        string
+		system    string
+		shouldErr bool
+	}{
+		{"my-link", "", false},
+		{"sys-123", "billing", false},
+		{"sys-123", "crm", false},
+		{"SYS-123", "", true},
+		{"sys-123", "other", true},
+		{"tmp-file", "billing", true},
+	}
+
+	for _, tt := range tests {
+		err := srv.checkReserved(tt.id, tt.system)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("checkReserved(%q, %q) error = %v, shouldErr %v", tt.id, tt.system, err, tt.shouldErr)
+		}
+		if err != nil && !errors.Is(err, errReservedPrefix) {
+			t.Errorf("checkReserved(%q, %q) error should wrap errReservedPrefix", tt.id, tt.system)
+		}
+	}
+}
+
+func TestAPIKeySystem(t *testing.T) {
+	t.Setenv("API_KEYS", "billing:secret")
+	srv := newTestServer(t)
+	managed, _, err := srv.createAPIKey("crm", "", nil)
+	if err != nil {
+		t.Fatalf("createAPIKey() error: %v", err)
+	}
+
+	tests := []struct {
+		header string
+		value  string
+		system string
+		ok     bool
+	}{
+		{"", "", "", true},
+		{"X-API-Key", "secret", "billing", true},
+		{"Authorization", "Bearer secret", "billing", true},
+		{"X-API-Key", managed, "crm", true},
+		{"X-API-Key", "wrong", "", false},
+	}
+
+	for _, tt := range tests {
+		r, _ := http.NewRequest("POST", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		system, ok := srv.apiKeySystem(r)
+		if system != tt.system || ok != tt.ok {
+			t.Errorf("apiKeySystem(%s: %q) = (%q, %v), want (%q, %v)", tt.header, tt.value, system, ok, tt.system, tt.ok)
+		}
+	}
+}
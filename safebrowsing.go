@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	googleSafeBrowsingURL = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+	urlhausURL            = "https://urlhaus-api.abuse.ch/v1/url/"
+
+	// googleBatchSize is the most URLs the Lookup API takes per request.
+	googleBatchSize = 500
+
+	threatCheckTimeout    = 5 * time.Second
+	defaultRescanInterval = 24 * time.Hour
+)
+
+var (
+	// errUnsafeURL is returned when a threat list flags a new destination.
+	errUnsafeURL = errors.New("destination is flagged as unsafe")
+	// errLinkDisabled is returned when resolving a flagged link.
+	errLinkDisabled = errors.New("link is disabled")
+)
+
+// SafeBrowsingConfig enables checking destinations against a threat list,
+// both when links are created and periodically for existing links.
+type SafeBrowsingConfig struct {
+	// Provider is "google" for Google Safe Browsing, "urlhaus" for
+	// abuse.ch URLhaus, or empty to disable the checks.
+	Provider string `yaml:"provider"`
+	APIKey   string `yaml:"api_key"`
+	// Endpoint overrides the provider's API URL, e.g. for a proxy.
+	Endpoint string `yaml:"endpoint"`
+	// RescanInterval is how often existing links are checked again; 0
+	// disables the rescan.
+	RescanInterval time.Duration `yaml:"rescan_interval"`
+}
+
+// LinkFlag records why a link was disabled.
+type LinkFlag struct {
+	Threat string    `json:"threat"`
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+}
+
+// threatChecker looks up URLs in a threat list.
+type threatChecker interface {
+	// Check returns the threat type of every URL in urls that is listed.
+	Check(ctx context.Context, urls []string) (map[string]string, error)
+	Name() string
+}
+
+// newThreatChecker returns the checker configured by c, or nil when none
+// is.
+func newThreatChecker(c SafeBrowsingConfig) (threatChecker, error) {
+	client := &http.Client{Timeout: threatCheckTimeout}
+	switch strings.ToLower(c.Provider) {
+	case "":
+		return nil, nil
+	case "google":
+		if c.APIKey == "" {
+			return nil, errors.New("google safe browsing needs an API key")
+		}
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = googleSafeBrowsingURL
+		}
+		return &googleSafeBrowsing{endpoint: endpoint, key: c.APIKey, client: client}, nil
+	case "urlhaus":
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = urlhausURL
+		}
+		return &urlhausChecker{endpoint: endpoint, key: c.APIKey, client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown safe browsing provider %q: use google or urlhaus", c.Provider)
+}
+
+// googleSafeBrowsing uses the Google Safe Browsing v4 Lookup API.
+type googleSafeBrowsing struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+func (g *googleSafeBrowsing) Name() string { return "google" }
+
+func (g *googleSafeBrowsing) Check(ctx context.Context, urls []string) (map[string]string, error) {
+	flagged := make(map[string]string)
+	for start := 0; start < len(urls); start += googleBatchSize {
+		end := min(start+googleBatchSize, len(urls))
+		if err := g.lookup(ctx, urls[start:end], flagged); err != nil {
+			return nil, err
+		}
+	}
+	return flagged, nil
+}
+
+func (g *googleSafeBrowsing) lookup(ctx context.Context, urls []string, flagged map[string]string) error {
+	type entry struct {
+		URL string `json:"url"`
+	}
+	var req struct {
+		Client struct {
+			ClientID      string `json:"clientId"`
+			ClientVersion string `json:"clientVersion"`
+		} `json:"client"`
+		ThreatInfo struct {
+			ThreatTypes      []string `json:"threatTypes"`
+			PlatformTypes    []string `json:"platformTypes"`
+			ThreatEntryTypes []string `json:"threatEntryTypes"`
+			ThreatEntries    []entry  `json:"threatEntries"`
+		} `json:"threatInfo"`
+	}
+	req.Client.ClientID = "pk-shorts"
+	req.Client.ClientVersion = version
+	req.ThreatInfo.ThreatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+	req.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	req.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, u := range urls {
+		req.ThreatInfo.ThreatEntries = append(req.ThreatInfo.ThreatEntries, entry{URL: u})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", g.endpoint+"?key="+url.QueryEscape(g.key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+			Threat     entry  `json:"threat"`
+		} `json:"matches"`
+	}
+	if err := doThreatRequest(g.client, httpReq, &resp); err != nil {
+		return err
+	}
+	for _, m := range resp.Matches {
+		flagged[m.Threat.URL] = strings.ToLower(m.ThreatType)
+	}
+	return nil
+}
+
+// urlhausChecker uses the URLhaus URL lookup, one URL per request.
+type urlhausChecker struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+func (u *urlhausChecker) Name() string { return "urlhaus" }
+
+func (u *urlhausChecker) Check(ctx context.Context, urls []string) (map[string]string, error) {
+	flagged := make(map[string]string)
+	for _, target := range urls {
+		form := url.Values{"url": {target}}
+		req, err := http.NewRequestWithContext(ctx, "POST", u.endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if u.key != "" {
+			req.Header.Set("Auth-Key", u.key)
+		}
+
+		var resp struct {
+			QueryStatus string `json:"query_status"`
+			Threat      string `json:"threat"`
+			URLStatus   string `json:"url_status"`
+		}
+		if err := doThreatRequest(u.client, req, &resp); err != nil {
+			return nil, err
+		}
+		switch resp.QueryStatus {
+		case "ok":
+			// Taken-down URLs stay in the database as "offline".
+			if resp.URLStatus != "offline" {
+				flagged[target] = resp.Threat
+			}
+		case "no_results":
+		default:
+			return nil, fmt.Errorf("urlhaus: %s", resp.QueryStatus)
+		}
+	}
+	return flagged, nil
+}
+
+// doThreatRequest sends req and decodes the JSON answer into v.
+func doThreatRequest(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// checkThreats rejects a new destination listed by the configured threat
+// checker. When the checker can't be reached the link is created anyway,
+// and the next rescan catches it.
+func (s *Server) checkThreats(destination string) error {
+	if s.threats == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), threatCheckTimeout)
+	defer cancel()
+	flagged, err := s.threats.Check(ctx, []string{destination})
+	if err != nil {
+		slog.Warn("threat check failed", "provider", s.threats.Name(), "err", err)
+		return nil
+	}
+	if threat, ok := flagged[destination]; ok {
+		return fmt.Errorf("%w: %s", errUnsafeURL, threat)
+	}
+	return nil
+}
+
+// setLinkFlag disables short with flag, or enables it again when flag is
+// nil. A link enabled again is trusted, so rescans don't flag the same
+// false positive again.
+func (s *Server) setLinkFlag(short string, flag *LinkFlag) error {
+	return s.updateLink(short, func(link *Link) {
+		link.Flagged = flag
+		link.Trusted = flag == nil
+	})
+}
+
+// scanLinks checks every link that is neither flagged nor trusted and
+// disables those whose destination is now listed. It returns how many
+// were flagged.
+func (s *Server) scanLinks(ctx context.Context) (int, error) {
+	links, err := s.getAllLinks(func(l *Link) bool { return l.Flagged == nil && !l.Trusted && l.Paste == nil })
+	if err != nil {
+		return 0, err
+	}
+	var urls []string
+	byURL := make(map[string][]string)
+	for _, link := range links {
+		if byURL[link.Original] == nil {
+			urls = append(urls, link.Original)
+		}
+		byURL[link.Original] = append(byURL[link.Original], link.Short)
+	}
+
+	listed, err := s.threats.Check(ctx, urls)
+	if err != nil {
+		return 0, err
+	}
+	flagged := 0
+	now := time.Now()
+	for target, threat := range listed {
+		for _, short := range byURL[target] {
+			flag := &LinkFlag{Threat: threat, Source: s.threats.Name(), At: now}
+			if err := s.setLinkFlag(short, flag); err != nil {
+				return flagged, err
+			}
+			slog.Warn("disabled unsafe link", "short", short, "threat", threat, "provider", flag.Source)
+			flagged++
+		}
+	}
+	return flagged, nil
+}
+
+// rescanLinks runs scanLinks every interval until ctx is done. Scans are
+// skipped in maintenance mode, which promises not to write.
+func (s *Server) rescanLinks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.maintenance().Enabled {
+			continue
+		}
+		n, err := s.scanLinks(ctx)
+		if err != nil {
+			slog.Error("link rescan failed", "provider", s.threats.Name(), "err", err)
+			continue
+		}
+		slog.Info("link rescan finished", "provider", s.threats.Name(), "flagged", n)
+	}
+}
+
+// handleAdminUnflag enables a link disabled by the threat check again,
+// for false positives.
+func (s *Server) handleAdminUnflag(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	if err := s.setLinkFlag(short, nil); err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	requestLogger(r).Info("link re-enabled", "short", short)
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
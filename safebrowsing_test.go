@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeThreats flags the URLs in its map.
+type fakeThreats map[string]string
+
+func (f fakeThreats) Name() string { return "fake" }
+
+func (f fakeThreats) Check(_ context.Context, urls []string) (map[string]string, error) {
+	flagged := make(map[string]string)
+	for _, u := range urls {
+		if threat, ok := f[u]; ok {
+			flagged[u] = threat
+		}
+	}
+	return flagged, nil
+}
+
+func TestGoogleSafeBrowsing(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "k" {
+			http.Error(w, "bad key", http.StatusForbidden)
+			return
+		}
+		var req struct {
+			ThreatInfo struct {
+				ThreatEntries []struct{ URL string } `json:"threatEntries"`
+			} `json:"threatInfo"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var matches []map[string]any
+		for _, e := range req.ThreatInfo.ThreatEntries {
+			if strings.Contains(e.URL, "malware") {
+				matches = append(matches, map[string]any{"threatType": "MALWARE", "threat": map[string]string{"url": e.URL}})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"matches": matches})
+	}))
+	defer api.Close()
+
+	checker, err := newThreatChecker(SafeBrowsingConfig{Provider: "google", APIKey: "k", Endpoint: api.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagged, err := checker.Check(context.Background(), []string{"https://example.com", "https://malware.test/x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged) != 1 || flagged["https://malware.test/x"] != "malware" {
+		t.Errorf("flagged = %v", flagged)
+	}
+
+	bad, _ := newThreatChecker(SafeBrowsingConfig{Provider: "google", APIKey: "wrong", Endpoint: api.URL})
+	if _, err := bad.Check(context.Background(), []string{"https://example.com"}); err == nil {
+		t.Error("expected an error for a rejected API key")
+	}
+}
+
+func TestURLhaus(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("url") {
+		case "https://bad.test/payload.exe":
+			json.NewEncoder(w).Encode(map[string]string{"query_status": "ok", "threat": "malware_download", "url_status": "online"})
+		case "https://gone.test/payload.exe":
+			json.NewEncoder(w).Encode(map[string]string{"query_status": "ok", "threat": "malware_download", "url_status": "offline"})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"query_status": "no_results"})
+		}
+	}))
+	defer api.Close()
+
+	checker, err := newThreatChecker(SafeBrowsingConfig{Provider: "urlhaus", Endpoint: api.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagged, err := checker.Check(context.Background(), []string{"https://example.com", "https://bad.test/payload.exe", "https://gone.test/payload.exe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged) != 1 || flagged["https://bad.test/payload.exe"] != "malware_download" {
+		t.Errorf("flagged = %v", flagged)
+	}
+}
+
+func TestNewThreatChecker(t *testing.T) {
+	tests := []struct {
+		cfg     SafeBrowsingConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{SafeBrowsingConfig{}, true, false},
+		{SafeBrowsingConfig{Provider: "google"}, true, true},
+		{SafeBrowsingConfig{Provider: "Google", APIKey: "k"}, false, false},
+		{SafeBrowsingConfig{Provider: "urlhaus"}, false, false},
+		{SafeBrowsingConfig{Provider: "virustotal"}, true, true},
+	}
+	for _, tt := range tests {
+		checker, err := newThreatChecker(tt.cfg)
+		if (err != nil) != tt.wantErr || (checker == nil) != tt.wantNil {
+			t.Errorf("newThreatChecker(%+v) = %v, %v", tt.cfg, checker, err)
+		}
+	}
+}
+
+func TestUnsafeLinks(t *testing.T) {
+	srv := newTestServer(t)
+	threats := fakeThreats{"https://phish.test/login": "social_engineering"}
+	srv.threats = threats
+
+	if _, err := srv.createShortLink("https://phish.test/login", createOptions{}); !errors.Is(err, errUnsafeURL) || createErrorStatus(err) != http.StatusForbidden {
+		t.Errorf("create of listed URL = %v, want errUnsafeURL", err)
+	}
+
+	if _, err := srv.createShortLink("https://later.test/", createOptions{CustomID: "later"}); err != nil {
+		t.Fatal(err)
+	}
+	redirect := func() int {
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/s/later", nil))
+		return rr.Code
+	}
+	if code := redirect(); code != http.StatusFound {
+		t.Fatalf("redirect status = %d, want 302", code)
+	}
+
+	// The destination turns malicious; the rescan disables the link even
+	// though its target is cached.
+	threats["https://later.test/"] = "malware"
+	if n, err := srv.scanLinks(context.Background()); err != nil || n != 1 {
+		t.Fatalf("scanLinks() = %d, %v; want 1 flagged", n, err)
+	}
+	if code := redirect(); code != http.StatusGone {
+		t.Errorf("redirect of flagged link = %d, want 410", code)
+	}
+	if n, _ := srv.scanLinks(context.Background()); n != 0 {
+		t.Errorf("second scan flagged %d links again", n)
+	}
+
+	adminCookie := loginAs(t, srv, "root")
+	req := httptest.NewRequest("GET", srv.uiPrefix+"/admin", nil)
+	req.AddCookie(adminCookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "https://later.test/") {
+		t.Error("admin panel does not list the flagged link")
+	}
+
+	req = httptest.NewRequest("POST", srv.uiPrefix+"/admin/links/later/unflag", nil)
+	req.AddCookie(adminCookie)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("unflag status = %d", rr.Code)
+	}
+	if code := redirect(); code != http.StatusFound {
+		t.Errorf("redirect after unflag = %d, want 302", code)
+	}
+	if n, _ := srv.scanLinks(context.Background()); n != 0 {
+		t.Errorf("rescan flagged a restored link again")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runServe implements the "serve" command, the default: it runs the server
+// until SIGINT or SIGTERM.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s [serve] [flags]\n\n", os.Args[0])
+		fmt.Fprintln(out, "Runs the server. Flags override the environment, which overrides the config file.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	var logOut io.Writer = os.Stderr
+	var logFile *logFile
+	if cfg.Log.File != "" {
+		if logFile, err = openLogFile(cfg.Log.File); err != nil {
+			return fmt.Errorf("failed to set up logging: %w", err)
+		}
+		logOut = logFile
+	}
+	logger, err := newLogger(logOut, cfg.Log)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	srv, err := NewServer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	defer srv.Close()
+
+	srv.setupRoutes()
+
+	port := cfg.Port
+
+	httpServer := cfg.Limits.httpServer(":"+port, srv.router)
+
+	// With autocert, a second listener on the plain HTTP port answers ACME
+	// challenges and redirects everything else to HTTPS.
+	var redirectServer *http.Server
+	if cfg.TLS.enabled() {
+		var challenge http.Handler
+		if httpServer.TLSConfig, challenge, err = cfg.TLS.serverTLS(); err != nil {
+			return fmt.Errorf("failed to set up TLS: %w", err)
+		}
+		if challenge != nil {
+			redirectServer = cfg.Limits.httpServer(":"+cfg.TLS.Autocert.HTTPPort, challenge)
+		}
+	}
+
+	// Under systemd socket activation the first socket serves the site and
+	// a second one, if any, the autocert HTTP port.
+	listeners, err := systemdListeners()
+	if err != nil {
+		return fmt.Errorf("failed to use systemd sockets: %w", err)
+	}
+	var mainListener, redirectListener net.Listener
+	if len(listeners) > 0 {
+		mainListener = listeners[0]
+		slog.Info("using socket from systemd", "addr", mainListener.Addr().String())
+	}
+	if len(listeners) > 1 {
+		redirectListener = listeners[1]
+	}
+
+	go func() {
+		build := buildInfo()
+		slog.Info("server starting",
+			"version", build.Version, "commit", build.Commit, "build_date", build.BuildDate,
+			"port", port, "tls", httpServer.TLSConfig != nil,
+			"short_prefix", srv.prefix, "ui_prefix", srv.uiPrefix)
+		if srv.readOnly {
+			slog.Info("read-only replica mode: serving redirects only")
+		}
+		if err := serve(httpServer, mainListener); err != nil && err != http.ErrServerClosed {
+			fatal("server failed to start", "err", err)
+		}
+	}()
+
+	if redirectServer != nil {
+		go func() {
+			slog.Info("serving ACME challenges and HTTPS redirects", "port", cfg.TLS.Autocert.HTTPPort, "domains", cfg.TLS.Autocert.Domains)
+			if err := serve(redirectServer, redirectListener); err != nil && err != http.ErrServerClosed {
+				fatal("HTTP redirect server failed to start", "err", err)
+			}
+		}()
+	}
+
+	var debugServer *http.Server
+	if cfg.DebugAddr != "" {
+		if err := checkDebugAddr(cfg.DebugAddr); err != nil {
+			return fmt.Errorf("failed to start debug server: %w", err)
+		}
+		debugServer = &http.Server{Addr: cfg.DebugAddr, Handler: debugHandler()}
+		go func() {
+			slog.Info("serving pprof and expvar", "addr", cfg.DebugAddr)
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("debug server failed to start", "err", err)
+			}
+		}()
+	}
+
+	// Existing links are checked against the threat list again, since
+	// destinations can turn malicious after they were shortened.
+	scanCtx, stopScan := context.WithCancel(context.Background())
+	defer stopScan()
+	if srv.threats != nil && !srv.readOnly && cfg.SafeBrowsing.RescanInterval > 0 {
+		go srv.rescanLinks(scanCtx, cfg.SafeBrowsing.RescanInterval)
+	}
+	if srv.metadata != nil && !srv.readOnly {
+		go srv.fetchMetadata(scanCtx)
+		if cfg.Metadata.RefreshInterval > 0 {
+			go srv.refreshMetadata(scanCtx, cfg.Metadata.RefreshInterval)
+		}
+	}
+	if srv.email.enabled() && !srv.readOnly {
+		go srv.pollEmail(scanCtx)
+	}
+
+	// SIGHUP reopens the log file and reloads templates and the parts of
+	// the configuration that can change without a restart.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					slog.Error("failed to reopen log file", "err", err)
+				}
+			}
+			cfg, err := flags.load()
+			if err == nil {
+				err = srv.reload(cfg)
+			}
+			if err != nil {
+				slog.Error("reload failed, keeping the previous configuration", "err", err)
+			}
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	slog.Info("shutting down server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if debugServer != nil {
+		debugServer.Close()
+	}
+	servers := []*http.Server{httpServer}
+	if redirectServer != nil {
+		servers = append(servers, redirectServer)
+	}
+	if err := srv.Shutdown(ctx, servers...); err != nil {
+		return fmt.Errorf("server forced to shutdown: %w", err)
+	}
+
+	slog.Info("server exited")
+	return nil
+}
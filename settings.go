@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	settingsBucket = "settings"
+	settingsKey    = "global"
+)
+
+var (
+	errReservedWord     = errors.New("reserved word")
+	errBlockedDomain    = errors.New("destination domain is blocked")
+	errDomainNotAllowed = errors.New("destination domain is not allowed")
+)
+
+// Settings are runtime options managed from the admin panel. They are
+// stored in the database; until an admin first saves them, defaults come
+// from the configuration.
+type Settings struct {
+	RegistrationOpen bool     `json:"registration_open"`
+	ReservedWords    []string `json:"reserved_words"`
+	BlockedDomains   []string `json:"blocked_domains"`
+	// AllowedDomains, when not empty, are the only domains links may
+	// point to.
+	AllowedDomains []string `json:"allowed_domains"`
+
+	// AnonymousCreate lets visitors without a session or API key create
+	// links. Redirects are always public.
+	AnonymousCreate bool `json:"anonymous_create"`
+
+	// RequireDeleteReason refuses deletions that don't say why; the
+	// reason is kept in the link's tombstone.
+	RequireDeleteReason bool `json:"require_delete_reason"`
+
+	// Quota applies to every user and API key without an entry in
+	// QuotaOverrides, which is keyed by link owner.
+	Quota          Quota            `json:"quota"`
+	QuotaOverrides map[string]Quota `json:"quota_overrides,omitempty"`
+}
+
+// defaultSettings returns the settings used before any have been saved.
+func defaultSettings(cfg *Config) Settings {
+	return Settings{
+		RegistrationOpen:    !cfg.Auth.DisableRegistration,
+		AnonymousCreate:     !cfg.Auth.DisableAnonymousCreate,
+		RequireDeleteReason: cfg.RequireDeleteReason,
+		ReservedWords:       normalizeList(cfg.ReservedWords),
+		BlockedDomains:      normalizeList(cfg.BlockedDomains),
+		AllowedDomains:      normalizeList(cfg.AllowedDomains),
+		Quota:               cfg.Quota,
+	}
+}
+
+// loadSettings reads the stored settings, falling back to the defaults
+// from cfg.
+func loadSettings(db *bolt.DB, cfg *Config) (Settings, error) {
+	settings := defaultSettings(cfg)
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(settingsBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(settingsKey))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &settings)
+	})
+	return settings, err
+}
+
+// getSettings returns a snapshot of the current settings.
+func (s *Server) getSettings() Settings {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.settings
+}
+
+// saveSettings normalizes, persists and activates new settings.
+func (s *Server) saveSettings(settings Settings) error {
+	settings.ReservedWords = normalizeList(settings.ReservedWords)
+	settings.BlockedDomains = normalizeList(settings.BlockedDomains)
+	settings.AllowedDomains = normalizeList(settings.AllowedDomains)
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(settingsBucket)).Put([]byte(settingsKey), data)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.settingsMu.Lock()
+	s.settings = settings
+	s.settingsMu.Unlock()
+	return nil
+}
+
+// normalizeList lowercases, trims and de-duplicates entries, dropping empty
+// ones.
+func normalizeList(items []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		out = append(out, item)
+	}
+	return out
+}
+
+// splitLines splits textarea input into one entry per line or comma.
+func splitLines(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	})
+}
+
+// checkReservedWord rejects custom IDs matching an admin-managed reserved
+// word, in addition to the built-in ones in validateCustomID.
+func (s *Server) checkReservedWord(id string) error {
+	lower := strings.ToLower(id)
+	for _, word := range s.getSettings().ReservedWords {
+		if lower == word {
+			return fmt.Errorf("%w: '%s' cannot be used as a custom ID", errReservedWord, id)
+		}
+	}
+	return nil
+}
+
+// checkBlockedDomain rejects destinations whose host matches a blocked
+// domain, or that match no allowed domain while an allowlist is set. The
+// blocklist wins over the allowlist.
+func (s *Server) checkBlockedDomain(destination string) error {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	settings := s.getSettings()
+	if matchDomain(host, settings.BlockedDomains) {
+		return fmt.Errorf("%w: %s", errBlockedDomain, host)
+	}
+	if len(settings.AllowedDomains) > 0 && !matchDomain(host, settings.AllowedDomains) {
+		return fmt.Errorf("%w: %s", errDomainNotAllowed, host)
+	}
+	return nil
+}
+
+// matchDomain reports whether host matches one of the domain entries. A
+// plain entry matches the domain itself and its subdomains; an entry with
+// a * is a wildcard pattern, as in "*.corp.example" (subdomains only) or
+// "cdn-*.example.com", where * also spans dots.
+func matchDomain(host string, entries []string) bool {
+	for _, entry := range entries {
+		if strings.Contains(entry, "*") {
+			if ok, _ := path.Match(entry, host); ok {
+				return true
+			}
+		} else if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDomainPatterns checks that every wildcard entry is a valid
+// pattern.
+func validateDomainPatterns(entries []string) error {
+	for _, entry := range entries {
+		if _, err := path.Match(entry, ""); err != nil {
+			return fmt.Errorf("invalid domain pattern %q", entry)
+		}
+	}
+	return nil
+}
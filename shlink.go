@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// shlinkErrorPrefix starts the type URIs of Shlink's problem details.
+	shlinkErrorPrefix = "https://shlink.io/api/error/"
+	// shlinkItemsPerPage is Shlink's default page size.
+	shlinkItemsPerPage = 10
+)
+
+// ShlinkConfig enables the Shlink-compatible REST API; see
+// setupShlinkRoutes.
+type ShlinkConfig struct {
+	// Enabled serves the core of Shlink's REST API under /rest, so Shlink
+	// clients can be pointed at this server with one of its API keys.
+	Enabled bool `yaml:"enabled"`
+}
+
+// shlinkShortURL is a link as Shlink's API describes it.
+type shlinkShortURL struct {
+	ShortCode     string              `json:"shortCode"`
+	ShortURL      string              `json:"shortUrl"`
+	LongURL       string              `json:"longUrl"`
+	DateCreated   time.Time           `json:"dateCreated"`
+	VisitsCount   int                 `json:"visitsCount"`
+	VisitsSummary shlinkVisitsSummary `json:"visitsSummary"`
+	Tags          []string            `json:"tags"`
+	Meta          shlinkMeta          `json:"meta"`
+	Domain        *string             `json:"domain"`
+	Title         *string             `json:"title"`
+	Crawlable     bool                `json:"crawlable"`
+	ForwardQuery  bool                `json:"forwardQuery"`
+}
+
+type shlinkVisitsSummary struct {
+	Total   int `json:"total"`
+	NonBots int `json:"nonBots"`
+	Bots    int `json:"bots"`
+}
+
+type shlinkMeta struct {
+	ValidSince *time.Time `json:"validSince"`
+	ValidUntil *time.Time `json:"validUntil"`
+	MaxVisits  *int       `json:"maxVisits"`
+}
+
+// shlinkVisit is a recorded click as Shlink's API describes it. Only the
+// referring host and country are known.
+type shlinkVisit struct {
+	Referer       string               `json:"referer"`
+	Date          time.Time            `json:"date"`
+	UserAgent     string               `json:"userAgent"`
+	VisitLocation *shlinkVisitLocation `json:"visitLocation"`
+	PotentialBot  bool                 `json:"potentialBot"`
+}
+
+type shlinkVisitLocation struct {
+	CountryCode string `json:"countryCode"`
+}
+
+type shlinkPagination struct {
+	CurrentPage        int `json:"currentPage"`
+	PagesCount         int `json:"pagesCount"`
+	ItemsPerPage       int `json:"itemsPerPage"`
+	ItemsInCurrentPage int `json:"itemsInCurrentPage"`
+	TotalItems         int `json:"totalItems"`
+}
+
+// setupShlinkRoutes registers the Shlink endpoints: creating, listing,
+// getting and deleting short URLs, their visits, and the health check,
+// under every API version clients may ask for.
+func (s *Server) setupShlinkRoutes() {
+	rest := s.router.PathPrefix("/rest").Subrouter()
+	rest.Use(shlinkCORS)
+	rest.HandleFunc("/health", s.handleShlinkHealth).Methods("GET")
+	api := rest.PathPrefix("/v{version:[1-3]}").Subrouter()
+	api.HandleFunc("/short-urls", s.limitCreate(s.handleShlinkCreate)).Methods("POST")
+	api.HandleFunc("/short-urls", s.handleShlinkList).Methods("GET")
+	api.HandleFunc("/short-urls/{short}", s.handleShlinkGet).Methods("GET")
+	api.HandleFunc("/short-urls/{short}", s.handleShlinkDelete).Methods("DELETE")
+	api.HandleFunc("/short-urls/{short}/visits", s.handleShlinkVisits).Methods("GET")
+	// Preflight requests carry no method route of their own.
+	rest.PathPrefix("/").Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// shlinkCORS allows Shlink's web client, which runs on its own origin, to
+// call the API. Requests authenticate with an API key, never a cookie.
+func shlinkCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "X-Api-Key, Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "3600")
+		}
+		r.Header.Del("Cookie")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeShlinkError answers with a problem details document, as Shlink
+// does; errType is appended to shlinkErrorPrefix.
+func writeShlinkError(w http.ResponseWriter, status int, errType, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":   shlinkErrorPrefix + errType,
+		"title":  http.StatusText(status),
+		"detail": detail,
+		"status": status,
+	})
+}
+
+func writeShlinkJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// shlinkAuth checks that the request carries a valid API key granting
+// scope, as Shlink requires a key for every call. It writes an error
+// response and returns false otherwise.
+func (s *Server) shlinkAuth(w http.ResponseWriter, r *http.Request, scope string) bool {
+	cred, ok := s.requestCredential(r)
+	if !ok || cred == nil {
+		writeShlinkError(w, http.StatusUnauthorized, "invalid-api-key", "Provided API key does not exist or is invalid.")
+		return false
+	}
+	if !scopeAllowed(cred.Scopes, scope) {
+		writeShlinkError(w, http.StatusForbidden, "forbidden-operation", "API key lacks the "+strconv.Quote(scope)+" scope.")
+		return false
+	}
+	return true
+}
+
+// shlinkLink returns the link short the caller may manage, or writes the
+// error Shlink would.
+func (s *Server) shlinkLink(w http.ResponseWriter, r *http.Request, short string) (*Link, bool) {
+	link, err := s.getLink(short)
+	if err == nil {
+		if status, _ := s.checkCanManage(r, link); status == http.StatusOK {
+			return link, true
+		}
+	}
+	writeShlinkError(w, http.StatusNotFound, "short-url-not-found", "No URL found with short code \""+short+"\"")
+	return nil, false
+}
+
+func (s *Server) toShlinkShortURL(r *http.Request, link *Link) shlinkShortURL {
+	out := shlinkShortURL{
+		ShortCode:     link.Short,
+		ShortURL:      s.shortURL(r, link.Domain, link.Short),
+		LongURL:       link.Original,
+		DateCreated:   link.CreatedAt,
+		VisitsCount:   link.Clicks,
+		VisitsSummary: shlinkVisitsSummary{Total: link.Clicks, NonBots: link.Clicks},
+		Tags:          link.Tags,
+		Meta:          shlinkMeta{ValidUntil: link.ExpiresAt},
+	}
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	if link.Domain != "" {
+		out.Domain = &link.Domain
+	}
+	if link.Meta != nil && link.Meta.Title != "" {
+		out.Title = &link.Meta.Title
+	}
+	return out
+}
+
+// shlinkPageBounds reads Shlink's page and itemsPerPage parameters, where
+// itemsPerPage -1 means everything, and returns the slice bounds of the
+// page among total items.
+func shlinkPageBounds(r *http.Request, total int) (from, to int, p shlinkPagination) {
+	query := r.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(query.Get("itemsPerPage"))
+	if err != nil || perPage == 0 || perPage < -1 {
+		perPage = shlinkItemsPerPage
+	}
+	p = shlinkPagination{CurrentPage: page, ItemsPerPage: perPage, TotalItems: total, PagesCount: 1}
+	if perPage == -1 {
+		p.ItemsPerPage = total
+		p.ItemsInCurrentPage = total
+		return 0, total, p
+	}
+	p.PagesCount = (total + perPage - 1) / perPage
+	from = min((page-1)*perPage, total)
+	to = min(from+perPage, total)
+	p.ItemsInCurrentPage = to - from
+	return from, to, p
+}
+
+func (s *Server) handleShlinkHealth(w http.ResponseWriter, r *http.Request) {
+	status, code := "pass", http.StatusOK
+	if err := s.db.View(func(tx *bolt.Tx) error { return nil }); err != nil {
+		status, code = "fail", http.StatusServiceUnavailable
+	}
+	writeShlinkJSON(w, code, map[string]interface{}{"status": status, "version": version})
+}
+
+// findOwnLink returns the oldest live link of owner to destination on
+// domain, or nil, for the compatibility APIs that return existing links
+// rather than creating duplicates.
+func (s *Server) findOwnLink(owner, destination, domain string) *Link {
+	links, err := s.getAllLinks(func(link *Link) bool {
+		return link.Owner == owner && link.Original == destination && link.Domain == domain && !link.Expired()
+	})
+	if err != nil || len(links) == 0 {
+		return nil
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return &links[0]
+}
+
+// handleShlinkCreate creates a link from Shlink's longUrl, customSlug,
+// tags, domain and validUntil. With findIfExists, a link of the caller to
+// the same URL is returned instead of creating another.
+func (s *Server) handleShlinkCreate(w http.ResponseWriter, r *http.Request) {
+	if !s.shlinkAuth(w, r, scopeCreate) {
+		return
+	}
+	var req struct {
+		LongURL      string     `json:"longUrl"`
+		CustomSlug   string     `json:"customSlug"`
+		Tags         []string   `json:"tags"`
+		Domain       string     `json:"domain"`
+		ValidUntil   *time.Time `json:"validUntil"`
+		FindIfExists bool       `json:"findIfExists"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeShlinkError(w, http.StatusBadRequest, "invalid-data", "Provided data is not valid")
+		return
+	}
+	if req.LongURL == "" {
+		writeShlinkError(w, http.StatusBadRequest, "invalid-data", "longUrl is required")
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		writeShlinkError(w, http.StatusBadRequest, "invalid-data", capitalize(err.Error()))
+		return
+	}
+	domain, err := s.createDomain(r, req.Domain, req.Domain != "")
+	if err != nil {
+		writeShlinkError(w, http.StatusBadRequest, "invalid-data", capitalize(err.Error()))
+		return
+	}
+	owner, _ := s.callerOwner(r)
+	system, _ := s.apiKeySystem(r)
+	destination := s.destinations.withDefaultScheme(req.LongURL)
+
+	if req.FindIfExists {
+		if link := s.findOwnLink(owner, destination, domain); link != nil && (req.CustomSlug == "" || link.Short == req.CustomSlug) {
+			writeShlinkJSON(w, http.StatusOK, s.toShlinkShortURL(r, link))
+			return
+		}
+	}
+
+	short, err := s.createShortLink(destination, createOptions{
+		CustomID:  strings.TrimSpace(req.CustomSlug),
+		System:    system,
+		Owner:     owner,
+		Tags:      tags,
+		Domain:    domain,
+		ExpiresAt: req.ValidUntil,
+	})
+	switch {
+	case errors.Is(err, errCustomIDTaken):
+		writeShlinkError(w, http.StatusBadRequest, "non-unique-slug", "Provided slug \""+req.CustomSlug+"\" is already in use.")
+		return
+	case err != nil && createErrorStatus(err) == http.StatusInternalServerError:
+		requestLogger(r).Error("failed to create short link", "err", err)
+		writeShlinkError(w, http.StatusInternalServerError, "internal-server-error", "Failed to create short link")
+		return
+	case err != nil:
+		writeShlinkError(w, http.StatusBadRequest, "invalid-data", capitalize(err.Error()))
+		return
+	}
+	link, err := s.getLink(short)
+	if err != nil {
+		writeShlinkError(w, http.StatusInternalServerError, "internal-server-error", "Failed to create short link")
+		return
+	}
+	writeShlinkJSON(w, http.StatusOK, s.toShlinkShortURL(r, link))
+}
+
+// shlinkOrders sort links for Shlink's orderBy parameter, ascending.
+var shlinkOrders = map[string]func(a, b *Link) bool{
+	"dateCreated": func(a, b *Link) bool { return a.CreatedAt.Before(b.CreatedAt) },
+	"shortCode":   func(a, b *Link) bool { return a.Short < b.Short },
+	"longUrl":     func(a, b *Link) bool { return a.Original < b.Original },
+	"visits":      func(a, b *Link) bool { return a.Clicks < b.Clicks },
+}
+
+// handleShlinkList lists the caller's links, filtered by searchTerm and
+// tags[] (any of them, or all with tagsMode=all), ordered by orderBy
+// (e.g. "visits-DESC"; newest first by default) and paginated.
+func (s *Server) handleShlinkList(w http.ResponseWriter, r *http.Request) {
+	if !s.shlinkAuth(w, r, scopeRead) {
+		return
+	}
+	query := r.URL.Query()
+	owner, _ := s.callerOwner(r)
+	search := strings.ToLower(strings.TrimSpace(query.Get("searchTerm")))
+	tags := query["tags[]"]
+	allTags := query.Get("tagsMode") == "all"
+
+	links, err := s.getAllLinks(func(link *Link) bool {
+		if link.Owner != owner || (search != "" && !link.matchesSearch(search)) {
+			return false
+		}
+		matched := 0
+		for _, tag := range tags {
+			if link.hasTag(strings.ToLower(tag)) {
+				matched++
+			}
+		}
+		if allTags {
+			return matched == len(tags)
+		}
+		return len(tags) == 0 || matched > 0
+	})
+	if err != nil {
+		writeShlinkError(w, http.StatusInternalServerError, "internal-server-error", "Failed to get links")
+		return
+	}
+
+	field, dir, _ := strings.Cut(query.Get("orderBy"), "-")
+	less, ok := shlinkOrders[field]
+	if !ok {
+		less, dir = shlinkOrders["dateCreated"], "DESC"
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		if strings.EqualFold(dir, "DESC") {
+			return less(&links[j], &links[i])
+		}
+		return less(&links[i], &links[j])
+	})
+
+	from, to, pagination := shlinkPageBounds(r, len(links))
+	data := make([]shlinkShortURL, 0, to-from)
+	for i := from; i < to; i++ {
+		data = append(data, s.toShlinkShortURL(r, &links[i]))
+	}
+	writeShlinkJSON(w, http.StatusOK, map[string]interface{}{
+		"shortUrls": map[string]interface{}{"data": data, "pagination": pagination},
+	})
+}
+
+func (s *Server) handleShlinkGet(w http.ResponseWriter, r *http.Request) {
+	if !s.shlinkAuth(w, r, scopeRead) {
+		return
+	}
+	link, ok := s.shlinkLink(w, r, mux.Vars(r)["short"])
+	if !ok {
+		return
+	}
+	writeShlinkJSON(w, http.StatusOK, s.toShlinkShortURL(r, link))
+}
+
+func (s *Server) handleShlinkDelete(w http.ResponseWriter, r *http.Request) {
+	if !s.shlinkAuth(w, r, scopeDelete) {
+		return
+	}
+	short := mux.Vars(r)["short"]
+	if status, _ := s.checkCanDelete(r, short); status != http.StatusOK {
+		writeShlinkError(w, http.StatusNotFound, "short-url-not-found", "No URL found with short code \""+short+"\"")
+		return
+	}
+	reason, err := s.deleteReason(r)
+	if err != nil {
+		writeShlinkError(w, http.StatusBadRequest, "invalid-data", "A reason is required to delete links")
+		return
+	}
+	if err := s.deleteLink(short, s.deleteActor(r), reason); err != nil {
+		writeShlinkError(w, http.StatusInternalServerError, "internal-server-error", "Failed to delete link")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleShlinkVisits lists the recent clicks of a link, newest first. Only
+// the last maxClickEvents clicks are kept, so older visits are missing.
+func (s *Server) handleShlinkVisits(w http.ResponseWriter, r *http.Request) {
+	if !s.shlinkAuth(w, r, scopeRead) {
+		return
+	}
+	link, ok := s.shlinkLink(w, r, mux.Vars(r)["short"])
+	if !ok {
+		return
+	}
+	var clicks []ClickEvent
+	s.db.View(func(tx *bolt.Tx) error {
+		clicks = recentClicks(tx, link.Short, maxClickEvents)
+		return nil
+	})
+
+	from, to, pagination := shlinkPageBounds(r, len(clicks))
+	data := make([]shlinkVisit, 0, to-from)
+	for _, click := range clicks[from:to] {
+		visit := shlinkVisit{Referer: click.Referrer, Date: click.At}
+		if click.Country != "" {
+			visit.VisitLocation = &shlinkVisitLocation{CountryCode: click.Country}
+		}
+		data = append(data, visit)
+	}
+	writeShlinkJSON(w, http.StatusOK, map[string]interface{}{
+		"visits": map[string]interface{}{"data": data, "pagination": pagination},
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShlinkPageBounds(t *testing.T) {
+	tests := []struct {
+		query      string
+		total      int
+		wantFrom   int
+		wantTo     int
+		wantPages  int
+		wantInPage int
+	}{
+		{"", 25, 0, 10, 3, 10},
+		{"?page=3", 25, 20, 25, 3, 5},
+		{"?page=9", 25, 25, 25, 3, 0},
+		{"?itemsPerPage=5&page=2", 25, 5, 10, 5, 5},
+		{"?itemsPerPage=-1", 25, 0, 25, 1, 25},
+		{"?page=x&itemsPerPage=0", 3, 0, 3, 1, 3},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/rest/v3/short-urls"+tt.query, nil)
+		from, to, p := shlinkPageBounds(r, tt.total)
+		if from != tt.wantFrom || to != tt.wantTo || p.PagesCount != tt.wantPages || p.ItemsInCurrentPage != tt.wantInPage || p.TotalItems != tt.total {
+			t.Errorf("shlinkPageBounds(%q) = %d, %d, %+v", tt.query, from, to, p)
+		}
+	}
+}
+
+func TestShlinkAPI(t *testing.T) {
+	t.Setenv("SHLINK_API", "true")
+	t.Setenv("API_KEYS", "shlink:s3cret,other:0ther")
+	srv := newTestServer(t)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("GET", "/rest/v3/short-urls", "", ""); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), shlinkErrorPrefix+"invalid-api-key") {
+		t.Errorf("list without a key = %d %s, want 401 invalid-api-key", rr.Code, rr.Body)
+	}
+
+	var created shlinkShortURL
+	rr := do("POST", "/rest/v3/short-urls", "s3cret", `{"longUrl":"https://example.com/docs","customSlug":"docs","tags":["Guides"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create = %d %s", rr.Code, rr.Body)
+	}
+	json.NewDecoder(rr.Body).Decode(&created)
+	if created.ShortCode != "docs" || created.LongURL != "https://example.com/docs" || !strings.HasSuffix(created.ShortURL, "/s/docs") ||
+		len(created.Tags) != 1 || created.Tags[0] != "guides" {
+		t.Errorf("created = %+v", created)
+	}
+
+	rr = do("POST", "/rest/v2/short-urls", "s3cret", `{"longUrl":"https://example.com/other","customSlug":"docs"}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), shlinkErrorPrefix+"non-unique-slug") ||
+		rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("taken slug = %d %s, want 400 non-unique-slug", rr.Code, rr.Body)
+	}
+	rr = do("POST", "/rest/v3/short-urls", "s3cret", `{"longUrl":"https://example.com/docs","findIfExists":true}`)
+	if !strings.Contains(rr.Body.String(), `"shortCode":"docs"`) {
+		t.Errorf("findIfExists = %s, want the existing link", rr.Body)
+	}
+	do("POST", "/rest/v3/short-urls", "s3cret", `{"longUrl":"https://example.com/blog","customSlug":"blog"}`)
+	do("POST", "/rest/v3/short-urls", "0ther", `{"longUrl":"https://example.com/theirs","customSlug":"theirs"}`)
+
+	var list struct {
+		ShortURLs struct {
+			Data       []shlinkShortURL `json:"data"`
+			Pagination shlinkPagination `json:"pagination"`
+		} `json:"shortUrls"`
+	}
+	rr = do("GET", "/rest/v3/short-urls?orderBy=shortCode-ASC", "s3cret", "")
+	json.NewDecoder(rr.Body).Decode(&list)
+	if len(list.ShortURLs.Data) != 2 || list.ShortURLs.Data[0].ShortCode != "blog" || list.ShortURLs.Pagination.TotalItems != 2 {
+		t.Errorf("list = %+v, want the key's two links", list.ShortURLs)
+	}
+	rr = do("GET", "/rest/v3/short-urls?tags[]=guides", "s3cret", "")
+	json.NewDecoder(rr.Body).Decode(&list)
+	if len(list.ShortURLs.Data) != 1 || list.ShortURLs.Data[0].ShortCode != "docs" {
+		t.Errorf("list by tag = %+v", list.ShortURLs.Data)
+	}
+
+	if rr := do("GET", "/rest/v3/short-urls/theirs", "s3cret", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("another key's link = %d, want 404", rr.Code)
+	}
+
+	srv.incrementClicks("docs", ClickEvent{At: time.Now().UTC(), Referrer: "news.example.org", Country: "DE"})
+	var visits struct {
+		Visits struct {
+			Data []shlinkVisit `json:"data"`
+		} `json:"visits"`
+	}
+	rr = do("GET", "/rest/v3/short-urls/docs/visits", "s3cret", "")
+	json.NewDecoder(rr.Body).Decode(&visits)
+	if len(visits.Visits.Data) != 1 || visits.Visits.Data[0].Referer != "news.example.org" || visits.Visits.Data[0].VisitLocation.CountryCode != "DE" {
+		t.Errorf("visits = %s", rr.Body)
+	}
+
+	if rr := do("DELETE", "/rest/v3/short-urls/docs", "s3cret", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete = %d %s, want 204", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/rest/v3/short-urls/docs", "s3cret", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted link = %d, want 404", rr.Code)
+	}
+
+	req := httptest.NewRequest("OPTIONS", "/rest/v3/short-urls", nil)
+	req.Header.Set("Origin", "https://app.shlink.io")
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "*" || !strings.Contains(rr.Header().Get("Access-Control-Allow-Headers"), "X-Api-Key") {
+		t.Errorf("preflight = %d %v", rr.Code, rr.Header())
+	}
+	if rr := do("GET", "/rest/health", "", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"status":"pass"`) {
+		t.Errorf("health = %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestShlinkAPIDisabled(t *testing.T) {
+	srv := newTestServer(t)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest("GET", "/rest/health", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("/rest/health while disabled = %d, want 404", rr.Code)
+	}
+}
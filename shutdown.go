@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// drainFunc flushes a background write queue, giving up once ctx is done.
+// It returns the number of queued items it had to drop.
+type drainFunc func(ctx context.Context) (dropped int)
+
+type drainer struct {
+	name  string
+	drain drainFunc
+}
+
+// onShutdown registers a queue of pending writes, such as batched click
+// counts or outgoing webhooks, to be flushed by Shutdown. It must be called
+// while the server is being set up, before it starts serving.
+func (s *Server) onShutdown(name string, drain drainFunc) {
+	s.drainers = append(s.drainers, drainer{name: name, drain: drain})
+}
+
+// Shutdown ends the event streams and stops the HTTP servers gracefully,
+// then flushes the registered queues in order, so requests still in flight
+// can enqueue their writes before the queues are drained. Everything
+// shares the deadline of ctx; whatever could not be written by then is
+// logged as dropped. It returns the first error from shutting down the
+// servers.
+func (s *Server) Shutdown(ctx context.Context, servers ...*http.Server) error {
+	// Event streams only end when told to, and would hold up the wait for
+	// requests in flight until the deadline.
+	if s.events != nil {
+		s.events.close()
+	}
+	var firstErr error
+	for _, hs := range servers {
+		if err := hs.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, d := range s.drainers {
+		if dropped := d.drain(ctx); dropped > 0 {
+			slog.Error("dropped pending writes on shutdown", "queue", d.name, "dropped", dropped)
+		} else {
+			slog.Info("flushed pending writes", "queue", d.name)
+		}
+	}
+	return firstErr
+}
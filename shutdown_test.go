@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsQueues(t *testing.T) {
+	srv := &Server{}
+	hs := &http.Server{}
+
+	var order []string
+	srv.onShutdown("clicks", func(ctx context.Context) int {
+		order = append(order, "clicks")
+		return 0
+	})
+	srv.onShutdown("webhooks", func(ctx context.Context) int {
+		order = append(order, "webhooks")
+		<-ctx.Done()
+		return 3
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx, hs); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	if len(order) != 2 || order[0] != "clicks" || order[1] != "webhooks" {
+		t.Errorf("drain order = %v", order)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// slackSystem names the Slack integration as a caller: links created
+	// from Slack are owned by "key:slack", and reserved prefixes can be
+	// granted to it like to an API key.
+	slackSystem = "slack"
+	// slackMaxSkew is how old a signed Slack request may be, against
+	// replays.
+	slackMaxSkew = 5 * time.Minute
+)
+
+var errSlackSignature = errors.New("invalid Slack request signature")
+
+// SlackConfig enables the /shorten slash command; see handleSlackCommand.
+type SlackConfig struct {
+	// SigningSecret is the signing secret of the Slack app, from its Basic
+	// Information page. Empty disables the integration.
+	SigningSecret string `yaml:"signing_secret"`
+}
+
+// verifySlackSignature checks the signature Slack sends with body, as
+// described in https://api.slack.com/authentication/verifying-requests-from-slack.
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return errSlackSignature
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > slackMaxSkew || skew < -slackMaxSkew {
+		return fmt.Errorf("%w: request is too old", errSlackSignature)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:", ts)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(want)) {
+		return errSlackSignature
+	}
+	return nil
+}
+
+// parseSlackText splits the text of "/shorten <url> [custom-id]" into its
+// arguments. Slack may send the URL as <https://example.com> or
+// <https://example.com|example.com>.
+func parseSlackText(text string) (destination, customID string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", "", false
+	}
+	destination = strings.TrimSuffix(strings.TrimPrefix(fields[0], "<"), ">")
+	destination, _, _ = strings.Cut(destination, "|")
+	if len(fields) == 2 {
+		customID = fields[1]
+	}
+	return destination, customID, destination != ""
+}
+
+// handleSlackCommand answers the Slack slash command "/shorten <url>
+// [custom-id]" with the new short link, posted in the channel. Refused
+// links are explained to the user only.
+func (s *Server) handleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	if err := verifySlackSignature(s.slack.SigningSecret, r.Header, body, time.Now()); err != nil {
+		requestLogger(r).Warn("rejected Slack command", "err", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	destination, customID, ok := parseSlackText(form.Get("text"))
+	if !ok {
+		writeSlackReply(w, false, fmt.Sprintf("Usage: %s <url> [custom-id]", form.Get("command")))
+		return
+	}
+	destination = s.destinations.withDefaultScheme(destination)
+	short, err := s.createShortLink(destination, createOptions{
+		CustomID: customID,
+		System:   slackSystem,
+		Owner:    apiKeyOwnerPrefix + slackSystem,
+	})
+	if err != nil {
+		if createErrorStatus(err) == http.StatusInternalServerError {
+			requestLogger(r).Error("failed to create short link from Slack", "err", err)
+			writeSlackReply(w, false, "Failed to create short link, please try again")
+			return
+		}
+		writeSlackReply(w, false, capitalize(err.Error()))
+		return
+	}
+	requestLogger(r).Info("short link created from Slack", "short", short, "slack_user", form.Get("user_id"))
+	writeSlackReply(w, true, fmt.Sprintf("%s → %s", s.shortURL(r, "", short), destination))
+}
+
+// writeSlackReply answers a slash command with text, shown to everyone in
+// the channel or only to the user who ran the command.
+func writeSlackReply(w http.ResponseWriter, inChannel bool, text string) {
+	responseType := "ephemeral"
+	if inChannel {
+		responseType = "in_channel"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"response_type": responseType, "text": text})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSlackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// slackRequest builds a slash command request signed with secret at ts.
+func slackRequest(secret string, ts time.Time, text string) *http.Request {
+	body := url.Values{"command": {"/shorten"}, "text": {text}, "user_id": {"U123"}}.Encode()
+	req := httptest.NewRequest("POST", "/sui/integrations/slack", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:%s", ts.Unix(), body)
+	req.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(ts.Unix(), 10))
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestParseSlackText(t *testing.T) {
+	tests := []struct {
+		text         string
+		wantDest     string
+		wantCustomID string
+		wantOK       bool
+	}{
+		{"https://example.com", "https://example.com", "", true},
+		{"  <https://example.com/a|example.com/a>  launch ", "https://example.com/a", "launch", true},
+		{"<https://example.com>", "https://example.com", "", true},
+		{"", "", "", false},
+		{"https://example.com one two", "", "", false},
+	}
+	for _, tt := range tests {
+		dest, customID, ok := parseSlackText(tt.text)
+		if dest != tt.wantDest || customID != tt.wantCustomID || ok != tt.wantOK {
+			t.Errorf("parseSlackText(%q) = %q, %q, %v", tt.text, dest, customID, ok)
+		}
+	}
+}
+
+func TestSlackCommand(t *testing.T) {
+	t.Setenv("SLACK_SIGNING_SECRET", testSlackSecret)
+	srv := newTestServer(t)
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		req          *http.Request
+		wantStatus   int
+		wantType     string
+		wantContains string
+	}{
+		{"creates", slackRequest(testSlackSecret, now, "https://example.com/launch launch"), http.StatusOK, "in_channel", "/s/launch → https://example.com/launch"},
+		{"taken", slackRequest(testSlackSecret, now, "https://example.com/other launch"), http.StatusOK, "ephemeral", "already exists"},
+		{"usage", slackRequest(testSlackSecret, now, ""), http.StatusOK, "ephemeral", "Usage: /shorten"},
+		{"wrong secret", slackRequest("another-secret", now, "https://example.com"), http.StatusUnauthorized, "", ""},
+		{"replayed", slackRequest(testSlackSecret, now.Add(-10*time.Minute), "https://example.com"), http.StatusUnauthorized, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, tt.req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var reply struct {
+				ResponseType string `json:"response_type"`
+				Text         string `json:"text"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply.ResponseType != tt.wantType || !strings.Contains(reply.Text, tt.wantContains) {
+				t.Errorf("reply = %+v, want %s containing %q", reply, tt.wantType, tt.wantContains)
+			}
+		})
+	}
+
+	if link, err := srv.getLink("launch"); err != nil || link.Owner != "key:slack" {
+		t.Errorf("link from Slack = %+v, %v, want it owned by key:slack", link, err)
+	}
+}
@@ -0,0 +1,282 @@
+// Disable secure option when custom ID is provided
+document.addEventListener('DOMContentLoaded', function() {
+    const customIdInput = document.getElementById('custom_id');
+    const secureCheckbox = document.getElementById('secure');
+    const secureLabel = document.querySelector('label[for="secure"]');
+
+    if (customIdInput && secureCheckbox) {
+        customIdInput.addEventListener('input', function() {
+            if (this.value.trim() !== '') {
+                secureCheckbox.checked = false;
+                secureCheckbox.disabled = true;
+                secureLabel.style.opacity = '0.5';
+                secureLabel.title = 'Secure mode is not available with custom IDs';
+            } else {
+                secureCheckbox.disabled = false;
+                secureLabel.style.opacity = '1';
+                secureLabel.title = '';
+            }
+        });
+    }
+});
+
+// Copy buttons: clicking an element with data-copy puts its value on the
+// clipboard and shows a short confirmation.
+//
+// showToast shows message for a moment. With an action ({label, run}) it
+// adds a button running it, and stays longer to give time to click it.
+function showToast(message, action) {
+    let toast = document.getElementById('toast');
+    if (!toast) {
+        toast = document.createElement('div');
+        toast.id = 'toast';
+        toast.className = 'toast';
+        toast.setAttribute('role', 'status');
+        document.body.appendChild(toast);
+    }
+    toast.textContent = message;
+    if (action) {
+        const button = document.createElement('button');
+        button.type = 'button';
+        button.className = 'toast-action';
+        button.textContent = action.label;
+        button.addEventListener('click', function() {
+            clearTimeout(showToast.timer);
+            toast.classList.remove('visible');
+            button.remove();
+            action.run();
+        });
+        toast.appendChild(button);
+    }
+    toast.classList.add('visible');
+    clearTimeout(showToast.timer);
+    showToast.timer = setTimeout(function() {
+        toast.classList.remove('visible');
+        toast.querySelectorAll('.toast-action').forEach(function(button) {
+            button.remove();
+        });
+    }, action ? 8000 : 2000);
+}
+
+function copyText(text) {
+    if (navigator.clipboard && window.isSecureContext) {
+        return navigator.clipboard.writeText(text);
+    }
+    // The Clipboard API needs HTTPS; fall back to a hidden selection.
+    return new Promise(function(resolve, reject) {
+        const area = document.createElement('textarea');
+        area.value = text;
+        area.style.position = 'fixed';
+        area.style.opacity = '0';
+        document.body.appendChild(area);
+        area.select();
+        const ok = document.execCommand('copy');
+        document.body.removeChild(area);
+        ok ? resolve() : reject(new Error('copy failed'));
+    });
+}
+
+document.addEventListener('click', function(event) {
+    const button = event.target.closest('[data-copy]');
+    if (!button) {
+        return;
+    }
+    event.preventDefault();
+    copyText(button.dataset.copy).then(function() {
+        showToast('Copied ' + button.dataset.copy);
+    }, function() {
+        showToast('Could not copy, select the link instead');
+    });
+});
+
+// Bookmarklet: the link opens the quick page of this instance with the URL
+// of whatever page it is clicked on.
+document.addEventListener('DOMContentLoaded', function() {
+    document.querySelectorAll('[data-bookmarklet]').forEach(function(link) {
+        const quick = location.origin + link.dataset.bookmarklet + '?url=';
+        link.href = 'javascript:void(location.href=' + JSON.stringify(quick) + '+encodeURIComponent(location.href))';
+        link.addEventListener('click', function(event) {
+            event.preventDefault();
+            showToast('Drag the button to your bookmarks bar');
+        });
+    });
+});
+
+// Installable app: register the service worker named by the manifest link.
+if ('serviceWorker' in navigator) {
+    window.addEventListener('load', function() {
+        const manifest = document.querySelector('link[rel="manifest"][data-service-worker]');
+        if (manifest) {
+            navigator.serviceWorker.register(manifest.dataset.serviceWorker).catch(function() {});
+        }
+    });
+}
+
+// createFieldChecks mirror the server's checks of the create form, so most
+// mistakes show up next to their field before anything is sent. Each
+// returns an error message, or '' when the value is fine.
+const createFieldChecks = {
+    url: function(value) {
+        value = value.trim();
+        if (value === '') {
+            return 'URL is required';
+        }
+        try {
+            new URL(value.includes('://') ? value : 'https://' + value);
+        } catch (e) {
+            return 'This is not a valid URL';
+        }
+        return '';
+    },
+    custom_id: function(value) {
+        value = value.trim();
+        if (value === '') {
+            return '';
+        }
+        // Namespaced IDs such as docs/install are checked after the slash;
+        // the server knows which namespaces exist.
+        const slash = value.indexOf('/');
+        if (slash >= 0) {
+            if (!/^[a-z0-9_-]+$/.test(value.slice(0, slash))) {
+                return 'Namespaces can only contain lowercase letters, numbers, dashes, and underscores';
+            }
+            value = value.slice(slash + 1);
+        }
+        if (value.length < 3 || value.length > 50) {
+            return 'Custom IDs are 3 to 50 characters long';
+        }
+        if (!/^[A-Za-z0-9_-]+$/.test(value)) {
+            return 'Custom IDs can only contain letters, numbers, dashes, and underscores';
+        }
+        return '';
+    }
+};
+
+// setFieldError shows message next to the form field name, or clears it
+// when message is ''. It reports whether the field has such a place.
+function setFieldError(form, name, message) {
+    const input = form.elements[name];
+    const error = document.getElementById(name + '-error');
+    if (!input || !error) {
+        return false;
+    }
+    error.textContent = message;
+    error.hidden = message === '';
+    if (message) {
+        input.setAttribute('aria-invalid', 'true');
+    } else {
+        input.removeAttribute('aria-invalid');
+    }
+    return true;
+}
+
+// The create form is checked as it is filled in, then posted in the
+// background so only the result is shown and, when the link is refused,
+// what was typed stays in place with the reason next to its field.
+document.addEventListener('DOMContentLoaded', function() {
+    const form = document.getElementById('create-form');
+    if (!form) {
+        return;
+    }
+    // The checks below replace the browser's own, with clearer messages.
+    form.noValidate = true;
+    const error = document.getElementById('create-error');
+    const showError = function(message) {
+        error.textContent = message;
+        error.hidden = false;
+    };
+    const checkField = function(name) {
+        const message = createFieldChecks[name](form.elements[name].value);
+        setFieldError(form, name, message);
+        return message === '';
+    };
+    Object.keys(createFieldChecks).forEach(function(name) {
+        const input = form.elements[name];
+        input.addEventListener('change', function() {
+            checkField(name);
+        });
+        input.addEventListener('input', function() {
+            // Errors go away as soon as they are fixed, but new ones only
+            // show up once the field is left.
+            if (input.getAttribute('aria-invalid') === 'true') {
+                checkField(name);
+            }
+        });
+    });
+
+    // Custom IDs that pass the checks above are looked up once typing
+    // pauses, so taken and reserved ones show up before submitting.
+    const customID = form.elements.custom_id;
+    let availabilityTimer;
+    customID.addEventListener('input', function() {
+        clearTimeout(availabilityTimer);
+        const value = customID.value.trim();
+        if (!customID.dataset.available || value === '' || createFieldChecks.custom_id(value) !== '') {
+            return;
+        }
+        availabilityTimer = setTimeout(function() {
+            const path = value.split('/').map(encodeURIComponent).join('/');
+            fetch(customID.dataset.available + path, {credentials: 'same-origin'})
+                .then(function(response) {
+                    return response.ok ? response.json() : null;
+                })
+                .then(function(result) {
+                    // Answers for what was typed before are dropped.
+                    if (result && result.id === customID.value.trim()) {
+                        setFieldError(form, 'custom_id', result.available ? '' : result.reason);
+                    }
+                })
+                .catch(function() {});
+        }, 300);
+    });
+
+    form.addEventListener('submit', function(event) {
+        error.hidden = true;
+        const invalid = Object.keys(createFieldChecks).filter(function(name) {
+            return !checkField(name);
+        });
+        if (invalid.length > 0) {
+            event.preventDefault();
+            form.elements[invalid[0]].focus();
+            return;
+        }
+        // CAPTCHA widgets expect a normal form submission.
+        if (form.querySelector('[data-sitekey]')) {
+            return;
+        }
+        event.preventDefault();
+        const button = form.querySelector('button[type="submit"]');
+        button.disabled = true;
+        fetch(form.action, {
+            method: 'POST',
+            headers: {'X-Partial': 'true'},
+            credentials: 'same-origin',
+            body: new URLSearchParams(new FormData(form))
+        }).then(function(resp) {
+            if (resp.redirected) {
+                location.href = resp.url;
+                return;
+            }
+            return resp.text().then(function(text) {
+                if (!resp.ok) {
+                    const field = resp.headers.get('X-Error-Field');
+                    if (field && setFieldError(form, field, text.trim())) {
+                        form.elements[field].focus();
+                    } else {
+                        showError(text.trim());
+                    }
+                    return;
+                }
+                document.getElementById('create-result').innerHTML = text;
+                form.reset();
+                form.querySelectorAll('input').forEach(function(input) {
+                    input.dispatchEvent(new Event('input'));
+                });
+            });
+        }, function() {
+            showError('Could not reach the server, try again');
+        }).finally(function() {
+            button.disabled = false;
+        });
+    });
+});
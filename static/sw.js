@@ -0,0 +1,46 @@
+// Service worker of the installable UI. It keeps the static files
+// available offline and otherwise goes to the network, so link lists and
+// counters are never served stale.
+const CACHE = 'pk-shorts-v1';
+const SCOPE = new URL(self.registration.scope).pathname.replace(/\/$/, '');
+const ASSETS = ['/static/app.js', '/static/theme.js', '/static/theme.css', '/static/icon.svg'].map(function(path) {
+    return SCOPE + path;
+});
+
+self.addEventListener('install', function(event) {
+    event.waitUntil(caches.open(CACHE).then(function(cache) {
+        return cache.addAll(ASSETS);
+    }));
+    self.skipWaiting();
+});
+
+self.addEventListener('activate', function(event) {
+    event.waitUntil(caches.keys().then(function(keys) {
+        return Promise.all(keys.filter(function(key) {
+            return key !== CACHE;
+        }).map(function(key) {
+            return caches.delete(key);
+        }));
+    }));
+    self.clients.claim();
+});
+
+self.addEventListener('fetch', function(event) {
+    const url = new URL(event.request.url);
+    if (event.request.method !== 'GET' || url.origin !== location.origin || !url.pathname.startsWith(SCOPE + '/static/')) {
+        return;
+    }
+    // Static files: answer from the network when possible, refreshing the
+    // cache, and from the cache when offline.
+    event.respondWith(fetch(event.request).then(function(response) {
+        if (response.ok) {
+            const copy = response.clone();
+            caches.open(CACHE).then(function(cache) {
+                cache.put(event.request, copy);
+            });
+        }
+        return response;
+    }).catch(function() {
+        return caches.match(event.request);
+    }));
+});
@@ -0,0 +1,46 @@
+// Color theme: a choice saved with the toggle wins, otherwise the page
+// follows the system's prefers-color-scheme. Loaded in <head> so the theme
+// is set before the page is painted.
+(function() {
+    const root = document.documentElement;
+    const media = window.matchMedia('(prefers-color-scheme: dark)');
+
+    function saved() {
+        try {
+            return localStorage.getItem('theme');
+        } catch (e) {
+            return null;
+        }
+    }
+
+    function apply() {
+        root.dataset.theme = saved() || (media.matches ? 'dark' : 'light');
+    }
+
+    apply();
+    media.addEventListener('change', apply);
+
+    document.addEventListener('DOMContentLoaded', function() {
+        const toggle = document.createElement('button');
+        toggle.type = 'button';
+        toggle.className = 'theme-toggle';
+        function label() {
+            const dark = root.dataset.theme === 'dark';
+            toggle.textContent = dark ? '☀️' : '🌙';
+            toggle.title = dark ? 'Switch to light mode' : 'Switch to dark mode';
+            toggle.setAttribute('aria-label', toggle.title);
+        }
+        toggle.addEventListener('click', function() {
+            const next = root.dataset.theme === 'dark' ? 'light' : 'dark';
+            try {
+                localStorage.setItem('theme', next);
+            } catch (e) {}
+            root.dataset.theme = next;
+            label();
+            document.dispatchEvent(new CustomEvent('themechange', {detail: next}));
+        });
+        media.addEventListener('change', label);
+        label();
+        document.body.appendChild(toggle);
+    });
+})();
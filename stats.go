@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	dailyClicksBucket = "clicks_daily"
+	dayKeyLayout      = "2006-01-02"
+	maxCompareLinks   = 20
+	maxStatsRangeDays = 366
+)
+
+// recordDailyClick increments the per-day click counter for short. Counters
+// live in a nested bucket per link, keyed by UTC date, so a time series can
+// be read back with a single cursor scan.
+func recordDailyClick(tx *bolt.Tx, short string, at time.Time) error {
+	days, err := tx.Bucket([]byte(dailyClicksBucket)).CreateBucketIfNotExists([]byte(short))
+	if err != nil {
+		return err
+	}
+
+	key := []byte(at.UTC().Format(dayKeyLayout))
+	var count uint64
+	if v := days.Get(key); len(v) == 8 {
+		count = binary.BigEndian.Uint64(v)
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, count+1)
+	return days.Put(key, buf)
+}
+
+// deleteDailyClicks drops the click history for short.
+func deleteDailyClicks(tx *bolt.Tx, short string) error {
+	b := tx.Bucket([]byte(dailyClicksBucket))
+	if b.Bucket([]byte(short)) == nil {
+		return nil
+	}
+	return b.DeleteBucket([]byte(short))
+}
+
+// statsDays returns the UTC dates covering the last n days, oldest first and
+// ending today.
+func statsDays(now time.Time, n int) []string {
+	today := now.UTC().Truncate(24 * time.Hour)
+	days := make([]string, n)
+	for i := 0; i < n; i++ {
+		days[i] = today.AddDate(0, 0, i-n+1).Format(dayKeyLayout)
+	}
+	return days
+}
+
+// getDailyClicks returns the click count for short on each of days, which
+// must be sorted ascending. Days without clicks are reported as zero.
+func (s *Server) getDailyClicks(short string, days []string) ([]uint64, error) {
+	counts := make([]uint64, len(days))
+	if len(days) == 0 {
+		return counts, nil
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucketName)).Get([]byte(short)) == nil {
+			return fmt.Errorf("link not found")
+		}
+		b := tx.Bucket([]byte(dailyClicksBucket)).Bucket([]byte(short))
+		if b == nil {
+			return nil
+		}
+
+		index := make(map[string]int, len(days))
+		for i, d := range days {
+			index[d] = i
+		}
+
+		c := b.Cursor()
+		last := []byte(days[len(days)-1])
+		for k, v := c.Seek([]byte(days[0])); k != nil && string(k) <= string(last); k, v = c.Next() {
+			if i, ok := index[string(k)]; ok && len(v) == 8 {
+				counts[i] = binary.BigEndian.Uint64(v)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// parseStatsRange parses a range such as "30d" or "2w" into a number of
+// days.
+func parseStatsRange(value string) (int, error) {
+	if value == "" {
+		return 30, nil
+	}
+	unit := value[len(value)-1]
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid range %q: use e.g. 7d, 30d or 4w", value)
+	}
+	switch unit {
+	case 'd':
+	case 'w':
+		n *= 7
+	default:
+		return 0, fmt.Errorf("invalid range %q: use e.g. 7d, 30d or 4w", value)
+	}
+	if n > maxStatsRangeDays {
+		return 0, fmt.Errorf("range must not exceed %d days", maxStatsRangeDays)
+	}
+	return n, nil
+}
+
+type statsSeries struct {
+	Short          string   `json:"short"`
+	Clicks         []uint64 `json:"clicks"`
+	Total          uint64   `json:"total"`
+	Conversions    uint64   `json:"conversions"`
+	ConversionRate float64  `json:"conversion_rate"`
+}
+
+// handleStatsCompare returns daily click series for several links aligned
+// on the same dates, with their conversions over the range, so campaign
+// variants can be compared directly. Every link must be one the caller may
+// manage.
+func (s *Server) handleStatsCompare(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeRead) {
+		return
+	}
+
+	var shorts []string
+	for _, short := range strings.Split(r.URL.Query().Get("shorts"), ",") {
+		if short = strings.TrimSpace(short); short != "" {
+			shorts = append(shorts, short)
+		}
+	}
+	if len(shorts) == 0 {
+		http.Error(w, "shorts is required", http.StatusBadRequest)
+		return
+	}
+	if len(shorts) > maxCompareLinks {
+		http.Error(w, fmt.Sprintf("At most %d links can be compared", maxCompareLinks), http.StatusBadRequest)
+		return
+	}
+
+	rangeParam := r.URL.Query().Get("range")
+	n, err := parseStatsRange(rangeParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rangeParam == "" {
+		rangeParam = strconv.Itoa(n) + "d"
+	}
+
+	days := statsDays(time.Now(), n)
+	series := make([]statsSeries, 0, len(shorts))
+	for _, short := range shorts {
+		link, err := s.getLink(short)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Link %q not found", short), http.StatusNotFound)
+			return
+		}
+		if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+			http.Error(w, msg, status)
+			return
+		}
+		counts, err := s.getDailyClicks(short, days)
+		if err != nil {
+			http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+			return
+		}
+
+		entry := statsSeries{Short: short, Clicks: counts}
+		for _, c := range counts {
+			entry.Total += c
+		}
+		s.db.View(func(tx *bolt.Tx) error {
+			for _, c := range conversions(tx, short, days).Daily {
+				entry.Conversions += c
+			}
+			return nil
+		})
+		entry.ConversionRate = conversionRate(entry.Conversions, entry.Total)
+		series = append(series, entry)
+	}
+
+	resp := map[string]interface{}{
+		"range":    rangeParam,
+		"interval": "day",
+		"dates":    days,
+		"series":   series,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recentClicksShown is how many of the kept recent clicks the link stats
+// return.
+const recentClicksShown = 20
+
+// linkStats are the statistics of one link. The daily clicks and
+// conversions cover the requested range, and so does the conversion rate;
+// referrers, countries and goals count every recorded click or conversion.
+type linkStats struct {
+	Short     string        `json:"short"`
+	Range     string        `json:"range"`
+	Interval  string        `json:"interval"`
+	Dates     []string      `json:"dates"`
+	Clicks    []uint64      `json:"clicks"`
+	Total     uint64        `json:"total"`
+	AllTime   int           `json:"all_time"`
+	Referrers []sourceCount `json:"referrers"`
+	Countries []sourceCount `json:"countries"`
+	Recent    []ClickEvent  `json:"recent"`
+
+	Conversions           []uint64          `json:"conversions"`
+	ConversionTotal       uint64            `json:"conversion_total"`
+	ConversionRate        float64           `json:"conversion_rate"`
+	AllTimeConversions    uint64            `json:"all_time_conversions"`
+	AllTimeConversionRate float64           `json:"all_time_conversion_rate"`
+	Goals                 []goalConversions `json:"goals"`
+}
+
+// handleLinkStats returns the click and conversion series, referrers,
+// countries, goals and recent clicks of a link to the callers who may
+// manage it.
+func (s *Server) handleLinkStats(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeRead) {
+		return
+	}
+	short := mux.Vars(r)["short"]
+	link, err := s.getLink(short)
+	if err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+
+	rangeParam := r.URL.Query().Get("range")
+	n, err := parseStatsRange(rangeParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rangeParam == "" {
+		rangeParam = strconv.Itoa(n) + "d"
+	}
+
+	days := statsDays(time.Now(), n)
+	counts, err := s.getDailyClicks(short, days)
+	if err != nil {
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+	stats := linkStats{Short: short, Range: rangeParam, Interval: "day", Dates: days, Clicks: counts, AllTime: link.Clicks}
+	for _, c := range counts {
+		stats.Total += c
+	}
+	s.db.View(func(tx *bolt.Tx) error {
+		stats.Referrers, stats.Countries = clickSources(tx, short)
+		stats.Recent = recentClicks(tx, short, recentClicksShown)
+		conv := conversions(tx, short, days)
+		stats.Conversions, stats.AllTimeConversions, stats.Goals = conv.Daily, conv.AllTime, conv.Goals
+		return nil
+	})
+	for _, c := range stats.Conversions {
+		stats.ConversionTotal += c
+	}
+	stats.ConversionRate = conversionRate(stats.ConversionTotal, stats.Total)
+	stats.AllTimeConversionRate = conversionRate(stats.AllTimeConversions, uint64(link.Clicks))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleLinkPage shows the statistics page of a link, which loads its
+// data from handleLinkStats.
+func (s *Server) handleLinkPage(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	link, err := s.getLink(short)
+	if err != nil {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	if s.currentUser(r) == nil {
+		http.Redirect(w, r, s.uiPrefix+"/login", http.StatusSeeOther)
+		return
+	}
+	if status, msg := s.checkCanManage(r, link); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+
+	data := s.pageData(r)
+	data["Link"] = link
+	data["ShortURL"] = s.shortURL(r, link.Domain, short)
+	data["StatsURL"] = s.uiPrefix + "/api/links/" + short + "/stats"
+	if err := s.templates().ExecuteTemplate(w, "link.html", data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
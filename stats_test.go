@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatsRange(t *testing.T) {
+	tests := []struct {
+		value     string
+		days      int
+		shouldErr bool
+	}{
+		{"", 30, false},
+		{"7d", 7, false},
+		{"2w", 14, false},
+		{"0d", 0, true},
+		{"30", 0, true},
+		{"1y", 0, true},
+		{"400d", 0, true},
+	}
+
+	for _, tt := range tests {
+		days, err := parseStatsRange(tt.value)
+		if (err != nil) != tt.shouldErr || days != tt.days {
+			t.Errorf("parseStatsRange(%q) = (%d, %v), want %d, shouldErr %v", tt.value, days, err, tt.days, tt.shouldErr)
+		}
+	}
+}
+
+func TestStatsDays(t *testing.T) {
+	now := time.Date(2024, 3, 2, 15, 0, 0, 0, time.UTC)
+	days := statsDays(now, 3)
+	want := []string{"2024-02-29", "2024-03-01", "2024-03-02"}
+	for i := range want {
+		if days[i] != want[i] {
+			t.Fatalf("statsDays() = %v, want %v", days, want)
+		}
+	}
+}
+
+func TestHandleStatsCompare(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+
+	for _, id := range []string{"variant-a", "variant-b"} {
+		if _, err := srv.createShortLink("https://example.com/"+id, createOptions{CustomID: id, Owner: "alice"}); err != nil {
+			t.Fatalf("createShortLink() error: %v", err)
+		}
+	}
+	if _, err := srv.createShortLink("https://example.com/bob", createOptions{CustomID: "bobs", Owner: "bob"}); err != nil {
+		t.Fatalf("createShortLink() error: %v", err)
+	}
+	srv.incrementClicks("variant-a", ClickEvent{At: time.Now()})
+	srv.incrementClicks("variant-a", ClickEvent{At: time.Now()})
+	srv.incrementClicks("variant-b", ClickEvent{At: time.Now()})
+
+	get := func(cookie *http.Cookie, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", srv.uiPrefix+"/api/stats/compare?"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(alice, "shorts=variant-a,variant-b&range=7d")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Dates  []string      `json:"dates"`
+		Series []statsSeries `json:"series"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(resp.Dates) != 7 || len(resp.Series) != 2 {
+		t.Fatalf("unexpected response shape: %+v", resp)
+	}
+	if resp.Series[0].Total != 2 || resp.Series[0].Clicks[6] != 2 {
+		t.Errorf("variant-a series = %+v, want 2 clicks today", resp.Series[0])
+	}
+	if resp.Series[1].Total != 1 {
+		t.Errorf("variant-b total = %d, want 1", resp.Series[1].Total)
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		query  string
+		want   int
+	}{
+		{"unknown link", alice, "shorts=missing", http.StatusNotFound},
+		{"another user's link among own", bob, "shorts=bobs,variant-a", http.StatusForbidden},
+		{"other user", bob, "shorts=variant-a", http.StatusForbidden},
+		{"anonymous", nil, "shorts=variant-a", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if rr := get(tt.cookie, tt.query); rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleLinkStats(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	if _, err := srv.createShortLink("https://example.com/launch", createOptions{CustomID: "launch", Owner: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.incrementClicks("launch", ClickEvent{At: time.Now().AddDate(0, 0, -10)})
+	srv.incrementClicks("launch", ClickEvent{At: time.Now(), Referrer: "news.example", Country: "DE"})
+
+	get := func(cookie *http.Cookie, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(alice, "/sui/api/links/launch/stats?range=7d")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var stats linkStats
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Dates) != 7 || stats.Total != 1 || stats.AllTime != 2 || stats.Clicks[6] != 1 {
+		t.Errorf("series = %+v, want 1 click in range and 2 in total", stats)
+	}
+	if len(stats.Referrers) != 2 || len(stats.Countries) != 1 || stats.Countries[0].Name != "DE" || len(stats.Recent) != 2 || stats.Recent[0].Referrer != "news.example" {
+		t.Errorf("sources = %+v %+v, recent %+v", stats.Referrers, stats.Countries, stats.Recent)
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		path   string
+		want   int
+	}{
+		{"other user's stats", bob, "/sui/api/links/launch/stats", http.StatusForbidden},
+		{"unknown link", alice, "/sui/api/links/nope/stats", http.StatusNotFound},
+		{"invalid range", alice, "/sui/api/links/launch/stats?range=1y", http.StatusBadRequest},
+		{"page", alice, "/sui/links/launch", http.StatusOK},
+		{"other user's page", bob, "/sui/links/launch", http.StatusForbidden},
+		{"page logged out", nil, "/sui/links/launch", http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		if rr := get(tt.cookie, tt.path); rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.want)
+		}
+	}
+	if body := get(alice, "/sui/links/launch").Body.String(); !strings.Contains(body, "/sui/api/links/launch/stats") || !strings.Contains(body, "https://example.com/launch") {
+		t.Error("stats page does not load the link's stats")
+	}
+}
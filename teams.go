@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	teamsBucket = "teams"
+
+	// teamOwnerPrefix marks links that belong to a team rather than to the
+	// user who created them.
+	teamOwnerPrefix = "team:"
+
+	maxTagLength = 32
+	maxLinkTags  = 10
+)
+
+var (
+	errTeamExists    = errors.New("team already exists")
+	errNotTeamMember = errors.New("you are not a member of this team")
+)
+
+// Team groups users who share a pool of links. Links created for a team
+// are owned by "team:<name>", so every member can list and delete them and
+// quotas are counted for the team as a whole.
+type Team struct {
+	Name      string    `json:"name"`
+	Members   []string  `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasMember reports whether username belongs to the team.
+func (t *Team) HasMember(username string) bool {
+	for _, m := range t.Members {
+		if m == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Owner is the link owner identity of the team.
+func (t *Team) Owner() string {
+	return teamOwnerPrefix + t.Name
+}
+
+// createTeam adds an empty team.
+func (s *Server) createTeam(name string) (*Team, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := validateHandle("team name", name); err != nil {
+		return nil, err
+	}
+
+	team := &Team{Name: name, Members: []string{}, CreatedAt: time.Now()}
+	data, err := json.Marshal(team)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamsBucket))
+		if b.Get([]byte(name)) != nil {
+			return errTeamExists
+		}
+		return b.Put([]byte(name), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// getTeam loads a team by name.
+func (s *Server) getTeam(name string) (*Team, error) {
+	var team *Team
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(teamsBucket)).Get([]byte(name))
+		if data == nil {
+			return fmt.Errorf("team not found")
+		}
+		team = &Team{}
+		return json.Unmarshal(data, team)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// listTeams returns every team, ordered by name.
+func (s *Server) listTeams() ([]Team, error) {
+	var teams []Team
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(teamsBucket)).ForEach(func(k, v []byte) error {
+			var team Team
+			if err := json.Unmarshal(v, &team); err != nil {
+				return err
+			}
+			teams = append(teams, team)
+			return nil
+		})
+	})
+	return teams, err
+}
+
+// userTeams returns the names of the teams username belongs to.
+func (s *Server) userTeams(username string) []string {
+	teams, err := s.listTeams()
+	if err != nil {
+		slog.Error("failed to list teams", "err", err)
+		return nil
+	}
+	var names []string
+	for _, team := range teams {
+		if team.HasMember(username) {
+			names = append(names, team.Name)
+		}
+	}
+	return names
+}
+
+// callerTeams returns the teams of a logged-in user, or nil.
+func (s *Server) callerTeams(user *User) []string {
+	if user == nil {
+		return nil
+	}
+	return s.userTeams(user.Username)
+}
+
+// updateTeam applies fn to the stored team and saves the result.
+func (s *Server) updateTeam(name string, fn func(*bolt.Tx, *Team) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamsBucket))
+		data := b.Get([]byte(name))
+		if data == nil {
+			return fmt.Errorf("team not found")
+		}
+		var team Team
+		if err := json.Unmarshal(data, &team); err != nil {
+			return err
+		}
+		if err := fn(tx, &team); err != nil {
+			return err
+		}
+		data, err := json.Marshal(team)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), data)
+	})
+}
+
+// addTeamMember adds an existing user to a team.
+func (s *Server) addTeamMember(name, username string) error {
+	username = strings.ToLower(strings.TrimSpace(username))
+	return s.updateTeam(name, func(tx *bolt.Tx, team *Team) error {
+		if tx.Bucket([]byte(usersBucket)).Get([]byte(username)) == nil {
+			return fmt.Errorf("user not found")
+		}
+		if !team.HasMember(username) {
+			team.Members = append(team.Members, username)
+		}
+		return nil
+	})
+}
+
+// removeTeamMember removes a user from a team.
+func (s *Server) removeTeamMember(name, username string) error {
+	return s.updateTeam(name, func(tx *bolt.Tx, team *Team) error {
+		team.Members = removeString(team.Members, username)
+		return nil
+	})
+}
+
+// deleteTeam removes a team. Its links are kept; only admins can reach
+// them afterwards.
+func (s *Server) deleteTeam(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamsBucket))
+		if b.Get([]byte(name)) == nil {
+			return fmt.Errorf("team not found")
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// removeUserFromTeams drops username from every team it belongs to.
+func removeUserFromTeams(tx *bolt.Tx, username string) error {
+	b := tx.Bucket([]byte(teamsBucket))
+	updated := make(map[string][]byte)
+	err := b.ForEach(func(k, v []byte) error {
+		var team Team
+		if err := json.Unmarshal(v, &team); err != nil {
+			return err
+		}
+		if !team.HasMember(username) {
+			return nil
+		}
+		team.Members = removeString(team.Members, username)
+		data, err := json.Marshal(team)
+		if err != nil {
+			return err
+		}
+		updated[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, data := range updated {
+		if err := b.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeString(items []string, item string) []string {
+	out := items[:0]
+	for _, it := range items {
+		if it != item {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// teamOwner returns the owner identity for links created for team by the
+// caller, who must be a member (or an admin).
+func (s *Server) teamOwner(r *http.Request, name string) (string, error) {
+	team, err := s.getTeam(strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return "", err
+	}
+	user := s.callerUser(r)
+	if !s.isAdmin(r) && (user == nil || !team.HasMember(user.Username)) {
+		return "", errNotTeamMember
+	}
+	return team.Owner(), nil
+}
+
+// isTeamMember reports whether the caller belongs to the team
+// owning links with the given owner identity.
+func (s *Server) isTeamMember(r *http.Request, owner string) bool {
+	name, ok := strings.CutPrefix(owner, teamOwnerPrefix)
+	if !ok {
+		return false
+	}
+	user := s.callerUser(r)
+	if user == nil {
+		return false
+	}
+	team, err := s.getTeam(name)
+	return err == nil && team.HasMember(user.Username)
+}
+
+// normalizeTags lowercases and de-duplicates tags and checks their format.
+func normalizeTags(tags []string) ([]string, error) {
+	tags = normalizeList(tags)
+	if len(tags) > maxLinkTags {
+		return nil, fmt.Errorf("a link can have at most %d tags", maxLinkTags)
+	}
+	for _, tag := range tags {
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag '%s' is longer than %d characters", tag, maxTagLength)
+		}
+		for _, ch := range tag {
+			if !((ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.') {
+				return nil, fmt.Errorf("tag '%s' can only contain letters, numbers, dots, dashes, and underscores", tag)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// hasTag reports whether the link is tagged with tag.
+func (l *Link) hasTag(tag string) bool {
+	for _, t := range l.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleAdminCreateTeam(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.createTeam(r.FormValue("name")); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errTeamExists) {
+			status = http.StatusConflict
+		}
+		s.renderAdmin(w, r, status, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminAddTeamMember(w http.ResponseWriter, r *http.Request) {
+	if err := s.addTeamMember(mux.Vars(r)["team"], r.FormValue("username")); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminRemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := s.removeTeamMember(vars["team"], vars["username"]); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
+
+func (s *Server) handleAdminDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	if err := s.deleteTeam(mux.Vars(r)["team"]); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		input     []string
+		want      string
+		shouldErr bool
+	}{
+		{nil, "", false},
+		{[]string{" Spring ", "spring", "q1.2024"}, "spring,q1.2024", false},
+		{[]string{"has space"}, "", true},
+		{[]string{strings.Repeat("a", 33)}, "", true},
+		{strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeTags(tt.input)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("normalizeTags(%q) error = %v, shouldErr %v", tt.input, err, tt.shouldErr)
+			continue
+		}
+		if !tt.shouldErr && strings.Join(got, ",") != tt.want {
+			t.Errorf("normalizeTags(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTeamMembership(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "alice")
+
+	if _, err := srv.createTeam("Marketing"); err != nil {
+		t.Fatalf("createTeam() error: %v", err)
+	}
+	if _, err := srv.createTeam("marketing"); err != errTeamExists {
+		t.Errorf("duplicate createTeam() error = %v, want errTeamExists", err)
+	}
+	if err := srv.addTeamMember("marketing", "nobody"); err == nil {
+		t.Error("expected error adding unknown user")
+	}
+	if err := srv.addTeamMember("marketing", "alice"); err != nil {
+		t.Fatalf("addTeamMember() error: %v", err)
+	}
+	if got := srv.userTeams("alice"); len(got) != 1 || got[0] != "marketing" {
+		t.Errorf("userTeams() = %v", got)
+	}
+
+	// Deleting a user drops them from their teams.
+	if err := srv.deleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	team, err := srv.getTeam("marketing")
+	if err != nil || len(team.Members) != 0 {
+		t.Errorf("team after member deletion = %+v, %v", team, err)
+	}
+}
+
+func TestTeamLinks(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "root")
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	mallory := loginAs(t, srv, "mallory")
+
+	if _, err := srv.createTeam("marketing"); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"alice", "bob"} {
+		if err := srv.addTeamMember("marketing", u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	create := func(cookie *http.Cookie, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/api/create", strings.NewReader(body))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+	rr := create(alice, `{"url":"https://example.com/spring","custom_id":"spring","team":"marketing","tags":["Campaign"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("team create status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if rr := create(mallory, `{"url":"https://example.com","team":"marketing"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("non-member team create status = %d, want 403", rr.Code)
+	}
+	if rr := create(alice, `{"url":"https://example.com/own","tags":["other"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("own create status = %d", rr.Code)
+	}
+
+	link, err := srv.getLink("spring")
+	if err != nil || link.Owner != "team:marketing" || len(link.Tags) != 1 || link.Tags[0] != "campaign" {
+		t.Fatalf("team link = %+v, %v", link, err)
+	}
+
+	list := func(cookie *http.Cookie, query string) (int, []Link) {
+		req := httptest.NewRequest("GET", srv.uiPrefix+"/api/list?"+query, nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		var links []Link
+		json.Unmarshal(rr.Body.Bytes(), &links)
+		return rr.Code, links
+	}
+	if code, links := list(bob, "team=marketing"); code != http.StatusOK || len(links) != 1 || links[0].Short != "spring" {
+		t.Errorf("team list = %d, %+v", code, links)
+	}
+	if code, _ := list(mallory, "team=marketing"); code != http.StatusForbidden {
+		t.Errorf("non-member team list status = %d, want 403", code)
+	}
+	if _, links := list(alice, "tag=other"); len(links) != 1 || links[0].Original != "https://example.com/own" {
+		t.Errorf("tag-filtered list = %+v", links)
+	}
+	if _, links := list(alice, "tag=campaign"); len(links) != 0 {
+		t.Errorf("own list should not include team links: %+v", links)
+	}
+
+	for _, path := range []string{"/", "/list?team=marketing&tag=campaign"} {
+		req := httptest.NewRequest("GET", srv.uiPrefix+path, nil)
+		req.AddCookie(alice)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Team marketing") {
+			t.Errorf("GET %s = %d, missing team entry", path, rr.Code)
+		}
+	}
+
+	// Any member may delete a team link; outsiders may not.
+	del := func(cookie *http.Cookie) int {
+		req := httptest.NewRequest("DELETE", srv.uiPrefix+"/api/delete/spring", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := del(mallory); code != http.StatusForbidden {
+		t.Errorf("non-member delete status = %d, want 403", code)
+	}
+	if code := del(bob); code != http.StatusOK {
+		t.Errorf("member delete status = %d, want 200", code)
+	}
+}
+
+func TestAdminTeamManagement(t *testing.T) {
+	srv := newTestServer(t)
+	admin := loginAs(t, srv, "root")
+	loginAs(t, srv, "alice")
+
+	post := func(path string, form url.Values) int {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/admin"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(admin)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := post("/teams", url.Values{"name": {"sales"}}); code != http.StatusSeeOther {
+		t.Fatalf("create team status = %d", code)
+	}
+	if code := post("/teams/sales/members", url.Values{"username": {"alice"}}); code != http.StatusSeeOther {
+		t.Fatalf("add member status = %d", code)
+	}
+	if teams := srv.userTeams("alice"); len(teams) != 1 {
+		t.Errorf("alice teams = %v", teams)
+	}
+	if code := post("/teams/sales/members/alice/remove", nil); code != http.StatusSeeOther {
+		t.Fatalf("remove member status = %d", code)
+	}
+	if teams := srv.userTeams("alice"); len(teams) != 0 {
+		t.Errorf("alice teams after removal = %v", teams)
+	}
+	if code := post("/teams/sales/delete", nil); code != http.StatusSeeOther {
+		t.Fatalf("delete team status = %d", code)
+	}
+	if _, err := srv.getTeam("sales"); err == nil {
+		t.Error("team should be deleted")
+	}
+
+	req := httptest.NewRequest("GET", srv.uiPrefix+"/admin", nil)
+	req.AddCookie(admin)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("admin page status = %d", rr.Code)
+	}
+}
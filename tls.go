@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig configures HTTPS termination, either with a certificate and
+// key from disk or with certificates obtained from Let's Encrypt.
+type TLSConfig struct {
+	// Cert and Key are PEM files; the certificate may include the chain.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+
+	Autocert AutocertConfig `yaml:"autocert"`
+}
+
+// AutocertConfig requests certificates from Let's Encrypt for Domains.
+// Certificates are kept in CacheDir so restarts don't hit the rate limits,
+// and HTTPPort serves the HTTP-01 challenges and redirects everything else
+// to HTTPS.
+type AutocertConfig struct {
+	Domains  []string `yaml:"domains"`
+	Email    string   `yaml:"email"`
+	CacheDir string   `yaml:"cache_dir"`
+	HTTPPort string   `yaml:"http_port"`
+}
+
+// enabled reports whether HTTPS is configured.
+func (c TLSConfig) enabled() bool {
+	return c.Cert != "" || c.Key != "" || len(c.Autocert.Domains) > 0
+}
+
+// serverTLS returns the TLS settings for the listener and, with autocert,
+// the handler to run on the plain HTTP port.
+func (c TLSConfig) serverTLS() (*tls.Config, http.Handler, error) {
+	if len(c.Autocert.Domains) == 0 {
+		tlsConfig, err := c.serverTLSConfig()
+		return tlsConfig, nil, err
+	}
+	if c.Cert != "" || c.Key != "" {
+		return nil, nil, fmt.Errorf("TLS certificate files and autocert domains are mutually exclusive")
+	}
+	m := c.Autocert.manager()
+	tlsConfig := m.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return tlsConfig, m.HTTPHandler(nil), nil
+}
+
+// serverTLSConfig loads the certificate pair, so a bad path fails at
+// startup rather than on the first handshake, and returns the TLS settings
+// for the listener: TLS 1.2 or later, with Go's default cipher suites,
+// which only include AEAD ciphers with forward secrecy for TLS 1.2.
+func (c TLSConfig) serverTLSConfig() (*tls.Config, error) {
+	if c.Cert == "" || c.Key == "" {
+		return nil, fmt.Errorf("both a TLS certificate (TLS_CERT) and key (TLS_KEY) are required")
+	}
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// manager builds the autocert manager. Only the configured domains are
+// allowed, so requests for other hostnames can't trigger issuance.
+func (c AutocertConfig) manager() *autocert.Manager {
+	var domains []string
+	for _, d := range c.Domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(c.CacheDir),
+		Email:      c.Email,
+	}
+}
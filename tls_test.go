@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for localhost and returns
+// the certificate and key paths.
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	certPath, keyPath := writeTestCert(t)
+
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		wantErr bool
+	}{
+		{"valid pair", TLSConfig{Cert: certPath, Key: keyPath}, false},
+		{"missing key", TLSConfig{Cert: certPath}, true},
+		{"unreadable file", TLSConfig{Cert: certPath, Key: certPath + ".missing"}, true},
+		{"swapped files", TLSConfig{Cert: keyPath, Key: certPath}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.cfg.enabled() {
+				t.Fatal("config with files should be enabled")
+			}
+			if _, err := tt.cfg.serverTLSConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("serverTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSRejectsOldVersions(t *testing.T) {
+	certPath, keyPath := writeTestCert(t)
+	tlsConfig, err := TLSConfig{Cert: certPath, Key: keyPath}.serverTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(maxVersion uint16) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         maxVersion,
+		}}}
+		resp, err := client.Get(ts.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(tls.VersionTLS11); err == nil {
+		t.Error("TLS 1.1 handshake succeeded")
+	}
+	if err := get(tls.VersionTLS12); err != nil {
+		t.Errorf("TLS 1.2 handshake failed: %v", err)
+	}
+}
+
+func TestAutocert(t *testing.T) {
+	cfg := TLSConfig{Autocert: AutocertConfig{Domains: []string{"Go.Example.com "}, CacheDir: t.TempDir()}}
+	if !cfg.enabled() {
+		t.Fatal("autocert config should be enabled")
+	}
+
+	tlsConfig, challenge, err := cfg.serverTLS()
+	if err != nil {
+		t.Fatalf("serverTLS() error: %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.GetCertificate == nil {
+		t.Errorf("TLS config = %+v, want TLS 1.2+ with certificates from autocert", tlsConfig)
+	}
+
+	rr := httptest.NewRecorder()
+	challenge.ServeHTTP(rr, httptest.NewRequest("GET", "http://go.example.com/s/abc?x=1", nil))
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://go.example.com/s/abc?x=1" {
+		t.Errorf("plain HTTP request = %d to %q, want a redirect to HTTPS", rr.Code, rr.Header().Get("Location"))
+	}
+
+	policy := cfg.Autocert.manager().HostPolicy
+	if err := policy(context.Background(), "go.example.com"); err != nil {
+		t.Errorf("configured domain rejected: %v", err)
+	}
+	if err := policy(context.Background(), "other.example.com"); err == nil {
+		t.Error("unconfigured domain accepted")
+	}
+
+	cfg.Cert, cfg.Key = writeTestCert(t)
+	if _, _, err := cfg.serverTLS(); err == nil {
+		t.Error("expected an error combining certificate files with autocert")
+	}
+}
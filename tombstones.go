@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// tombstonesBucket keeps a Tombstone per deleted link, keyed like the
+// creation-date index by deletion time and short code.
+const tombstonesBucket = "tombstones"
+
+// maxDeleteReason caps the length of a deletion reason.
+const maxDeleteReason = 500
+
+var errReasonRequired = errors.New("a reason is required to delete links")
+
+// Tombstone records who deleted a link, when and why, together with what
+// the link was, so removals can be investigated later.
+type Tombstone struct {
+	Short     string    `json:"short"`
+	Original  string    `json:"original"`
+	Domain    string    `json:"domain,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Clicks    int       `json:"clicks"`
+	DeletedBy string    `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// putTombstone stores t in tx.
+func putTombstone(tx *bolt.Tx, t Tombstone) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(tombstonesBucket)).Put(createdIndexKey(t.DeletedAt, t.Short), data)
+}
+
+// listTombstones returns up to limit tombstones, newest first, of short
+// or of every link when short is empty. limit <= 0 means no limit.
+func (s *Server) listTombstones(short string, limit int) ([]Tombstone, error) {
+	tombstones := []Tombstone{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(tombstonesBucket)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if short != "" {
+				if _, keyShort, err := parseCreatedIndexKey(k); err != nil || keyShort != short {
+					continue
+				}
+			}
+			var t Tombstone
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			tombstones = append(tombstones, t)
+			if limit > 0 && len(tombstones) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	return tombstones, err
+}
+
+// deleteActor names who is deleting with r for the tombstone: the user or
+// API key, the admin token, or an anonymous holder of a deletion token.
+func (s *Server) deleteActor(r *http.Request) string {
+	if owner, _ := s.callerOwner(r); owner != "" {
+		return owner
+	}
+	if s.isAdmin(r) {
+		return "admin token"
+	}
+	return "anonymous"
+}
+
+// deleteReason returns the reason sent with a delete request in the
+// reason form or query parameter, or errReasonRequired when the settings
+// require one and none was given.
+func (s *Server) deleteReason(r *http.Request) (string, error) {
+	return s.checkDeleteReason(r.FormValue("reason"))
+}
+
+// checkDeleteReason trims reason to maxDeleteReason, or returns
+// errReasonRequired when the settings require one and it is empty.
+func (s *Server) checkDeleteReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxDeleteReason {
+		reason = reason[:maxDeleteReason]
+	}
+	if reason == "" && s.getSettings().RequireDeleteReason {
+		return "", errReasonRequired
+	}
+	return reason, nil
+}
+
+// handleAdminTombstones lists deleted links, newest first, optionally for
+// one ?short= and up to ?limit= entries (default 100).
+func (s *Server) handleAdminTombstones(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	tombstones, err := s.listTombstones(r.URL.Query().Get("short"), limit)
+	if err != nil {
+		http.Error(w, "Failed to get deletions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tombstones)
+}
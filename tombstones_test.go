@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeletionTombstones(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	t.Setenv("API_KEYS", "crm:k1")
+	srv := newTestServer(t)
+	for _, short := range []string{"first", "second"} {
+		if _, err := srv.createShortLink("https://example.com/"+short, createOptions{CustomID: short, Owner: "key:crm"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.incrementClicks("first", ClickEvent{At: time.Now()})
+
+	del := func(short, query string) int {
+		req := httptest.NewRequest("DELETE", "/sui/api/delete/"+short+query, nil)
+		req.Header.Set("X-API-Key", "k1")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := del("first", "?reason=campaign+ended"); code != http.StatusOK {
+		t.Fatalf("delete status = %d", code)
+	}
+
+	settings := srv.getSettings()
+	settings.RequireDeleteReason = true
+	if err := srv.saveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if code := del("second", ""); code != http.StatusBadRequest {
+		t.Errorf("delete without a reason = %d, want 400", code)
+	}
+	if _, err := srv.getLink("second"); err != nil {
+		t.Error("link deleted although the reason was missing")
+	}
+	if code := del("second", "?reason=typo"); code != http.StatusOK {
+		t.Fatalf("delete with a reason = %d", code)
+	}
+
+	list := func(query string) []Tombstone {
+		req := httptest.NewRequest("GET", "/sui/api/admin/deletions"+query, nil)
+		req.Header.Set("X-Admin-Token", "secret")
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list status = %d", rr.Code)
+		}
+		var tombstones []Tombstone
+		json.NewDecoder(rr.Body).Decode(&tombstones)
+		return tombstones
+	}
+	all := list("")
+	if len(all) != 2 || all[0].Short != "second" || all[1].Short != "first" {
+		t.Fatalf("tombstones = %+v, want newest first", all)
+	}
+	first := all[1]
+	if first.DeletedBy != "key:crm" || first.Reason != "campaign ended" || first.Original != "https://example.com/first" || first.Clicks != 1 || first.Owner != "key:crm" {
+		t.Errorf("tombstone = %+v", first)
+	}
+	if got := list("?short=first"); len(got) != 1 || got[0].Short != "first" {
+		t.Errorf("tombstones of first = %+v", got)
+	}
+	if got := list("?limit=1"); len(got) != 1 || got[0].Short != "second" {
+		t.Errorf("limited tombstones = %+v", got)
+	}
+
+	req := httptest.NewRequest("GET", "/sui/api/admin/deletions", nil)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("non-admin list = %d, want 403", rr.Code)
+	}
+}
+
+func TestDeleteReasonLength(t *testing.T) {
+	srv := newTestServer(t)
+	req := httptest.NewRequest("POST", "/", strings.NewReader("reason="+strings.Repeat("x", maxDeleteReason+1)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	reason, err := srv.deleteReason(req)
+	if err != nil || len(reason) != maxDeleteReason {
+		t.Errorf("deleteReason() = %d characters, %v", len(reason), err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportRows caps the rows of one CSV import.
+const maxImportRows = 1000
+
+// importRow is one row of an imported CSV file and what importing it does
+// or did.
+type importRow struct {
+	Line      int        `json:"line"`
+	Short     string     `json:"short,omitempty"`
+	URL       string     `json:"url"`
+	Tags      []string   `json:"tags,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Status is "new", "conflict" when the short code is taken, or
+	// "invalid"; importing turns new rows into "created" or "failed".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// parseImportCSV reads links from CSV with a header row naming the
+// columns: url is required; short, tags (separated by spaces or
+// semicolons) and expires_at are optional, and any other columns, such as
+// the rest of a CSV export, are ignored. Rows with bad tags or expiry are
+// returned as invalid rather than failing the whole file.
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("the first row must name the columns, including url")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("at most %d links can be imported at once", maxImportRows)
+		}
+		line, _ := cr.FieldPos(0)
+		row := importRow{Line: line, Short: field(record, "short"), URL: field(record, "url")}
+		if row.URL == "" && row.Short == "" {
+			continue
+		}
+		tags := strings.FieldsFunc(field(record, "tags"), func(r rune) bool { return r == ' ' || r == ';' })
+		if row.Tags, err = normalizeTags(tags); err != nil {
+			row.Status, row.Error = "invalid", err.Error()
+		}
+		if v := field(record, "expires_at"); v != "" && row.Status == "" {
+			t, err := parseTimeParam(v)
+			if err != nil {
+				row.Status, row.Error = "invalid", err.Error()
+			} else {
+				row.ExpiresAt = &t
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// checkImport sets the status of the rows not yet found invalid, as
+// importing them now would: conflict when the short code is taken or
+// repeated in the file, invalid when the destination or short code is
+// refused, and new otherwise.
+func (s *Server) checkImport(rows []importRow) {
+	seen := make(map[string]bool)
+	for i := range rows {
+		row := &rows[i]
+		if row.Status != "" {
+			continue
+		}
+		if row.URL == "" {
+			row.Status, row.Error = "invalid", "url is required"
+			continue
+		}
+		row.URL = s.destinations.withDefaultScheme(row.URL)
+		if row.Short != "" {
+			if err := validateCustomID(row.Short); err != nil {
+				row.Status, row.Error = "invalid", err.Error()
+				continue
+			}
+			if _, err := s.getLink(row.Short); err == nil || seen[row.Short] {
+				row.Status, row.Error = "conflict", "short code already taken"
+				continue
+			}
+			seen[row.Short] = true
+		}
+		if err := s.checkDestination(row.URL); err != nil {
+			row.Status, row.Error = "invalid", err.Error()
+			continue
+		}
+		row.Status = "new"
+	}
+}
+
+// commitImport creates the links of the new rows for owner.
+func (s *Server) commitImport(rows []importRow, owner, system string) {
+	for i := range rows {
+		row := &rows[i]
+		if row.Status != "new" {
+			continue
+		}
+		short, err := s.createShortLink(row.URL, createOptions{
+			CustomID:  row.Short,
+			System:    system,
+			Owner:     owner,
+			Tags:      row.Tags,
+			ExpiresAt: row.ExpiresAt,
+		})
+		if err != nil {
+			row.Status, row.Error = "failed", err.Error()
+			continue
+		}
+		row.Short, row.Status = short, "created"
+	}
+}
+
+// importCounts counts the rows by status.
+func importCounts(rows []importRow) map[string]int {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Status]++
+	}
+	return counts
+}
+
+// importCSV returns the CSV text of an import request: a multipart upload
+// in the file field, or the csv field, or else the request body.
+func importCSV(r *http.Request) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		data, err := io.ReadAll(r.Body)
+		return string(data), err
+	}
+	file, _, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return r.FormValue("csv"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	return string(data), err
+}
+
+// handleAPIImport creates links from CSV. With ?dry_run=true nothing is
+// created, and the response shows what importing would do with each row.
+func (s *Server) handleAPIImport(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeCreate) {
+		return
+	}
+	owner, _ := s.callerOwner(r)
+	if owner == "" {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	text, err := importCSV(r)
+	if err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	rows, err := parseImportCSV(strings.NewReader(text))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.checkImport(rows)
+	if r.URL.Query().Get("dry_run") != "true" {
+		system, _ := s.apiKeySystem(r)
+		s.commitImport(rows, owner, system)
+		requestLogger(r).Info("links imported", "rows", len(rows), "created", importCounts(rows)["created"])
+	}
+	if rows == nil {
+		rows = []importRow{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rows":   rows,
+		"counts": importCounts(rows),
+	})
+}
+
+// writeLinksCSV writes links as CSV with a header row, in a format
+// parseImportCSV reads back.
+func writeLinksCSV(w io.Writer, links []Link, shortURL func(*Link) string) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"short", "short_url", "url", "tags", "created_at", "clicks", "expires_at"})
+	for i := range links {
+		link := &links[i]
+		var expires string
+		if link.ExpiresAt != nil {
+			expires = link.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			link.Short,
+			shortURL(link),
+			link.Original,
+			strings.Join(link.Tags, " "),
+			link.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(link.Clicks),
+			expires,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// handleAPIExport downloads the links the list API would return, as
+// ?format=csv (default) or json, the format the import command reads.
+func (s *Server) handleAPIExport(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeRead) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+	match, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+	links, err := s.getLinksCreatedBetween(time.Time{}, time.Time{}, 0, match)
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "links-" + time.Now().UTC().Format("2006-01-02") + "." + format
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		writeJSONLinks(w, s.prefix, links)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writeLinksCSV(w, links, func(link *Link) string { return s.shortURL(r, link.Domain, link.Short) })
+}
+
+// handleTools shows the import and export page. Uploading a CSV file
+// previews it; confirming the preview imports the new rows.
+func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if user == nil {
+		http.Redirect(w, r, s.uiPrefix+"/login", http.StatusSeeOther)
+		return
+	}
+
+	data := s.pageData(r)
+	if r.Method == http.MethodPost {
+		text, err := importCSV(r)
+		var rows []importRow
+		if err == nil {
+			rows, err = parseImportCSV(strings.NewReader(text))
+		}
+		if err != nil {
+			data["ImportError"] = err.Error()
+		} else {
+			s.checkImport(rows)
+			if r.FormValue("confirm") == "true" {
+				s.commitImport(rows, user.Username, "")
+				requestLogger(r).Info("links imported", "rows", len(rows), "created", importCounts(rows)["created"])
+				data["Imported"] = true
+			}
+			data["CSV"] = text
+			data["Rows"] = rows
+			data["Counts"] = importCounts(rows)
+		}
+	}
+	if err := s.templates().ExecuteTemplate(w, "tools.html", data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
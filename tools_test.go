@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		csv       string
+		rows      int
+		status    string
+		shouldErr bool
+	}{
+		{"url only", "url\nhttps://example.com/a\n", 1, "", false},
+		{"all columns", "short,url,tags,expires_at\npromo,https://example.com,spring;sale,2030-01-01T00:00:00Z\n", 1, "", false},
+		{"byte order mark", "\ufeffurl,short\nhttps://example.com,promo\n", 1, "", false},
+		{"blank rows skipped", "url\n\nhttps://example.com\n,\n", 1, "", false},
+		{"invalid tag", "url,tags\nhttps://example.com,bad/tag\n", 1, "invalid", false},
+		{"invalid expiry", "url,expires_at\nhttps://example.com,soon\n", 1, "invalid", false},
+		{"missing url column", "short\npromo\n", 0, "", true},
+		{"empty file", "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		rows, err := parseImportCSV(strings.NewReader(tt.csv))
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: error = %v, shouldErr %v", tt.name, err, tt.shouldErr)
+			continue
+		}
+		if len(rows) != tt.rows {
+			t.Errorf("%s: got %d rows, want %d", tt.name, len(rows), tt.rows)
+			continue
+		}
+		if tt.rows > 0 && rows[0].Status != tt.status {
+			t.Errorf("%s: status = %q (%s), want %q", tt.name, rows[0].Status, rows[0].Error, tt.status)
+		}
+	}
+
+	rows, _ := parseImportCSV(strings.NewReader("short,url,tags,expires_at\npromo,https://example.com,spring sale,2030-01-01T00:00:00Z\n"))
+	if rows[0].Line != 2 || rows[0].Short != "promo" || len(rows[0].Tags) != 2 || rows[0].ExpiresAt == nil {
+		t.Errorf("parsed row = %+v", rows[0])
+	}
+}
+
+func TestCheckImport(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "taken"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := parseImportCSV(strings.NewReader("short,url\ntaken,https://example.com/1\nfresh,https://example.com/2\nfresh,https://example.com/3\n,example.com/4\nx,https://example.com/5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.checkImport(rows)
+	want := []string{"conflict", "new", "conflict", "new", "invalid"}
+	for i, status := range want {
+		if rows[i].Status != status {
+			t.Errorf("row %d status = %q (%s), want %q", i, rows[i].Status, rows[i].Error, status)
+		}
+	}
+	if rows[3].URL != "https://example.com/4" {
+		t.Errorf("URL without scheme = %q, want https added", rows[3].URL)
+	}
+}
+
+func TestAPIImport(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	body := "short,url,tags\npromo,https://example.com/promo,spring\n,https://example.com/random,\n"
+
+	post := func(path string) (int, map[string]int) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		req.AddCookie(alice)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		var resp struct {
+			Counts map[string]int `json:"counts"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp.Counts
+	}
+
+	if code, counts := post("/sui/api/import?dry_run=true"); code != http.StatusOK || counts["new"] != 2 {
+		t.Fatalf("dry run = %d %v, want 2 new", code, counts)
+	}
+	if _, err := srv.getLink("promo"); err == nil {
+		t.Fatal("dry run created a link")
+	}
+	if code, counts := post("/sui/api/import"); code != http.StatusOK || counts["created"] != 2 {
+		t.Fatalf("import = %d %v, want 2 created", code, counts)
+	}
+	link, err := srv.getLink("promo")
+	if err != nil || link.Owner != "alice" || len(link.Tags) != 1 {
+		t.Errorf("imported link = %+v, %v", link, err)
+	}
+	if _, counts := post("/sui/api/import?dry_run=true"); counts["conflict"] != 1 || counts["new"] != 1 {
+		t.Errorf("second dry run = %v, want the custom short code in conflict", counts)
+	}
+
+	req := httptest.NewRequest("POST", "/sui/api/import", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous import status = %d, want 401", rr.Code)
+	}
+}
+
+func TestAPIExportRoundTrip(t *testing.T) {
+	srv := newTestServer(t)
+	alice := loginAs(t, srv, "alice")
+	expires := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	if _, err := srv.createShortLink("https://example.com/a", createOptions{CustomID: "exported", Owner: "alice", Tags: []string{"spring", "sale"}, ExpiresAt: &expires}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.createShortLink("https://example.com/b", createOptions{CustomID: "someone-else", Owner: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.AddCookie(alice)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/sui/api/export")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export = %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "attachment") {
+		t.Error("export is not a download")
+	}
+	rows, err := parseImportCSV(rr.Body)
+	if err != nil {
+		t.Fatalf("export does not parse as an import: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Short != "exported" || rows[0].URL != "https://example.com/a" ||
+		strings.Join(rows[0].Tags, ",") != "spring,sale" || rows[0].ExpiresAt == nil || !rows[0].ExpiresAt.Equal(expires) {
+		t.Errorf("exported rows = %+v", rows)
+	}
+
+	rr = get("/sui/api/export?format=json")
+	var links []map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&links); err != nil || len(links) != 1 {
+		t.Errorf("JSON export = %v, %v", links, err)
+	}
+	if rr := get("/sui/api/export?format=xml"); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown format status = %d, want 400", rr.Code)
+	}
+}
+
+func TestToolsPage(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "root")
+	alice := loginAs(t, srv, "alice")
+	if _, err := srv.createShortLink("https://example.com", createOptions{CustomID: "taken"}); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(fields map[string]string, file string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for name, value := range fields {
+			mw.WriteField(name, value)
+		}
+		if file != "" {
+			fw, _ := mw.CreateFormFile("file", "links.csv")
+			fw.Write([]byte(file))
+		}
+		mw.Close()
+		req := httptest.NewRequest("POST", "/sui/tools", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.AddCookie(alice)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req := httptest.NewRequest("GET", "/sui/tools", nil)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("logged out status = %d, want 303", rr.Code)
+	}
+
+	csv := "short,url\ntaken,https://example.com/1\nfresh,https://example.com/2\n"
+	rr = upload(nil, csv)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Import 1 links") || !strings.Contains(body, `class="status conflict"`) {
+		t.Fatalf("preview = %d, missing confirm button or conflict row", rr.Code)
+	}
+	if _, err := srv.getLink("fresh"); err == nil {
+		t.Fatal("preview created a link")
+	}
+
+	rr = upload(map[string]string{"csv": csv, "confirm": "true"}, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Created 1 links") {
+		t.Fatalf("confirm = %d, missing result", rr.Code)
+	}
+	if link, err := srv.getLink("fresh"); err != nil || link.Owner != "alice" {
+		t.Errorf("imported link = %+v, %v", link, err)
+	}
+
+	if rr := upload(nil, "short\nfresh\n"); !strings.Contains(rr.Body.String(), "must name the columns") {
+		t.Error("invalid file error is not shown")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	qrcode "github.com/skip2/go-qrcode"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	totpIssuer = "PK Shorts"
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods before or after the current one are
+	// accepted, to tolerate clock drift.
+	totpSkew = 1
+
+	backupCodeCount = 10
+
+	// A password login on an account with two-factor enabled only starts a
+	// pending login, identified by its own cookie, which the second step
+	// turns into a real session.
+	pendingLoginCookieName = "pk_login"
+	pendingLoginTTL        = 5 * time.Minute
+	maxPendingLoginTries   = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random 160-bit secret, base32 encoded as
+// authenticator apps expect.
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// validTOTPSecret reports whether secret looks like one from newTOTPSecret.
+func validTOTPSecret(secret string) bool {
+	key, err := totpEncoding.DecodeString(secret)
+	return err == nil && len(key) == 20
+}
+
+// hotp computes the RFC 4226 one-time password for counter.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP checks code against secret at now (RFC 6238). To stop a code
+// from being replayed, only time steps after lastStep are accepted; the
+// matching step is returned so the caller can store it.
+func verifyTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI is the otpauth:// URI encoded in the enrollment QR code.
+func totpURI(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// qrDataURL renders content as a PNG QR code data URL for an <img> tag.
+func qrDataURL(content string) (template.URL, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+func hashBackupCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newBackupCodes returns single-use recovery codes and their hashes.
+func newBackupCodes() (codes, hashes []string, err error) {
+	for i := 0; i < backupCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashBackupCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// checkSecondFactor verifies a TOTP or backup code for user, recording
+// the used time step or consuming the backup code.
+func (s *Server) checkSecondFactor(username, code string) error {
+	return s.updateUser(username, func(u *User) error {
+		if u.TOTPSecret == "" {
+			return fmt.Errorf("two-factor authentication is not enabled")
+		}
+		if step, ok := verifyTOTP(u.TOTPSecret, code, time.Now(), u.TOTPLastStep); ok {
+			u.TOTPLastStep = step
+			return nil
+		}
+		hash := hashBackupCode(code)
+		for i, h := range u.BackupCodes {
+			if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				u.BackupCodes = append(u.BackupCodes[:i], u.BackupCodes[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid authentication code")
+	})
+}
+
+// startPendingLogin records that username passed the password check and
+// still owes a second factor.
+func (s *Server) startPendingLogin(w http.ResponseWriter, r *http.Request, username string) error {
+	now := time.Now()
+	token, err := s.storeSession(Session{
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(pendingLoginTTL),
+		Pending:   true,
+	})
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingLoginCookieName,
+		Value:    token,
+		Path:     s.uiPrefix + "/login",
+		MaxAge:   int(pendingLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.scheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// pendingLogin returns the pending login of the request, counting one more
+// attempt. Logins past their expiry or attempt limit are discarded.
+func (s *Server) pendingLogin(r *http.Request) (token string, sess *Session) {
+	cookie, err := r.Cookie(pendingLoginCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", nil
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(sessionsBucket))
+		key := hashSessionToken(cookie.Value)
+		data := b.Get(key)
+		if data == nil {
+			return fmt.Errorf("login not found")
+		}
+		sess = &Session{}
+		if err := json.Unmarshal(data, sess); err != nil {
+			return err
+		}
+		if !sess.Pending {
+			sess = nil
+			return nil
+		}
+		sess.Attempts++
+		if time.Now().After(sess.ExpiresAt) || sess.Attempts > maxPendingLoginTries {
+			sess = nil
+			return b.Delete(key)
+		}
+		data, err := json.Marshal(sess)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, data)
+	})
+	if err != nil || sess == nil {
+		return "", nil
+	}
+	return cookie.Value, sess
+}
+
+func clearPendingLoginCookie(w http.ResponseWriter, uiPrefix string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingLoginCookieName,
+		Value:    "",
+		Path:     uiPrefix + "/login",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	token, pending := s.pendingLogin(r)
+	if pending == nil {
+		clearPendingLoginCookie(w, s.uiPrefix)
+		s.renderAuthPage(w, r, "login.html", http.StatusUnauthorized, "Your login has expired, please log in again", "")
+		return
+	}
+
+	if err := s.checkSecondFactor(pending.Username, r.FormValue("code")); err != nil {
+		data := s.pageData(r)
+		data["TwoFactor"] = true
+		data["Error"] = err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		if err := s.templates().ExecuteTemplate(w, "login.html", data); err != nil {
+			requestLogger(r).Error("template error", "err", err)
+		}
+		return
+	}
+
+	if err := s.deleteSession(token); err != nil {
+		requestLogger(r).Error("failed to delete pending login", "err", err)
+	}
+	clearPendingLoginCookie(w, s.uiPrefix)
+
+	sessionToken, err := s.createSession(pending.Username)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	s.setSessionCookie(w, r, sessionToken)
+	http.Redirect(w, r, s.uiPrefix+"/", http.StatusSeeOther)
+}
+
+// handleEnableTwoFactor confirms enrollment: the secret shown on the
+// account page is saved once the user proves their app generates codes
+// for it.
+func (s *Server) handleEnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	secret := r.FormValue("secret")
+	if !validTOTPSecret(secret) {
+		s.renderAccount(w, r, http.StatusBadRequest, "Invalid secret", nil, "")
+		return
+	}
+	step, ok := verifyTOTP(secret, r.FormValue("code"), time.Now(), 0)
+	if !ok {
+		s.renderAccount(w, r, http.StatusBadRequest, "That code didn't match, check your device's clock and try again", nil, "")
+		return
+	}
+
+	codes, hashes, err := newBackupCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate backup codes", http.StatusInternalServerError)
+		return
+	}
+	err = s.updateUser(user.Username, func(u *User) error {
+		if u.TOTPSecret != "" {
+			return fmt.Errorf("two-factor authentication is already enabled")
+		}
+		u.TOTPSecret = secret
+		u.TOTPLastStep = step
+		u.BackupCodes = hashes
+		return nil
+	})
+	if err != nil {
+		s.renderAccount(w, r, http.StatusBadRequest, err.Error(), nil, "")
+		return
+	}
+	s.renderAccount(w, r, http.StatusOK, "", codes, "")
+}
+
+// handleDisableTwoFactor turns two-factor off after checking a current
+// code, so a hijacked session alone can't remove it.
+func (s *Server) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if err := s.checkSecondFactor(user.Username, r.FormValue("code")); err != nil {
+		s.renderAccount(w, r, http.StatusBadRequest, err.Error(), nil, "")
+		return
+	}
+	if err := s.updateUser(user.Username, resetTwoFactor); err != nil {
+		http.Error(w, "Failed to update account", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/account", http.StatusSeeOther)
+}
+
+// handleRegenerateBackupCodes replaces the user's backup codes.
+func (s *Server) handleRegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
+	user := s.currentUser(r)
+	if err := s.checkSecondFactor(user.Username, r.FormValue("code")); err != nil {
+		s.renderAccount(w, r, http.StatusBadRequest, err.Error(), nil, "")
+		return
+	}
+	codes, hashes, err := newBackupCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate backup codes", http.StatusInternalServerError)
+		return
+	}
+	err = s.updateUser(user.Username, func(u *User) error {
+		u.BackupCodes = hashes
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to update account", http.StatusInternalServerError)
+		return
+	}
+	s.renderAccount(w, r, http.StatusOK, "", codes, "")
+}
+
+func resetTwoFactor(u *User) error {
+	u.TOTPSecret = ""
+	u.TOTPLastStep = 0
+	u.BackupCodes = nil
+	return nil
+}
+
+// handleAdminResetTwoFactor turns off two-factor for a user who lost their
+// authenticator and backup codes.
+func (s *Server) handleAdminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if err := s.updateUser(mux.Vars(r)["username"], resetTwoFactor); err != nil {
+		s.renderAdmin(w, r, http.StatusNotFound, err.Error(), "")
+		return
+	}
+	http.Redirect(w, r, s.uiPrefix+"/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the base32 form of the RFC 4226/6238 test key
+// "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D.
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp([]byte("12345678901234567890"), uint64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits: T=59s is step 1.
+	at := time.Unix(59, 0)
+	tests := []struct {
+		name     string
+		code     string
+		now      time.Time
+		lastStep int64
+		want     bool
+	}{
+		{"current step", "287082", at, 0, true},
+		{"with spaces", " 287 082 ", at, 0, true},
+		{"previous step", "287082", at.Add(30 * time.Second), 0, true},
+		{"too old", "287082", at.Add(90 * time.Second), 0, false},
+		{"replayed", "287082", at, 1, false},
+		{"wrong code", "123456", at, 0, false},
+		{"wrong length", "28708", at, 0, false},
+	}
+
+	for _, tt := range tests {
+		step, ok := verifyTOTP(rfcSecret, tt.code, tt.now, tt.lastStep)
+		if ok != tt.want {
+			t.Errorf("%s: verifyTOTP() = %v, want %v", tt.name, ok, tt.want)
+		}
+		if ok && step != 1 {
+			t.Errorf("%s: step = %d, want 1", tt.name, step)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("alice", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/PK%20Shorts:alice?") || !strings.Contains(uri, "secret="+rfcSecret) {
+		t.Errorf("totpURI() = %q", uri)
+	}
+}
+
+func TestTwoFactorLoginFlow(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := loginAs(t, srv, "alice")
+
+	post := func(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", srv.uiPrefix+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req := httptest.NewRequest("GET", srv.uiPrefix+"/account", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `src="data:image/png;base64,`) {
+		t.Fatalf("account page = %d, missing QR code", rr.Code)
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	codeAt := func(at time.Time) string { return hotp(key, uint64(at.Unix()/totpPeriod)) }
+
+	if rr := post("/account/2fa/enable", url.Values{"secret": {secret}, "code": {"000000"}}, cookie); rr.Code != http.StatusBadRequest {
+		t.Errorf("enable with wrong code status = %d, want 400", rr.Code)
+	}
+	enrollCode := codeAt(time.Now())
+	rr = post("/account/2fa/enable", url.Values{"secret": {secret}, "code": {enrollCode}}, cookie)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enable status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	backupCodes := regexp.MustCompile(`<li>([a-z2-7]{4}-[a-z2-7]{4})</li>`).FindAllStringSubmatch(rr.Body.String(), -1)
+	if len(backupCodes) != backupCodeCount {
+		t.Fatalf("found %d backup codes on the page, want %d", len(backupCodes), backupCodeCount)
+	}
+
+	// The password alone only starts a pending login.
+	rr = post("/login", url.Values{"username": {"alice"}, "password": {"password123"}})
+	var pending *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			t.Fatal("password login must not set a session cookie with two-factor enabled")
+		}
+		if c.Name == pendingLoginCookieName {
+			pending = c
+		}
+	}
+	if rr.Code != http.StatusOK || pending == nil {
+		t.Fatalf("password login = %d, pending cookie %v", rr.Code, pending)
+	}
+	req = httptest.NewRequest("GET", srv.uiPrefix+"/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: pending.Value})
+	if srv.currentUser(req) != nil {
+		t.Error("a pending login must not authenticate requests")
+	}
+
+	if rr := post("/login/2fa", url.Values{"code": {"000000"}}, pending); rr.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code status = %d, want 401", rr.Code)
+	}
+	rr = post("/login/2fa", url.Values{"code": {backupCodes[0][1]}}, pending)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("backup code login status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var session *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("completed login should set a session cookie")
+	}
+
+	// Backup codes are single use, and TOTP codes can't be replayed.
+	if err := srv.checkSecondFactor("alice", backupCodes[0][1]); err == nil {
+		t.Error("backup code should only work once")
+	}
+	if err := srv.checkSecondFactor("alice", enrollCode); err == nil {
+		t.Error("the code used for enrollment should not be accepted again")
+	}
+
+	// Disabling requires a valid code.
+	if rr := post("/account/2fa/disable", url.Values{"code": {"000000"}}, session); rr.Code != http.StatusBadRequest {
+		t.Errorf("disable with wrong code status = %d, want 400", rr.Code)
+	}
+	if rr := post("/account/2fa/disable", url.Values{"code": {codeAt(time.Now().Add(totpPeriod * time.Second))}}, session); rr.Code != http.StatusSeeOther {
+		t.Errorf("disable status = %d, want 303", rr.Code)
+	}
+	if user, _ := srv.getUser("alice"); user.TOTPSecret != "" || len(user.BackupCodes) != 0 {
+		t.Errorf("two-factor still enabled: %+v", user)
+	}
+}
+
+func TestPendingLoginAttemptLimit(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "alice")
+	if err := srv.updateUser("alice", func(u *User) error {
+		u.TOTPSecret = rfcSecret
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", srv.uiPrefix+"/login", nil)
+	if err := srv.startPendingLogin(rec, req, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	pending := rec.Result().Cookies()[0]
+
+	for i := 0; i < maxPendingLoginTries; i++ {
+		req := httptest.NewRequest("POST", srv.uiPrefix+"/login/2fa", nil)
+		req.AddCookie(pending)
+		if _, sess := srv.pendingLogin(req); sess == nil {
+			t.Fatalf("attempt %d: pending login gone too early", i+1)
+		}
+	}
+	req = httptest.NewRequest("POST", srv.uiPrefix+"/login/2fa", nil)
+	req.AddCookie(pending)
+	if _, sess := srv.pendingLogin(req); sess != nil {
+		t.Error("pending login should be discarded after too many attempts")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	bolt "go.etcd.io/bbolt"
+)
+
+// deletedLinksBucket keeps deleted links for undoDeleteWindow, keyed by
+// short code, so a deletion can be undone. Their click counters and
+// statistics stay in place until the link is purged.
+const deletedLinksBucket = "deleted_links"
+
+// undoDeleteWindow is how long after a deletion it can be undone.
+const undoDeleteWindow = 10 * time.Minute
+
+var errCannotRestore = errors.New("the link can no longer be restored")
+
+// deletedLink is a link in deletedLinksBucket. The hash of an anonymous
+// link's deletion token moves along, since the token must not work while
+// the link is deleted.
+type deletedLink struct {
+	Link            Link      `json:"link"`
+	DeletedAt       time.Time `json:"deleted_at"`
+	DeleteTokenHash []byte    `json:"delete_token_hash,omitempty"`
+}
+
+// getDeletedLink returns the deleted link short, or nil.
+func getDeletedLink(tx *bolt.Tx, short string) *deletedLink {
+	data := tx.Bucket([]byte(deletedLinksBucket)).Get([]byte(short))
+	if data == nil {
+		return nil
+	}
+	var deleted deletedLink
+	if err := json.Unmarshal(data, &deleted); err != nil {
+		return nil
+	}
+	return &deleted
+}
+
+// purgeLinkData drops what is stored about short besides the link itself:
+// its clicks, statistics and deletion token, and its deleted copy.
+func purgeLinkData(tx *bolt.Tx, short string) error {
+	if err := deleteDailyClicks(tx, short); err != nil {
+		return err
+	}
+	if err := deleteClickEvents(tx, short); err != nil {
+		return err
+	}
+	if err := deleteConversions(tx, short); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte(clicksBucket)).Delete([]byte(short)); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte(deleteTokensBucket)).Delete([]byte(short)); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(deletedLinksBucket)).Delete([]byte(short))
+}
+
+// purgeDeletedLinks removes the deleted links that can no longer be
+// restored at now.
+func purgeDeletedLinks(tx *bolt.Tx, now time.Time) error {
+	var expired []string
+	err := tx.Bucket([]byte(deletedLinksBucket)).ForEach(func(k, v []byte) error {
+		var deleted deletedLink
+		if err := json.Unmarshal(v, &deleted); err != nil || now.Sub(deleted.DeletedAt) > undoDeleteWindow {
+			expired = append(expired, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, short := range expired {
+		if err := purgeLinkData(tx, short); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreLink undoes the deletion of short within undoDeleteWindow,
+// removing its tombstone. check may refuse the restore by returning an
+// error.
+func (s *Server) restoreLink(short string, check func(*Link) error) (*Link, error) {
+	var restored *Link
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		deleted := getDeletedLink(tx, short)
+		if deleted == nil || time.Since(deleted.DeletedAt) > undoDeleteWindow {
+			return errCannotRestore
+		}
+		if err := check(&deleted.Link); err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte(bucketName))
+		if b.Get([]byte(short)) != nil {
+			return errCannotRestore
+		}
+
+		data, err := json.Marshal(deleted.Link)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(short), data); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(createdIndexBucket)).Put(createdIndexKey(deleted.Link.CreatedAt, short), []byte{}); err != nil {
+			return err
+		}
+		if err := putFoldedShort(tx, short); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(tombstonesBucket)).Delete(createdIndexKey(deleted.DeletedAt, short)); err != nil {
+			return err
+		}
+		// The link was already counted against the quota when created, so
+		// restoring it takes back its place without the limit checks.
+		if deleted.Link.Owner != "" {
+			usage := getQuotaUsage(tx, deleted.Link.Owner)
+			usage.Total++
+			if err := putQuotaUsage(tx, deleted.Link.Owner, usage); err != nil {
+				return err
+			}
+		}
+		if deleted.DeleteTokenHash != nil {
+			if err := tx.Bucket([]byte(deleteTokensBucket)).Put([]byte(short), deleted.DeleteTokenHash); err != nil {
+				return err
+			}
+		}
+		restored = &deleted.Link
+		return tx.Bucket([]byte(deletedLinksBucket)).Delete([]byte(short))
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.forgetLink(restored.Domain, short)
+	s.linksChanged()
+	return restored, nil
+}
+
+// handleAPIRestore undoes a deletion made in the last undoDeleteWindow, for
+// callers who may manage the link.
+func (s *Server) handleAPIRestore(w http.ResponseWriter, r *http.Request) {
+	if !s.requireScope(w, r, scopeDelete) {
+		return
+	}
+	short := mux.Vars(r)["short"]
+
+	status, msg := http.StatusOK, ""
+	_, err := s.restoreLink(short, func(link *Link) error {
+		if status, msg = s.checkCanManage(r, link); status != http.StatusOK {
+			return errors.New(msg)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errCannotRestore):
+		http.Error(w, "The link can no longer be restored", http.StatusGone)
+		return
+	case err != nil && status != http.StatusOK:
+		http.Error(w, msg, status)
+		return
+	case err != nil:
+		http.Error(w, "Failed to restore link", http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("link restored", "short", short)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "restored", "short": short})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRestoreLink(t *testing.T) {
+	srv := newTestServer(t)
+	loginAs(t, srv, "root")
+	alice := loginAs(t, srv, "alice")
+	bob := loginAs(t, srv, "bob")
+	if _, err := srv.createShortLink("https://example.com/launch", createOptions{CustomID: "launch", Owner: "alice", Tags: []string{"spring"}}); err != nil {
+		t.Fatal(err)
+	}
+	srv.incrementClicks("launch", ClickEvent{At: time.Now()})
+	srv.incrementClicks("launch", ClickEvent{At: time.Now()})
+	if err := srv.deleteLink("launch", "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.getLink("launch"); err == nil {
+		t.Fatal("deleted link still resolves")
+	}
+
+	restore := func(cookie *http.Cookie, short string) int {
+		req := httptest.NewRequest("POST", "/sui/api/links/"+short+"/restore", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := restore(bob, "launch"); code != http.StatusForbidden {
+		t.Errorf("restore by another user = %d, want 403", code)
+	}
+	if code := restore(alice, "launch"); code != http.StatusOK {
+		t.Fatalf("restore = %d, want 200", code)
+	}
+	link, err := srv.getLink("launch")
+	if err != nil || link.Clicks != 2 || len(link.Tags) != 1 {
+		t.Fatalf("restored link = %+v, %v; want its clicks and tags back", link, err)
+	}
+	if tombstones, _ := srv.listTombstones("launch", 0); len(tombstones) != 0 {
+		t.Errorf("tombstones after undo = %+v, want none", tombstones)
+	}
+	if links, _ := srv.getLinksCreatedBetween(time.Time{}, time.Time{}, 0, nil); len(links) != 1 {
+		t.Errorf("restored link is not listed: %+v", links)
+	}
+	if code := restore(alice, "launch"); code != http.StatusGone {
+		t.Errorf("second restore = %d, want 410", code)
+	}
+
+	// Past the undo window the link is gone for good.
+	srv.deleteLink("launch", "alice", "")
+	srv.db.Update(func(tx *bolt.Tx) error {
+		data, _ := json.Marshal(deletedLink{Link: *link, DeletedAt: time.Now().Add(-undoDeleteWindow - time.Minute)})
+		return tx.Bucket([]byte(deletedLinksBucket)).Put([]byte("launch"), data)
+	})
+	if code := restore(alice, "launch"); code != http.StatusGone {
+		t.Errorf("restore after the undo window = %d, want 410", code)
+	}
+}
+
+func TestDeletedLinkIDReuse(t *testing.T) {
+	srv := newTestServer(t)
+	if _, err := srv.createShortLink("https://example.com/old", createOptions{CustomID: "reused"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.incrementClicks("reused", ClickEvent{At: time.Now()})
+	if err := srv.deleteLink("reused", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Taking the ID again drops the deleted link and its clicks.
+	if _, err := srv.createShortLink("https://example.com/new", createOptions{CustomID: "reused"}); err != nil {
+		t.Fatal(err)
+	}
+	link, err := srv.getLink("reused")
+	if err != nil || link.Clicks != 0 || link.Original != "https://example.com/new" {
+		t.Errorf("recreated link = %+v, %v; want no clicks inherited", link, err)
+	}
+	if _, err := srv.restoreLink("reused", func(*Link) error { return nil }); err != errCannotRestore {
+		t.Errorf("restoreLink() of a replaced link error = %v, want errCannotRestore", err)
+	}
+}
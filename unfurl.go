@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// unfurlBots are User-Agent fragments of the crawlers chat apps and social
+// networks send to build link previews.
+var unfurlBots = []string{
+	"slackbot-linkexpanding", "slack-imgproxy", "twitterbot", "facebookexternalhit", "facebot",
+	"linkedinbot", "discordbot", "telegrambot", "whatsapp", "skypeuripreview", "redditbot",
+	"mastodon", "pinterestbot", "embedly", "iframely", "vkshare", "mattermost",
+}
+
+// isUnfurlBot reports whether r comes from a link preview crawler.
+func isUnfurlBot(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	for _, bot := range unfurlBots {
+		if strings.Contains(ua, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// unfurlCard is a meta tag of the preview page. Open Graph tags use the
+// property attribute, others name.
+type unfurlCard struct {
+	Key, Value string
+	Property   bool
+}
+
+// renderUnfurl answers a link preview crawler with a page carrying the
+// Open Graph and Twitter Card tags of destination, when passthrough is on
+// and they were fetched. It reports whether it answered; otherwise the
+// crawler gets the usual redirect.
+func (s *Server) renderUnfurl(w http.ResponseWriter, r *http.Request, short, destination string) bool {
+	if s.metadata == nil || !s.metadata.passthrough || !isUnfurlBot(r) {
+		return false
+	}
+	link, err := s.getLink(short)
+	if err != nil || link.Meta == nil || len(link.Meta.Cards) == 0 || link.Original != destination {
+		return false
+	}
+
+	cards := make([]unfurlCard, 0, len(link.Meta.Cards))
+	for key, value := range link.Meta.Cards {
+		cards = append(cards, unfurlCard{Key: key, Value: value, Property: strings.HasPrefix(key, "og:")})
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].Key < cards[j].Key })
+
+	title := link.Meta.Cards["og:title"]
+	if title == "" {
+		title = link.Meta.Title
+	}
+	if title == "" {
+		title = destination
+	}
+	data := s.pageData(r)
+	data["Title"] = title
+	data["ShortURL"] = s.shortURL(r, link.Domain, short)
+	data["Destination"] = destination
+	data["Cards"] = cards
+	w.Header().Set("Cache-Control", "no-store")
+	if err := s.templates().ExecuteTemplate(w, "unfurl.html", data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
+	}
+	return true
+}
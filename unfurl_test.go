@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsUnfurlBot(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want bool
+	}{
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", true},
+		{"facebookexternalhit/1.1 Facebot Twitterbot/1.0", true},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/124.0 Safari/537.36", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/s/abc", nil)
+		r.Header.Set("User-Agent", tt.ua)
+		if got := isUnfurlBot(r); got != tt.want {
+			t.Errorf("isUnfurlBot(%q) = %v, want %v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestUnfurlPassthrough(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<title>Launch</title><meta property="og:title" content="We &quot;launched&quot;"><meta property="og:image" content="/cover.png"><meta name="twitter:card" content="summary">`)
+	}))
+	defer ts.Close()
+
+	t.Setenv("METADATA_PASSTHROUGH", "true")
+	srv := newTestServer(t)
+	srv.metadata.client = ts.Client()
+	if _, err := srv.createShortLink(ts.URL+"/launch", createOptions{CustomID: "launch"}); err != nil {
+		t.Fatal(err)
+	}
+	job := <-srv.metadata.queue
+	if _, err := srv.refreshLinkMeta(context.Background(), job.short, job.destination); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ua string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/s/launch", nil)
+		req.Header.Set("User-Agent", ua)
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("bot got %d, want the preview page", rr.Code)
+	}
+	for _, want := range []string{
+		`<meta property="og:title" content="We &#34;launched&#34;">`,
+		`<meta property="og:image" content="` + ts.URL + `/cover.png">`,
+		`<meta name="twitter:card" content="summary">`,
+		`<meta property="og:url" content="http://example.com/s/launch">`,
+		`<meta http-equiv="refresh" content="0; url=` + ts.URL + `/launch">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("preview page does not contain %s:\n%s", want, body)
+		}
+	}
+
+	if rr := get("Mozilla/5.0 Firefox/126.0"); rr.Code != http.StatusFound || rr.Header().Get("Location") != ts.URL+"/launch" {
+		t.Errorf("browser got %d to %q, want a redirect", rr.Code, rr.Header().Get("Location"))
+	}
+	if link, _ := srv.getLink("launch"); link.Clicks != 1 {
+		t.Errorf("clicks = %d, want only the browser counted", link.Clicks)
+	}
+}
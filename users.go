@@ -0,0 +1,485 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	usersBucket       = "users"
+	sessionsBucket    = "sessions"
+	sessionCookieName = "pk_session"
+	sessionTTL        = 30 * 24 * time.Hour
+	minPasswordLength = 8
+
+	roleAdmin = "admin"
+	roleUser  = "user"
+
+	// userSourceLDAP marks accounts provisioned on first LDAP login; their
+	// passwords are checked against the directory.
+	userSourceLDAP = "ldap"
+)
+
+var (
+	errUserExists         = errors.New("username is already taken")
+	errInvalidCredentials = errors.New("invalid username or password")
+
+	// dummyPasswordHash is compared against when a login names an unknown
+	// user, so response timing doesn't reveal which usernames exist.
+	dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("pk-shorts"), bcrypt.DefaultCost)
+)
+
+// User is a registered account. Passwords are stored as bcrypt hashes,
+// which embed their own random salt. Directory accounts (Source "ldap")
+// have no local password.
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"password_hash,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// TOTPSecret is set once two-factor authentication is enabled.
+	// TOTPLastStep is the last accepted time step, so codes can't be
+	// replayed; BackupCodes holds SHA-256 hashes of unused recovery codes.
+	TOTPSecret   string   `json:"totp_secret,omitempty"`
+	TOTPLastStep int64    `json:"totp_last_step,omitempty"`
+	BackupCodes  []string `json:"backup_codes,omitempty"`
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == roleAdmin
+}
+
+// Session ties a browser cookie to a user. Sessions are stored under the
+// SHA-256 of the cookie token, so a leaked database does not leak usable
+// session cookies.
+type Session struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Pending marks a login that passed the password check but still needs
+	// a second factor; it does not authenticate requests.
+	Pending  bool `json:"pending,omitempty"`
+	Attempts int  `json:"attempts,omitempty"`
+}
+
+func validateUsername(name string) error {
+	return validateHandle("username", name)
+}
+
+// validateHandle checks the format shared by usernames and team names.
+func validateHandle(kind, name string) error {
+	if len(name) < 3 || len(name) > 32 {
+		return fmt.Errorf("%s must be 3-32 characters long", kind)
+	}
+	for _, ch := range name {
+		if !((ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.') {
+			return fmt.Errorf("%s can only contain lowercase letters, numbers, dots, dashes, and underscores", kind)
+		}
+	}
+	return nil
+}
+
+// initialRole is the role a new account named username starts out with.
+func (s *Server) initialRole(username string) string {
+	if s.adminUser != "" && username == s.adminUser {
+		return roleAdmin
+	}
+	return roleUser
+}
+
+// createUser registers a new account. Only the account named by
+// ADMIN_USER starts out as an admin.
+func (s *Server) createUser(username, password string) (*User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{Username: username, PasswordHash: hash, Role: s.initialRole(username), CreatedAt: time.Now()}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		if b.Get([]byte(username)) != nil {
+			return errUserExists
+		}
+		data, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(username), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// getUser loads an account by username.
+func (s *Server) getUser(username string) (*User, error) {
+	var user *User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(usersBucket)).Get([]byte(username))
+		if data == nil {
+			return fmt.Errorf("user not found")
+		}
+		user = &User{}
+		return json.Unmarshal(data, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// listUsers returns every account.
+func (s *Server) listUsers() ([]User, error) {
+	var users []User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(usersBucket)).ForEach(func(k, v []byte) error {
+			var user User
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+// updateUser applies fn to the stored account and saves the result.
+func (s *Server) updateUser(username string, fn func(*User) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		data := b.Get([]byte(username))
+		if data == nil {
+			return fmt.Errorf("user not found")
+		}
+		var user User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+		data, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(username), data)
+	})
+}
+
+// deleteUser removes an account, ends its sessions, revokes its API tokens
+// and drops it from its teams. Links the user created are kept and still
+// record them as owner.
+func (s *Server) deleteUser(username string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usersBucket))
+		if b.Get([]byte(username)) == nil {
+			return fmt.Errorf("user not found")
+		}
+		if err := b.Delete([]byte(username)); err != nil {
+			return err
+		}
+		if err := removeUserFromTeams(tx, username); err != nil {
+			return err
+		}
+		err := deleteAPIKeys(tx, func(key *APIKey) bool { return key.Owner == username }, false)
+		if err != nil {
+			return err
+		}
+
+		sessions := tx.Bucket([]byte(sessionsBucket))
+		var ended [][]byte
+		sessions.ForEach(func(k, v []byte) error {
+			var sess Session
+			if json.Unmarshal(v, &sess) == nil && sess.Username == username {
+				ended = append(ended, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range ended {
+			if err := sessions.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// authenticate checks a username and password. Local accounts are checked
+// against their bcrypt hash; when LDAP is configured, everyone else is
+// checked against the directory.
+func (s *Server) authenticate(username, password string) (*User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	user, err := s.getUser(username)
+	if err == nil && user.Source != userSourceLDAP {
+		if bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)) != nil {
+			return nil, errInvalidCredentials
+		}
+		return user, nil
+	}
+
+	if s.ldap != nil {
+		return s.authenticateLDAP(username, password)
+	}
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+	return nil, errInvalidCredentials
+}
+
+// registrationOpen reports whether visitors may create local accounts.
+// It is always off with LDAP configured, so nobody can claim a directory
+// user's name before that user first logs in.
+func (s *Server) registrationOpen() bool {
+	return s.ldap == nil && s.getSettings().RegistrationOpen
+}
+
+func hashSessionToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// createSession starts a session for username and returns the cookie token.
+func (s *Server) createSession(username string) (string, error) {
+	now := time.Now()
+	return s.storeSession(Session{Username: username, CreatedAt: now, ExpiresAt: now.Add(sessionTTL)})
+}
+
+// storeSession saves sess under a new random token and returns the token.
+func (s *Server) storeSession(sess Session) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(sessionsBucket)).Put(hashSessionToken(token), data)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// deleteSession ends the session identified by token.
+func (s *Server) deleteSession(token string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(sessionsBucket)).Delete(hashSessionToken(token))
+	})
+}
+
+// currentUser returns the user logged in with the request's session cookie,
+// or nil for anonymous requests.
+func (s *Server) currentUser(r *http.Request) *User {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	var sess Session
+	var user *User
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(sessionsBucket)).Get(hashSessionToken(cookie.Value))
+		if data == nil {
+			return fmt.Errorf("session not found")
+		}
+		if err := json.Unmarshal(data, &sess); err != nil {
+			return err
+		}
+		if sess.Pending || time.Now().After(sess.ExpiresAt) {
+			return fmt.Errorf("session expired")
+		}
+		udata := tx.Bucket([]byte(usersBucket)).Get([]byte(sess.Username))
+		if udata == nil {
+			return fmt.Errorf("user not found")
+		}
+		user = &User{}
+		return json.Unmarshal(udata, user)
+	})
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+func (s *Server) setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.scheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// purgeExpiredSessions removes sessions past their expiry.
+func purgeExpiredSessions(db *bolt.DB) error {
+	now := time.Now()
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(sessionsBucket))
+
+		// Collect first: deleting through a cursor mid-iteration skips keys.
+		var expired [][]byte
+		b.ForEach(func(k, v []byte) error {
+			var sess Session
+			if err := json.Unmarshal(v, &sess); err != nil || now.After(sess.ExpiresAt) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Server) renderAuthPage(w http.ResponseWriter, r *http.Request, name string, status int, errMsg, username string) {
+	data := s.pageData(r)
+	data["Error"] = errMsg
+	data["Username"] = username
+
+	w.WriteHeader(status)
+	if err := s.templates().ExecuteTemplate(w, name, data); err != nil {
+		requestLogger(r).Error("template error", "err", err)
+	}
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.renderAuthPage(w, r, "login.html", http.StatusOK, "", "")
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	username := r.FormValue("username")
+	user, err := s.authenticate(username, r.FormValue("password"))
+	if err != nil {
+		s.renderAuthPage(w, r, "login.html", http.StatusUnauthorized, err.Error(), username)
+		return
+	}
+
+	if user.TOTPSecret != "" {
+		if err := s.startPendingLogin(w, r, user.Username); err != nil {
+			http.Error(w, "Failed to start login", http.StatusInternalServerError)
+			return
+		}
+		data := s.pageData(r)
+		data["TwoFactor"] = true
+		if err := s.templates().ExecuteTemplate(w, "login.html", data); err != nil {
+			requestLogger(r).Error("template error", "err", err)
+		}
+		return
+	}
+
+	token, err := s.createSession(user.Username)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	s.setSessionCookie(w, r, token)
+	http.Redirect(w, r, s.uiPrefix+"/", http.StatusSeeOther)
+}
+
+func (s *Server) handleRegisterPage(w http.ResponseWriter, r *http.Request) {
+	if !s.registrationOpen() {
+		http.Error(w, "Registration is disabled", http.StatusForbidden)
+		return
+	}
+	s.renderAuthPage(w, r, "register.html", http.StatusOK, "", "")
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if !s.registrationOpen() {
+		http.Error(w, "Registration is disabled", http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm") {
+		s.renderAuthPage(w, r, "register.html", http.StatusBadRequest, "passwords do not match", username)
+		return
+	}
+
+	user, err := s.createUser(username, password)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errUserExists) {
+			status = http.StatusConflict
+		}
+		s.renderAuthPage(w, r, "register.html", status, err.Error(), username)
+		return
+	}
+
+	token, err := s.createSession(user.Username)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	s.setSessionCookie(w, r, token)
+	http.Redirect(w, r, s.uiPrefix+"/", http.StatusSeeOther)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		if err := s.deleteSession(cookie.Value); err != nil {
+			requestLogger(r).Error("failed to delete session", "err", err)
+		}
+	}
+	clearSessionCookie(w)
+	http.Redirect(w, r, s.uiPrefix+"/login", http.StatusSeeOther)
+}
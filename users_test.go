@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		name      string
+		shouldErr bool
+	}{
+		{"alice", false},
+		{"bob.smith-2", false},
+		{"al", true},
+		{"Alice", true},
+		{"has space", true},
+		{strings.Repeat("a", 33), true},
+	}
+
+	for _, tt := range tests {
+		if err := validateUsername(tt.name); (err != nil) != tt.shouldErr {
+			t.Errorf("validateUsername(%q) error = %v, shouldErr %v", tt.name, err, tt.shouldErr)
+		}
+	}
+}
+
+func TestCreateUserAndAuthenticate(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := srv.createUser("Alice", "correct horse"); err != nil {
+		t.Fatalf("createUser() error: %v", err)
+	}
+	if _, err := srv.createUser("alice", "another password"); err != errUserExists {
+		t.Errorf("duplicate createUser() error = %v, want errUserExists", err)
+	}
+	if _, err := srv.createUser("bob", "short"); err == nil {
+		t.Error("expected error for short password")
+	}
+
+	if _, err := srv.authenticate("ALICE", "correct horse"); err != nil {
+		t.Errorf("authenticate() error: %v", err)
+	}
+	if _, err := srv.authenticate("alice", "wrong password"); err != errInvalidCredentials {
+		t.Errorf("authenticate() with wrong password error = %v", err)
+	}
+	if _, err := srv.authenticate("nobody", "whatever1"); err != errInvalidCredentials {
+		t.Errorf("authenticate() with unknown user error = %v", err)
+	}
+}
+
+func TestRegisterLoginLogoutFlow(t *testing.T) {
+	srv := newTestServer(t)
+
+	form := url.Values{"username": {"carol"}, "password": {"s3cret-pass"}, "confirm": {"s3cret-pass"}}
+	req := httptest.NewRequest("POST", srv.uiPrefix+"/register", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("register status = %d, body %s", rr.Code, rr.Body.String())
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("expected HttpOnly session cookie, got %+v", cookies)
+	}
+
+	req = httptest.NewRequest("GET", srv.uiPrefix+"/", nil)
+	req.AddCookie(cookies[0])
+	if user := srv.currentUser(req); user == nil || user.Username != "carol" {
+		t.Fatalf("currentUser() = %+v, want carol", user)
+	}
+
+	req = httptest.NewRequest("POST", srv.uiPrefix+"/logout", nil)
+	req.AddCookie(cookies[0])
+	srv.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", srv.uiPrefix+"/", nil)
+	req.AddCookie(cookies[0])
+	if user := srv.currentUser(req); user != nil {
+		t.Error("session should be invalid after logout")
+	}
+
+	form = url.Values{"username": {"carol"}, "password": {"wrong-pass"}}
+	req = httptest.NewRequest("POST", srv.uiPrefix+"/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("login with wrong password status = %d, want 401", rr.Code)
+	}
+}
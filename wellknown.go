@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AppLinksConfig names the files that let native apps open short links
+// directly: Apple's apple-app-site-association for universal links on iOS
+// and Android's assetlinks.json for app links. Both are JSON files written
+// for the apps, served as they are.
+type AppLinksConfig struct {
+	AppleAppSiteAssociation string `yaml:"apple_app_site_association"`
+	AssetLinks              string `yaml:"assetlinks"`
+}
+
+// appLinkFiles holds the loaded association files of a host.
+type appLinkFiles struct {
+	aasa, assetLinks []byte
+}
+
+// loadAppLinks reads and checks the association files of c.
+func loadAppLinks(c AppLinksConfig) (appLinkFiles, error) {
+	var files appLinkFiles
+	var err error
+	if files.aasa, err = readJSONFile(c.AppleAppSiteAssociation); err != nil {
+		return files, fmt.Errorf("apple-app-site-association: %w", err)
+	}
+	if files.assetLinks, err = readJSONFile(c.AssetLinks); err != nil {
+		return files, fmt.Errorf("assetlinks.json: %w", err)
+	}
+	return files, nil
+}
+
+// readJSONFile returns the contents of the JSON file at path, or nil when
+// path is empty.
+func readJSONFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("%s is not valid JSON", path)
+	}
+	return data, nil
+}
+
+// parseAppLinks loads the default association files and those of each
+// domain, keyed by host with "" for the default.
+func parseAppLinks(c AppLinksConfig, domains []DomainConfig) (map[string]appLinkFiles, error) {
+	files, err := loadAppLinks(c)
+	if err != nil {
+		return nil, err
+	}
+	appLinks := map[string]appLinkFiles{"": files}
+	for _, d := range domains {
+		files, err := loadAppLinks(d.AppLinks)
+		if err != nil {
+			return nil, fmt.Errorf("domain %s: %w", d.Host, err)
+		}
+		appLinks[strings.ToLower(strings.TrimSpace(d.Host))] = files
+	}
+	return appLinks, nil
+}
+
+// setupAppLinkRoutes serves the association files. Apple also looks for
+// its file at the root, as older iOS versions did.
+func (s *Server) setupAppLinkRoutes() {
+	aasa := func(f appLinkFiles) []byte { return f.aasa }
+	assetLinks := func(f appLinkFiles) []byte { return f.assetLinks }
+	s.router.HandleFunc("/.well-known/apple-app-site-association", s.serveAppLinkFile(aasa)).Methods("GET")
+	s.router.HandleFunc("/apple-app-site-association", s.serveAppLinkFile(aasa)).Methods("GET")
+	s.router.HandleFunc("/.well-known/assetlinks.json", s.serveAppLinkFile(assetLinks)).Methods("GET")
+}
+
+// serveAppLinkFile serves the file pick selects for the requested domain,
+// falling back to the default one when the domain has none.
+func (s *Server) serveAppLinkFile(pick func(appLinkFiles) []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := pick(s.appLinks[s.requestDomain(r)])
+		if data == nil {
+			data = pick(s.appLinks[""])
+		}
+		if data == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
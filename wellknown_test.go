@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAppLinks(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(valid, []byte(`{"applinks": {}}`), 0o600)
+	os.WriteFile(invalid, []byte(`{"applinks":`), 0o600)
+
+	tests := []struct {
+		name    string
+		config  AppLinksConfig
+		domains []DomainConfig
+		wantErr bool
+	}{
+		{"none", AppLinksConfig{}, nil, false},
+		{"valid", AppLinksConfig{AppleAppSiteAssociation: valid, AssetLinks: valid}, nil, false},
+		{"invalid json", AppLinksConfig{AssetLinks: invalid}, nil, true},
+		{"missing file", AppLinksConfig{AppleAppSiteAssociation: filepath.Join(dir, "missing.json")}, nil, true},
+		{"invalid domain file", AppLinksConfig{}, []DomainConfig{{Host: "go.corp.com", AppLinks: AppLinksConfig{AssetLinks: invalid}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseAppLinks(tt.config, tt.domains)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAppLinks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAppLinkFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	cfg := testConfig(t)
+	cfg.DBPath = filepath.Join(dir, "links.db")
+	cfg.AppLinks = AppLinksConfig{AppleAppSiteAssociation: write("aasa.json", `{"applinks": {"default": true}}`)}
+	cfg.Domains = []DomainConfig{{
+		Host:   "go.corp.com",
+		Prefix: "/",
+		AppLinks: AppLinksConfig{
+			AppleAppSiteAssociation: write("corp-aasa.json", `{"applinks": {"corp": true}}`),
+			AssetLinks:              write("corp-assetlinks.json", `[{"relation": ["delegate_permission/common.handle_all_urls"]}]`),
+		},
+	}}
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	srv.setupRoutes()
+
+	tests := []struct {
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{"http://example.com/.well-known/apple-app-site-association", http.StatusOK, `{"applinks": {"default": true}}`},
+		{"http://example.com/apple-app-site-association", http.StatusOK, `{"applinks": {"default": true}}`},
+		{"http://example.com/.well-known/assetlinks.json", http.StatusNotFound, ""},
+		{"http://go.corp.com/.well-known/apple-app-site-association", http.StatusOK, `{"applinks": {"corp": true}}`},
+		{"http://go.corp.com/.well-known/assetlinks.json", http.StatusOK, `[{"relation": ["delegate_permission/common.handle_all_urls"]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantCode)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body, tt.wantBody)
+			}
+		})
+	}
+}
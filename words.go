@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Words of memorable IDs: short, common, easy to spell and without
+// homophones, so a code heard once can be typed correctly.
+var (
+	memorableAdjectives = []string{
+		"able", "bold", "brave", "bright", "busy", "calm", "clever", "cool",
+		"daring", "crisp", "eager", "early", "easy", "loyal", "fancy", "fast",
+		"fresh", "friendly", "gentle", "giant", "glad", "golden", "good", "grand",
+		"green", "happy", "honest", "jolly", "keen", "kind", "lively", "lucky",
+		"merry", "mighty", "modern", "neat", "nice", "noble", "polite", "proud",
+		"quick", "quiet", "rapid", "ready", "rich", "royal", "shiny", "silent",
+		"silver", "simple", "smart", "smooth", "snowy", "solid", "steady", "sunny",
+		"swift", "tidy", "tiny", "vivid", "warm", "wild", "wise", "witty",
+	}
+	memorableNouns = []string{
+		"badger", "beetle", "beaver", "bison", "camel", "cedar", "cheetah", "comet",
+		"coral", "crane", "daisy", "dolphin", "eagle", "falcon", "fern", "finch",
+		"forest", "fox", "garden", "gecko", "hedgehog", "hawk", "heron", "island",
+		"jaguar", "koala", "lake", "lemon", "lion", "llama", "lotus", "maple",
+		"meadow", "mango", "moon", "otter", "owl", "panda", "parrot", "pebble",
+		"pepper", "planet", "pony", "rabbit", "raven", "river", "robin", "salmon",
+		"bamboo", "shark", "sparrow", "squirrel", "star", "tiger", "tulip", "turtle",
+		"valley", "walrus", "walnut", "willow", "wolf", "yak", "zebra", "cloud",
+	}
+)
+
+// memorableID returns a code like "brave-otter-42": an adjective, a noun
+// and a number from 10 to 99.
+func memorableID() string {
+	return fmt.Sprintf("%s-%s-%d", randomWord(memorableAdjectives), randomWord(memorableNouns), 10+randomInt(90))
+}
+
+func randomWord(words []string) string {
+	return words[randomInt(len(words))]
+}
+
+// randomInt returns a uniformly drawn number in [0, n).
+func randomInt(n int) int {
+	i, _ := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	return int(i.Int64())
+}
+
+// profaneWords are screened out of generated codes, after undoing the
+// usual digit-for-letter spellings with leetReplacer.
+var profaneWords = []string{
+	"anal", "anus", "arse", "ass", "bitch", "bollock", "boner", "boob",
+	"butt", "clit", "cock", "coon", "crap", "cum", "cunt", "dick",
+	"dildo", "dyke", "fag", "fuck", "fuk", "gay", "hitler", "homo",
+	"jizz", "kike", "nazi", "nigg", "nigr", "paki", "penis", "piss",
+	"poop", "porn", "prick", "pube", "puss", "rape", "retard", "scum",
+	"semen", "sex", "shit", "slut", "spic", "tit", "twat", "vagina",
+	"wank", "whore",
+}
+
+// leetReplacer maps digits that stand in for letters back to them.
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "-", "", "_", "")
+
+// isProfane reports whether code spells out one of profaneWords, in any
+// case and with digits for letters.
+func isProfane(code string) bool {
+	folded := leetReplacer.Replace(strings.ToLower(code))
+	for _, word := range profaneWords {
+		if strings.Contains(folded, word) {
+			return true
+		}
+	}
+	return false
+}
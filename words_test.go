@@ -0,0 +1,72 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMemorableID(t *testing.T) {
+	for _, words := range [][]string{memorableAdjectives, memorableNouns} {
+		seen := make(map[string]bool)
+		for _, w := range words {
+			if seen[w] || w != strings.ToLower(w) {
+				t.Errorf("word %q is repeated or not lowercase", w)
+			}
+			seen[w] = true
+		}
+	}
+
+	format := regexp.MustCompile(`^[a-z]+-[a-z]+-[1-9][0-9]$`)
+	for i := 0; i < 100; i++ {
+		if id := memorableID(); !format.MatchString(id) || validateCustomID(id) != nil {
+			t.Fatalf("memorableID() = %q, want adjective-noun-number", id)
+		}
+	}
+}
+
+func TestMemorableIDs(t *testing.T) {
+	t.Setenv("ID_STRATEGY", "memorable")
+	srv := newTestServer(t)
+
+	short, err := srv.createShortLink("https://example.com", createOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts := strings.Split(short, "-"); len(parts) != 3 {
+		t.Errorf("created %q, want a memorable code", short)
+	}
+	secure, err := srv.createShortLink("https://example.com/secret", createOptions{Secure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secure) != secureIDLength || strings.Contains(secure, "-") {
+		t.Errorf("secure link got %q, want a random code", secure)
+	}
+}
+
+func TestIsProfane(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"aB3xK9qz", false},
+		{"brave-otter-42", false},
+		{"xFuCkq2A", true},
+		{"Q5h1tzzz", true},
+		{"k-_5-h-1-t", true},
+		{"8utt0000", true},
+	}
+	for _, tt := range tests {
+		if got := isProfane(tt.code); got != tt.want {
+			t.Errorf("isProfane(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+	for _, words := range [][]string{memorableAdjectives, memorableNouns} {
+		for _, w := range words {
+			if isProfane(w) {
+				t.Errorf("memorable word %q is screened out", w)
+			}
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// yourlsTimeLayout is how YOURLS formats dates.
+const yourlsTimeLayout = "2006-01-02 15:04:05"
+
+// YOURLSConfig enables the YOURLS-compatible API; see handleYOURLS.
+type YOURLSConfig struct {
+	// Enabled serves /yourls-api.php, for WordPress plugins and scripts
+	// that speak the YOURLS protocol.
+	Enabled bool `yaml:"enabled"`
+}
+
+// yourlsResult is a YOURLS answer, encoded as JSON, XML or plain text.
+type yourlsResult map[string]interface{}
+
+// handleYOURLS implements the shorturl, expand and url-stats actions of
+// the YOURLS API. The API key goes in the signature parameter, where
+// YOURLS takes its secret signature token; username and password and
+// time-limited signatures are not supported.
+func (s *Server) handleYOURLS(w http.ResponseWriter, r *http.Request) {
+	format := r.FormValue("format")
+	// The signature is the only credential: cookies of a browser that
+	// happens to be logged in don't count.
+	r.Header.Del("Cookie")
+	r.Header.Del("Authorization")
+	r.Header.Set("X-API-Key", r.FormValue("signature"))
+
+	cred, ok := s.requestCredential(r)
+	if !ok || cred == nil {
+		writeYOURLS(w, format, http.StatusForbidden, "", yourlsResult{"errorCode": 403, "message": "Please log in"})
+		return
+	}
+
+	action := r.FormValue("action")
+	scope := scopeRead
+	if action == "shorturl" {
+		scope = scopeCreate
+	}
+	if !scopeAllowed(cred.Scopes, scope) {
+		writeYOURLS(w, format, http.StatusForbidden, "", yourlsResult{"errorCode": 403, "message": "API key lacks the " + strconv.Quote(scope) + " scope"})
+		return
+	}
+
+	switch action {
+	case "shorturl":
+		s.limitCreate(func(w http.ResponseWriter, r *http.Request) { s.yourlsShorten(w, r, format) })(w, r)
+	case "expand", "url-stats":
+		s.yourlsLookup(w, r, format, action)
+	default:
+		writeYOURLS(w, format, http.StatusBadRequest, "", yourlsResult{"errorCode": 400, "message": `Unknown or missing "action" parameter`})
+	}
+}
+
+// yourlsLinkTitle returns the page title of link, or its destination as
+// YOURLS does for pages without one.
+func yourlsLinkTitle(link *Link) string {
+	if link.Meta != nil && link.Meta.Title != "" {
+		return link.Meta.Title
+	}
+	return link.Original
+}
+
+// yourlsShorten creates a link to url, with keyword as its custom ID. Like
+// YOURLS with unique URLs, shortening a URL again without a keyword fails
+// with the existing short URL.
+func (s *Server) yourlsShorten(w http.ResponseWriter, r *http.Request, format string) {
+	destination := r.FormValue("url")
+	if destination == "" {
+		writeYOURLS(w, format, http.StatusBadRequest, "", yourlsResult{"status": "fail", "code": "error:nourl", "message": "Missing or malformed URL", "errorCode": 400, "statusCode": 400})
+		return
+	}
+	destination = s.destinations.withDefaultScheme(destination)
+	keyword := strings.TrimSpace(r.FormValue("keyword"))
+	owner, _ := s.callerOwner(r)
+	system, _ := s.apiKeySystem(r)
+	domain := s.requestDomain(r)
+
+	if keyword == "" {
+		if link := s.findOwnLink(owner, destination, domain); link != nil {
+			result := s.yourlsURLResult(r, link)
+			result["status"], result["code"], result["statusCode"] = "fail", "error:url", 200
+			result["message"] = link.Original + " already exists in database"
+			writeYOURLS(w, format, http.StatusOK, result["shorturl"].(string), result)
+			return
+		}
+	}
+
+	short, err := s.createShortLink(destination, createOptions{CustomID: keyword, System: system, Owner: owner, Domain: domain})
+	if err != nil {
+		status, code, msg := http.StatusBadRequest, "error:url", capitalize(err.Error())
+		switch {
+		case createErrorField(err) == "custom_id":
+			code = "error:keyword"
+			msg = "Short URL " + keyword + " already exists in database or is reserved"
+		case createErrorStatus(err) == http.StatusInternalServerError:
+			requestLogger(r).Error("failed to create short link", "err", err)
+			status, code, msg = http.StatusInternalServerError, "error:db", "Error saving URL to database"
+		}
+		writeYOURLS(w, format, status, "", yourlsResult{"status": "fail", "code": code, "message": msg, "errorCode": status, "statusCode": status})
+		return
+	}
+	link, err := s.getLink(short)
+	if err != nil {
+		writeYOURLS(w, format, http.StatusInternalServerError, "", yourlsResult{"status": "fail", "code": "error:db", "message": "Error saving URL to database", "errorCode": 500, "statusCode": 500})
+		return
+	}
+	result := s.yourlsURLResult(r, link)
+	result["status"], result["statusCode"] = "success", 200
+	result["message"] = link.Original + " added to database"
+	writeYOURLS(w, format, http.StatusOK, result["shorturl"].(string), result)
+}
+
+// yourlsURLResult describes link as shorturl answers do.
+func (s *Server) yourlsURLResult(r *http.Request, link *Link) yourlsResult {
+	title := yourlsLinkTitle(link)
+	return yourlsResult{
+		"url": yourlsResult{
+			"keyword": link.Short,
+			"url":     link.Original,
+			"title":   title,
+			"date":    link.CreatedAt.UTC().Format(yourlsTimeLayout),
+			"ip":      "",
+		},
+		"title":    title,
+		"shorturl": s.shortURL(r, link.Domain, link.Short),
+	}
+}
+
+// yourlsLookup answers expand and url-stats for the shorturl parameter,
+// a keyword or a full short URL.
+func (s *Server) yourlsLookup(w http.ResponseWriter, r *http.Request, format, action string) {
+	keyword := r.FormValue("shorturl")
+	if _, rest, ok := strings.Cut(keyword, "://"); ok {
+		keyword = rest
+	}
+	link, err := s.getLink(s.bitlinkShort(keyword))
+	if err == nil {
+		if status, _ := s.checkCanManage(r, link); status != http.StatusOK {
+			err = fmt.Errorf("link not found")
+		}
+	}
+	if err != nil {
+		writeYOURLS(w, format, http.StatusNotFound, "", yourlsResult{"statusCode": 404, "message": "Error: short URL not found", "errorCode": 404})
+		return
+	}
+
+	shortURL := s.shortURL(r, link.Domain, link.Short)
+	if action == "expand" {
+		writeYOURLS(w, format, http.StatusOK, link.Original, yourlsResult{
+			"keyword":    link.Short,
+			"shorturl":   shortURL,
+			"longurl":    link.Original,
+			"title":      yourlsLinkTitle(link),
+			"message":    "success",
+			"statusCode": 200,
+		})
+		return
+	}
+	writeYOURLS(w, format, http.StatusOK, strconv.Itoa(link.Clicks), yourlsResult{
+		"statusCode": 200,
+		"message":    "success",
+		"link": yourlsResult{
+			"shorturl":  shortURL,
+			"url":       link.Original,
+			"title":     yourlsLinkTitle(link),
+			"timestamp": link.CreatedAt.UTC().Format(yourlsTimeLayout),
+			"ip":        "",
+			"clicks":    strconv.Itoa(link.Clicks),
+		},
+	})
+}
+
+// writeYOURLS encodes result in format: "json", "simple", which is just
+// the simple text, or else XML, the YOURLS default.
+func writeYOURLS(w http.ResponseWriter, format string, status int, simple string, result yourlsResult) {
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	case "simple":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		io.WriteString(w, simple)
+	default:
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		io.WriteString(w, xml.Header)
+		e := xml.NewEncoder(w)
+		encodeYOURLSXML(e, "result", result)
+		e.Flush()
+	}
+}
+
+// encodeYOURLSXML writes value as an element named name, with the keys
+// of nested results as child elements in sorted order.
+func encodeYOURLSXML(e *xml.Encoder, name string, value interface{}) {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	e.EncodeToken(start)
+	if result, ok := value.(yourlsResult); ok {
+		keys := make([]string, 0, len(result))
+		for key := range result {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			encodeYOURLSXML(e, key, result[key])
+		}
+	} else {
+		e.EncodeToken(xml.CharData(fmt.Sprint(value)))
+	}
+	e.EncodeToken(start.End())
+}
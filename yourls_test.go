@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestYOURLSAPI(t *testing.T) {
+	t.Setenv("YOURLS_API", "true")
+	t.Setenv("API_KEYS", "wordpress:s3cret,other:0ther")
+	srv := newTestServer(t)
+
+	call := func(method string, params url.Values) *httptest.ResponseRecorder {
+		var req *http.Request
+		if method == "POST" {
+			req = httptest.NewRequest("POST", "/yourls-api.php", strings.NewReader(params.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest("GET", "/yourls-api.php?"+params.Encode(), nil)
+		}
+		req.Host = "sho.rt"
+		rr := httptest.NewRecorder()
+		srv.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		params       url.Values
+		wantStatus   int
+		wantContains string
+	}{
+		{"no signature", "GET", url.Values{"action": {"shorturl"}, "url": {"https://example.com"}, "format": {"json"}}, http.StatusForbidden, `"message":"Please log in"`},
+		{"creates", "POST", url.Values{"signature": {"s3cret"}, "action": {"shorturl"}, "url": {"https://example.com/post"}, "keyword": {"post"}, "format": {"json"}}, http.StatusOK, `"shorturl":"http://sho.rt/s/post","status":"success"`},
+		{"taken keyword", "POST", url.Values{"signature": {"s3cret"}, "action": {"shorturl"}, "url": {"https://example.com/x"}, "keyword": {"post"}, "format": {"json"}}, http.StatusBadRequest, `"code":"error:keyword"`},
+		{"existing URL", "GET", url.Values{"signature": {"s3cret"}, "action": {"shorturl"}, "url": {"https://example.com/post"}, "format": {"json"}}, http.StatusOK, `"code":"error:url"`},
+		{"simple", "GET", url.Values{"signature": {"s3cret"}, "action": {"expand"}, "shorturl": {"post"}, "format": {"simple"}}, http.StatusOK, "https://example.com/post"},
+		{"expand full URL", "GET", url.Values{"signature": {"s3cret"}, "action": {"expand"}, "shorturl": {"http://sho.rt/s/post"}, "format": {"json"}}, http.StatusOK, `"longurl":"https://example.com/post"`},
+		{"stats as XML", "GET", url.Values{"signature": {"s3cret"}, "action": {"url-stats"}, "shorturl": {"post"}}, http.StatusOK, "<link><clicks>0</clicks><ip></ip><shorturl>http://sho.rt/s/post</shorturl>"},
+		{"other key's link", "GET", url.Values{"signature": {"0ther"}, "action": {"expand"}, "shorturl": {"post"}, "format": {"json"}}, http.StatusNotFound, `"errorCode":404`},
+		{"unknown action", "GET", url.Values{"signature": {"s3cret"}, "action": {"db-stats"}, "format": {"json"}}, http.StatusBadRequest, "action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := call(tt.method, tt.params)
+			if rr.Code != tt.wantStatus || !strings.Contains(rr.Body.String(), tt.wantContains) {
+				t.Errorf("= %d %s, want %d containing %s", rr.Code, rr.Body, tt.wantStatus, tt.wantContains)
+			}
+		})
+	}
+
+	var result struct {
+		URL struct {
+			Keyword string `json:"keyword"`
+		} `json:"url"`
+	}
+	rr := call("GET", url.Values{"signature": {"s3cret"}, "action": {"shorturl"}, "url": {"https://example.com/other"}, "format": {"json"}})
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || result.URL.Keyword == "" {
+		t.Fatalf("generated keyword = %+v, %v", result, err)
+	}
+	if link, err := srv.getLink(result.URL.Keyword); err != nil || link.Owner != "key:wordpress" {
+		t.Errorf("link = %+v, %v, want it owned by key:wordpress", link, err)
+	}
+}